@@ -12,6 +12,13 @@ type Application struct {
 	userUseCases         usecases.UserUseCase
 	bookUseCases         usecases.BookUseCase
 	shoppingCartUseCases usecases.ShoppingCartUseCase
+	orderUseCases        usecases.OrderUseCase
+	libraryUseCases      usecases.LibraryUseCase
+	readingUseCases      usecases.ReadingUseCase
+	reviewUseCases       usecases.ReviewUseCase
+	exportUseCases       usecases.ExportUseCase
+	notificationUseCases usecases.NotificationUseCase
+	authUseCases         usecases.AuthUseCase
 }
 
 func NewApplication(
@@ -19,11 +26,25 @@ func NewApplication(
 	userUseCase usecases.UserUseCase,
 	bookUseCases usecases.BookUseCase,
 	shoppingCartUseCases usecases.ShoppingCartUseCase,
+	orderUseCases usecases.OrderUseCase,
+	libraryUseCases usecases.LibraryUseCase,
+	readingUseCases usecases.ReadingUseCase,
+	reviewUseCases usecases.ReviewUseCase,
+	exportUseCases usecases.ExportUseCase,
+	notificationUseCases usecases.NotificationUseCase,
+	authUseCases usecases.AuthUseCase,
 ) *Application {
 	return &Application{
 		datastore:            datastore,
 		userUseCases:         userUseCase,
 		bookUseCases:         bookUseCases,
 		shoppingCartUseCases: shoppingCartUseCases,
+		orderUseCases:        orderUseCases,
+		libraryUseCases:      libraryUseCases,
+		readingUseCases:      readingUseCases,
+		reviewUseCases:       reviewUseCases,
+		exportUseCases:       exportUseCases,
+		notificationUseCases: notificationUseCases,
+		authUseCases:         authUseCases,
 	}
 }
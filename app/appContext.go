@@ -0,0 +1,32 @@
+package app
+
+import (
+	"context"
+	"leanpub-app/domain/models"
+)
+
+type contextKey string
+
+const (
+	claimsContextKey contextKey = "claims"
+	actorContextKey  contextKey = "actor"
+)
+
+func withIdentity(ctx context.Context, claims *models.TokenClaims, actor *models.User) context.Context {
+	ctx = context.WithValue(ctx, claimsContextKey, claims)
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// claimsFromContext returns the claims of the authenticated caller, or nil
+// when the request carried no access token.
+func claimsFromContext(ctx context.Context) *models.TokenClaims {
+	claims, _ := ctx.Value(claimsContextKey).(*models.TokenClaims)
+	return claims
+}
+
+// actorFromContext returns the authenticated user, or nil for anonymous
+// requests.
+func actorFromContext(ctx context.Context) *models.User {
+	actor, _ := ctx.Value(actorContextKey).(*models.User)
+	return actor
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"leanpub-app/domain"
+	"leanpub-app/domain/validation"
+	"net/http"
+)
+
+// maxBodySize bounds the JSON bodies accepted by the API. Manuscripts are
+// uploaded as zip archives and bounded by maxManuscriptSize instead.
+const maxBodySize = 1 << 20
+
+// decodeBody decodes the JSON body of the request into value and validates
+// it. Fields value does not have and bodies over maxBodySize are rejected.
+func decodeBody(w http.ResponseWriter, r *http.Request, value interface{}) error {
+	return decode(w, r, value, false)
+}
+
+// decodeOptionalBody is decodeBody for requests that may have no body, which
+// leave value as it is.
+func decodeOptionalBody(w http.ResponseWriter, r *http.Request, value interface{}) error {
+	return decode(w, r, value, true)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, value interface{}, optional bool) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(value)
+	switch {
+	case err == io.EOF && optional:
+		return nil
+	case err != nil && err.Error() == "http: request body too large":
+		return domain.ErrBodyTooLarge
+	case err != nil:
+		return invalidBody(err)
+	}
+
+	return validation.Validate(value)
+}
+
+// decodePatch applies the JSON Merge Patch (RFC 7396) in the body of the
+// request to current, the resource as the API returns it, and decodes the
+// result into value, checked like decodeBody checks a full body. Fields the
+// patch leaves out keep their current values and fields it sets to null are
+// cleared.
+func decodePatch(w http.ResponseWriter, r *http.Request, current interface{}, value interface{}) error {
+	var patch interface{}
+	if err := decode(w, r, &patch, false); err != nil {
+		return err
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return domain.ErrInvalidBody.WithMessage("The patch must be a JSON object.")
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return invalidBody(err)
+	}
+
+	return validation.Validate(value)
+}
+
+// mergePatch merges patch into target as RFC 7396 describes: objects are
+// merged member by member, null removes a member and any other value,
+// including an array, replaces the target.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
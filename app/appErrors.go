@@ -0,0 +1,47 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"leanpub-app/domain"
+	"log"
+	"net/http"
+)
+
+// errorResponse is the envelope every error is reported in.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Details []domain.FieldError `json:"details,omitempty"`
+}
+
+// writeError reports err with the status and code of the domain error it
+// wraps. Any other error is logged and reported as an internal error, so that
+// driver and library messages are not shown to clients.
+func writeError(w http.ResponseWriter, err error) {
+	var domainErr *domain.Error
+	if !errors.As(err, &domainErr) {
+		log.Printf("internal error: %v", err)
+		domainErr = domain.ErrInternal
+	}
+
+	data, _ := json.Marshal(errorResponse{Error: errorBody{
+		Code:    domainErr.Code,
+		Message: domainErr.Message,
+		Details: domainErr.Details,
+	}})
+
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(domainErr.Status)
+	w.Write(data)
+}
+
+// invalidBody reports a request body that could not be decoded.
+func invalidBody(err error) error {
+	return domain.ErrInvalidBody.WithMessage(err.Error())
+}
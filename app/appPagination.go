@@ -0,0 +1,145 @@
+package app
+
+import (
+	"encoding/json"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listOptionsFromRequest reads the offset, limit, sort and fields query
+// parameters. Sort takes a comma separated list of fields, each prefixed with
+// "-" for descending order.
+func listOptionsFromRequest(r *http.Request) (models.ListOptions, error) {
+	var listOptions models.ListOptions
+	query := r.URL.Query()
+
+	var err error
+	if offset := query.Get("offset"); offset != "" {
+		listOptions.Offset, err = strconv.Atoi(offset)
+		if err != nil {
+			return listOptions, domain.ErrInvalidPagination
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		listOptions.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return listOptions, domain.ErrInvalidPagination
+		}
+	}
+
+	for _, field := range splitList(query.Get("sort")) {
+		descending := strings.HasPrefix(field, "-")
+		listOptions.Sort = append(listOptions.Sort, models.SortField{
+			Field:      strings.TrimPrefix(field, "-"),
+			Descending: descending,
+		})
+	}
+
+	listOptions.Fields = splitList(query.Get("fields"))
+
+	return listOptions, nil
+}
+
+// bookSearchFromRequest reads the q, language, minPrice, maxPrice, state and
+// sections query parameters of a catalog search.
+func bookSearchFromRequest(r *http.Request) (models.BookSearch, error) {
+	query := r.URL.Query()
+	search := models.BookSearch{
+		Query:        query.Get("q"),
+		LanguageCode: query.Get("language"),
+		State:        models.StateBook(strings.ToUpper(query.Get("state"))),
+	}
+
+	for name, price := range map[string]**float64{"minPrice": &search.MinPrice, "maxPrice": &search.MaxPrice} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return search, domain.ErrInvalidSearch
+			}
+			*price = &parsed
+		}
+	}
+
+	if sections := query.Get("sections"); sections != "" {
+		includeSections, err := strconv.ParseBool(sections)
+		if err != nil {
+			return search, domain.ErrInvalidSearch
+		}
+		search.IncludeSections = includeSections
+	}
+
+	return search, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// writePage writes a page of results, keeping only the requested fields of
+// each item and linking to the next page when there is one.
+func writePage(w http.ResponseWriter, r *http.Request, page *models.Page, fields []string) {
+	if len(fields) > 0 {
+		items, err := selectFields(page.Items, fields)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		page.Items = items
+	}
+
+	if int64(page.Offset+page.Limit) < page.Total {
+		next := *r.URL
+		query := next.Query()
+		query.Set("offset", strconv.Itoa(page.Offset+page.Limit))
+		query.Set("limit", strconv.Itoa(page.Limit))
+		next.RawQuery = query.Encode()
+		page.Next = next.RequestURI()
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func selectFields(items interface{}, fields []string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []map[string]interface{}
+	err = json.Unmarshal(data, &documents)
+	if err != nil {
+		return nil, err
+	}
+
+	included := map[string]bool{"id": true}
+	for _, field := range fields {
+		included[field] = true
+	}
+
+	for _, document := range documents {
+		for field := range document {
+			if !included[field] {
+				delete(document, field)
+			}
+		}
+	}
+
+	return documents, nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"leanpub-app/domain"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag tags a response with the version of the resource it returns.
+// Resources written before versions were counted have no tag.
+func setETag(w http.ResponseWriter, version int) {
+	if version > 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+	}
+}
+
+// ifMatchVersion returns the version an update expects from the If-Match
+// header: 0 when the header is missing or "*", or the version of the one
+// entity tag it lists. When it lists several, stored is called for the
+// current version of the resource, which is expected when it is among them.
+// Weak and unknown tags never match a version, so a header with no other
+// tags fails the precondition.
+func ifMatchVersion(r *http.Request, stored func() (int, error)) (int, error) {
+	versions, err := ifMatchVersions(strings.Join(r.Header.Values("If-Match"), ","))
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, nil
+	case 1:
+		return versions[0], nil
+	}
+
+	version, err := stored()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, listed := range versions {
+		if listed == version {
+			return version, nil
+		}
+	}
+
+	return 0, domain.ErrVersionConflict
+}
+
+// knownVersion is the stored argument of ifMatchVersion for handlers that
+// already read the resource.
+func knownVersion(version int) func() (int, error) {
+	return func() (int, error) {
+		return version, nil
+	}
+}
+
+// ifMatchVersions parses an If-Match value, "*" or a comma-separated list of
+// entity tags (RFC 9110, section 13.1.1), into the versions of its strong
+// tags. It returns none for a missing header or "*".
+func ifMatchVersions(header string) ([]int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	var versions []int
+	for rest := header; ; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[len("W/"):]
+		}
+
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, domain.ErrVersionConflict
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, domain.ErrVersionConflict
+		}
+		tag := rest[1 : end+1]
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, domain.ErrVersionConflict
+		}
+
+		version, err := strconv.Atoi(tag)
+		if !weak && err == nil && version > 0 && strconv.Itoa(version) == tag {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, domain.ErrVersionConflict
+	}
+
+	return versions, nil
+}
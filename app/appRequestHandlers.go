@@ -1,55 +1,69 @@
 package app
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"github.com/gorilla/mux"
+	"leanpub-app/domain"
 	"leanpub-app/domain/models"
+	"io"
 	"leanpub-app/domain/models/dtos"
+	"mime"
 	"net/http"
+	"strconv"
+)
+
+// maxManuscriptSize bounds the zip archives accepted by ImportBook, and
+// maxManuscriptEntries and maxManuscriptUnpackedSize what they may unpack to.
+const (
+	maxManuscriptSize         = 32 << 20
+	maxManuscriptEntries      = 1000
+	maxManuscriptUnpackedSize = 64 << 20
 )
 
 func (app Application) SaveUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	err := json.NewDecoder(r.Body).Decode(&user)
+	var user dtos.CreateUserDto
+	err := decodeBody(w, r, &user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	userSaved, err := app.userUseCases.SaveUser(&user)
+	userSaved, err := app.userUseCases.SaveUser(actorFromContext(r.Context()), user.ToUser())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(userSaved)
+	data, err := json.Marshal(dtos.NewUserResponseDto(userSaved))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, userSaved.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
 func (app Application) ValidateUser(w http.ResponseWriter, r *http.Request) {
 	var userData models.RegisteredUser
-	var user models.User
-	err := json.NewDecoder(r.Body).Decode(&userData)
+	err := decodeBody(w, r, &userData)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	validateUser, err := app.userUseCases.ValidateUser(&userData, &user)
+	tokens, err := app.authUseCases.Login(&userData)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(validateUser)
+	data, err := json.Marshal(tokens)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -57,16 +71,23 @@ func (app Application) ValidateUser(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func (app Application) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := app.userUseCases.GetUsers()
+func (app Application) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var refresh models.TokenRefresh
+	err := decodeBody(w, r, &refresh)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tokens, err := app.authUseCases.RefreshTokens(refresh.RefreshToken)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(users)
+	data, err := json.Marshal(tokens)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -74,20 +95,59 @@ func (app Application) GetUsers(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+func (app Application) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	if claims == nil {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	var refresh models.TokenRefresh
+	err := decodeOptionalBody(w, r, &refresh)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = app.authUseCases.Logout(claims, refresh.RefreshToken)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+func (app Application) GetUsers(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	users, err := app.userUseCases.GetUsers(actorFromContext(r.Context()), listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	users.Items = dtos.NewUserResponseDtos(*users.Items.(*[]models.User))
+	writePage(w, r, users, listOptions.Fields)
+}
+
 func (app Application) GetUserById(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	user, err := app.userUseCases.GetUserById(id)
+	user, err := app.userUseCases.GetUserById(actorFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(&user)
+	data, err := json.Marshal(dtos.NewUserResponseDto(user))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, user.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
@@ -95,94 +155,233 @@ func (app Application) GetUserById(w http.ResponseWriter, r *http.Request) {
 func (app Application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	err := app.userUseCases.DeleteUser(id)
+	version, err := ifMatchVersion(r, func() (int, error) {
+		storedUser, err := app.userUseCases.GetUserById(actorFromContext(r.Context()), id)
+		if err != nil {
+			return 0, err
+		}
+		return storedUser.Version, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = app.userUseCases.DeleteUser(actorFromContext(r.Context()), id, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 }
 
 func (app Application) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	var user models.User
-	err := json.NewDecoder(r.Body).Decode(&user)
+	var user dtos.UpdateUserDto
+	err := decodeBody(w, r, &user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, func() (int, error) {
+		storedUser, err := app.userUseCases.GetUserById(actorFromContext(r.Context()), user.Id)
+		if err != nil {
+			return 0, err
+		}
+		return storedUser.Version, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	changes := user.ToUser()
+	changes.Version = version
+	updatedUser, err := app.userUseCases.UpdateUser(actorFromContext(r.Context()), changes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	if user.Id == "" {
-		http.Error(w, "USER_NOT_FOUND", http.StatusBadRequest)
+	data, err := json.Marshal(dtos.NewUserResponseDto(updatedUser))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	updatedUser, err := app.userUseCases.UpdateUser(&user)
+	setETag(w, updatedUser.Version)
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+// PatchUser updates only the fields of the user sent in a JSON Merge Patch
+// and checks the result against the same rules as UpdateUser.
+func (app Application) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	actor := actorFromContext(r.Context())
+
+	storedUser, err := app.userUseCases.GetUserById(actor, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var user dtos.UpdateUserDto
+	err = decodePatch(w, r, dtos.NewUserResponseDto(storedUser), &user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	user.Id = id
+
+	version, err := ifMatchVersion(r, knownVersion(storedUser.Version))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if version == 0 {
+		version = storedUser.Version
+	}
+
+	changes := user.ToUser()
+	changes.Version = version
+	updatedUser, err := app.userUseCases.UpdateUser(actor, changes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(updatedUser)
+	data, err := json.Marshal(dtos.NewUserResponseDto(updatedUser))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, updatedUser.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
 func (app Application) SaveBook(w http.ResponseWriter, r *http.Request) {
 	var book dtos.BookDto
-	err := json.NewDecoder(r.Body).Decode(&book)
+	err := decodeBody(w, r, &book)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	bookSaved, err := app.bookUseCases.SaveBook(&book)
+	bookSaved, err := app.bookUseCases.SaveBook(actorFromContext(r.Context()), &book)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(bookSaved)
+	data, err := json.Marshal(dtos.NewBookResponseDto(bookSaved))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, bookSaved.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
-func (app Application) GetBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := app.bookUseCases.GetBooks()
+// ImportBook creates a book from a zip archive of a manuscript sent as the
+// request body. The title of the book is given in the title query parameter.
+func (app Application) ImportBook(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromContext(r.Context())
+	if actor == nil {
+		writeError(w, domain.ErrUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxManuscriptSize+1))
+	if err != nil {
+		writeError(w, invalidBody(err))
+		return
+	}
+
+	if len(data) > maxManuscriptSize {
+		writeError(w, domain.ErrFileTooLarge)
+		return
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, domain.ErrInvalidManuscript)
+		return
+	}
+
+	if err := checkManuscriptArchive(archive); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(books)
+	imported, err := app.bookUseCases.ImportBook(actor, archive, &dtos.BookDto{
+		Title: r.URL.Query().Get("title"),
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	response, err := json.Marshal(imported)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
 	w.Header().Set("content-type", "application/json")
-	w.Write(data)
+	w.Write(response)
+}
+
+// checkManuscriptArchive rejects archives with too many entries or declaring
+// too much content. Reading an entry past its declared size fails, so the
+// declared sizes bound what the import can unpack.
+func checkManuscriptArchive(archive *zip.Reader) error {
+	if len(archive.File) > maxManuscriptEntries {
+		return domain.ErrFileTooLarge
+	}
+
+	var size uint64
+	for _, file := range archive.File {
+		size += file.UncompressedSize64
+		if file.UncompressedSize64 > maxManuscriptUnpackedSize || size > maxManuscriptUnpackedSize {
+			return domain.ErrFileTooLarge
+		}
+	}
+
+	return nil
+}
+
+func (app Application) GetBooks(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books, err := app.bookUseCases.GetBooks(actorFromContext(r.Context()), listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books.Items = dtos.NewBookResponseDtos(*books.Items.(*[]models.Book))
+	writePage(w, r, books, listOptions.Fields)
 }
 
 func (app Application) GetBookIndex(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	book, err := app.bookUseCases.GetBookIndex(id)
+	book, err := app.bookUseCases.GetBookIndex(actorFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	data, err := json.Marshal(&book)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -192,15 +391,15 @@ func (app Application) GetBookIndex(w http.ResponseWriter, r *http.Request) {
 
 func (app Application) GetSectionsByBookId(w http.ResponseWriter, r *http.Request) {
 	bookId := mux.Vars(r)["bookId"]
-	sections, err := app.bookUseCases.GetSectionsByBookId(bookId)
+	sections, err := app.bookUseCases.GetSectionsByBookId(actorFromContext(r.Context()), bookId)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	data, err := json.Marshal(&sections)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -210,15 +409,15 @@ func (app Application) GetSectionsByBookId(w http.ResponseWriter, r *http.Reques
 
 func (app Application) GetBookSectionById(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	section, err := app.bookUseCases.GetBookSectionById(id)
+	section, err := app.bookUseCases.GetBookSectionById(actorFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
 	data, err := json.Marshal(&section)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
@@ -228,92 +427,402 @@ func (app Application) GetBookSectionById(w http.ResponseWriter, r *http.Request
 
 func (app Application) GetBookById(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	book, err := app.bookUseCases.GetBookById(id)
+	book, err := app.bookUseCases.GetBookById(actorFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(&book)
+	data, err := json.Marshal(dtos.NewBookResponseDto(book))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, book.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
 func (app Application) GetBooksByAuthor(w http.ResponseWriter, r *http.Request) {
 	authorId := mux.Vars(r)["authorId"]
-	book, err := app.bookUseCases.GetBooksByAuthor(authorId)
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
+	books, err := app.bookUseCases.GetBooksByAuthor(actorFromContext(r.Context()), authorId, listOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(&book)
+	books.Items = dtos.NewBookResponseDtos(*books.Items.(*[]models.Book))
+	writePage(w, r, books, listOptions.Fields)
+}
+
+func (app Application) GetBooksByCategory(w http.ResponseWriter, r *http.Request) {
+	category := mux.Vars(r)["category"]
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books, err := app.bookUseCases.GetBooksByCategory(actorFromContext(r.Context()), category, listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books.Items = dtos.NewBookResponseDtos(*books.Items.(*[]models.Book))
+	writePage(w, r, books, listOptions.Fields)
+}
+
+func (app Application) SearchBooks(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	search, err := bookSearchFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books, err := app.bookUseCases.SearchBooks(actorFromContext(r.Context()), search, listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	books.Items = dtos.NewBookSearchResultDtos(*books.Items.(*[]models.BookSearchResult))
+	fields := listOptions.Fields
+	if len(fields) > 0 {
+		fields = append(fields, "score")
+	}
+	writePage(w, r, books, fields)
+}
+
+func (app Application) DeleteBook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	version, err := ifMatchVersion(r, app.storedBookVersion(r, id))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = app.bookUseCases.DeleteBook(actorFromContext(r.Context()), id, version)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+func (app Application) UpdateBook(w http.ResponseWriter, r *http.Request) {
+	var book dtos.UpdateBookDto
+	err := decodeBody(w, r, &book)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, app.storedBookVersion(r, book.Id))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	changes := book.ToBook()
+	changes.Version = version
+	updatedBook, err := app.bookUseCases.UpdateBook(actorFromContext(r.Context()), changes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(dtos.NewBookResponseDto(updatedBook))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, updatedBook.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
-func (app Application) GetBooksByCategory(w http.ResponseWriter, r *http.Request) {
-	category := mux.Vars(r)["category"]
-	books, err := app.bookUseCases.GetBooksByCategory(category)
+// PatchBook merges the patch into the book as it is read. Arrays such as
+// content and categories are replaced as a whole, as RFC 7396 requires.
+func (app Application) PatchBook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	actor := actorFromContext(r.Context())
+
+	storedBook, err := app.bookUseCases.GetBookById(actor, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var book dtos.UpdateBookDto
+	err = decodePatch(w, r, dtos.NewBookResponseDto(storedBook), &book)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	book.Id = id
 
+	version, err := ifMatchVersion(r, knownVersion(storedBook.Version))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
+	if version == 0 {
+		version = storedBook.Version
+	}
 
-	data, err := json.Marshal(&books)
+	changes := book.ToBook()
+	changes.Version = version
+	updatedBook, err := app.bookUseCases.UpdateBook(actor, changes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	data, err := json.Marshal(dtos.NewBookResponseDto(updatedBook))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, updatedBook.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
-func (app Application) DeleteBook(w http.ResponseWriter, r *http.Request) {
+func (app Application) PublishBook(w http.ResponseWriter, r *http.Request) {
+	app.changeBookState(w, r, app.bookUseCases.PublishBook)
+}
+
+func (app Application) UnpublishBook(w http.ResponseWriter, r *http.Request) {
+	app.changeBookState(w, r, app.bookUseCases.UnpublishBook)
+}
+
+func (app Application) RetireBook(w http.ResponseWriter, r *http.Request) {
+	app.changeBookState(w, r, app.bookUseCases.RetireBook)
+}
+
+func (app Application) CloseBook(w http.ResponseWriter, r *http.Request) {
+	app.changeBookState(w, r, app.bookUseCases.CloseBook)
+}
+
+func (app Application) changeBookState(w http.ResponseWriter, r *http.Request, transition func(actor *models.User, id string) (*models.Book, error)) {
 	id := mux.Vars(r)["id"]
-	err := app.bookUseCases.DeleteBook(id)
+	writeBookChange(w, r, func(actor *models.User) (*models.Book, error) {
+		return transition(actor, id)
+	})
+}
+
+func (app Application) AddChapter(w http.ResponseWriter, r *http.Request) {
+	var chapter dtos.ChapterDto
+	if err := decodeBody(w, r, &chapter); err != nil {
+		writeError(w, err)
+		return
+	}
 
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.AddChapter(actor, mux.Vars(r)["id"], version, &chapter)
+	})
+}
+
+func (app Application) UpdateChapter(w http.ResponseWriter, r *http.Request) {
+	var chapter dtos.ChapterDto
+	if err := decodeBody(w, r, &chapter); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.UpdateChapter(actor, mux.Vars(r)["id"], version, chapterIndex(r), &chapter)
+	})
+}
+
+func (app Application) DeleteChapter(w http.ResponseWriter, r *http.Request) {
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.DeleteChapter(actor, mux.Vars(r)["id"], version, chapterIndex(r))
+	})
+}
+
+func (app Application) AddSection(w http.ResponseWriter, r *http.Request) {
+	var section dtos.SectionDto
+	if err := decodeBody(w, r, &section); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.AddSection(actor, mux.Vars(r)["id"], version, chapterIndex(r), &section)
+	})
+}
+
+func (app Application) UpdateSection(w http.ResponseWriter, r *http.Request) {
+	var section dtos.SectionDto
+	if err := decodeBody(w, r, &section); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.UpdateSection(actor, mux.Vars(r)["id"], version, mux.Vars(r)["sectionId"], &section)
+	})
+}
+
+func (app Application) MoveSection(w http.ResponseWriter, r *http.Request) {
+	var move dtos.SectionMoveDto
+	if err := decodeBody(w, r, &move); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.MoveSection(actor, mux.Vars(r)["id"], version, mux.Vars(r)["sectionId"], &move)
+	})
+}
+
+func (app Application) DeleteSection(w http.ResponseWriter, r *http.Request) {
+	app.writeContentChange(w, r, func(actor *models.User, version int) (*models.Book, error) {
+		return app.bookUseCases.DeleteSection(actor, mux.Vars(r)["id"], version, mux.Vars(r)["sectionId"])
+	})
+}
+
+// chapterIndex reads the chapter position from the route. A value that is not
+// a number is returned as -1, which the use cases report as a missing chapter.
+func chapterIndex(r *http.Request) int {
+	index, err := strconv.Atoi(mux.Vars(r)["chapter"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return -1
+	}
+	return index
+}
+
+// writeBookChange applies a change on behalf of the caller and writes the
+// resulting book.
+func writeBookChange(w http.ResponseWriter, r *http.Request, change func(actor *models.User) (*models.Book, error)) {
+	book, err := change(actorFromContext(r.Context()))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+
+	data, err := json.Marshal(dtos.NewBookResponseDto(book))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, book.Version)
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
 }
 
-func (app Application) UpdateBook(w http.ResponseWriter, r *http.Request) {
-	var book models.Book
-	err := json.NewDecoder(r.Body).Decode(&book)
+// writeContentChange applies a change to the content of a book made against
+// the version in the If-Match header, if any, like writeBookChange.
+func (app Application) writeContentChange(w http.ResponseWriter, r *http.Request, change func(actor *models.User, version int) (*models.Book, error)) {
+	version, err := ifMatchVersion(r, app.storedBookVersion(r, mux.Vars(r)["id"]))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	if book.Id == "" {
-		http.Error(w, "BOOK_NOT_FOUND", http.StatusBadRequest)
+	writeBookChange(w, r, func(actor *models.User) (*models.Book, error) {
+		return change(actor, version)
+	})
+}
+
+// storedBookVersion reads the version of the book for ifMatchVersion.
+func (app Application) storedBookVersion(r *http.Request, id string) func() (int, error) {
+	return func() (int, error) {
+		book, err := app.bookUseCases.GetBookById(actorFromContext(r.Context()), id)
+		if err != nil {
+			return 0, err
+		}
+		return book.Version, nil
+	}
+}
+
+func (app Application) GetBookVersions(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
-	updatedBook, err := app.bookUseCases.UpdateBook(&book)
+	versions, err := app.bookUseCases.GetBookVersions(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, versions, listOptions.Fields)
+}
+
+// PublishVersion takes optional release notes; a request without a body
+// publishes the version without them.
+func (app Application) PublishVersion(w http.ResponseWriter, r *http.Request) {
+	var version dtos.VersionDto
+	if err := decodeOptionalBody(w, r, &version); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(updatedBook)
+	writeVersion(w, r, func(actor *models.User) (*models.BookVersion, error) {
+		return app.bookUseCases.PublishVersion(actor, mux.Vars(r)["id"], &version)
+	})
+}
+
+func (app Application) GetBookVersion(w http.ResponseWriter, r *http.Request) {
+	writeVersion(w, r, func(actor *models.User) (*models.BookVersion, error) {
+		return app.bookUseCases.GetBookVersion(actor, mux.Vars(r)["id"], versionNumber(r))
+	})
+}
+
+func (app Application) RollbackVersion(w http.ResponseWriter, r *http.Request) {
+	writeBookChange(w, r, func(actor *models.User) (*models.Book, error) {
+		return app.bookUseCases.RollbackVersion(actor, mux.Vars(r)["id"], versionNumber(r))
+	})
+}
+
+func (app Application) PreviewBook(w http.ResponseWriter, r *http.Request) {
+	writeVersion(w, r, func(actor *models.User) (*models.BookVersion, error) {
+		return app.bookUseCases.PreviewBook(actor, mux.Vars(r)["id"])
+	})
+}
+
+// versionNumber reads the version number from the route. A value that is not
+// a number is returned as 0, which no version has.
+func versionNumber(r *http.Request) int {
+	number, err := strconv.Atoi(mux.Vars(r)["number"])
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// writeVersion runs a version operation on behalf of the caller and writes
+// the resulting version.
+func writeVersion(w http.ResponseWriter, r *http.Request, operation func(actor *models.User) (*models.BookVersion, error)) {
+	version, err := operation(actorFromContext(r.Context()))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(version)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 
@@ -322,60 +831,62 @@ func (app Application) UpdateBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app Application) SaveShoppingCart(w http.ResponseWriter, r *http.Request)  {
-	var shoppingCart models.ShoppingCart
-	err := json.NewDecoder(r.Body).Decode(&shoppingCart)
+	var shoppingCart dtos.CreateShoppingCartDto
+	err := decodeBody(w, r, &shoppingCart)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
 
-	shoppingCartSaved, err := app.shoppingCartUseCases.SaveShoppingCart(&shoppingCart)
+	shoppingCartSaved, err := app.shoppingCartUseCases.SaveShoppingCart(actorFromContext(r.Context()), shoppingCart.ToShoppingCart())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(shoppingCartSaved)
+	data, err := json.Marshal(dtos.NewShoppingCartResponseDto(shoppingCartSaved))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, shoppingCartSaved.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
 
 func (app Application) GetShoppingCarts(w http.ResponseWriter, r *http.Request) {
-	shoppingCarts, err := app.shoppingCartUseCases.GetShoppingCarts()
+	listOptions, err := listOptionsFromRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(shoppingCarts)
+	shoppingCarts, err := app.shoppingCartUseCases.GetShoppingCarts(actorFromContext(r.Context()), listOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	w.Header().Set("content-type", "application/json")
-	w.Write(data)
+	shoppingCarts.Items = dtos.NewShoppingCartResponseDtos(*shoppingCarts.Items.(*[]models.ShoppingCart))
+	writePage(w, r, shoppingCarts, listOptions.Fields)
 }
 
 func (app Application) GetShoppingCartById(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	shoppingCart, err := app.shoppingCartUseCases.GetShoppingCartById(id)
+	shoppingCart, err := app.shoppingCartUseCases.GetShoppingCartById(actorFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(shoppingCart)
+	data, err := json.Marshal(dtos.NewShoppingCartResponseDto(shoppingCart))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, shoppingCart.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
 }
@@ -383,38 +894,481 @@ func (app Application) GetShoppingCartById(w http.ResponseWriter, r *http.Reques
 func (app Application) DeleteShoppingCart(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	err := app.shoppingCartUseCases.DeleteShoppingCart(id)
+	version, err := ifMatchVersion(r, func() (int, error) {
+		storedShoppingCart, err := app.shoppingCartUseCases.GetShoppingCartById(actorFromContext(r.Context()), id)
+		if err != nil {
+			return 0, err
+		}
+		return storedShoppingCart.Version, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = app.shoppingCartUseCases.DeleteShoppingCart(actorFromContext(r.Context()), id, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 }
 
 func (app Application) UpdateShoppingCart(w http.ResponseWriter, r *http.Request) {
-	var shoppingCart models.ShoppingCart
-	err := json.NewDecoder(r.Body).Decode(&shoppingCart)
+	var shoppingCart dtos.UpdateShoppingCartDto
+	err := decodeBody(w, r, &shoppingCart)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, func() (int, error) {
+		storedShoppingCart, err := app.shoppingCartUseCases.GetShoppingCartById(actorFromContext(r.Context()), shoppingCart.Id)
+		if err != nil {
+			return 0, err
+		}
+		return storedShoppingCart.Version, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	changes := shoppingCart.ToShoppingCart()
+	changes.Version = version
+	updatedShoppingCart, err := app.shoppingCartUseCases.UpdateShoppingCart(actorFromContext(r.Context()), changes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(dtos.NewShoppingCartResponseDto(updatedShoppingCart))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setETag(w, updatedShoppingCart.Version)
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) PatchShoppingCart(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	actor := actorFromContext(r.Context())
+
+	storedShoppingCart, err := app.shoppingCartUseCases.GetShoppingCartById(actor, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var shoppingCart dtos.UpdateShoppingCartDto
+	err = decodePatch(w, r, dtos.NewShoppingCartResponseDto(storedShoppingCart), &shoppingCart)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
+	shoppingCart.Id = id
 
-	if shoppingCart.Id == "" {
-		http.Error(w, "SHOPPING_CART_NOT_FOUND", http.StatusBadRequest)
+	version, err := ifMatchVersion(r, knownVersion(storedShoppingCart.Version))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
+	if version == 0 {
+		version = storedShoppingCart.Version
+	}
 
-	updatedShoppingCart, err := app.shoppingCartUseCases.UpdateShoppingCart(&shoppingCart)
+	changes := shoppingCart.ToShoppingCart()
+	changes.Version = version
+	updatedShoppingCart, err := app.shoppingCartUseCases.UpdateShoppingCart(actor, changes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
-	data, err := json.Marshal(updatedShoppingCart)
+	data, err := json.Marshal(dtos.NewShoppingCartResponseDto(updatedShoppingCart))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 
+	setETag(w, updatedShoppingCart.Version)
 	w.Header().Set("content-type", "application/json")
 	w.Write(data)
-}
\ No newline at end of file
+}
+func (app Application) Checkout(w http.ResponseWriter, r *http.Request) {
+	var checkout dtos.CheckoutDto
+	if err := decodeBody(w, r, &checkout); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeOrder(w, r, func(actor *models.User) (*models.Order, error) {
+		return app.orderUseCases.Checkout(actor, checkout.CartId)
+	})
+}
+
+func (app Application) GetOrders(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	orders, err := app.orderUseCases.GetOrders(actorFromContext(r.Context()), listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, orders, listOptions.Fields)
+}
+
+func (app Application) GetOrdersByUser(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	orders, err := app.orderUseCases.GetOrdersByUser(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, orders, listOptions.Fields)
+}
+
+func (app Application) GetOrderById(w http.ResponseWriter, r *http.Request) {
+	writeOrder(w, r, func(actor *models.User) (*models.Order, error) {
+		return app.orderUseCases.GetOrderById(actor, mux.Vars(r)["id"])
+	})
+}
+
+func (app Application) PayOrder(w http.ResponseWriter, r *http.Request) {
+	var payment dtos.PaymentDto
+	if err := decodeBody(w, r, &payment); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeOrder(w, r, func(actor *models.User) (*models.Order, error) {
+		return app.orderUseCases.PayOrder(actor, mux.Vars(r)["id"], payment.Source)
+	})
+}
+
+func (app Application) FulfillOrder(w http.ResponseWriter, r *http.Request) {
+	writeOrder(w, r, func(actor *models.User) (*models.Order, error) {
+		return app.orderUseCases.FulfillOrder(actor, mux.Vars(r)["id"])
+	})
+}
+
+func (app Application) RefundOrder(w http.ResponseWriter, r *http.Request) {
+	writeOrder(w, r, func(actor *models.User) (*models.Order, error) {
+		return app.orderUseCases.RefundOrder(actor, mux.Vars(r)["id"])
+	})
+}
+
+// PaymentWebhook receives the payment provider notifications. They are not
+// authenticated with a token but signed by the provider.
+func (app Application) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, domain.ErrBodyTooLarge)
+		return
+	}
+
+	err = app.orderUseCases.HandlePaymentWebhook(payload, r.Header.Get("Payment-Signature"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+// writeOrder runs an order operation on behalf of the caller and writes the
+// resulting order.
+func writeOrder(w http.ResponseWriter, r *http.Request, operation func(actor *models.User) (*models.Order, error)) {
+	order, err := operation(actorFromContext(r.Context()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(order)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) ClaimFreeBook(w http.ResponseWriter, r *http.Request) {
+	entitlement, err := app.libraryUseCases.ClaimFreeBook(actorFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(entitlement)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) GetLibrary(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	library, err := app.libraryUseCases.GetLibrary(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	library.Items = dtos.NewLibraryItemDtos(*library.Items.(*[]models.LibraryItem))
+	writePage(w, r, library, listOptions.Fields)
+}
+
+func (app Application) GetReadingProgress(w http.ResponseWriter, r *http.Request) {
+	writeReading(w, r, func(actor *models.User) (interface{}, error) {
+		return app.readingUseCases.GetProgress(actor, mux.Vars(r)["id"])
+	})
+}
+
+func (app Application) UpdateReadingProgress(w http.ResponseWriter, r *http.Request) {
+	var progress dtos.ProgressDto
+	if err := decodeBody(w, r, &progress); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeReading(w, r, func(actor *models.User) (interface{}, error) {
+		return app.readingUseCases.UpdateProgress(actor, mux.Vars(r)["id"], &progress)
+	})
+}
+
+func (app Application) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bookmarks, err := app.readingUseCases.GetBookmarks(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, bookmarks, listOptions.Fields)
+}
+
+func (app Application) AddBookmark(w http.ResponseWriter, r *http.Request) {
+	var bookmark dtos.BookmarkDto
+	if err := decodeBody(w, r, &bookmark); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeReading(w, r, func(actor *models.User) (interface{}, error) {
+		return app.readingUseCases.AddBookmark(actor, mux.Vars(r)["id"], &bookmark)
+	})
+}
+
+func (app Application) DeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	err := app.readingUseCases.DeleteBookmark(actorFromContext(r.Context()), mux.Vars(r)["bookmarkId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+func (app Application) GetHighlights(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	highlights, err := app.readingUseCases.GetHighlights(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, highlights, listOptions.Fields)
+}
+
+func (app Application) AddHighlight(w http.ResponseWriter, r *http.Request) {
+	var highlight dtos.HighlightDto
+	if err := decodeBody(w, r, &highlight); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeReading(w, r, func(actor *models.User) (interface{}, error) {
+		return app.readingUseCases.AddHighlight(actor, mux.Vars(r)["id"], &highlight)
+	})
+}
+
+func (app Application) DeleteHighlight(w http.ResponseWriter, r *http.Request) {
+	err := app.readingUseCases.DeleteHighlight(actorFromContext(r.Context()), mux.Vars(r)["highlightId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+// writeReading runs a reading operation on behalf of the caller and writes
+// its result.
+func writeReading(w http.ResponseWriter, r *http.Request, operation func(actor *models.User) (interface{}, error)) {
+	result, err := operation(actorFromContext(r.Context()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) GetReviews(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	reviews, err := app.reviewUseCases.GetReviews(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, reviews, listOptions.Fields)
+}
+
+func (app Application) AddReview(w http.ResponseWriter, r *http.Request) {
+	var review dtos.ReviewDto
+	if err := decodeBody(w, r, &review); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeReview(w, r, func(actor *models.User) (*models.Review, error) {
+		return app.reviewUseCases.AddReview(actor, mux.Vars(r)["id"], &review)
+	})
+}
+
+func (app Application) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	var review dtos.ReviewDto
+	if err := decodeBody(w, r, &review); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeReview(w, r, func(actor *models.User) (*models.Review, error) {
+		return app.reviewUseCases.UpdateReview(actor, mux.Vars(r)["id"], mux.Vars(r)["reviewId"], &review)
+	})
+}
+
+func (app Application) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	err := app.reviewUseCases.DeleteReview(actorFromContext(r.Context()), mux.Vars(r)["id"], mux.Vars(r)["reviewId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+}
+
+func (app Application) HideReview(w http.ResponseWriter, r *http.Request) {
+	writeReview(w, r, func(actor *models.User) (*models.Review, error) {
+		return app.reviewUseCases.HideReview(actor, mux.Vars(r)["id"], mux.Vars(r)["reviewId"])
+	})
+}
+
+func (app Application) ShowReview(w http.ResponseWriter, r *http.Request) {
+	writeReview(w, r, func(actor *models.User) (*models.Review, error) {
+		return app.reviewUseCases.ShowReview(actor, mux.Vars(r)["id"], mux.Vars(r)["reviewId"])
+	})
+}
+
+// writeReview runs a review operation on behalf of the caller and writes the
+// resulting review.
+func writeReview(w http.ResponseWriter, r *http.Request, operation func(actor *models.User) (*models.Review, error)) {
+	review, err := operation(actorFromContext(r.Context()))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(review)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	listOptions, err := listOptionsFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	notifications, err := app.notificationUseCases.GetNotifications(actorFromContext(r.Context()), mux.Vars(r)["id"], listOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writePage(w, r, notifications, listOptions.Fields)
+}
+
+func (app Application) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	notification, err := app.notificationUseCases.MarkNotificationRead(actorFromContext(r.Context()), mux.Vars(r)["id"], mux.Vars(r)["notificationId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(data)
+}
+
+func (app Application) ExportEpub(w http.ResponseWriter, r *http.Request) {
+	file, err := app.exportUseCases.ExportEpub(actorFromContext(r.Context()), mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", file.ContentType)
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+	w.Write(file.Data)
+}
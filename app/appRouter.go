@@ -1,24 +1,55 @@
 package app
 
-import "net/http"
+import (
+	"leanpub-app/domain"
+	"net/http"
+	"os"
+	"strings"
+)
 
+// enableCore lists the allowed request headers, since the "*" wildcard never
+// covers Authorization.
 func enableCore(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-control-allow-Methods", "*")
 	(*w).Header().Set("Access-control-allow-Origin", "*")
-	(*w).Header().Set("Access-control-allow-Headers", "*")
+	(*w).Header().Set("Access-control-allow-Headers", "Authorization, Content-Type, If-Match")
+	(*w).Header().Set("Access-control-expose-Headers", "ETag")
+}
+
+// bootstrapAdmin makes the user given by admin.email and admin.password an
+// admin, creating it if needed. Both are optional but go together.
+func (app Application) bootstrapAdmin() {
+	email, password := os.Getenv("admin.email"), os.Getenv("admin.password")
+	if email == "" && password == "" {
+		return
+	}
+	if email == "" || password == "" {
+		panic("admin.email and admin.password must be set together")
+	}
+
+	if _, err := app.userUseCases.BootstrapAdmin(email, password); err != nil {
+		panic(err)
+	}
 }
 
 func (app Application) Setup() {
 	app.datastore.Setup()
+	app.bootstrapAdmin()
 	app.Router.Use(app.routeMiddleware)
+	app.Router.Use(app.authMiddleware)
 	app.Router.HandleFunc("/users", app.SaveUser).Methods(http.MethodPost, http.MethodOptions)
 	app.Router.HandleFunc("/users/validate", app.ValidateUser).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/users/refresh", app.RefreshToken).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/users/logout", app.Logout).Methods(http.MethodPost, http.MethodOptions)
 	app.Router.HandleFunc("/users", app.GetUsers).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/users/{id}", app.GetUserById).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/users/{id}", app.DeleteUser).Methods(http.MethodDelete, http.MethodOptions)
 	app.Router.HandleFunc("/users", app.UpdateUser).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/users/{id}", app.PatchUser).Methods(http.MethodPatch, http.MethodOptions)
 	app.Router.HandleFunc("/books", app.SaveBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/import", app.ImportBook).Methods(http.MethodPost, http.MethodOptions)
 	app.Router.HandleFunc("/books", app.GetBooks).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/search", app.SearchBooks).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/books/index/{id}", app.GetBookIndex).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/books/sections/{bookId}", app.GetSectionsByBookId).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/books/section/{id}", app.GetBookSectionById).Methods(http.MethodGet, http.MethodOptions)
@@ -27,11 +58,56 @@ func (app Application) Setup() {
 	app.Router.HandleFunc("/books/category/{category}", app.GetBooksByCategory).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/books/{id}", app.DeleteBook).Methods(http.MethodDelete, http.MethodOptions)
 	app.Router.HandleFunc("/books", app.UpdateBook).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}", app.PatchBook).Methods(http.MethodPatch, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/publish", app.PublishBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/unpublish", app.UnpublishBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/retire", app.RetireBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/close", app.CloseBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/versions", app.GetBookVersions).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/versions", app.PublishVersion).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/versions/{number}", app.GetBookVersion).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/versions/{number}/rollback", app.RollbackVersion).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/preview", app.PreviewBook).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/chapters", app.AddChapter).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/chapters/{chapter}", app.UpdateChapter).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/chapters/{chapter}", app.DeleteChapter).Methods(http.MethodDelete, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/chapters/{chapter}/sections", app.AddSection).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/sections/{sectionId}", app.UpdateSection).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/sections/{sectionId}/move", app.MoveSection).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/sections/{sectionId}", app.DeleteSection).Methods(http.MethodDelete, http.MethodOptions)
 	app.Router.HandleFunc("/cart", app.SaveShoppingCart).Methods(http.MethodPost, http.MethodOptions)
 	app.Router.HandleFunc("/cart", app.GetShoppingCarts).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/cart/{id}", app.GetShoppingCartById).Methods(http.MethodGet, http.MethodOptions)
 	app.Router.HandleFunc("/cart/{id}", app.DeleteShoppingCart).Methods(http.MethodDelete, http.MethodOptions)
 	app.Router.HandleFunc("/cart", app.UpdateShoppingCart).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/cart/{id}", app.PatchShoppingCart).Methods(http.MethodPatch, http.MethodOptions)
+	app.Router.HandleFunc("/orders", app.Checkout).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/orders", app.GetOrders).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/orders/{id}", app.GetOrderById).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/orders/{id}/pay", app.PayOrder).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/orders/{id}/fulfill", app.FulfillOrder).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/orders/{id}/refund", app.RefundOrder).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/claim", app.ClaimFreeBook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/progress", app.GetReadingProgress).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/progress", app.UpdateReadingProgress).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/bookmarks", app.GetBookmarks).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/bookmarks", app.AddBookmark).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/bookmarks/{bookmarkId}", app.DeleteBookmark).Methods(http.MethodDelete, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/highlights", app.GetHighlights).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/highlights", app.AddHighlight).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/highlights/{highlightId}", app.DeleteHighlight).Methods(http.MethodDelete, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/export.epub", app.ExportEpub).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews", app.GetReviews).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews", app.AddReview).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews/{reviewId}", app.UpdateReview).Methods(http.MethodPut, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews/{reviewId}", app.DeleteReview).Methods(http.MethodDelete, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews/{reviewId}/hide", app.HideReview).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/books/{id}/reviews/{reviewId}/show", app.ShowReview).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/users/{id}/library", app.GetLibrary).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/users/{id}/notifications", app.GetNotifications).Methods(http.MethodGet, http.MethodOptions)
+	app.Router.HandleFunc("/users/{id}/notifications/{notificationId}/read", app.MarkNotificationRead).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/payments/webhook", app.PaymentWebhook).Methods(http.MethodPost, http.MethodOptions)
+	app.Router.HandleFunc("/users/{id}/orders", app.GetOrdersByUser).Methods(http.MethodGet, http.MethodOptions)
 }
 
 func (app Application) routeMiddleware(next http.Handler) http.Handler {
@@ -43,3 +119,30 @@ func (app Application) routeMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// authMiddleware authenticates requests that carry a bearer access token and
+// stores the caller's claims and user in the request context. Requests without an
+// Authorization header continue anonymously.
+func (app Application) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		if token == authorization {
+			writeError(w, domain.ErrInvalidToken)
+			return
+		}
+
+		claims, actor, err := app.authUseCases.Authenticate(token)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), claims, actor)))
+	})
+}
@@ -0,0 +1,1347 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("jwt.dev", "true")
+	os.Setenv("admin.email", testAdmin.Email)
+	os.Setenv("admin.password", testAdmin.Password)
+	os.Exit(m.Run())
+}
+
+// testAdmin is the admin every test server bootstraps from the environment.
+// Only admins make users authors, so registerAndLogin signs in as it to do so.
+var testAdmin = models.RegisteredUser{Email: "admin@example.com", Password: "admin1234"}
+
+func newTestServer() *httptest.Server {
+	application := CreateMemoryApp()
+	application.Router = mux.NewRouter()
+	application.Setup()
+
+	return httptest.NewServer(application.Router)
+}
+
+func doRequest(t *testing.T, method string, url string, token string, body interface{}, response interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		assert.Nil(t, json.NewEncoder(&payload).Encode(body))
+	}
+
+	request, err := http.NewRequest(method, url, &payload)
+	assert.Nil(t, err)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	result, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer result.Body.Close()
+
+	if response != nil && result.StatusCode == http.StatusOK {
+		assert.Nil(t, json.NewDecoder(result.Body).Decode(response))
+	}
+
+	return result.StatusCode
+}
+
+func registerAndLogin(t *testing.T, server *httptest.Server, email string, isAuthor bool) *dtos.AuthTokensResponseDto {
+	var user dtos.UserResponseDto
+	status := doRequest(t, http.MethodPost, server.URL+"/users", "", map[string]interface{}{
+		"email":    email,
+		"password": "test1234",
+	}, &user)
+	assert.Equal(t, http.StatusOK, status)
+
+	if isAuthor {
+		admin := login(t, server, testAdmin)
+		status = doRequest(t, http.MethodPatch, server.URL+"/users/"+user.Id, admin.AccessToken, map[string]interface{}{
+			"isAuthor": true,
+		}, nil)
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	return login(t, server, models.RegisteredUser{Email: email, Password: "test1234"})
+}
+
+func login(t *testing.T, server *httptest.Server, user models.RegisteredUser) *dtos.AuthTokensResponseDto {
+	var tokens dtos.AuthTokensResponseDto
+	status := doRequest(t, http.MethodPost, server.URL+"/users/validate", "", user, &tokens)
+	assert.Equal(t, http.StatusOK, status)
+
+	return &tokens
+}
+
+// createPublishedBook creates a book with one chapter by the logged in author
+// and publishes it.
+func createPublishedBook(t *testing.T, server *httptest.Server, tokens *dtos.AuthTokensResponseDto, book map[string]interface{}) *models.Book {
+	book["authors"] = []models.Author{{AuthorId: tokens.User.Id}}
+	book["content"] = []map[string]interface{}{{
+		"chapter":  "Intro",
+		"sections": []models.BookSection{{Title: "Hello", Content: "World"}},
+	}}
+
+	var created models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, book, &created)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+created.Id+"/publish", tokens.AccessToken, nil, &created)
+	assert.Equal(t, http.StatusOK, status)
+
+	return &created
+}
+
+func TestLoginAndReadOwnProfile(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "reader@example.com", false)
+
+	var user map[string]interface{}
+	status := doRequest(t, http.MethodGet, server.URL+"/users/"+tokens.User.Id, tokens.AccessToken, nil, &user)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "reader@example.com", user["email"])
+	assert.NotContains(t, user, "password")
+
+	var login struct {
+		User map[string]interface{} `json:"user"`
+	}
+	status = doRequest(t, http.MethodPost, server.URL+"/users/validate", "", models.RegisteredUser{
+		Email:    "reader@example.com",
+		Password: "test1234",
+	}, &login)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "reader@example.com", login.User["email"])
+	assert.NotContains(t, login.User, "password")
+}
+
+func TestListUsersRequiresAuthentication(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	status := doRequest(t, http.MethodGet, server.URL+"/users", "", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	tokens := registerAndLogin(t, server, "reader@example.com", false)
+	status = doRequest(t, http.MethodGet, server.URL+"/users", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestPreflightAllowsAuthorization(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodOptions, server.URL+"/users", nil)
+	assert.Nil(t, err)
+	request.Header.Set("Origin", "https://example.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	request.Header.Set("Access-Control-Request-Headers", "authorization")
+
+	result, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "Authorization, Content-Type, If-Match", result.Header.Get("Access-Control-Allow-Headers"))
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "reader@example.com", false)
+
+	status := doRequest(t, http.MethodPost, server.URL+"/users/logout", tokens.AccessToken, models.TokenRefresh{
+		RefreshToken: tokens.RefreshToken,
+	}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/users/"+tokens.User.Id, tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/users/refresh", "", models.TokenRefresh{
+		RefreshToken: tokens.RefreshToken,
+	}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestRefreshTokenIsSpentOnce(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "reader@example.com", false)
+
+	statuses := make(chan int, 10)
+	for i := 0; i < cap(statuses); i++ {
+		go func() {
+			statuses <- doRequest(t, http.MethodPost, server.URL+"/users/refresh", "", models.TokenRefresh{
+				RefreshToken: tokens.RefreshToken,
+			}, nil)
+		}()
+	}
+
+	refreshed := 0
+	for i := 0; i < cap(statuses); i++ {
+		status := <-statuses
+		if status == http.StatusOK {
+			refreshed++
+		} else {
+			assert.Equal(t, http.StatusUnauthorized, status)
+		}
+	}
+	assert.Equal(t, 1, refreshed)
+}
+
+func TestUsersCannotWriteServerFields(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "reader@example.com", false)
+
+	var user map[string]interface{}
+	status := doRequest(t, http.MethodPut, server.URL+"/users", tokens.AccessToken, map[string]interface{}{
+		"id":              tokens.User.Id,
+		"name":            "Reader",
+		"email":           "reader@example.com",
+		"isAuthor":        true,
+		"isAdmin":         true,
+		"hasSubscription": true,
+		"createdAt":       "2000-01-01T00:00:00Z",
+	}, &user)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Reader", user["name"])
+	assert.Equal(t, false, user["isAuthor"])
+	assert.Equal(t, false, user["isAdmin"])
+	assert.Equal(t, false, user["hasSubscription"])
+	assert.Equal(t, tokens.User.CreatedAt.Format(time.RFC3339Nano), user["createdAt"])
+	assert.NotContains(t, user, "password")
+
+	status = doRequest(t, http.MethodGet, server.URL+"/users", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status, "the user is still not an admin")
+	status = doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Mine",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+	}, nil)
+	assert.Equal(t, http.StatusForbidden, status, "the user is still not an author")
+}
+
+func TestSignUpCannotGrantAuthorship(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	var user dtos.UserResponseDto
+	status := doRequest(t, http.MethodPost, server.URL+"/users", "", map[string]interface{}{
+		"email":    "reader@example.com",
+		"password": "test1234",
+		"isAuthor": true,
+	}, &user)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, user.IsAuthor)
+}
+
+func TestAdminIsBootstrappedFromEnvironment(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	admin := login(t, server, testAdmin)
+	assert.True(t, admin.User.IsAdmin)
+
+	status := doRequest(t, http.MethodGet, server.URL+"/users", admin.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestAuthorCreatesBookAndReadsIndex(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+
+	var book models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Go",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+		"content": []map[string]interface{}{{
+			"chapter":  "Intro",
+			"sections": []models.BookSection{{Title: "Hello", Content: "World"}},
+		}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/index/"+book.Id, "", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status, "the book is not published yet")
+
+	var index []models.Index
+	status = doRequest(t, http.MethodGet, server.URL+"/books/index/"+book.Id, tokens.AccessToken, nil, &index)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Intro", index[0].Chapter)
+	assert.Equal(t, "Hello", index[0].Sections[0].Title)
+}
+
+func TestBookUpdatesIgnoreServerFields(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, tokens, map[string]interface{}{"title": "Go"})
+
+	var updated map[string]interface{}
+	status := doRequest(t, http.MethodPut, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"id":        book.Id,
+		"title":     "Learning Go",
+		"authors":   book.Authors,
+		"content":   book.Content,
+		"reviews":   1000,
+		"rating":    5,
+		"state":     models.StateRetired,
+		"createdAt": "2000-01-01T00:00:00Z",
+	}, &updated)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Learning Go", updated["title"])
+	assert.Equal(t, float64(0), updated["reviews"])
+	assert.Equal(t, float64(0), updated["rating"])
+	assert.Equal(t, string(models.StatePublished), updated["state"])
+	assert.Equal(t, book.CreatedAt.Format(time.RFC3339Nano), updated["createdAt"])
+}
+
+func TestPatchUpdatesOnlyTheGivenFields(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, tokens, map[string]interface{}{
+		"title":      "Go",
+		"categories": []string{"programming", "go"},
+	})
+	bookUrl := server.URL + "/books/" + book.Id
+
+	var patched dtos.BookResponseDto
+	status := doRequest(t, http.MethodPatch, bookUrl, tokens.AccessToken, map[string]interface{}{"title": "Learning Go"}, &patched)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Learning Go", patched.Title)
+	assert.Equal(t, []string{"programming", "go"}, patched.Categories)
+	assert.Equal(t, book.Content, patched.Content)
+
+	status = doRequest(t, http.MethodPatch, bookUrl, tokens.AccessToken, map[string]interface{}{"categories": nil}, &patched)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, patched.Categories, "null clears a field")
+	assert.Equal(t, "Learning Go", patched.Title)
+
+	status = doRequest(t, http.MethodPatch, bookUrl, tokens.AccessToken, map[string]interface{}{"title": nil}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status, "the title is still required")
+	status = doRequest(t, http.MethodPatch, bookUrl, tokens.AccessToken, map[string]interface{}{"isFree": true}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = doRequest(t, http.MethodPatch, bookUrl, tokens.AccessToken, []string{"title"}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	status = doRequest(t, http.MethodPatch, bookUrl, reader.AccessToken, map[string]interface{}{"title": "Mine"}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var user dtos.UserResponseDto
+	status = doRequest(t, http.MethodPatch, server.URL+"/users/"+reader.User.Id, reader.AccessToken, map[string]interface{}{
+		"name":    "Reader",
+		"isAdmin": true,
+	}, &user)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Reader", user.Name)
+	assert.Equal(t, "reader@example.com", user.Email)
+	assert.False(t, user.IsAdmin)
+
+	var shoppingCart dtos.ShoppingCartResponseDto
+	status = doRequest(t, http.MethodPost, server.URL+"/cart", reader.AccessToken, dtos.CreateShoppingCartDto{}, &shoppingCart)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodPatch, server.URL+"/cart/"+shoppingCart.Id, reader.AccessToken, map[string]interface{}{
+		"books": []models.BookId{{Book: book.Id}},
+	}, &shoppingCart)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, reader.User.Id, shoppingCart.UserId)
+	assert.Equal(t, []models.BookId{{Book: book.Id}}, shoppingCart.Books)
+}
+
+func TestStaleUpdatesFailWithPreconditionFailed(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, tokens, map[string]interface{}{"title": "Go"})
+	bookUrl := server.URL + "/books/" + book.Id
+
+	send := func(method string, url string, ifMatch string, body interface{}) *http.Response {
+		var payload bytes.Buffer
+		if body != nil {
+			assert.Nil(t, json.NewEncoder(&payload).Encode(body))
+		}
+
+		request, err := http.NewRequest(method, url, &payload)
+		assert.Nil(t, err)
+		request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		if ifMatch != "" {
+			request.Header.Set("If-Match", ifMatch)
+		}
+
+		result, err := http.DefaultClient.Do(request)
+		assert.Nil(t, err)
+		result.Body.Close()
+		return result
+	}
+
+	read := send(http.MethodGet, bookUrl, "", nil)
+	assert.Equal(t, http.StatusOK, read.StatusCode)
+	etag := read.Header.Get("ETag")
+	assert.Equal(t, strconv.Quote(strconv.Itoa(book.Version)), etag)
+
+	updated := send(http.MethodPatch, bookUrl, etag, map[string]interface{}{"title": "First"})
+	assert.Equal(t, http.StatusOK, updated.StatusCode)
+	assert.Equal(t, strconv.Quote(strconv.Itoa(book.Version+1)), updated.Header.Get("ETag"))
+
+	result := send(http.MethodPatch, bookUrl, etag, map[string]interface{}{"title": "Second"})
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "the book changed since it was read")
+
+	result = send(http.MethodPatch, bookUrl, "W/"+updated.Header.Get("ETag"), map[string]interface{}{"title": "Second"})
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "weak tags never match")
+
+	var stored dtos.UpdateBookDto
+	status := doRequest(t, http.MethodGet, bookUrl, tokens.AccessToken, nil, &stored)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "First", stored.Title)
+	assert.Equal(t, book.Version+1, stored.Version)
+
+	current := updated.Header.Get("ETag")
+	stored.Title = "Second"
+	result = send(http.MethodPut, server.URL+"/books", current, stored)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	stored.Title = "Third"
+	result = send(http.MethodPut, server.URL+"/books", current, stored)
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode)
+	result = send(http.MethodPut, server.URL+"/books", "", stored)
+	assert.Equal(t, http.StatusOK, result.StatusCode, "updates without If-Match are not conditional")
+
+	chapter := map[string]interface{}{"chapter": "Appendix"}
+	result = send(http.MethodPost, bookUrl+"/chapters", current, chapter)
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "content changes check the version too")
+
+	read = send(http.MethodGet, bookUrl, "", nil)
+	result = send(http.MethodPost, bookUrl+"/chapters", read.Header.Get("ETag"), chapter)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.NotEqual(t, read.Header.Get("ETag"), result.Header.Get("ETag"))
+
+	latest := result.Header.Get("ETag")
+	result = send(http.MethodPatch, bookUrl, etag+", W/"+latest, map[string]interface{}{"title": "Fourth"})
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "no listed tag matches")
+
+	tags := etag + ", " + read.Header.Get("ETag") + ",  " + latest
+	result = send(http.MethodPost, bookUrl+"/chapters", tags, chapter)
+	assert.Equal(t, http.StatusOK, result.StatusCode, "one listed tag matches")
+
+	result = send(http.MethodDelete, bookUrl, latest, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "deletes check the version too")
+	result = send(http.MethodDelete, bookUrl, send(http.MethodGet, bookUrl, "", nil).Header.Get("ETag"), nil)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, bookUrl, "", nil).StatusCode)
+
+	userUrl := server.URL + "/users/" + tokens.User.Id
+	userTag := send(http.MethodGet, userUrl, "", nil).Header.Get("ETag")
+	assert.NotEmpty(t, userTag)
+	result = send(http.MethodDelete, userUrl, strconv.Quote("99"), nil)
+	assert.Equal(t, http.StatusPreconditionFailed, result.StatusCode)
+	result = send(http.MethodDelete, userUrl, userTag, nil)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+}
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		err      error
+	}{
+		{"", nil, nil},
+		{"*", nil, nil},
+		{`"3"`, []int{3}, nil},
+		{`"1", "2"`, []int{1, 2}, nil},
+		{` "1",W/"2" ,, "x", "3"`, []int{1, 3}, nil},
+		{`W/"1"`, nil, domain.ErrVersionConflict},
+		{`"+1", "01", "0"`, nil, domain.ErrVersionConflict},
+		{`"1" "2"`, nil, domain.ErrVersionConflict},
+		{`"1, 2`, nil, domain.ErrVersionConflict},
+		{`1`, nil, domain.ErrVersionConflict},
+	}
+
+	for _, test := range tests {
+		versions, err := ifMatchVersions(test.header)
+		assert.Equal(t, test.versions, versions, test.header)
+		assert.Equal(t, test.err, err, test.header)
+	}
+}
+
+func TestListBooksPaginatesAndSelectsFields(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	for _, title := range []string{"b", "a", "c"} {
+		createPublishedBook(t, server, tokens, map[string]interface{}{"title": title})
+	}
+
+	var page struct {
+		Items []map[string]interface{} `json:"items"`
+		Total int64                    `json:"total"`
+		Next  string                   `json:"next"`
+	}
+	status := doRequest(t, http.MethodGet, server.URL+"/books?limit=2&sort=-title&fields=title", "", nil, &page)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, "c", page.Items[0]["title"])
+	assert.Len(t, page.Items[0], 2)
+	assert.Equal(t, "/books?fields=title&limit=2&offset=2&sort=-title", page.Next)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books?sort=password", "", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestSearchBooksRanksAndFilters(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	for _, book := range []map[string]interface{}{
+		{"title": "Learning Go", "description": "a book", "minimumPrice": 10},
+		{"title": "Rust", "description": "compared with go", "minimumPrice": 30},
+		{"title": "Python", "description": "scripting", "minimumPrice": 10},
+	} {
+		createPublishedBook(t, server, tokens, book)
+	}
+
+	var page struct {
+		Items []map[string]interface{} `json:"items"`
+		Total int64                    `json:"total"`
+	}
+	status := doRequest(t, http.MethodGet, server.URL+"/books/search?q=go&fields=title", "", nil, &page)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, "Learning Go", page.Items[0]["title"])
+	assert.Contains(t, page.Items[0], "score")
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/search?q=go&maxPrice=20", "", nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), page.Total)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/search?q=world&sections=true", "", nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(3), page.Total)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/search?q=", "", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestBooksHaveTheSameShapeOnEveryRoute(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Learning Go"})
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	status := doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/claim", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var detail map[string]interface{}
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id, "", nil, &detail)
+	assert.Equal(t, http.StatusOK, status)
+
+	var search struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/books/search?q=go", "", nil, &search)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, search.Items, 1)
+	assert.Contains(t, search.Items[0], "score")
+	delete(search.Items[0], "score")
+
+	var library struct {
+		Items []struct {
+			Book map[string]interface{} `json:"book"`
+		} `json:"items"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/users/"+reader.User.Id+"/library", reader.AccessToken, nil, &library)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, library.Items, 1)
+
+	keys := func(book map[string]interface{}) []string {
+		fields := []string{}
+		for field := range book {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		return fields
+	}
+	assert.Equal(t, keys(detail), keys(search.Items[0]))
+	assert.Equal(t, keys(detail), keys(library.Items[0].Book))
+}
+
+func TestBookLifecycleControlsCatalogVisibility(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+
+	var book models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Go",
+		"state":   models.StatePublished,
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+		"content": []map[string]interface{}{{
+			"chapter":  "Intro",
+			"sections": []models.BookSection{{Title: "Hello", Content: "World"}},
+		}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.StateUnpublished, book.State)
+
+	var page struct {
+		Total int64 `json:"total"`
+	}
+	doRequest(t, http.MethodGet, server.URL+"/books", "", nil, &page)
+	assert.Equal(t, int64(0), page.Total)
+	doRequest(t, http.MethodGet, server.URL+"/books/author/"+tokens.User.Id, tokens.AccessToken, nil, &page)
+	assert.Equal(t, int64(1), page.Total)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id, "", nil, nil)
+	assert.NotEqual(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodDelete, server.URL+"/books/"+book.Id+"/chapters/0", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/chapters", tokens.AccessToken, dtos.ChapterDto{Chapter: "Intro"}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", tokens.AccessToken, nil, &book)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.StatePublished, book.State)
+	assert.Equal(t, tokens.User.Id, book.Transitions[0].ActorId)
+
+	doRequest(t, http.MethodGet, server.URL+"/books", "", nil, &page)
+	assert.Equal(t, int64(1), page.Total)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/retire", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/close", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	doRequest(t, http.MethodGet, server.URL+"/books", "", nil, &page)
+	assert.Equal(t, int64(0), page.Total)
+}
+
+func TestAuthorEditsChaptersAndSections(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	url := server.URL + "/books/"
+
+	var book models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Go",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+		"content": []map[string]interface{}{{
+			"chapter":  "Intro",
+			"sections": []models.BookSection{{Title: "Hello", Content: "World"}},
+		}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	url += book.Id
+	introSection := book.Content[0].Sections[0].SectionId
+
+	first := 0
+	status = doRequest(t, http.MethodPost, url+"/chapters", tokens.AccessToken, dtos.ChapterDto{Chapter: "Preface", Position: &first}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Preface", book.Content[0].Chapter)
+
+	status = doRequest(t, http.MethodPost, url+"/chapters/0/sections", tokens.AccessToken, dtos.SectionDto{Title: "Why", Content: "Because"}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	prefaceSection := book.Content[0].Sections[0].SectionId
+
+	status = doRequest(t, http.MethodPut, url+"/sections/"+prefaceSection, tokens.AccessToken, dtos.SectionDto{Title: "Why Go", Content: "Because"}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPost, url+"/sections/"+prefaceSection+"/move", tokens.AccessToken, dtos.SectionMoveDto{Chapter: 1, Position: &first}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, book.Content[0].Sections)
+	assert.Equal(t, []models.BookSectionId{{SectionId: prefaceSection}, {SectionId: introSection}}, book.Content[1].Sections)
+
+	status = doRequest(t, http.MethodPut, url+"/chapters/1", tokens.AccessToken, dtos.ChapterDto{Chapter: "Introduction", Position: &first}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Introduction", book.Content[0].Chapter)
+
+	var section models.BookSection
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+prefaceSection, tokens.AccessToken, nil, &section)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Why Go", section.Title)
+
+	status = doRequest(t, http.MethodDelete, url+"/sections/"+introSection, tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+introSection, tokens.AccessToken, nil, nil)
+	assert.NotEqual(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodDelete, url+"/chapters/0", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+prefaceSection, tokens.AccessToken, nil, nil)
+	assert.NotEqual(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodDelete, url+"/chapters/5", tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status = doRequest(t, http.MethodPost, url+"/sections/"+prefaceSection+"/move", tokens.AccessToken, dtos.SectionMoveDto{}, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestSectionsAreRenderedFromMarkdown(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+
+	var book models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Go",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+		"content": []map[string]interface{}{{
+			"chapter": "Intro",
+			"sections": []models.BookSection{
+				{Title: "Getting Started", Content: "Install **Go**"},
+				{Title: "Next", Content: "Draft"},
+			},
+		}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	start := book.Content[0].Sections[0].SectionId
+	next := book.Content[0].Sections[1].SectionId
+
+	content := "See [the start](#getting-started)[^1].\n\n```go\nfmt.Println()\n```\n\n<script>alert(1)</script>\n\n[^1]: Read it first."
+	status = doRequest(t, http.MethodPut, server.URL+"/books/"+book.Id+"/sections/"+next, tokens.AccessToken, dtos.SectionDto{Title: "Next", Content: content}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var section models.BookSection
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+next, tokens.AccessToken, nil, &section)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, content, section.Content)
+	assert.Contains(t, section.Html, `<a href="#section-`+start+`">the start</a>`)
+	assert.Contains(t, section.Html, `<pre><code class="language-go">fmt.Println()`)
+	assert.Contains(t, section.Html, `<li id="section-`+next+`-fn-1">Read it first.`)
+	assert.Contains(t, section.Html, "&lt;script&gt;")
+	assert.NotContains(t, section.Html, "<script>")
+
+	var sections models.BookSections
+	status = doRequest(t, http.MethodGet, server.URL+"/books/sections/"+book.Id, tokens.AccessToken, nil, &sections)
+	assert.Equal(t, http.StatusOK, status)
+	for _, section := range sections.Sections {
+		if section.Id == start {
+			assert.Equal(t, "<p>Install <strong>Go</strong></p>", section.Html)
+		}
+	}
+}
+
+func TestDeleteBookCascadesToSections(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+
+	status := doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Empty",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+	}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var book models.Book
+	status = doRequest(t, http.MethodPost, server.URL+"/books", tokens.AccessToken, map[string]interface{}{
+		"title":   "Go",
+		"authors": []models.Author{{AuthorId: tokens.User.Id}},
+		"content": []map[string]interface{}{{
+			"chapter":  "Intro",
+			"sections": []models.BookSection{{Title: "Hello", Content: "World"}},
+		}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	sectionId := book.Content[0].Sections[0].SectionId
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+sectionId, tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodDelete, server.URL+"/books/"+book.Id, tokens.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+sectionId, tokens.AccessToken, nil, nil)
+	assert.NotEqual(t, http.StatusOK, status)
+}
+
+func TestCheckoutCreatesOrderAndEmptiesCart(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{
+		"title":          "Go",
+		"minimumPrice":   5,
+		"suggestedPrice": 12.5,
+	})
+
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	var shoppingCart models.ShoppingCart
+	status := doRequest(t, http.MethodPost, server.URL+"/cart", reader.AccessToken, models.ShoppingCart{
+		Books: []models.BookId{{Book: book.Id}},
+	}, &shoppingCart)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders", author.AccessToken, dtos.CheckoutDto{CartId: shoppingCart.Id}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var order models.Order
+	status = doRequest(t, http.MethodPost, server.URL+"/orders", reader.AccessToken, dtos.CheckoutDto{CartId: shoppingCart.Id}, &order)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.OrderPending, order.Status)
+	assert.Equal(t, 12.5, order.Total)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/cart/"+shoppingCart.Id, reader.AccessToken, nil, &shoppingCart)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, shoppingCart.Books)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders", reader.AccessToken, dtos.CheckoutDto{CartId: shoppingCart.Id}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	var page struct {
+		Items []models.Order `json:"items"`
+		Total int64          `json:"total"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/orders", reader.AccessToken, nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), page.Total)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/orders/"+order.Id, author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders/"+order.Id+"/fulfill", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestPayOrderThroughPaymentProvider(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Go", "minimumPrice": 8})
+
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	price := 4.0
+	status := doRequest(t, http.MethodPost, server.URL+"/cart", reader.AccessToken, models.ShoppingCart{
+		Books: []models.BookId{{Book: book.Id, Price: &price}},
+	}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status, "offers below the minimum price are rejected")
+
+	price = 9.5
+	var shoppingCart models.ShoppingCart
+	status = doRequest(t, http.MethodPost, server.URL+"/cart", reader.AccessToken, models.ShoppingCart{
+		Books: []models.BookId{{Book: book.Id, Price: &price}},
+	}, &shoppingCart)
+	assert.Equal(t, http.StatusOK, status)
+
+	var order models.Order
+	status = doRequest(t, http.MethodPost, server.URL+"/orders", reader.AccessToken, dtos.CheckoutDto{CartId: shoppingCart.Id}, &order)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 9.5, order.Total)
+	assert.Equal(t, []models.Royalty{{AuthorId: author.User.Id, Amount: 7.6}}, order.Items[0].Royalties)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders/"+order.Id+"/pay", reader.AccessToken, dtos.PaymentDto{Source: "tok_declined"}, nil)
+	assert.Equal(t, http.StatusPaymentRequired, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders/"+order.Id+"/pay", reader.AccessToken, dtos.PaymentDto{Source: "tok_visa"}, &order)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, models.OrderPaid, order.Status)
+	assert.NotEmpty(t, order.PaymentId)
+
+	var library struct {
+		Items []models.LibraryItem `json:"items"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/users/"+reader.User.Id+"/library", reader.AccessToken, nil, &library)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, library.Items, 1)
+	assert.Equal(t, models.EntitlementPurchase, library.Items[0].Source)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/orders/"+order.Id+"/pay", reader.AccessToken, dtos.PaymentDto{Source: "tok_visa"}, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/payments/webhook", "", models.PaymentEvent{
+		Type:    models.PaymentRefundedEvent,
+		OrderId: order.Id,
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, status, "unsigned webhooks are rejected")
+}
+
+func TestSectionsRequireOwnershipBeyondSample(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	sections := []models.BookSection{}
+	for _, title := range []string{"One", "Two", "Three", "Four"} {
+		sections = append(sections, models.BookSection{Title: title, Content: title})
+	}
+
+	var book models.Book
+	status := doRequest(t, http.MethodPost, server.URL+"/books", author.AccessToken, map[string]interface{}{
+		"title":   "Free",
+		"authors": []models.Author{{AuthorId: author.User.Id}},
+		"content": []map[string]interface{}{{"chapter": "Intro", "sections": sections}},
+	}, &book)
+	assert.Equal(t, http.StatusOK, status)
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/publish", author.AccessToken, nil, &book)
+	assert.Equal(t, http.StatusOK, status)
+
+	firstSection := book.Content[0].Sections[0].SectionId
+	lastSection := book.Content[0].Sections[3].SectionId
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+firstSection, "", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+lastSection, reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var readable models.BookSections
+	status = doRequest(t, http.MethodGet, server.URL+"/books/sections/"+book.Id, reader.AccessToken, nil, &readable)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, readable.Sections, 3)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/claim", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/section/"+lastSection, reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var library struct {
+		Items []models.LibraryItem `json:"items"`
+		Total int64                `json:"total"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/users/"+reader.User.Id+"/library", reader.AccessToken, nil, &library)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), library.Total)
+	assert.Equal(t, book.Id, library.Items[0].Book.Id)
+	assert.Equal(t, models.EntitlementFree, library.Items[0].Source)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/users/"+reader.User.Id+"/library", author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestReaderTracksProgressBookmarksAndHighlights(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Go"})
+	section := book.Content[0].Sections[0].SectionId
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	progressUrl := server.URL + "/books/" + book.Id + "/progress"
+
+	status := doRequest(t, http.MethodGet, progressUrl, reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	var progress models.ReadingProgress
+	status = doRequest(t, http.MethodPut, progressUrl, reader.AccessToken, dtos.ProgressDto{SectionId: section}, &progress)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 100.0, progress.PercentComplete)
+
+	status = doRequest(t, http.MethodGet, progressUrl, reader.AccessToken, nil, &progress)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, section, progress.SectionId)
+
+	var bookmark models.Bookmark
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/bookmarks", reader.AccessToken, dtos.BookmarkDto{SectionId: section, Note: "later"}, &bookmark)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodDelete, server.URL+"/books/"+book.Id+"/bookmarks/"+bookmark.Id, author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status = doRequest(t, http.MethodDelete, server.URL+"/books/"+book.Id+"/bookmarks/"+bookmark.Id, reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var highlight models.Highlight
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/highlights", reader.AccessToken, dtos.HighlightDto{SectionId: section, Start: 0, End: 3, Note: "nice"}, &highlight)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Wor", highlight.Text)
+
+	var highlights struct {
+		Items []models.Highlight `json:"items"`
+		Total int64              `json:"total"`
+	}
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id+"/highlights", reader.AccessToken, nil, &highlights)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), highlights.Total)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/highlights", reader.AccessToken, dtos.HighlightDto{SectionId: section, Start: 0, End: 50}, nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id+"/bookmarks", "", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestOwnersReviewBooksAndRatingIsRecalculated(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Go"})
+	reviewsUrl := server.URL + "/books/" + book.Id + "/reviews"
+
+	status := doRequest(t, http.MethodPost, reviewsUrl, author.AccessToken, dtos.ReviewDto{Rating: 5}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var reviews []models.Review
+	for i, email := range []string{"first@example.com", "second@example.com"} {
+		reader := registerAndLogin(t, server, email, false)
+		status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/claim", reader.AccessToken, nil, nil)
+		assert.Equal(t, http.StatusOK, status)
+
+		var review models.Review
+		status = doRequest(t, http.MethodPost, reviewsUrl, reader.AccessToken, dtos.ReviewDto{Rating: 4 + i, Text: "good"}, &review)
+		assert.Equal(t, http.StatusOK, status)
+		reviews = append(reviews, review)
+
+		status = doRequest(t, http.MethodPost, reviewsUrl, reader.AccessToken, dtos.ReviewDto{Rating: 1}, nil)
+		assert.Equal(t, http.StatusConflict, status)
+
+		status = doRequest(t, http.MethodPost, reviewsUrl+"/"+review.Id+"/hide", reader.AccessToken, nil, nil)
+		assert.Equal(t, http.StatusForbidden, status)
+	}
+
+	var stored models.Book
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id, "", nil, &stored)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, stored.Reviews)
+	assert.Equal(t, 4.5, stored.Rating)
+
+	stored.Reviews = 1000
+	status = doRequest(t, http.MethodPut, server.URL+"/books", author.AccessToken, stored, &stored)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, stored.Reviews)
+
+	var page struct {
+		Items []models.Review `json:"items"`
+		Total int64           `json:"total"`
+	}
+	status = doRequest(t, http.MethodGet, reviewsUrl+"?limit=1", "", nil, &page)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Len(t, page.Items, 1)
+
+	status = doRequest(t, http.MethodDelete, reviewsUrl+"/"+reviews[0].Id, author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = doRequest(t, http.MethodPut, reviewsUrl+"/"+reviews[0].Id, author.AccessToken, dtos.ReviewDto{Rating: 1}, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestExportEpubRequiresOwnership(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Go"})
+	exportUrl := server.URL + "/books/" + book.Id + "/export.epub"
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+
+	status := doRequest(t, http.MethodGet, exportUrl, reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/claim", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	request, err := http.NewRequest(http.MethodGet, exportUrl, nil)
+	assert.Nil(t, err)
+	request.Header.Set("Authorization", "Bearer "+reader.AccessToken)
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/epub+zip", response.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=go.epub`, response.Header.Get("Content-Disposition"))
+}
+
+func TestAuthorImportsBookFromZip(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, text := range map[string]string{
+		"manuscript/Book.txt":    "chapter1.md\nmissing.md\n",
+		"manuscript/chapter1.md": "# Getting Started\n\nHello\n\n## Install\n\nSee [the start](#getting-started).",
+	} {
+		file, err := writer.Create(name)
+		assert.Nil(t, err)
+		file.Write([]byte(text))
+	}
+	assert.Nil(t, writer.Close())
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/books/import?title=Go", bytes.NewReader(archive.Bytes()))
+	request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	result, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	var imported models.BookImport
+	assert.Nil(t, json.NewDecoder(result.Body).Decode(&imported))
+	assert.Equal(t, "Go", imported.Book.Title)
+	assert.Equal(t, "Getting Started", imported.Book.Content[0].Chapter)
+	assert.Equal(t, []string{"not found, skipped"}, imported.Files[2].Warnings)
+
+	var sections models.BookSections
+	status := doRequest(t, http.MethodGet, server.URL+"/books/sections/"+imported.Book.Id, tokens.AccessToken, nil, &sections)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, sections.Sections, 2)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/books/import", tokens.AccessToken, "not a zip", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	result, err = http.Post(server.URL+"/books/import", "application/zip", bytes.NewReader(archive.Bytes()))
+	assert.Nil(t, err)
+	result.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+}
+
+func TestImportBookIsWrongLargeArchives(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+
+	importArchive := func(files int, size int) int {
+		var archive bytes.Buffer
+		writer := zip.NewWriter(&archive)
+		content := make([]byte, size)
+		for i := 0; i < files; i++ {
+			file, err := writer.Create("chapter" + strconv.Itoa(i) + ".md")
+			assert.Nil(t, err)
+			file.Write(content)
+		}
+		assert.Nil(t, writer.Close())
+
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/books/import", bytes.NewReader(archive.Bytes()))
+		request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		result, err := http.DefaultClient.Do(request)
+		assert.Nil(t, err)
+		result.Body.Close()
+		return result.StatusCode
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, importArchive(maxManuscriptEntries+1, 0))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, importArchive(33, 2<<20))
+}
+
+func TestReadersSeeThePublishedVersion(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	author := registerAndLogin(t, server, "author@example.com", true)
+	book := createPublishedBook(t, server, author, map[string]interface{}{"title": "Go"})
+	section := book.Content[0].Sections[0].SectionId
+	sectionUrl := server.URL + "/books/section/" + section
+	versionsUrl := server.URL + "/books/" + book.Id + "/versions"
+	reader := registerAndLogin(t, server, "reader@example.com", false)
+	status := doRequest(t, http.MethodPost, server.URL+"/books/"+book.Id+"/claim", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	status = doRequest(t, http.MethodPut, server.URL+"/books/"+book.Id+"/sections/"+section, author.AccessToken, dtos.SectionDto{Title: "Hello", Content: "Draft"}, nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	var read models.BookSection
+	status = doRequest(t, http.MethodGet, sectionUrl, reader.AccessToken, nil, &read)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "World", read.Content, "drafts are not shown to readers")
+
+	var preview models.BookVersion
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id+"/preview", author.AccessToken, nil, &preview)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Draft", preview.Sections[0].Content)
+
+	status = doRequest(t, http.MethodGet, server.URL+"/books/"+book.Id+"/preview", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var version models.BookVersion
+	status = doRequest(t, http.MethodPost, versionsUrl, author.AccessToken, dtos.VersionDto{ReleaseNotes: "Rewritten"}, &version)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, version.Number)
+
+	status = doRequest(t, http.MethodGet, sectionUrl, reader.AccessToken, nil, &read)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Draft", read.Content)
+
+	var notifications struct {
+		Items []models.Notification `json:"items"`
+		Total int64                 `json:"total"`
+	}
+	notificationsUrl := server.URL + "/users/" + reader.User.Id + "/notifications"
+	status = doRequest(t, http.MethodGet, notificationsUrl, reader.AccessToken, nil, &notifications)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1), notifications.Total)
+	assert.Equal(t, 2, notifications.Items[0].Version)
+
+	status = doRequest(t, http.MethodPost, notificationsUrl+"/"+notifications.Items[0].Id+"/read", author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	var notification models.Notification
+	status = doRequest(t, http.MethodPost, notificationsUrl+"/"+notifications.Items[0].Id+"/read", reader.AccessToken, nil, &notification)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, notification.Read)
+
+	var versions struct {
+		Items []models.BookVersion `json:"items"`
+		Total int64                `json:"total"`
+	}
+	status = doRequest(t, http.MethodGet, versionsUrl, reader.AccessToken, nil, &versions)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), versions.Total)
+	assert.Equal(t, "Rewritten", versions.Items[0].ReleaseNotes)
+	assert.Empty(t, versions.Items[0].Sections)
+
+	status = doRequest(t, http.MethodPost, versionsUrl+"/1/rollback", reader.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status = doRequest(t, http.MethodPost, versionsUrl+"/3/rollback", author.AccessToken, nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	var rolledBack models.Book
+	status = doRequest(t, http.MethodPost, versionsUrl+"/1/rollback", author.AccessToken, nil, &rolledBack)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, rolledBack.PublishedVersion)
+	assert.Equal(t, 2, rolledBack.LatestVersion)
+
+	status = doRequest(t, http.MethodGet, sectionUrl, reader.AccessToken, nil, &read)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "World", read.Content)
+
+	status = doRequest(t, http.MethodGet, versionsUrl+"/2", author.AccessToken, nil, &version)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Draft", version.Sections[0].Content)
+}
+
+func TestErrorsAreReportedAsJson(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	readError := func(method string, url string, body string) (int, errorResponse) {
+		request, err := http.NewRequest(method, url, strings.NewReader(body))
+		assert.Nil(t, err)
+
+		result, err := http.DefaultClient.Do(request)
+		assert.Nil(t, err)
+		defer result.Body.Close()
+
+		assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+		var response errorResponse
+		assert.Nil(t, json.NewDecoder(result.Body).Decode(&response))
+		return result.StatusCode, response
+	}
+
+	status, response := readError(http.MethodGet, server.URL+"/books/missing", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "BOOK_NOT_FOUND", response.Error.Code)
+	assert.NotEmpty(t, response.Error.Message)
+
+	registerAndLogin(t, server, "reader@example.com", false)
+	status, response = readError(http.MethodPost, server.URL+"/users", `{"email": "reader@example.com", "password": "test1234"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "REGISTERED_EMAIL", response.Error.Code)
+
+	status, response = readError(http.MethodPost, server.URL+"/users", `{"email": `)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_BODY", response.Error.Code)
+
+	status, response = readError(http.MethodPost, server.URL+"/users/validate", `{"email": "reader@example.com", "password": "wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "INVALID_USER_OR_PASSWORD", response.Error.Code)
+}
+
+func TestUnknownErrorsAreNotShownToClients(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeError(recorder, errors.New("connection refused by mongo-1:27017"))
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "mongo")
+	assert.Contains(t, recorder.Body.String(), `"code":"INTERNAL_ERROR"`)
+}
+
+func TestInvalidPayloadsAreRejected(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	tokens := registerAndLogin(t, server, "author@example.com", true)
+	send := func(body string) (int, errorResponse) {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/books", strings.NewReader(body))
+		assert.Nil(t, err)
+		request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+		result, err := http.DefaultClient.Do(request)
+		assert.Nil(t, err)
+		defer result.Body.Close()
+
+		var response errorResponse
+		assert.Nil(t, json.NewDecoder(result.Body).Decode(&response))
+		return result.StatusCode, response
+	}
+
+	status, response := send(`{"authors": [{"authorId": "` + tokens.User.Id + `"}], "minimumPrice": -1, "languageCode": "english"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "VALIDATION_FAILED", response.Error.Code)
+	var fields []string
+	for _, detail := range response.Error.Details {
+		fields = append(fields, detail.Field)
+	}
+	assert.ElementsMatch(t, []string{"title", "minimumPrice", "languageCode"}, fields)
+
+	status, response = send(`{"title": "Go", "authors": [{"authorId": "` + tokens.User.Id + `"}], "isFree": true}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_BODY", response.Error.Code)
+	assert.Contains(t, response.Error.Message, "isFree")
+
+	status, response = send(`{"title": "` + strings.Repeat("a", maxBodySize) + `"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "BODY_TOO_LARGE", response.Error.Code)
+
+	status = doRequest(t, http.MethodPost, server.URL+"/users", "", map[string]interface{}{"email": "not an email", "password": "test1234"}, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+}
@@ -3,11 +3,26 @@ package app
 import (
 	"github.com/google/wire"
 	"leanpub-app/domain/usecases"
+	"leanpub-app/infra/auth"
 	"leanpub-app/infra/datastore"
+	"leanpub-app/infra/files"
+	"leanpub-app/infra/payments"
 )
 
 var DataStoreProvider = wire.NewSet(datastore.NewMongoGatewayImpl)
+var MemoryDataStoreProvider = wire.NewSet(datastore.NewMemoryGatewayImpl)
+var TokenProvider = wire.NewSet(auth.NewJwtGatewayImpl)
+var PaymentProvider = wire.NewSet(payments.NewPaymentGatewayImpl)
+var FakePaymentProvider = wire.NewSet(payments.NewFakePaymentGatewayImpl)
+var FileProvider = wire.NewSet(files.NewHttpFileGatewayImpl)
 var UserUseCasesProvider = wire.NewSet(usecases.NewUserUseCase)
 var BookUseCasesProvider = wire.NewSet(usecases.NewBookUseCase)
 var ShoppingCartUseCasesProvider = wire.NewSet(usecases.NewShoppingCartUseCase)
+var OrderUseCasesProvider = wire.NewSet(usecases.NewOrderUseCase)
+var LibraryUseCasesProvider = wire.NewSet(usecases.NewLibraryUseCase)
+var ReadingUseCasesProvider = wire.NewSet(usecases.NewReadingUseCase)
+var ReviewUseCasesProvider = wire.NewSet(usecases.NewReviewUseCase)
+var ExportUseCasesProvider = wire.NewSet(usecases.NewExportUseCase)
+var NotificationUseCasesProvider = wire.NewSet(usecases.NewNotificationUseCase)
+var AuthUseCasesProvider = wire.NewSet(usecases.NewAuthUseCase)
 var AppProvider = wire.NewSet(NewApplication)
@@ -2,10 +2,16 @@ package test
 
 type Application struct {
 	DataStore DbGateway
+	Tokens    TokenGateway
+	Payments  PaymentGateway
+	Files     FileGateway
 }
 
-func NewApplication(datastoreGateway DbGateway)	*Application {
+func NewApplication(datastoreGateway DbGateway, tokenGateway TokenGateway, paymentGateway PaymentGateway, fileGateway FileGateway)	*Application {
 	return &Application{
 		DataStore: datastoreGateway,
+		Tokens:    tokenGateway,
+		Payments:  paymentGateway,
+		Files:     fileGateway,
 	}
 }
\ No newline at end of file
@@ -6,4 +6,7 @@ import (
 )
 
 var DbGateweyProvider = wire.NewSet(NewDbGateway, wire.Bind(new(domain.DatabaseGateway), new(DbGateway)))
+var TokenGatewayProvider = wire.NewSet(NewTokenGateway, wire.Bind(new(domain.TokenGateway), new(TokenGateway)))
+var PaymentGatewayProvider = wire.NewSet(NewPaymentGateway, wire.Bind(new(domain.PaymentGateway), new(PaymentGateway)))
+var FileGatewayProvider = wire.NewSet(NewFileGateway, wire.Bind(new(domain.FileGateway), new(FileGateway)))
 var TestApplicacion = wire.NewSet(NewApplication)
\ No newline at end of file
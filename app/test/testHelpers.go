@@ -23,20 +23,20 @@ func (db DbGateway) SaveUser(user *models.User) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (db DbGateway) ValidateUser(registeredUser *models.RegisteredUser, user *models.User) (*models.User, error) {
-	args := db.Called(registeredUser, user)
-	if args.Get(0) == nil || args.Get(1) == nil {
+func (db DbGateway) GetUserByEmail(email string) (*models.User, error) {
+	args := db.Called(email)
+	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(1).(*models.User), args.Error(1)
+	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (db DbGateway) GetUsers() (*[]models.User, error) {
-	args := db.Called()
+func (db DbGateway) GetUsers(options models.ListOptions) (*[]models.User, int64, error) {
+	args := db.Called(options)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, 0, args.Error(2)
 	}
-	return args.Get(0).(*[]models.User), args.Error(1)
+	return args.Get(0).(*[]models.User), args.Get(1).(int64), args.Error(2)
 }
 
 func (db DbGateway) GetUserById(id string) (*models.User, error){
@@ -47,8 +47,8 @@ func (db DbGateway) GetUserById(id string) (*models.User, error){
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (db DbGateway) DeleteUser(id string) error {
-	args := db.Called(id)
+func (db DbGateway) DeleteUser(id string, version int) error {
+	args := db.Called(id, version)
 	return args.Error(0)
 }
 
@@ -60,8 +60,8 @@ func (db DbGateway) UpdateUser(user *models.User) (*models.User, error){
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (db DbGateway) SaveBook(book *models.Book) (*models.Book, error) {
-	args := db.Called(book)
+func (db DbGateway) SaveBook(book *models.Book, sections []models.BookSection) (*models.Book, error) {
+	args := db.Called(book, sections)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -78,12 +78,12 @@ func (db DbGateway) SaveBookSections(bookSections []interface{}) error {
 	return args.Error(0)
 }
 
-func (db DbGateway) GetBooks() (*[]models.Book, error) {
-	args := db.Called()
+func (db DbGateway) GetBooks(state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error) {
+	args := db.Called(state, options)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, 0, args.Error(2)
 	}
-	return args.Get(0).(*[]models.Book), args.Error(1)
+	return args.Get(0).(*[]models.Book), args.Get(1).(int64), args.Error(2)
 }
 
 func (db DbGateway) GetBookIndex(id string) (*models.BookIndex, error) {
@@ -118,29 +118,69 @@ func (db DbGateway) GetBookById(id string) (*models.Book, error) {
 	return args.Get(0).(*models.Book), args.Error(1)
 }
 
-func (db DbGateway) GetBooksByAuthor(authorId string) (*[]models.Book, error) {
-	args := db.Called(authorId)
+func (db DbGateway) GetBooksByIds(ids []string) (*[]models.Book, error) {
+	args := db.Called(ids)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*[]models.Book), args.Error(1)
 }
 
-func (db DbGateway) GetBooksByCategory(category string) (*[]models.Book, error) {
-	args := db.Called(category)
+func (db DbGateway) GetBooksByAuthor(authorId string, state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error) {
+	args := db.Called(authorId, state, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Book), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) GetBooksByCategory(category string, state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error) {
+	args := db.Called(category, state, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Book), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) SearchBooks(search models.BookSearch, listOptions models.ListOptions) (*[]models.BookSearchResult, int64, error) {
+	args := db.Called(search, listOptions)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.BookSearchResult), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) SaveBookContent(bookId string, version int, content []models.BookContent, sections []models.BookSection, deletedSectionIds []string) (*models.Book, error) {
+	args := db.Called(bookId, version, content, sections, deletedSectionIds)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*[]models.Book), args.Error(1)
+	return args.Get(0).(*models.Book), args.Error(1)
 }
 
-func (db DbGateway) DeleteBook(id string) error {
-	args := db.Called(id)
+func (db DbGateway) ChangeBookState(id string, from models.StateBook, transition *models.BookStateTransition) (*models.Book, error) {
+	args := db.Called(id, from, transition)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) PublishBook(id string, from models.StateBook, transition *models.BookStateTransition, version *models.BookVersion) (*models.Book, error) {
+	args := db.Called(id, from, transition, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) DeleteBook(id string, version int) error {
+	args := db.Called(id, version)
 	return args.Error(0)
 }
 
-func (db DbGateway) UpdateBook(book *models.Book) (*models.Book, error) {
-	args := db.Called(book)
+func (db DbGateway) UpdateBook(book *models.Book, deletedSectionIds []string) (*models.Book, error) {
+	args := db.Called(book, deletedSectionIds)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -148,21 +188,352 @@ func (db DbGateway) UpdateBook(book *models.Book) (*models.Book, error) {
 }
 
 func (db DbGateway) SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
-	panic("implement me")
+	args := db.Called(shoppingCart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ShoppingCart), args.Error(1)
 }
 
-func (db DbGateway) GetShoppingCarts() (*[]models.ShoppingCart, error) {
-	panic("implement me")
+func (db DbGateway) GetShoppingCarts(options models.ListOptions) (*[]models.ShoppingCart, int64, error) {
+	args := db.Called(options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.ShoppingCart), args.Get(1).(int64), args.Error(2)
 }
 
 func (db DbGateway) GetShoppingCartById(id string) (*models.ShoppingCart, error) {
-	panic("implement me")
+	args := db.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ShoppingCart), args.Error(1)
 }
 
-func (db DbGateway) DeleteShoppingCart(id string) error {
-	panic("implement me")
+func (db DbGateway) DeleteShoppingCart(id string, version int) error {
+	args := db.Called(id, version)
+	return args.Error(0)
 }
 
 func (db DbGateway) UpdateShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
-	panic("implement me")
-}
\ No newline at end of file
+	args := db.Called(shoppingCart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ShoppingCart), args.Error(1)
+}
+
+func (db DbGateway) SaveOrder(order *models.Order, cartId string) (*models.Order, error) {
+	args := db.Called(order, cartId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (db DbGateway) GetOrdersByUser(userId string, options models.ListOptions) (*[]models.Order, int64, error) {
+	args := db.Called(userId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Order), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) GetOrderById(id string) (*models.Order, error) {
+	args := db.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (db DbGateway) ChangeOrderStatus(id string, from models.OrderStatus, change *models.OrderStatusChange) (*models.Order, error) {
+	args := db.Called(id, from, change)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (db DbGateway) SaveEntitlement(entitlement *models.Entitlement) error {
+	args := db.Called(entitlement)
+	return args.Error(0)
+}
+
+func (db DbGateway) HasEntitlement(userId string, bookId string) (bool, error) {
+	args := db.Called(userId, bookId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (db DbGateway) GetEntitlementsByUser(userId string, options models.ListOptions) (*[]models.Entitlement, int64, error) {
+	args := db.Called(userId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Entitlement), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) DeleteEntitlementsByOrder(orderId string) error {
+	args := db.Called(orderId)
+	return args.Error(0)
+}
+
+func (db DbGateway) GetBookBySectionId(sectionId string) (*models.Book, error) {
+	args := db.Called(sectionId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) SaveBookVersion(version *models.BookVersion) (*models.Book, error) {
+	args := db.Called(version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) GetBookVersion(bookId string, number int) (*models.BookVersion, error) {
+	args := db.Called(bookId, number)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BookVersion), args.Error(1)
+}
+
+func (db DbGateway) GetBookVersions(bookId string, options models.ListOptions) (*[]models.BookVersion, int64, error) {
+	args := db.Called(bookId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.BookVersion), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) SetPublishedVersion(bookId string, number int) (*models.Book, error) {
+	args := db.Called(bookId, number)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) GetBookOwnerIds(bookId string) ([]string, error) {
+	args := db.Called(bookId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (db DbGateway) SaveNotifications(notifications []models.Notification) error {
+	args := db.Called(notifications)
+	return args.Error(0)
+}
+
+func (db DbGateway) GetNotificationsByUser(userId string, options models.ListOptions) (*[]models.Notification, int64, error) {
+	args := db.Called(userId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Notification), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) MarkNotificationRead(userId string, id string) (*models.Notification, error) {
+	args := db.Called(userId, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Notification), args.Error(1)
+}
+
+func (db DbGateway) SaveReadingProgress(progress *models.ReadingProgress) (*models.ReadingProgress, error) {
+	args := db.Called(progress)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReadingProgress), args.Error(1)
+}
+
+func (db DbGateway) GetReadingProgress(userId string, bookId string) (*models.ReadingProgress, error) {
+	args := db.Called(userId, bookId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReadingProgress), args.Error(1)
+}
+
+func (db DbGateway) SaveBookmark(bookmark *models.Bookmark) (*models.Bookmark, error) {
+	args := db.Called(bookmark)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Bookmark), args.Error(1)
+}
+
+func (db DbGateway) GetBookmarks(userId string, bookId string, options models.ListOptions) (*[]models.Bookmark, int64, error) {
+	args := db.Called(userId, bookId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Bookmark), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) DeleteBookmark(userId string, id string) error {
+	args := db.Called(userId, id)
+	return args.Error(0)
+}
+
+func (db DbGateway) SaveHighlight(highlight *models.Highlight) (*models.Highlight, error) {
+	args := db.Called(highlight)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Highlight), args.Error(1)
+}
+
+func (db DbGateway) GetHighlights(userId string, bookId string, options models.ListOptions) (*[]models.Highlight, int64, error) {
+	args := db.Called(userId, bookId, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Highlight), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) DeleteHighlight(userId string, id string) error {
+	args := db.Called(userId, id)
+	return args.Error(0)
+}
+
+func (db DbGateway) SaveReview(review *models.Review) (*models.Review, error) {
+	args := db.Called(review)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Review), args.Error(1)
+}
+
+func (db DbGateway) GetReviewById(id string) (*models.Review, error) {
+	args := db.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Review), args.Error(1)
+}
+
+func (db DbGateway) GetReviewsByBook(bookId string, includeHidden bool, options models.ListOptions) (*[]models.Review, int64, error) {
+	args := db.Called(bookId, includeHidden, options)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).(*[]models.Review), args.Get(1).(int64), args.Error(2)
+}
+
+func (db DbGateway) UpdateReview(review *models.Review) (*models.Review, error) {
+	args := db.Called(review)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Review), args.Error(1)
+}
+
+func (db DbGateway) DeleteReview(id string) error {
+	args := db.Called(id)
+	return args.Error(0)
+}
+
+func (db DbGateway) RefreshBookRating(bookId string) (*models.Book, error) {
+	args := db.Called(bookId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Book), args.Error(1)
+}
+
+func (db DbGateway) RevokeToken(token *models.RevokedToken) (bool, error) {
+	args := db.Called(token)
+	return args.Bool(0), args.Error(1)
+}
+
+func (db DbGateway) IsTokenRevoked(id string) (bool, error) {
+	args := db.Called(id)
+	return args.Bool(0), args.Error(1)
+}
+
+type TokenGateway struct {
+	mock.Mock
+}
+
+func NewTokenGateway() TokenGateway {
+	return TokenGateway{}
+}
+
+func (tokens TokenGateway) IssueToken(claims *models.TokenClaims) (string, error) {
+	args := tokens.Called(claims)
+	return args.String(0), args.Error(1)
+}
+
+func (tokens TokenGateway) ParseToken(token string) (*models.TokenClaims, error) {
+	args := tokens.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TokenClaims), args.Error(1)
+}
+
+type PaymentGateway struct {
+	mock.Mock
+}
+
+func NewPaymentGateway() PaymentGateway {
+	return PaymentGateway{}
+}
+
+func (payments PaymentGateway) Authorize(request *models.PaymentRequest) (*models.Payment, error) {
+	args := payments.Called(request)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (payments PaymentGateway) Capture(paymentId string) (*models.Payment, error) {
+	args := payments.Called(paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (payments PaymentGateway) Refund(paymentId string, amount float64) (*models.Payment, error) {
+	args := payments.Called(paymentId, amount)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (payments PaymentGateway) VerifyWebhook(payload []byte, signature string) (*models.PaymentEvent, error) {
+	args := payments.Called(payload, signature)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentEvent), args.Error(1)
+}
+
+type FileGateway struct {
+	mock.Mock
+}
+
+func NewFileGateway() FileGateway {
+	return FileGateway{}
+}
+
+func (files FileGateway) GetFile(location string) (*models.File, error) {
+	args := files.Called(location)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.File), args.Error(1)
+}
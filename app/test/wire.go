@@ -6,6 +6,6 @@ package test
 import "github.com/google/wire"
 
 func CreateApp() *Application {
-	wire.Build(DbGateweyProvider, TestApplicacion)
+	wire.Build(DbGateweyProvider, TokenGatewayProvider, PaymentGatewayProvider, FileGatewayProvider, TestApplicacion)
 	return new(Application)
 }
@@ -10,6 +10,9 @@ package test
 
 func CreateApp() *Application {
 	dbGateway := NewDbGateway()
-	application := NewApplication(dbGateway)
+	tokenGateway := NewTokenGateway()
+	paymentGateway := NewPaymentGateway()
+	fileGateway := NewFileGateway()
+	application := NewApplication(dbGateway, tokenGateway, paymentGateway, fileGateway)
 	return application
 }
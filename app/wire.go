@@ -9,9 +9,42 @@ func CreateApp() *Application {
 
 	wire.Build(
 		DataStoreProvider,
+		TokenProvider,
+		PaymentProvider,
+		FileProvider,
 		UserUseCasesProvider,
 		BookUseCasesProvider,
 		ShoppingCartUseCasesProvider,
+		OrderUseCasesProvider,
+		LibraryUseCasesProvider,
+		ReadingUseCasesProvider,
+		ReviewUseCasesProvider,
+		ExportUseCasesProvider,
+		NotificationUseCasesProvider,
+		AuthUseCasesProvider,
+		AppProvider,
+	)
+
+	return new(Application)
+}
+
+func CreateMemoryApp() *Application {
+
+	wire.Build(
+		MemoryDataStoreProvider,
+		TokenProvider,
+		FakePaymentProvider,
+		FileProvider,
+		UserUseCasesProvider,
+		BookUseCasesProvider,
+		ShoppingCartUseCasesProvider,
+		OrderUseCasesProvider,
+		LibraryUseCasesProvider,
+		ReadingUseCasesProvider,
+		ReviewUseCasesProvider,
+		ExportUseCasesProvider,
+		NotificationUseCasesProvider,
+		AuthUseCasesProvider,
 		AppProvider,
 	)
 
@@ -8,7 +8,10 @@ package app
 
 import (
 	"leanpub-app/domain/usecases"
+	"leanpub-app/infra/auth"
 	"leanpub-app/infra/datastore"
+	"leanpub-app/infra/files"
+	"leanpub-app/infra/payments"
 )
 
 // Injectors from wire.go:
@@ -18,6 +21,35 @@ func CreateApp() *Application {
 	userUseCases := usecases.NewUserUseCase(databaseGateway)
 	bookUseCases := usecases.NewBookUseCase(databaseGateway)
 	shoppingCartUseCases := usecases.NewShoppingCartUseCase(databaseGateway)
-	application := NewApplication(databaseGateway, userUseCases, bookUseCases, shoppingCartUseCases)
+	paymentGateway := payments.NewPaymentGatewayImpl()
+	orderUseCase := usecases.NewOrderUseCase(databaseGateway, paymentGateway)
+	libraryUseCase := usecases.NewLibraryUseCase(databaseGateway)
+	readingUseCase := usecases.NewReadingUseCase(databaseGateway)
+	reviewUseCase := usecases.NewReviewUseCase(databaseGateway)
+	fileGateway := files.NewHttpFileGatewayImpl()
+	exportUseCase := usecases.NewExportUseCase(databaseGateway, fileGateway)
+	notificationUseCase := usecases.NewNotificationUseCase(databaseGateway)
+	tokenGateway := auth.NewJwtGatewayImpl()
+	authUseCases := usecases.NewAuthUseCase(databaseGateway, tokenGateway, userUseCases)
+	application := NewApplication(databaseGateway, userUseCases, bookUseCases, shoppingCartUseCases, orderUseCase, libraryUseCase, readingUseCase, reviewUseCase, exportUseCase, notificationUseCase, authUseCases)
+	return application
+}
+
+func CreateMemoryApp() *Application {
+	databaseGateway := datastore.NewMemoryGatewayImpl()
+	userUseCases := usecases.NewUserUseCase(databaseGateway)
+	bookUseCases := usecases.NewBookUseCase(databaseGateway)
+	shoppingCartUseCases := usecases.NewShoppingCartUseCase(databaseGateway)
+	paymentGateway := payments.NewFakePaymentGatewayImpl()
+	orderUseCase := usecases.NewOrderUseCase(databaseGateway, paymentGateway)
+	libraryUseCase := usecases.NewLibraryUseCase(databaseGateway)
+	readingUseCase := usecases.NewReadingUseCase(databaseGateway)
+	reviewUseCase := usecases.NewReviewUseCase(databaseGateway)
+	fileGateway := files.NewHttpFileGatewayImpl()
+	exportUseCase := usecases.NewExportUseCase(databaseGateway, fileGateway)
+	notificationUseCase := usecases.NewNotificationUseCase(databaseGateway)
+	tokenGateway := auth.NewJwtGatewayImpl()
+	authUseCases := usecases.NewAuthUseCase(databaseGateway, tokenGateway, userUseCases)
+	application := NewApplication(databaseGateway, userUseCases, bookUseCases, shoppingCartUseCases, orderUseCase, libraryUseCase, readingUseCase, reviewUseCase, exportUseCase, notificationUseCase, authUseCases)
 	return application
 }
@@ -0,0 +1,113 @@
+package domain
+
+import "net/http"
+
+// Error is an error reported to clients. Code is stable and meant for
+// programs, Message is meant for people, Status is the HTTP status the error
+// is reported with and Details lists the fields a validation failure is
+// about. Error() returns the code, so errors compare by their code in logs
+// and tests alike.
+type Error struct {
+	Code    string
+	Message string
+	Status  int
+	Details []FieldError
+}
+
+// FieldError describes why a single field of a request was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func newError(status int, code string, message string) *Error {
+	return &Error{Code: code, Message: message, Status: status}
+}
+
+func (err *Error) Error() string {
+	return err.Code
+}
+
+// Is matches errors with the same code, so that the copies made by
+// WithMessage and WithDetails still match the error they were made from.
+func (err *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Code == err.Code
+}
+
+// WithMessage returns a copy of the error with a more specific message.
+func (err *Error) WithMessage(message string) *Error {
+	copied := *err
+	copied.Message = message
+	return &copied
+}
+
+// WithDetails returns a copy of the error listing the fields it is about.
+func (err *Error) WithDetails(details []FieldError) *Error {
+	copied := *err
+	copied.Details = details
+	return &copied
+}
+
+var (
+	ErrInternal          = newError(http.StatusInternalServerError, "INTERNAL_ERROR", "An unexpected error occurred.")
+	ErrInvalidBody       = newError(http.StatusBadRequest, "INVALID_BODY", "The request body could not be read.")
+	ErrBodyTooLarge      = newError(http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", "The request body is too large.")
+	ErrValidation        = newError(http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Some fields are not valid.")
+	ErrUnauthorized      = newError(http.StatusUnauthorized, "UNAUTHORIZED", "Authentication is required.")
+	ErrForbidden         = newError(http.StatusForbidden, "FORBIDDEN", "You are not allowed to do this.")
+	ErrInvalidPagination = newError(http.StatusBadRequest, "INVALID_PAGINATION", "The offset or limit is not valid.")
+	ErrInvalidSortField  = newError(http.StatusBadRequest, "INVALID_SORT_FIELD", "The results cannot be sorted by that field.")
+	ErrInvalidField      = newError(http.StatusBadRequest, "INVALID_FIELD", "One of the requested fields does not exist.")
+	ErrInvalidSearch     = newError(http.StatusBadRequest, "INVALID_SEARCH", "The search is not valid.")
+	ErrVersionConflict   = newError(http.StatusPreconditionFailed, "VERSION_CONFLICT", "The resource was changed since it was read.")
+
+	ErrInvalidToken          = newError(http.StatusUnauthorized, "INVALID_TOKEN", "The token is not valid.")
+	ErrExpiredToken          = newError(http.StatusUnauthorized, "EXPIRED_TOKEN", "The token has expired.")
+	ErrRevokedToken          = newError(http.StatusUnauthorized, "REVOKED_TOKEN", "The token has been revoked.")
+	ErrInvalidUserOrPassword = newError(http.StatusUnauthorized, "INVALID_USER_OR_PASSWORD", "The email or password is not correct.")
+
+	ErrUserNotFound    = newError(http.StatusNotFound, "USER_NOT_FOUND", "The user does not exist.")
+	ErrRegisteredEmail = newError(http.StatusConflict, "REGISTERED_EMAIL", "The email is already registered.")
+
+	ErrBookNotFound           = newError(http.StatusNotFound, "BOOK_NOT_FOUND", "The book does not exist.")
+	ErrInvalidStateTransition = newError(http.StatusConflict, "INVALID_STATE_TRANSITION", "The book cannot move to that state.")
+	ErrBookNotPublishable     = newError(http.StatusUnprocessableEntity, "BOOK_NOT_PUBLISHABLE", "The book is not ready to be published.")
+	ErrBookNotPublished       = newError(http.StatusConflict, "BOOK_NOT_PUBLISHED", "Only published books get new versions.")
+
+	ErrChapterNotFound    = newError(http.StatusNotFound, "CHAPTER_NOT_FOUND", "The chapter does not exist.")
+	ErrSectionNotFound    = newError(http.StatusNotFound, "SECTION_NOT_FOUND", "The section does not exist.")
+	ErrInvalidPosition    = newError(http.StatusBadRequest, "INVALID_POSITION", "The position is out of range.")
+	ErrInvalidBookContent = newError(http.StatusBadRequest, "INVALID_BOOK_CONTENT", "The content of the book is not valid.")
+	ErrInvalidManuscript  = newError(http.StatusBadRequest, "INVALID_MANUSCRIPT", "The manuscript could not be imported.")
+
+	ErrVersionNotFound      = newError(http.StatusNotFound, "VERSION_NOT_FOUND", "The version does not exist.")
+	ErrVersionExists        = newError(http.StatusConflict, "VERSION_EXISTS", "The version was already published.")
+	ErrNotificationNotFound = newError(http.StatusNotFound, "NOTIFICATION_NOT_FOUND", "The notification does not exist.")
+
+	ErrShoppingCartNotFound   = newError(http.StatusNotFound, "SHOPPING_CART_NOT_FOUND", "The shopping cart does not exist.")
+	ErrOrderNotFound          = newError(http.StatusNotFound, "ORDER_NOT_FOUND", "The order does not exist.")
+	ErrEmptyCart              = newError(http.StatusUnprocessableEntity, "EMPTY_CART", "The shopping cart is empty.")
+	ErrBookNotAvailable       = newError(http.StatusConflict, "BOOK_NOT_AVAILABLE", "The book is not for sale.")
+	ErrInvalidOrderTransition = newError(http.StatusConflict, "INVALID_ORDER_TRANSITION", "The order cannot move to that state.")
+	ErrBelowMinimumPrice      = newError(http.StatusUnprocessableEntity, "BELOW_MINIMUM_PRICE", "The price is below the minimum price of the book.")
+
+	ErrPaymentDeclined = newError(http.StatusPaymentRequired, "PAYMENT_DECLINED", "The payment was declined.")
+	ErrInvalidWebhook  = newError(http.StatusBadRequest, "INVALID_WEBHOOK", "The webhook is not valid.")
+
+	ErrBookNotOwned = newError(http.StatusForbidden, "BOOK_NOT_OWNED", "The book is not in your library.")
+	ErrBookNotFree  = newError(http.StatusUnprocessableEntity, "BOOK_NOT_FREE", "The book is not free.")
+
+	ErrReadingProgressNotFound = newError(http.StatusNotFound, "READING_PROGRESS_NOT_FOUND", "No reading progress was saved for the book.")
+	ErrBookmarkNotFound        = newError(http.StatusNotFound, "BOOKMARK_NOT_FOUND", "The bookmark does not exist.")
+	ErrHighlightNotFound       = newError(http.StatusNotFound, "HIGHLIGHT_NOT_FOUND", "The highlight does not exist.")
+	ErrInvalidHighlight        = newError(http.StatusBadRequest, "INVALID_HIGHLIGHT", "The highlight is outside the section.")
+
+	ErrReviewNotFound = newError(http.StatusNotFound, "REVIEW_NOT_FOUND", "The review does not exist.")
+	ErrReviewExists   = newError(http.StatusConflict, "REVIEW_EXISTS", "You already reviewed the book.")
+	ErrInvalidRating  = newError(http.StatusUnprocessableEntity, "INVALID_RATING", "The rating must be between 1 and 5.")
+
+	ErrFileNotFound = newError(http.StatusNotFound, "FILE_NOT_FOUND", "The file does not exist.")
+	ErrFileTooLarge = newError(http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", "The file is too large.")
+)
@@ -4,27 +4,106 @@ import "leanpub-app/domain/models"
 
 type DatabaseGateway interface {
 	SaveUser(user *models.User) (*models.User, error)
-	ValidateUser(registeredUser *models.RegisteredUser, user *models.User) (*models.User, error)
-	GetUsers() (*[]models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	GetUsers(options models.ListOptions) (*[]models.User, int64, error)
 	GetUserById(id string) (*models.User, error)
-	DeleteUser(id string) error
+	// DeleteUser, DeleteBook and DeleteShoppingCart delete only while the
+	// stored document still has the given version, and fail with
+	// ErrVersionConflict when it was changed. Deleting a missing one is not
+	// an error.
+	DeleteUser(id string, version int) error
+	// UpdateUser, UpdateBook and UpdateShoppingCart write only while the
+	// stored document still has the version of the one given and increment
+	// it, and fail with ErrVersionConflict when it was changed in between.
 	UpdateUser(user *models.User) (*models.User, error)
-	SaveBook(book *models.Book) (*models.Book, error)
+	SaveBook(book *models.Book, sections []models.BookSection) (*models.Book, error)
 	SaveBookSection(bookSection *models.BookSection) error
 	SaveBookSections(bookSections []interface{}) error
-	GetBooks() (*[]models.Book, error)
+	GetBooks(state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error)
 	GetBookIndex(id string) (*models.BookIndex, error)
 	GetSectionsByBookId(bookId string) (*models.BookSections, error)
 	GetBookSectionById(id string) (*models.BookSection, error)
 	GetBookById(id string) (*models.Book, error)
-	GetBooksByAuthor(authorId string) (*[]models.Book, error)
-	GetBooksByCategory(category string) (*[]models.Book, error)
-	DeleteBook(id string) error
-	UpdateBook(book *models.Book) (*models.Book, error)
+	// GetBooksByIds returns the books with the given ids that exist, in no
+	// particular order.
+	GetBooksByIds(ids []string) (*[]models.Book, error)
+	GetBooksByAuthor(authorId string, state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error)
+	GetBooksByCategory(category string, state models.StateBook, options models.ListOptions) (*[]models.Book, int64, error)
+	// SearchBooks returns the page of matching books listOptions selects,
+	// ranked by score and then by id, and how many books matched. Section
+	// text is searched in each book's published version.
+	SearchBooks(search models.BookSearch, listOptions models.ListOptions) (*[]models.BookSearchResult, int64, error)
+	// SaveBookContent writes the same way, while the book is still at the
+	// given version, which 0 matches for books written before versions.
+	SaveBookContent(bookId string, version int, content []models.BookContent, sections []models.BookSection, deletedSectionIds []string) (*models.Book, error)
+	ChangeBookState(id string, from models.StateBook, transition *models.BookStateTransition) (*models.Book, error)
+	// PublishBook changes the state of the book like ChangeBookState and saves
+	// its first version like SaveBookVersion, both or neither.
+	PublishBook(id string, from models.StateBook, transition *models.BookStateTransition, version *models.BookVersion) (*models.Book, error)
+	// DeleteBook deletes the book together with its sections, versions and
+	// the entitlements to it.
+	DeleteBook(id string, version int) error
+	UpdateBook(book *models.Book, deletedSectionIds []string) (*models.Book, error)
 	SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error)
-	GetShoppingCarts() (*[]models.ShoppingCart, error)
+	GetShoppingCarts(options models.ListOptions) (*[]models.ShoppingCart, int64, error)
 	GetShoppingCartById(id string) (*models.ShoppingCart, error)
-	DeleteShoppingCart(id string) error
+	DeleteShoppingCart(id string, version int) error
 	UpdateShoppingCart(shoppingCart *models.ShoppingCart)	(*models.ShoppingCart, error)
+	SaveOrder(order *models.Order, cartId string) (*models.Order, error)
+	GetOrdersByUser(userId string, options models.ListOptions) (*[]models.Order, int64, error)
+	GetOrderById(id string) (*models.Order, error)
+	ChangeOrderStatus(id string, from models.OrderStatus, change *models.OrderStatusChange) (*models.Order, error)
+	SaveEntitlement(entitlement *models.Entitlement) error
+	HasEntitlement(userId string, bookId string) (bool, error)
+	GetEntitlementsByUser(userId string, options models.ListOptions) (*[]models.Entitlement, int64, error)
+	DeleteEntitlementsByOrder(orderId string) error
+	GetBookBySectionId(sectionId string) (*models.Book, error)
+	SaveBookVersion(version *models.BookVersion) (*models.Book, error)
+	GetBookVersion(bookId string, number int) (*models.BookVersion, error)
+	GetBookVersions(bookId string, options models.ListOptions) (*[]models.BookVersion, int64, error)
+	SetPublishedVersion(bookId string, number int) (*models.Book, error)
+	GetBookOwnerIds(bookId string) ([]string, error)
+	SaveNotifications(notifications []models.Notification) error
+	GetNotificationsByUser(userId string, options models.ListOptions) (*[]models.Notification, int64, error)
+	MarkNotificationRead(userId string, id string) (*models.Notification, error)
+	SaveReadingProgress(progress *models.ReadingProgress) (*models.ReadingProgress, error)
+	GetReadingProgress(userId string, bookId string) (*models.ReadingProgress, error)
+	SaveBookmark(bookmark *models.Bookmark) (*models.Bookmark, error)
+	GetBookmarks(userId string, bookId string, options models.ListOptions) (*[]models.Bookmark, int64, error)
+	DeleteBookmark(userId string, id string) error
+	SaveHighlight(highlight *models.Highlight) (*models.Highlight, error)
+	GetHighlights(userId string, bookId string, options models.ListOptions) (*[]models.Highlight, int64, error)
+	DeleteHighlight(userId string, id string) error
+	SaveReview(review *models.Review) (*models.Review, error)
+	GetReviewById(id string) (*models.Review, error)
+	GetReviewsByBook(bookId string, includeHidden bool, options models.ListOptions) (*[]models.Review, int64, error)
+	UpdateReview(review *models.Review) (*models.Review, error)
+	DeleteReview(id string) error
+	// RefreshBookRating recomputes the review count and rating of the book
+	// without changing its version, which only counts edits.
+	RefreshBookRating(bookId string) (*models.Book, error)
+	RevokeToken(token *models.RevokedToken) (bool, error)
+	IsTokenRevoked(id string) (bool, error)
 	Setup()
 }
+
+// FileGateway reads files kept outside the database, like the cover images
+// books link to.
+type FileGateway interface {
+	GetFile(location string) (*models.File, error)
+}
+
+type TokenGateway interface {
+	IssueToken(claims *models.TokenClaims) (string, error)
+	ParseToken(token string) (*models.TokenClaims, error)
+}
+
+// PaymentGateway charges buyers through a payment provider. Authorize holds
+// the amount, Capture collects it and Refund returns it. VerifyWebhook checks
+// that a notification was sent by the provider before it is trusted.
+type PaymentGateway interface {
+	Authorize(request *models.PaymentRequest) (*models.Payment, error)
+	Capture(paymentId string) (*models.Payment, error)
+	Refund(paymentId string, amount float64) (*models.Payment, error)
+	VerifyWebhook(payload []byte, signature string) (*models.PaymentEvent, error)
+}
@@ -0,0 +1,505 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// allowedSchemes are the URL schemes links may use; images may only use the
+// ones that are true. Relative URLs have no scheme and are always allowed.
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": false,
+}
+
+// renderInline renders the text of a block: code spans, emphasis, links,
+// images, footnote references and line breaks. Everything else is escaped.
+func (r *renderer) renderInline(text string) string {
+	var output strings.Builder
+	r.renderSpan(&output, indexInline(text), 0, len(text))
+	return output.String()
+}
+
+// renderSpan renders text[from:to]. Emphasis and link labels are rendered by
+// calling it again on their part of the same text, so every lookup goes
+// through the index built once for the whole block.
+func (r *renderer) renderSpan(output *strings.Builder, in *inlineText, from int, to int) {
+	text := in.text
+
+	for i := from; i < to; {
+		character := text[i]
+
+		switch {
+		case character == '\\' && i+1 < to && text[i+1] == '\n':
+			output.WriteString("<br />\n")
+			i += 2
+
+		case character == '\\' && i+1 < to && isPunctuation(text[i+1]):
+			output.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+
+		case character == '`':
+			i = r.renderCodeSpan(output, in, i, to)
+
+		case character == '!' && i+1 < to && text[i+1] == '[':
+			if end, ok := r.renderImage(output, in, i, to); ok {
+				i = end
+			} else {
+				output.WriteString("!")
+				i++
+			}
+
+		case character == '[' && i+1 < to && text[i+1] == '^':
+			if end, ok := r.renderFootnoteReference(output, in, i, to); ok {
+				i = end
+			} else {
+				output.WriteString("[")
+				i++
+			}
+
+		case character == '[':
+			if end, ok := r.renderLink(output, in, i, to); ok {
+				i = end
+			} else {
+				output.WriteString("[")
+				i++
+			}
+
+		case character == '<':
+			if end, ok := renderAutolink(output, in, i, to); ok {
+				i = end
+			} else {
+				output.WriteString("&lt;")
+				i++
+			}
+
+		case character == '*' || character == '_':
+			if end, ok := r.renderEmphasis(output, in, i, to); ok {
+				i = end
+			} else {
+				run := delimiterRun(text, i, to)
+				output.WriteString(text[i : i+run])
+				i += run
+			}
+
+		case character == '\n':
+			output.WriteString("\n")
+			i++
+
+		default:
+			end := i + 1
+			for end < to && !strings.ContainsRune("\\`![<*_\n", rune(text[end])) {
+				end++
+			}
+
+			chunk := text[i:end]
+			// Two spaces at the end of a line break it.
+			if end < to && text[end] == '\n' && strings.HasSuffix(chunk, "  ") {
+				output.WriteString(html.EscapeString(strings.TrimRight(chunk, " ")))
+				output.WriteString("<br />")
+			} else {
+				output.WriteString(html.EscapeString(chunk))
+			}
+			i = end
+		}
+	}
+}
+
+// renderCodeSpan renders the code span opening at text[start], or the run of
+// backticks as is when nothing closes it.
+func (r *renderer) renderCodeSpan(output *strings.Builder, in *inlineText, start int, to int) int {
+	text := in.text
+	run := delimiterRun(text, start, to)
+	fence := text[start : start+run]
+
+	// Only a run of exactly as many backticks closes the span.
+	closing := nextPosition(in.codeRuns[run], start+run)
+	if closing < 0 || closing+run > to {
+		output.WriteString(fence)
+		return start + run
+	}
+
+	code := strings.ReplaceAll(text[start+run:closing], "\n", " ")
+	if len(code) > 1 && strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "" {
+		code = code[1 : len(code)-1]
+	}
+	fmt.Fprintf(output, "<code>%s</code>", html.EscapeString(code))
+	return closing + run
+}
+
+// renderImage renders the image at text[start]. Images with a URL that is not
+// allowed are rendered as their description.
+func (r *renderer) renderImage(output *strings.Builder, in *inlineText, start int, to int) (int, bool) {
+	label, destination, title, end, ok := in.parseLink(start+1, to)
+	if !ok {
+		return 0, false
+	}
+
+	source, allowed := safeURL(destination, true)
+	if !allowed {
+		output.WriteString(html.EscapeString(label))
+		return end, true
+	}
+
+	fmt.Fprintf(output, `<img src="%s" alt="%s"`, html.EscapeString(source), html.EscapeString(label))
+	if title != "" {
+		fmt.Fprintf(output, ` title="%s"`, html.EscapeString(title))
+	}
+	output.WriteString(" />")
+	return end, true
+}
+
+// renderLink renders the link at text[start]. Links starting with "#" go to
+// other sections through Options.SectionLink; those and links with a URL that
+// is not allowed are rendered as their text when they cannot be followed.
+func (r *renderer) renderLink(output *strings.Builder, in *inlineText, start int, to int) (int, bool) {
+	label, destination, title, end, ok := in.parseLink(start, to)
+	if !ok {
+		return 0, false
+	}
+
+	var content strings.Builder
+	r.renderSpan(&content, in, start+1, start+1+len(label))
+
+	var href string
+	if strings.HasPrefix(destination, "#") {
+		if r.options.SectionLink != nil {
+			href, ok = r.options.SectionLink(destination[1:])
+		} else {
+			ok = false
+		}
+	} else {
+		href, ok = safeURL(destination, false)
+	}
+
+	if !ok {
+		output.WriteString(content.String())
+		return end, true
+	}
+
+	fmt.Fprintf(output, `<a href="%s"`, html.EscapeString(href))
+	if title != "" {
+		fmt.Fprintf(output, ` title="%s"`, html.EscapeString(title))
+	}
+	fmt.Fprintf(output, ">%s</a>", content.String())
+	return end, true
+}
+
+// renderFootnoteReference renders a reference to a defined footnote at
+// text[start], numbering footnotes in the order they are first referenced.
+func (r *renderer) renderFootnoteReference(output *strings.Builder, in *inlineText, start int, to int) (int, bool) {
+	closing := nextPosition(in.closingBrackets, start)
+	if closing < 0 || closing >= to {
+		return 0, false
+	}
+
+	label := in.text[start+2 : closing]
+	if _, defined := r.footnotes[label]; !defined {
+		return 0, false
+	}
+
+	number, referenced := r.numbers[label]
+	if !referenced {
+		r.referenced = append(r.referenced, label)
+		number = len(r.referenced)
+		r.numbers[label] = number
+
+		// Only the first reference gets an id, for the link back to it.
+		fmt.Fprintf(output, `<sup class="footnote-ref" id="%s">`, r.referenceId(number))
+	} else {
+		output.WriteString(`<sup class="footnote-ref">`)
+	}
+	fmt.Fprintf(output, `<a href="#%s">%d</a></sup>`, r.footnoteId(number), number)
+
+	return closing + 1, true
+}
+
+// renderEmphasis renders the emphasis opening at text[start]: one delimiter
+// for <em>, two for <strong>. Underscores inside words are left as text.
+func (r *renderer) renderEmphasis(output *strings.Builder, in *inlineText, start int, to int) (int, bool) {
+	text := in.text
+	delimiter := text[start]
+	run := delimiterRun(text, start, to)
+	if run > 2 {
+		run = 2
+	}
+
+	opening := text[start : start+run]
+	after := start + run
+	if after >= to || isSpace(text[after]) {
+		return 0, false
+	}
+	if delimiter == '_' && start > 0 && isWordCharacter(text[start-1]) {
+		return 0, false
+	}
+
+	closing := nextPosition(in.emphasisClosers[opening], after+1)
+	if closing < 0 || closing+run > to {
+		return 0, false
+	}
+
+	tag := "em"
+	if run == 2 {
+		tag = "strong"
+	}
+	fmt.Fprintf(output, "<%s>", tag)
+	r.renderSpan(output, in, after, closing)
+	fmt.Fprintf(output, "</%s>", tag)
+	return closing + run, true
+}
+
+// renderAutolink renders a URL written between angle brackets as a link to
+// itself.
+func renderAutolink(output *strings.Builder, in *inlineText, start int, to int) (int, bool) {
+	closing := nextPosition(in.closingAngles, start)
+	if closing < 0 || closing >= to {
+		return 0, false
+	}
+
+	destination := in.text[start+1 : closing]
+	if destination == "" || strings.ContainsAny(destination, " \t\n<") || !strings.Contains(destination, ":") {
+		return 0, false
+	}
+
+	href, ok := safeURL(destination, false)
+	if !ok {
+		return 0, false
+	}
+
+	fmt.Fprintf(output, `<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(destination))
+	return closing + 1, true
+}
+
+// inlineText is the text of a block together with where every construct that
+// has to be closed may close. It is built in one pass, so rendering stays
+// linear however many delimiters, brackets or backticks are left open.
+type inlineText struct {
+	text string
+	// matches holds, for every unescaped "[" and "(", the index of the
+	// bracket that closes it, or -1.
+	matches []int
+	// emphasisClosers lists, for each opening delimiter, the positions where
+	// it may close.
+	emphasisClosers map[string][]int
+	// codeRuns lists the positions of the runs of backticks of each length.
+	codeRuns        map[int][]int
+	closingBrackets []int
+	closingAngles   []int
+	spaces          []span
+}
+
+// span is text[start:end].
+type span struct {
+	start int
+	end   int
+}
+
+func indexInline(text string) *inlineText {
+	in := &inlineText{
+		text:            text,
+		matches:         make([]int, len(text)),
+		emphasisClosers: map[string][]int{},
+		codeRuns:        map[int][]int{},
+	}
+
+	for i := range in.matches {
+		in.matches[i] = -1
+	}
+
+	var brackets, parentheses []int
+	for i := 0; i < len(text); i++ {
+		character := text[i]
+
+		switch {
+		case character == '\\' && i+1 < len(text) && isPunctuation(text[i+1]):
+			i++
+		case character == '[':
+			brackets = append(brackets, i)
+		case character == '(':
+			parentheses = append(parentheses, i)
+		case character == ']':
+			in.closingBrackets = append(in.closingBrackets, i)
+			if len(brackets) > 0 {
+				in.matches[brackets[len(brackets)-1]] = i
+				brackets = brackets[:len(brackets)-1]
+			}
+		case character == ')':
+			if len(parentheses) > 0 {
+				in.matches[parentheses[len(parentheses)-1]] = i
+				parentheses = parentheses[:len(parentheses)-1]
+			}
+		case character == '>':
+			in.closingAngles = append(in.closingAngles, i)
+		case character == '*' || character == '_':
+			run := delimiterRun(text, i, len(text))
+			in.indexEmphasisClosers(i, run)
+			i += run - 1
+		}
+	}
+
+	for i := 0; i < len(text); {
+		end := i + 1
+		if text[i] == '`' {
+			run := delimiterRun(text, i, len(text))
+			in.codeRuns[run] = append(in.codeRuns[run], i)
+			end = i + run
+		} else if isSpace(text[i]) {
+			for end < len(text) && isSpace(text[end]) {
+				end++
+			}
+			in.spaces = append(in.spaces, span{i, end})
+		}
+		i = end
+	}
+
+	return in
+}
+
+// indexEmphasisClosers records where the run of delimiters at
+// text[start:start+run] may close emphasis when it follows text. A double
+// delimiter closes on the start of the run. A single one closes on a run of
+// its own, or on the last of three or more after a strong emphasis inside it,
+// but not on a double one, which belongs to a strong emphasis inside it.
+func (in *inlineText) indexEmphasisClosers(start int, run int) {
+	text := in.text
+	if start == 0 || isSpace(text[start-1]) {
+		return
+	}
+
+	closes := func(end int) bool {
+		return text[start] != '_' || end >= len(text) || !isWordCharacter(text[end])
+	}
+
+	if run >= 2 && closes(start+2) {
+		opening := text[start : start+2]
+		in.emphasisClosers[opening] = append(in.emphasisClosers[opening], start)
+	}
+
+	if run != 2 && closes(start+run) {
+		opening := text[start : start+1]
+		in.emphasisClosers[opening] = append(in.emphasisClosers[opening], start+run-1)
+	}
+}
+
+// parseLink reads "[label](destination "title")" starting at the bracket at
+// text[start] and returns the index after it.
+func (in *inlineText) parseLink(start int, to int) (label string, destination string, title string, end int, ok bool) {
+	text := in.text
+
+	closing := in.matches[start]
+	if closing < 0 || closing+1 >= to || text[closing+1] != '(' {
+		return "", "", "", 0, false
+	}
+
+	end = in.matches[closing+1]
+	if end < 0 || end >= to {
+		return "", "", "", 0, false
+	}
+
+	targetStart := in.skipSpace(closing + 2)
+	targetEnd := end
+	for targetEnd > targetStart && isSpace(text[targetEnd-1]) {
+		targetEnd--
+	}
+
+	destinationEnd := in.nextSpace(targetStart)
+	if destinationEnd < targetEnd {
+		titleStart := in.skipSpace(destinationEnd)
+		quote := text[titleStart]
+		if (quote != '"' && quote != '\'') || targetEnd-1 <= titleStart || text[targetEnd-1] != quote {
+			return "", "", "", 0, false
+		}
+		title = text[titleStart+1 : targetEnd-1]
+	} else {
+		destinationEnd = targetEnd
+	}
+
+	destination = strings.TrimSuffix(strings.TrimPrefix(text[targetStart:destinationEnd], "<"), ">")
+	return text[start+1 : closing], destination, title, end + 1, true
+}
+
+// nextSpace returns the index of the first whitespace at or after position,
+// or the length of the text.
+func (in *inlineText) nextSpace(position int) int {
+	found := sort.Search(len(in.spaces), func(i int) bool { return in.spaces[i].end > position })
+	if found == len(in.spaces) {
+		return len(in.text)
+	}
+	if in.spaces[found].start > position {
+		return in.spaces[found].start
+	}
+	return position
+}
+
+// skipSpace returns the index of the first character at or after position
+// that is not whitespace, or the length of the text.
+func (in *inlineText) skipSpace(position int) int {
+	found := sort.Search(len(in.spaces), func(i int) bool { return in.spaces[i].end > position })
+	if found < len(in.spaces) && in.spaces[found].start <= position {
+		return in.spaces[found].end
+	}
+	return position
+}
+
+// nextPosition returns the first of the sorted positions at or after from, or
+// -1.
+func nextPosition(positions []int, from int) int {
+	found := sort.SearchInts(positions, from)
+	if found == len(positions) {
+		return -1
+	}
+	return positions[found]
+}
+
+// safeURL checks the scheme of a URL against allowedSchemes. Browsers ignore
+// whitespace and control characters inside schemes, so they are ignored here
+// too before looking for one.
+func safeURL(raw string, image bool) (string, bool) {
+	url := strings.TrimSpace(raw)
+	if url == "" {
+		return "", false
+	}
+
+	scheme := strings.Map(func(character rune) rune {
+		if unicode.IsSpace(character) || unicode.IsControl(character) {
+			return -1
+		}
+		return unicode.ToLower(character)
+	}, url)
+
+	colon := strings.IndexByte(scheme, ':')
+	if colon < 0 || strings.ContainsAny(scheme[:colon], "/?#") {
+		return url, true
+	}
+
+	allowedForImages, allowed := allowedSchemes[scheme[:colon]]
+	if !allowed || (image && !allowedForImages) {
+		return "", false
+	}
+
+	return url, true
+}
+
+func delimiterRun(text string, start int, to int) int {
+	run := 0
+	for start+run < to && text[start+run] == text[start] {
+		run++
+	}
+	return run
+}
+
+func isPunctuation(character byte) bool {
+	return (character < 0x80 && unicode.IsPunct(rune(character))) || strings.IndexByte("$+<=>^`|~", character) >= 0
+}
+
+func isSpace(character byte) bool {
+	return character == ' ' || character == '\t' || character == '\n' || character == '\r' || character == '\f' || character == '\v'
+}
+
+func isWordCharacter(character byte) bool {
+	return character >= 0x80 || unicode.IsLetter(rune(character)) || unicode.IsDigit(rune(character))
+}
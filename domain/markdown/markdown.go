@@ -0,0 +1,381 @@
+// Package markdown renders the Markdown sections are written in to HTML that
+// is safe to show as is. Raw HTML in the source is escaped, never passed
+// through, and links and images only keep http, https, mailto and relative
+// URLs. The output is also well-formed XHTML so it can go into EPUB files.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Options changes how links between sections and footnote ids are written.
+type Options struct {
+	// IdPrefix starts the id of every footnote, so several sections rendered
+	// into the same page do not clash.
+	IdPrefix string
+	// SectionLink resolves the target of a link starting with "#", without
+	// the "#", to the href of a section. Links it does not resolve are
+	// rendered as their text.
+	SectionLink func(target string) (string, bool)
+}
+
+var (
+	headingPattern     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	rulePattern        = regexp.MustCompile(`^ {0,3}([-*_])(?:[ \t]*([-*_]))+[ \t]*$`)
+	fencePattern       = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	bulletPattern      = regexp.MustCompile(`^( {0,3})([-*+])([ \t]+|$)`)
+	orderedPattern     = regexp.MustCompile(`^( {0,3})(\d{1,9})([.)])([ \t]+|$)`)
+	quotePattern       = regexp.MustCompile(`^ {0,3}> ?`)
+	footnotePattern    = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:[ \t]*(.*)$`)
+	languagePattern    = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+	continuationIndent = "    "
+)
+
+type renderer struct {
+	options   Options
+	footnotes map[string]string
+	// referenced lists the footnotes in the order they are first referenced,
+	// which is also their number.
+	referenced []string
+	numbers    map[string]int
+}
+
+// Render renders Markdown source to HTML.
+func Render(source string, options Options) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	r := &renderer{
+		options:   options,
+		footnotes: map[string]string{},
+		numbers:   map[string]int{},
+	}
+	r.collectFootnotes(lines)
+
+	var output strings.Builder
+	r.renderBlocks(&output, lines)
+	r.renderFootnotes(&output)
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// Slug turns a section title into the target other sections link to it by,
+// so "Getting Started" is linked as "#getting-started".
+func Slug(title string) string {
+	var slug strings.Builder
+	dash := false
+	for _, character := range strings.ToLower(title) {
+		if ('a' <= character && character <= 'z') || ('0' <= character && character <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(character)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return slug.String()
+}
+
+// collectFootnotes reads the footnote definitions outside code blocks before
+// rendering, since they may come after the text that references them.
+func (r *renderer) collectFootnotes(lines []string) {
+	var fence string
+	for i := 0; i < len(lines); i++ {
+		if fence != "" {
+			if closesFence(lines[i], fence) {
+				fence = ""
+			}
+			continue
+		}
+
+		if match := fencePattern.FindStringSubmatch(lines[i]); match != nil {
+			fence = match[2]
+			continue
+		}
+
+		match := footnotePattern.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+
+		text := []string{match[2]}
+		for i+1 < len(lines) && strings.HasPrefix(expandTabs(lines[i+1]), continuationIndent) {
+			i++
+			text = append(text, strings.TrimSpace(lines[i]))
+		}
+
+		if _, defined := r.footnotes[match[1]]; !defined {
+			r.footnotes[match[1]] = strings.Join(text, "\n")
+		}
+	}
+}
+
+func (r *renderer) renderBlocks(output *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			i = r.renderCode(output, lines, i)
+
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			level := len(match[1])
+			fmt.Fprintf(output, "<h%d>%s</h%d>\n", level, r.renderInline(match[2]), level)
+			i++
+
+		case isRule(line):
+			output.WriteString("<hr />\n")
+			i++
+
+		case footnotePattern.MatchString(line):
+			i++
+			for i < len(lines) && strings.HasPrefix(expandTabs(lines[i]), continuationIndent) {
+				i++
+			}
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for i < len(lines) && quotePattern.MatchString(lines[i]) {
+				quoted = append(quoted, quotePattern.ReplaceAllString(lines[i], ""))
+				i++
+			}
+
+			output.WriteString("<blockquote>\n")
+			r.renderBlocks(output, quoted)
+			output.WriteString("</blockquote>\n")
+
+		case bulletPattern.MatchString(line) || orderedPattern.MatchString(line):
+			i = r.renderList(output, lines, i)
+
+		default:
+			paragraph := []string{strings.TrimLeft(line, " \t")}
+			for i++; i < len(lines) && !startsBlock(lines[i]); i++ {
+				paragraph = append(paragraph, strings.TrimLeft(lines[i], " \t"))
+			}
+
+			text := strings.TrimRight(strings.Join(paragraph, "\n"), " \t")
+			fmt.Fprintf(output, "<p>%s</p>\n", r.renderInline(text))
+		}
+	}
+}
+
+// renderCode renders the fenced code block starting at lines[start] and
+// returns the line after it. A block left open runs to the end of the text.
+func (r *renderer) renderCode(output *strings.Builder, lines []string, start int) int {
+	match := fencePattern.FindStringSubmatch(lines[start])
+	indent, fence := len(match[1]), match[2]
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines) && !closesFence(lines[i], fence); i++ {
+		line := lines[i]
+		for removed := 0; removed < indent && strings.HasPrefix(line, " "); removed++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+
+	output.WriteString("<pre><code")
+	if language := strings.Fields(match[3]); len(language) > 0 && languagePattern.MatchString(language[0]) {
+		fmt.Fprintf(output, ` class="language-%s"`, html.EscapeString(language[0]))
+	}
+	output.WriteString(">")
+	for _, line := range code {
+		output.WriteString(html.EscapeString(line))
+		output.WriteString("\n")
+	}
+	output.WriteString("</code></pre>\n")
+
+	return i + 1
+}
+
+// renderList renders the list starting at lines[start] and returns the line
+// after it. The items of a list all use the same kind of marker; lines
+// indented past the marker belong to the item above them.
+func (r *renderer) renderList(output *strings.Builder, lines []string, start int) int {
+	ordered := orderedPattern.MatchString(lines[start])
+	marker := listMarker(lines[start], ordered)
+	indent := indentation(lines[start])
+
+	// Items indented past the first one are nested in the item above them.
+	startsItem := func(line string) bool {
+		return listMarker(line, ordered) == marker && indentation(line) <= indent+1
+	}
+
+	var items [][]string
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+		if startsItem(line) {
+			items = append(items, []string{strings.TrimSpace(line[listMarkerWidth(line, ordered):])})
+			i++
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			next := i + 1
+			for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+				next++
+			}
+			if next < len(lines) && (startsItem(lines[next]) || isIndented(lines[next])) {
+				items[len(items)-1] = append(items[len(items)-1], "")
+				i = next
+				continue
+			}
+			break
+		}
+
+		if isIndented(line) || !startsBlock(line) {
+			items[len(items)-1] = append(items[len(items)-1], dedent(line))
+			i++
+			continue
+		}
+
+		break
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+
+	output.WriteString("<" + tag)
+	if number := orderedPattern.FindStringSubmatch(lines[start]); ordered && strings.TrimLeft(number[2], "0") != "1" {
+		fmt.Fprintf(output, ` start="%s"`, strings.TrimLeft(number[2], "0"))
+	}
+	output.WriteString(">\n")
+
+	for _, item := range items {
+		var content strings.Builder
+		r.renderBlocks(&content, item)
+
+		rendered := strings.TrimSuffix(content.String(), "\n")
+		if strings.HasPrefix(rendered, "<p>") && strings.HasSuffix(rendered, "</p>") && strings.Count(rendered, "<p>") == 1 {
+			rendered = strings.TrimSuffix(strings.TrimPrefix(rendered, "<p>"), "</p>")
+		}
+		fmt.Fprintf(output, "<li>%s</li>\n", rendered)
+	}
+
+	output.WriteString("</" + tag + ">\n")
+
+	return i
+}
+
+func (r *renderer) renderFootnotes(output *strings.Builder) {
+	if len(r.referenced) == 0 {
+		return
+	}
+
+	var items strings.Builder
+	// Footnotes may reference footnotes not referenced yet, which adds them
+	// to the end of the list.
+	for position := 0; position < len(r.referenced); position++ {
+		number := position + 1
+		text := r.renderInline(r.footnotes[r.referenced[position]])
+		fmt.Fprintf(&items, "<li id=\"%s\">%s <a href=\"#%s\" class=\"footnote-back\">&#8617;</a></li>\n",
+			r.footnoteId(number), text, r.referenceId(number))
+	}
+
+	output.WriteString("<section class=\"footnotes\">\n<ol>\n")
+	output.WriteString(items.String())
+	output.WriteString("</ol>\n</section>\n")
+}
+
+func (r *renderer) footnoteId(number int) string {
+	return html.EscapeString(fmt.Sprintf("%sfn-%d", r.options.IdPrefix, number))
+}
+
+func (r *renderer) referenceId(number int) string {
+	return html.EscapeString(fmt.Sprintf("%sfnref-%d", r.options.IdPrefix, number))
+}
+
+func closesFence(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(line)-len(strings.TrimLeft(line, " ")) <= 3 &&
+		strings.HasPrefix(trimmed, fence) &&
+		strings.Trim(trimmed, fence[:1]) == ""
+}
+
+func isRule(line string) bool {
+	match := rulePattern.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+
+	// Every mark of a rule is the same character and there are at least three.
+	marks := strings.Join(strings.Fields(line), "")
+	return len(marks) >= 3 && strings.Trim(marks, match[1]) == ""
+}
+
+// startsBlock reports whether line ends the paragraph before it.
+func startsBlock(line string) bool {
+	return strings.TrimSpace(line) == "" ||
+		fencePattern.MatchString(line) ||
+		headingPattern.MatchString(line) ||
+		isRule(line) ||
+		quotePattern.MatchString(line) ||
+		bulletPattern.MatchString(line) ||
+		orderedPattern.MatchString(line) ||
+		footnotePattern.MatchString(line)
+}
+
+// listMarker identifies the kind of list item line starts, or returns an
+// empty string when it does not start one. Ordered items are told apart by
+// their delimiter and bullets by their character.
+func listMarker(line string, ordered bool) string {
+	if ordered {
+		if match := orderedPattern.FindStringSubmatch(line); match != nil {
+			return match[3]
+		}
+		return ""
+	}
+
+	if isRule(line) {
+		return ""
+	}
+
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		return match[2]
+	}
+	return ""
+}
+
+func listMarkerWidth(line string, ordered bool) int {
+	if ordered {
+		return len(orderedPattern.FindString(line))
+	}
+
+	return len(bulletPattern.FindString(line))
+}
+
+func indentation(line string) int {
+	expanded := expandTabs(line)
+	return len(expanded) - len(strings.TrimLeft(expanded, " "))
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(expandTabs(line), "  ")
+}
+
+// dedent removes the indentation that places a line inside a list item.
+func dedent(line string) string {
+	line = expandTabs(line)
+	for removed := 0; removed < len(continuationIndent) && strings.HasPrefix(line, " "); removed++ {
+		line = line[1:]
+	}
+	return line
+}
+
+func expandTabs(line string) string {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	return strings.ReplaceAll(line[:indent], "\t", continuationIndent) + line[indent:]
+}
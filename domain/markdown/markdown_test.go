@@ -0,0 +1,162 @@
+package markdown
+
+import (
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sectionLinks(target string) (string, bool) {
+	if target == "getting-started" || target == "42" {
+		return "#section-42", true
+	}
+	return "", false
+}
+
+// requireWellFormed checks the HTML can be read as XML, as EPUB files need.
+func requireWellFormed(t *testing.T, rendered string) {
+	decoder := xml.NewDecoder(strings.NewReader("<div>" + rendered + "</div>"))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		require.Nil(t, err, rendered)
+	}
+}
+
+func TestRenderBlocks(t *testing.T) {
+	rendered := Render("# Title\n\nFirst line  \nsecond line\n\n> quoted\n\n- one\n- two\n  - nested\n\n3. three\n4. four\n\n---", Options{})
+
+	assert.Equal(t, "<h1>Title</h1>\n"+
+		"<p>First line<br />\nsecond line</p>\n"+
+		"<blockquote>\n<p>quoted</p>\n</blockquote>\n"+
+		"<ul>\n<li>one</li>\n<li><p>two</p>\n<ul>\n<li>nested</li>\n</ul></li>\n</ul>\n"+
+		"<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"+
+		"<hr />", rendered)
+	requireWellFormed(t, rendered)
+}
+
+func TestRenderInline(t *testing.T) {
+	rendered := Render("Some **bold**, *em*, snake_case_name and `a < b` \\*stars\\*.", Options{})
+
+	assert.Equal(t, "<p>Some <strong>bold</strong>, <em>em</em>, snake_case_name and <code>a &lt; b</code> *stars*.</p>", rendered)
+}
+
+func TestRenderNestedEmphasis(t *testing.T) {
+	rendered := Render("*a **b** c* and *d **e***", Options{})
+
+	assert.Equal(t, "<p><em>a <strong>b</strong> c</em> and <em>d <strong>e</strong></em></p>", rendered)
+}
+
+func TestRenderUnclosedInlineIsLinear(t *testing.T) {
+	for _, repeated := range []string{"*a ", "_a ", "**a ", "[", "[a](", "[a]([a](x y", "`", "``a", "<a", "[^a"} {
+		source := strings.Repeat(repeated, 72*1024/len(repeated))
+
+		started := time.Now()
+		Render(source, Options{})
+
+		assert.Less(t, time.Since(started), time.Second, repeated)
+	}
+}
+
+func TestRenderCodeBlocks(t *testing.T) {
+	rendered := Render("```go\nfunc main() {\n\tfmt.Println(\"<b>\")\n}\n```\n\n~~~\n# not a heading\n~~~", Options{})
+
+	assert.Equal(t, "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(&#34;&lt;b&gt;&#34;)\n}\n</code></pre>\n"+
+		"<pre><code># not a heading\n</code></pre>", rendered)
+	requireWellFormed(t, rendered)
+}
+
+func TestRenderCodeBlocksDropUnsafeLanguages(t *testing.T) {
+	rendered := Render("```go\"onmouseover=\"alert(1)\nx\n```", Options{})
+
+	assert.Equal(t, "<pre><code>x\n</code></pre>", rendered)
+}
+
+func TestRenderFootnotes(t *testing.T) {
+	rendered := Render("Text[^b] and more[^a], again[^b] and [^missing].\n\n[^a]: First note.\n[^b]: Second note\n    on two lines[^a].", Options{IdPrefix: "s1-"})
+
+	assert.Equal(t, "<p>Text<sup class=\"footnote-ref\" id=\"s1-fnref-1\"><a href=\"#s1-fn-1\">1</a></sup>"+
+		" and more<sup class=\"footnote-ref\" id=\"s1-fnref-2\"><a href=\"#s1-fn-2\">2</a></sup>,"+
+		" again<sup class=\"footnote-ref\"><a href=\"#s1-fn-1\">1</a></sup> and [^missing].</p>\n"+
+		"<section class=\"footnotes\">\n<ol>\n"+
+		"<li id=\"s1-fn-1\">Second note\non two lines<sup class=\"footnote-ref\"><a href=\"#s1-fn-2\">2</a></sup>. <a href=\"#s1-fnref-1\" class=\"footnote-back\">&#8617;</a></li>\n"+
+		"<li id=\"s1-fn-2\">First note. <a href=\"#s1-fnref-2\" class=\"footnote-back\">&#8617;</a></li>\n"+
+		"</ol>\n</section>", rendered)
+	requireWellFormed(t, rendered)
+}
+
+func TestRenderFootnotesIgnoresDefinitionsInCode(t *testing.T) {
+	rendered := Render("See[^a].\n\n```\n[^a]: not a note\n```", Options{})
+
+	assert.Equal(t, "<p>See[^a].</p>\n<pre><code>[^a]: not a note\n</code></pre>", rendered)
+}
+
+func TestRenderLinksAndImages(t *testing.T) {
+	rendered := Render("[Site](https://example.com \"Home\") ![A cat](/images/cat.png) <https://example.com/a?b=1&c=2> [Mail](mailto:ana@example.com)", Options{})
+
+	assert.Equal(t, "<p><a href=\"https://example.com\" title=\"Home\">Site</a>"+
+		" <img src=\"/images/cat.png\" alt=\"A cat\" />"+
+		" <a href=\"https://example.com/a?b=1&amp;c=2\">https://example.com/a?b=1&amp;c=2</a>"+
+		" <a href=\"mailto:ana@example.com\">Mail</a></p>", rendered)
+	requireWellFormed(t, rendered)
+}
+
+func TestRenderSectionLinks(t *testing.T) {
+	rendered := Render("See [the start](#getting-started), [by id](#42) and [nowhere](#missing).", Options{SectionLink: sectionLinks})
+
+	assert.Equal(t, "<p>See <a href=\"#section-42\">the start</a>, <a href=\"#section-42\">by id</a> and nowhere.</p>", rendered)
+}
+
+func TestRenderSectionLinksWithoutResolver(t *testing.T) {
+	rendered := Render("See [the start](#getting-started).", Options{})
+
+	assert.Equal(t, "<p>See the start.</p>", rendered)
+}
+
+func TestRenderEscapesHtml(t *testing.T) {
+	rendered := Render("<script>alert(1)</script>\n\n<img src=x onerror=alert(1)>\n\n# <b>Bold</b> & \"quoted\"", Options{})
+
+	assert.Equal(t, "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"+
+		"<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"+
+		"<h1>&lt;b&gt;Bold&lt;/b&gt; &amp; &#34;quoted&#34;</h1>", rendered)
+}
+
+func TestRenderDropsUnsafeUrls(t *testing.T) {
+	for _, source := range []string{
+		"[click](javascript:alert(1))",
+		"[click](JavaScript:alert(1))",
+		"[click](<java\tscript:alert(1)>)",
+		"[click](vbscript:msgbox(1))",
+		"[click](data:text/html;base64,PHNjcmlwdD4=)",
+		"![click](data:image/svg+xml;base64,PHN2Zz4=)",
+		"![click](mailto:ana@example.com)",
+	} {
+		rendered := Render(source, Options{})
+
+		assert.NotContains(t, rendered, "href", source)
+		assert.NotContains(t, rendered, "src", source)
+		assert.Contains(t, rendered, "click", source)
+	}
+
+	assert.Equal(t, "<p>&lt;javascript:alert(1)&gt;</p>", Render("<javascript:alert(1)>", Options{}))
+}
+
+func TestRenderEscapesAttributes(t *testing.T) {
+	rendered := Render("![\" onerror=\"alert(1)](/a.png) [x](/a\"onclick=\"b)", Options{})
+
+	assert.NotContains(t, rendered, "\" onerror")
+	assert.NotContains(t, rendered, "\"onclick")
+	requireWellFormed(t, rendered)
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "getting-started", Slug("Getting Started"))
+	assert.Equal(t, "go-you-2", Slug("  Go & You, 2! "))
+	assert.Equal(t, "", Slug("¿?"))
+}
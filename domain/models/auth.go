@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type TokenType string
+
+const (
+	AccessTokenType  TokenType = "access"
+	RefreshTokenType TokenType = "refresh"
+)
+
+type TokenClaims struct {
+	Id        string    `json:"jti"`
+	Subject   string    `json:"sub"`
+	Type      TokenType `json:"type"`
+	IssuedAt  int64     `json:"iat"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+type TokenRefresh struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RevokedToken struct {
+	Id        string    `json:"id" bson:"_id"`
+	UserId    string    `json:"userId" bson:"userId"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
@@ -11,6 +11,14 @@ const (
 	StateClosed      StateBook = "CLOSED"
 )
 
+// BookStateTransition records a change of state, who made it and when.
+type BookStateTransition struct {
+	From      StateBook `json:"from" bson:"from"`
+	To        StateBook `json:"to" bson:"to"`
+	ActorId   string    `json:"actorId" bson:"actorId"`
+	ChangedAt time.Time `json:"changedAt" bson:"changedAt"`
+}
+
 type Index struct {
 	Chapter  string             `json:"chapter" bson:"chapter"`
 	Sections []BookSectionIndex `json:"sections" bson:"sections"`
@@ -29,19 +37,25 @@ type BookIndex struct {
 	Content []BookContent `json:"content" bson:"content"`
 }
 
+// Author lists a writer of the book. RoyaltyShare is the author's weight in
+// the royalty split; when no author of the book has one, it is split evenly.
 type Author struct {
-	AuthorId string `json:"authorId" bson:"authorId"`
+	AuthorId     string  `json:"authorId" bson:"authorId" validate:"required"`
+	RoyaltyShare float64 `json:"royaltyShare,omitempty" bson:"royaltyShare,omitempty" validate:"min=0"`
 }
 
 type ReadingOption struct {
-	Option      string `json:"option" bson:"option"`
-	Description string `json:"description" bson:"description"`
+	Option      string `json:"option" bson:"option" validate:"required,max=50"`
+	Description string `json:"description" bson:"description" validate:"max=500"`
 }
 
+// BookSection is written in Markdown. Html caches the sanitized rendering of
+// Content, made whenever the section is saved.
 type BookSection struct {
 	Id      string `json:"id" bson:"_id"`
 	Title   string `json:"title" bson:"title"`
 	Content string `json:"content" bson:"content"`
+	Html    string `json:"html" bson:"html"`
 }
 
 type BookSectionId struct {
@@ -54,22 +68,34 @@ type BookContent struct {
 }
 
 type Book struct {
-	Id             string          `json:"id" bson:"_id"`
-	Authors        []Author        `json:"authors" bson:"authors"`
-	AuthorCount    int             `json:"authorCount" bson:"authorCount"`
-	Title          string          `json:"title" bson:"title"`
-	AboutTheBook   string          `json:"aboutTheBook" bson:"aboutTheBook"`
-	Description    string          `json:"description" bson:"description"`
-	Content        []BookContent   `json:"content" bson:"content"`
-	CoverImage     string          `json:"coverImage" bson:"coverImage"`
-	MinimumPrice   float64         `json:"minimumPrice" bson:"minimumPrice"`
-	SuggestedPrice float64         `json:"suggestedPrice" bson:"suggestedPrice"`
-	Reviews        int             `json:"reviews" bson:"reviews"`
-	State          StateBook       `json:"state" bson:"state"`
-	CreatedAt      time.Time       `json:"createdAt" bson:"createdAt"`
-	UpdatedAt      time.Time       `json:"updatedAt" bson:"updatedAt"`
-	LanguageName   string          `json:"languageName" bson:"languageName"`
-	LanguageCode   string          `json:"languageCode" bson:"languageCode"`
-	Categories     []string        `json:"categories" bson:"categories"`
-	ReadingOptions []ReadingOption `json:"readingOptions" bson:"readingOptions"`
+	Id             string                `json:"id" bson:"_id"`
+	Authors        []Author              `json:"authors" bson:"authors"`
+	AuthorCount    int                   `json:"authorCount" bson:"authorCount"`
+	Title          string                `json:"title" bson:"title"`
+	AboutTheBook   string                `json:"aboutTheBook" bson:"aboutTheBook"`
+	Description    string                `json:"description" bson:"description"`
+	Content        []BookContent         `json:"content" bson:"content"`
+	CoverImage     string                `json:"coverImage" bson:"coverImage"`
+	MinimumPrice   float64               `json:"minimumPrice" bson:"minimumPrice"`
+	SuggestedPrice float64               `json:"suggestedPrice" bson:"suggestedPrice"`
+	Reviews        int                   `json:"reviews" bson:"reviews"`
+	Rating         float64               `json:"rating" bson:"rating"`
+	State          StateBook             `json:"state" bson:"state"`
+	CreatedAt      time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt" bson:"updatedAt"`
+	LanguageName   string                `json:"languageName" bson:"languageName"`
+	LanguageCode   string                `json:"languageCode" bson:"languageCode"`
+	Categories     []string              `json:"categories" bson:"categories"`
+	ReadingOptions []ReadingOption       `json:"readingOptions" bson:"readingOptions"`
+	Transitions    []BookStateTransition `json:"transitions" bson:"transitions,omitempty"`
+	// LatestVersion is the number of the last version published and
+	// PublishedVersion the one readers see, which a rollback moves back.
+	// Books published before versions were kept have neither and show their
+	// content to readers as it is.
+	LatestVersion    int `json:"latestVersion" bson:"latestVersion"`
+	PublishedVersion int `json:"publishedVersion" bson:"publishedVersion"`
+	// Version counts the writes to the book, starting at 1. An update only
+	// succeeds while the stored book still has the version it was read at.
+	// Books written before versions were counted have none, which counts as 0.
+	Version int `json:"version" bson:"version"`
 }
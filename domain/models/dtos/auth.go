@@ -0,0 +1,10 @@
+package dtos
+
+// AuthTokensResponseDto is what logging in and refreshing tokens return.
+type AuthTokensResponseDto struct {
+	AccessToken  string           `json:"accessToken"`
+	RefreshToken string           `json:"refreshToken"`
+	TokenType    string           `json:"tokenType"`
+	ExpiresIn    int64            `json:"expiresIn"`
+	User         *UserResponseDto `json:"user"`
+}
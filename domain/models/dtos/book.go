@@ -10,23 +10,159 @@ type BookContentDto struct {
 	Sections []models.BookSection `json:"sections" bson:"sections"`
 }
 
+// BookDto creates a book. Id, AuthorCount, Reviews, State, CreatedAt,
+// UpdatedAt and Version are set by the server and ignored.
 type BookDto struct {
 	Id             string                 `json:"id" bson:"_id"`
-	Authors        []models.Author        `json:"authors"`
+	Authors        []models.Author        `json:"authors" validate:"required"`
 	AuthorCount    int                    `json:"authorCount" bson:"authorCount"`
-	Title          string                 `json:"title" bson:"title"`
-	AboutTheBook   string                 `json:"aboutTheBook" bson:"aboutTheBook"`
-	Description    string                 `json:"description" bson:"description"`
+	Title          string                 `json:"title" bson:"title" validate:"required,max=200"`
+	AboutTheBook   string                 `json:"aboutTheBook" bson:"aboutTheBook" validate:"max=5000"`
+	Description    string                 `json:"description" bson:"description" validate:"max=5000"`
 	Content        []BookContentDto       `json:"content" bson:"content"`
-	CoverImage     string                 `json:"coverImage" bson:"coverImage"`
-	MinimumPrice   float64                `json:"minimumPrice" bson:"minimumPrice"`
-	SuggestedPrice float64                `json:"suggestedPrice" bson:"suggestedPrice"`
+	CoverImage     string                 `json:"coverImage" bson:"coverImage" validate:"url"`
+	MinimumPrice   float64                `json:"minimumPrice" bson:"minimumPrice" validate:"min=0"`
+	SuggestedPrice float64                `json:"suggestedPrice" bson:"suggestedPrice" validate:"min=0"`
 	Reviews        int                    `json:"reviews" bson:"reviews"`
 	State          models.StateBook       `json:"state" bson:"state"`
 	CreatedAt      time.Time              `json:"createdAt" bson:"createdAt"`
 	UpdatedAt      time.Time              `json:"updatedAt" bson:"updatedAt"`
-	LanguageName   string                 `json:"languageName" bson:"languageName"`
-	LanguageCode   string                 `json:"languageCode" bson:"languageCode"`
-	Categories     []string               `json:"categories" bson:"categories"`
+	LanguageName   string                 `json:"languageName" bson:"languageName" validate:"max=50"`
+	LanguageCode   string                 `json:"languageCode" bson:"languageCode" validate:"language"`
+	Categories     []string               `json:"categories" bson:"categories" validate:"max=10"`
 	ReadingOptions []models.ReadingOption `json:"readingOptions" bson:"readingOptions"`
+	Version        int                    `json:"version" bson:"version"`
+}
+
+// UpdateBookDto replaces the details and content of the book with the given
+// id. The fields after ReadingOptions are set by the server; they are
+// accepted so that clients can send back a book they read, and ignored. The
+// version an update expects is sent in the If-Match header instead.
+type UpdateBookDto struct {
+	Id             string                 `json:"id" validate:"required"`
+	Authors        []models.Author        `json:"authors" validate:"required"`
+	Title          string                 `json:"title" validate:"required,max=200"`
+	AboutTheBook   string                 `json:"aboutTheBook" validate:"max=5000"`
+	Description    string                 `json:"description" validate:"max=5000"`
+	Content        []models.BookContent   `json:"content"`
+	CoverImage     string                 `json:"coverImage" validate:"url"`
+	MinimumPrice   float64                `json:"minimumPrice" validate:"min=0"`
+	SuggestedPrice float64                `json:"suggestedPrice" validate:"min=0"`
+	LanguageName   string                 `json:"languageName" validate:"max=50"`
+	LanguageCode   string                 `json:"languageCode" validate:"language"`
+	Categories     []string               `json:"categories" validate:"max=10"`
+	ReadingOptions []models.ReadingOption `json:"readingOptions"`
+
+	AuthorCount      int                          `json:"authorCount"`
+	Reviews          int                          `json:"reviews"`
+	Rating           float64                      `json:"rating"`
+	State            models.StateBook             `json:"state"`
+	CreatedAt        time.Time                    `json:"createdAt"`
+	UpdatedAt        time.Time                    `json:"updatedAt"`
+	Transitions      []models.BookStateTransition `json:"transitions"`
+	LatestVersion    int                          `json:"latestVersion"`
+	PublishedVersion int                          `json:"publishedVersion"`
+	Version          int                          `json:"version"`
+}
+
+// BookResponseDto is a book as the API returns it.
+type BookResponseDto struct {
+	Id               string                       `json:"id"`
+	Authors          []models.Author              `json:"authors"`
+	AuthorCount      int                          `json:"authorCount"`
+	Title            string                       `json:"title"`
+	AboutTheBook     string                       `json:"aboutTheBook"`
+	Description      string                       `json:"description"`
+	Content          []models.BookContent         `json:"content"`
+	CoverImage       string                       `json:"coverImage"`
+	MinimumPrice     float64                      `json:"minimumPrice"`
+	SuggestedPrice   float64                      `json:"suggestedPrice"`
+	Reviews          int                          `json:"reviews"`
+	Rating           float64                      `json:"rating"`
+	State            models.StateBook             `json:"state"`
+	CreatedAt        time.Time                    `json:"createdAt"`
+	UpdatedAt        time.Time                    `json:"updatedAt"`
+	LanguageName     string                       `json:"languageName"`
+	LanguageCode     string                       `json:"languageCode"`
+	Categories       []string                     `json:"categories"`
+	ReadingOptions   []models.ReadingOption       `json:"readingOptions"`
+	Transitions      []models.BookStateTransition `json:"transitions,omitempty"`
+	LatestVersion    int                          `json:"latestVersion"`
+	PublishedVersion int                          `json:"publishedVersion"`
+	Version          int                          `json:"version"`
+}
+
+func (dto *UpdateBookDto) ToBook() *models.Book {
+	return &models.Book{
+		Id:             dto.Id,
+		Authors:        dto.Authors,
+		AuthorCount:    len(dto.Authors),
+		Title:          dto.Title,
+		AboutTheBook:   dto.AboutTheBook,
+		Description:    dto.Description,
+		Content:        dto.Content,
+		CoverImage:     dto.CoverImage,
+		MinimumPrice:   dto.MinimumPrice,
+		SuggestedPrice: dto.SuggestedPrice,
+		LanguageName:   dto.LanguageName,
+		LanguageCode:   dto.LanguageCode,
+		Categories:     dto.Categories,
+		ReadingOptions: dto.ReadingOptions,
+	}
+}
+
+func NewBookResponseDto(book *models.Book) *BookResponseDto {
+	return &BookResponseDto{
+		Id:               book.Id,
+		Authors:          book.Authors,
+		AuthorCount:      book.AuthorCount,
+		Title:            book.Title,
+		AboutTheBook:     book.AboutTheBook,
+		Description:      book.Description,
+		Content:          book.Content,
+		CoverImage:       book.CoverImage,
+		MinimumPrice:     book.MinimumPrice,
+		SuggestedPrice:   book.SuggestedPrice,
+		Reviews:          book.Reviews,
+		Rating:           book.Rating,
+		State:            book.State,
+		CreatedAt:        book.CreatedAt,
+		UpdatedAt:        book.UpdatedAt,
+		LanguageName:     book.LanguageName,
+		LanguageCode:     book.LanguageCode,
+		Categories:       book.Categories,
+		ReadingOptions:   book.ReadingOptions,
+		Transitions:      book.Transitions,
+		LatestVersion:    book.LatestVersion,
+		PublishedVersion: book.PublishedVersion,
+		Version:          book.Version,
+	}
+}
+
+func NewBookResponseDtos(books []models.Book) []BookResponseDto {
+	responses := make([]BookResponseDto, 0, len(books))
+	for i := range books {
+		responses = append(responses, *NewBookResponseDto(&books[i]))
+	}
+
+	return responses
+}
+
+// BookSearchResultDto is a book found by a search, shaped like every other
+// book the API returns, with its relevance score.
+type BookSearchResultDto struct {
+	*BookResponseDto
+	Score float64 `json:"score"`
+}
+
+func NewBookSearchResultDtos(results []models.BookSearchResult) []BookSearchResultDto {
+	responses := make([]BookSearchResultDto, 0, len(results))
+	for i := range results {
+		responses = append(responses, BookSearchResultDto{
+			BookResponseDto: NewBookResponseDto(&results[i].Book),
+			Score:           results[i].Score,
+		})
+	}
+
+	return responses
 }
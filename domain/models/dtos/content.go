@@ -0,0 +1,23 @@
+package dtos
+
+// ChapterDto adds, renames or moves a chapter. Positions are zero based; a
+// nil position appends a new chapter or leaves an existing one in place.
+type ChapterDto struct {
+	Chapter  string `json:"chapter"`
+	Position *int   `json:"position"`
+}
+
+// SectionDto adds a section to a chapter or replaces the title and content of
+// an existing one. Position only applies when adding.
+type SectionDto struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Position *int   `json:"position"`
+}
+
+// SectionMoveDto moves a section to a position of a chapter, which may be the
+// chapter it is already in. A nil position moves it to the end.
+type SectionMoveDto struct {
+	Chapter  int  `json:"chapter"`
+	Position *int `json:"position"`
+}
@@ -0,0 +1,21 @@
+package dtos
+
+import "leanpub-app/domain/models"
+
+// LibraryItemDto is an owned book as listed in the user's library.
+type LibraryItemDto struct {
+	models.Entitlement
+	Book *BookResponseDto `json:"book"`
+}
+
+func NewLibraryItemDtos(items []models.LibraryItem) []LibraryItemDto {
+	responses := make([]LibraryItemDto, 0, len(items))
+	for _, item := range items {
+		responses = append(responses, LibraryItemDto{
+			Entitlement: item.Entitlement,
+			Book:        NewBookResponseDto(item.Book),
+		})
+	}
+
+	return responses
+}
@@ -0,0 +1,11 @@
+package dtos
+
+type CheckoutDto struct {
+	CartId string `json:"cartId"`
+}
+
+// PaymentDto carries the payment provider token for the buyer's payment
+// method.
+type PaymentDto struct {
+	Source string `json:"source"`
+}
@@ -0,0 +1,17 @@
+package dtos
+
+type ProgressDto struct {
+	SectionId string `json:"sectionId"`
+}
+
+type BookmarkDto struct {
+	SectionId string `json:"sectionId"`
+	Note      string `json:"note"`
+}
+
+type HighlightDto struct {
+	SectionId string `json:"sectionId"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Note      string `json:"note"`
+}
@@ -0,0 +1,6 @@
+package dtos
+
+type ReviewDto struct {
+	Rating int    `json:"rating"`
+	Text   string `json:"text"`
+}
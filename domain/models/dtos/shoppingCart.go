@@ -0,0 +1,70 @@
+package dtos
+
+import (
+	"leanpub-app/domain/models"
+	"time"
+)
+
+// CreateShoppingCartDto creates a cart for the caller, or for another user
+// when the caller is an admin. Id, CreatedAt and Version are set by the
+// server; they are accepted and ignored.
+type CreateShoppingCartDto struct {
+	Id        string          `json:"id"`
+	UserId    string          `json:"userId"`
+	Books     []models.BookId `json:"books"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Version   int             `json:"version"`
+}
+
+// UpdateShoppingCartDto replaces the books of the cart with the given id.
+// UserId, CreatedAt and Version are set by the server; they are accepted so
+// that clients can send back a cart they read, and ignored.
+type UpdateShoppingCartDto struct {
+	Id        string          `json:"id" validate:"required"`
+	Books     []models.BookId `json:"books"`
+	UserId    string          `json:"userId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Version   int             `json:"version"`
+}
+
+// ShoppingCartResponseDto is a cart as the API returns it.
+type ShoppingCartResponseDto struct {
+	Id        string          `json:"id"`
+	UserId    string          `json:"userId"`
+	Books     []models.BookId `json:"books"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Version   int             `json:"version"`
+}
+
+func (dto *CreateShoppingCartDto) ToShoppingCart() *models.ShoppingCart {
+	return &models.ShoppingCart{
+		UserId: dto.UserId,
+		Books:  dto.Books,
+	}
+}
+
+func (dto *UpdateShoppingCartDto) ToShoppingCart() *models.ShoppingCart {
+	return &models.ShoppingCart{
+		Id:    dto.Id,
+		Books: dto.Books,
+	}
+}
+
+func NewShoppingCartResponseDto(shoppingCart *models.ShoppingCart) *ShoppingCartResponseDto {
+	return &ShoppingCartResponseDto{
+		Id:        shoppingCart.Id,
+		UserId:    shoppingCart.UserId,
+		Books:     shoppingCart.Books,
+		CreatedAt: shoppingCart.CreatedAt,
+		Version:   shoppingCart.Version,
+	}
+}
+
+func NewShoppingCartResponseDtos(shoppingCarts []models.ShoppingCart) []ShoppingCartResponseDto {
+	responses := make([]ShoppingCartResponseDto, 0, len(shoppingCarts))
+	for i := range shoppingCarts {
+		responses = append(responses, *NewShoppingCartResponseDto(&shoppingCarts[i]))
+	}
+
+	return responses
+}
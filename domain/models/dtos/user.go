@@ -0,0 +1,118 @@
+package dtos
+
+import (
+	"leanpub-app/domain/models"
+	"time"
+)
+
+// CreateUserDto registers a user. IsAuthor, IsAdmin and HasSubscription are
+// only kept when an admin creates the user. Id, CreatedAt, UpdatedAt and Version are set
+// by the server; they are accepted and ignored.
+type CreateUserDto struct {
+	Id              string                 `json:"id"`
+	Name            string                 `json:"name" validate:"max=100"`
+	Password        string                 `json:"password" validate:"required,min=8,max=72,maxbytes=72"`
+	Email           string                 `json:"email" validate:"required,email,max=254"`
+	About           string                 `json:"about" validate:"max=5000"`
+	AvatarUrl       string                 `json:"avatarUrl" validate:"url"`
+	IsAuthor        bool                   `json:"isAuthor"`
+	IsAdmin         bool                   `json:"isAdmin"`
+	HasSubscription bool                   `json:"hasSubscription"`
+	SocialNetworks  []models.SocialNetwork `json:"socialNetworks"`
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       time.Time              `json:"updatedAt"`
+	Version         int                    `json:"version"`
+}
+
+// UpdateUserDto replaces the profile of the user with the given id. An empty
+// password keeps the current one, and IsAuthor, IsAdmin and HasSubscription
+// are only changed by admins.
+type UpdateUserDto struct {
+	Id              string                 `json:"id" validate:"required"`
+	Name            string                 `json:"name" validate:"max=100"`
+	Password        string                 `json:"password" validate:"max=72,maxbytes=72"`
+	Email           string                 `json:"email" validate:"required,email,max=254"`
+	About           string                 `json:"about" validate:"max=5000"`
+	AvatarUrl       string                 `json:"avatarUrl" validate:"url"`
+	IsAuthor        bool                   `json:"isAuthor"`
+	IsAdmin         bool                   `json:"isAdmin"`
+	HasSubscription bool                   `json:"hasSubscription"`
+	SocialNetworks  []models.SocialNetwork `json:"socialNetworks"`
+	// CreatedAt, UpdatedAt and Version are set by the server. They are
+	// accepted so that clients can send back a user they read, and ignored;
+	// the version an update expects is sent in the If-Match header.
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Version   int       `json:"version"`
+}
+
+// UserResponseDto is a user as the API returns it, without its password.
+type UserResponseDto struct {
+	Id              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Email           string                 `json:"email"`
+	About           string                 `json:"about"`
+	AvatarUrl       string                 `json:"avatarUrl"`
+	HasSubscription bool                   `json:"hasSubscription"`
+	IsAuthor        bool                   `json:"isAuthor"`
+	IsAdmin         bool                   `json:"isAdmin"`
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       time.Time              `json:"updatedAt"`
+	SocialNetworks  []models.SocialNetwork `json:"socialNetworks"`
+	Version         int                    `json:"version"`
+}
+
+func (dto *CreateUserDto) ToUser() *models.User {
+	return &models.User{
+		Name:            dto.Name,
+		Password:        dto.Password,
+		Email:           dto.Email,
+		About:           dto.About,
+		AvatarUrl:       dto.AvatarUrl,
+		IsAuthor:        dto.IsAuthor,
+		IsAdmin:         dto.IsAdmin,
+		HasSubscription: dto.HasSubscription,
+		SocialNetworks:  dto.SocialNetworks,
+	}
+}
+
+func (dto *UpdateUserDto) ToUser() *models.User {
+	return &models.User{
+		Id:              dto.Id,
+		Name:            dto.Name,
+		Password:        dto.Password,
+		Email:           dto.Email,
+		About:           dto.About,
+		AvatarUrl:       dto.AvatarUrl,
+		IsAuthor:        dto.IsAuthor,
+		IsAdmin:         dto.IsAdmin,
+		HasSubscription: dto.HasSubscription,
+		SocialNetworks:  dto.SocialNetworks,
+	}
+}
+
+func NewUserResponseDto(user *models.User) *UserResponseDto {
+	return &UserResponseDto{
+		Id:              user.Id,
+		Name:            user.Name,
+		Email:           user.Email,
+		About:           user.About,
+		AvatarUrl:       user.AvatarUrl,
+		HasSubscription: user.HasSubscription,
+		IsAuthor:        user.IsAuthor,
+		IsAdmin:         user.IsAdmin,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		SocialNetworks:  user.SocialNetworks,
+		Version:         user.Version,
+	}
+}
+
+func NewUserResponseDtos(users []models.User) []UserResponseDto {
+	responses := make([]UserResponseDto, 0, len(users))
+	for i := range users {
+		responses = append(responses, *NewUserResponseDto(&users[i]))
+	}
+
+	return responses
+}
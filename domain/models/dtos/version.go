@@ -0,0 +1,5 @@
+package dtos
+
+type VersionDto struct {
+	ReleaseNotes string `json:"releaseNotes"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// File is a document served for download or read from outside the database,
+// such as a cover image.
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
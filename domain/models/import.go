@@ -0,0 +1,17 @@
+package models
+
+// BookImport is the book created from a manuscript together with what was
+// read from each of its files.
+type BookImport struct {
+	Book  *Book          `json:"book"`
+	Files []ImportedFile `json:"files"`
+}
+
+// ImportedFile reports the chapters and sections a manuscript file started
+// and anything in it that was skipped or guessed.
+type ImportedFile struct {
+	File     string   `json:"file"`
+	Chapters int      `json:"chapters"`
+	Sections int      `json:"sections"`
+	Warnings []string `json:"warnings"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type EntitlementSource string
+
+const (
+	EntitlementPurchase EntitlementSource = "PURCHASE"
+	EntitlementFree     EntitlementSource = "FREE"
+)
+
+// Entitlement records that a user owns a book. A user owns a book at most
+// once, so the id is made of the user and book ids. Subscribers can read
+// every book without an entitlement.
+type Entitlement struct {
+	Id        string            `json:"id" bson:"_id"`
+	UserId    string            `json:"userId" bson:"userId"`
+	BookId    string            `json:"bookId" bson:"bookId"`
+	Source    EntitlementSource `json:"source" bson:"source"`
+	OrderId   string            `json:"orderId,omitempty" bson:"orderId,omitempty"`
+	CreatedAt time.Time         `json:"createdAt" bson:"createdAt"`
+}
+
+func EntitlementId(userId string, bookId string) string {
+	return userId + ":" + bookId
+}
+
+// LibraryItem is an owned book as listed in the user's library.
+type LibraryItem struct {
+	Entitlement `bson:",inline"`
+	Book        *Book `json:"book" bson:"book"`
+}
@@ -0,0 +1,21 @@
+package models
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+type ListOptions struct {
+	Offset int
+	Limit  int
+	Sort   []SortField
+	Fields []string
+}
+
+type Page struct {
+	Items  interface{} `json:"items"`
+	Total  int64       `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Next   string      `json:"next,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type NotificationType string
+
+const (
+	NotificationBookUpdated NotificationType = "BOOK_UPDATED"
+)
+
+// Notification tells a user about a change to something they own, like a new
+// version of a book in their library.
+type Notification struct {
+	Id        string           `json:"id" bson:"_id"`
+	UserId    string           `json:"userId" bson:"userId"`
+	Type      NotificationType `json:"type" bson:"type"`
+	BookId    string           `json:"bookId,omitempty" bson:"bookId,omitempty"`
+	Version   int              `json:"version,omitempty" bson:"version,omitempty"`
+	Message   string           `json:"message" bson:"message"`
+	Read      bool             `json:"read" bson:"read"`
+	CreatedAt time.Time        `json:"createdAt" bson:"createdAt"`
+}
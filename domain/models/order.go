@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+type OrderStatus string
+
+// OrderPaying marks an order whose payment is being taken, so that a second
+// payment of the same order is refused instead of charged.
+const (
+	OrderPending   OrderStatus = "PENDING"
+	OrderPaying    OrderStatus = "PAYING"
+	OrderPaid      OrderStatus = "PAID"
+	OrderFulfilled OrderStatus = "FULFILLED"
+	OrderRefunded  OrderStatus = "REFUNDED"
+)
+
+// OrderItem is a book as it was priced at checkout. Later price changes on
+// the book do not affect it.
+type OrderItem struct {
+	BookId         string    `json:"bookId" bson:"bookId"`
+	Title          string    `json:"title" bson:"title"`
+	MinimumPrice   float64   `json:"minimumPrice" bson:"minimumPrice"`
+	SuggestedPrice float64   `json:"suggestedPrice" bson:"suggestedPrice"`
+	Price          float64   `json:"price" bson:"price"`
+	Royalties      []Royalty `json:"royalties" bson:"royalties"`
+}
+
+// Royalty is the part of an item price owed to one of the book authors.
+type Royalty struct {
+	AuthorId string  `json:"authorId" bson:"authorId"`
+	Amount   float64 `json:"amount" bson:"amount"`
+}
+
+// OrderStatusChange records a status change. PaymentId is set when the change
+// comes from the payment provider and is copied onto the order.
+type OrderStatusChange struct {
+	From      OrderStatus `json:"from" bson:"from"`
+	To        OrderStatus `json:"to" bson:"to"`
+	PaymentId string      `json:"paymentId,omitempty" bson:"paymentId,omitempty"`
+	ChangedAt time.Time   `json:"changedAt" bson:"changedAt"`
+}
+
+type Order struct {
+	Id        string              `json:"id" bson:"_id"`
+	UserId    string              `json:"userId" bson:"userId"`
+	CartId    string              `json:"cartId" bson:"cartId"`
+	Items     []OrderItem         `json:"items" bson:"items"`
+	Total     float64             `json:"total" bson:"total"`
+	Status    OrderStatus         `json:"status" bson:"status"`
+	PaymentId string              `json:"paymentId,omitempty" bson:"paymentId,omitempty"`
+	History   []OrderStatusChange `json:"history" bson:"history,omitempty"`
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+}
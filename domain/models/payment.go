@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type PaymentStatus string
+
+const (
+	PaymentAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentCaptured   PaymentStatus = "CAPTURED"
+	PaymentRefunded   PaymentStatus = "REFUNDED"
+	PaymentDeclined   PaymentStatus = "DECLINED"
+)
+
+type PaymentEventType string
+
+const (
+	PaymentCapturedEvent PaymentEventType = "payment.captured"
+	PaymentRefundedEvent PaymentEventType = "payment.refunded"
+)
+
+// PaymentRequest asks the provider to hold Amount for an order. Source is the
+// provider token for the buyer's payment method.
+type PaymentRequest struct {
+	OrderId string  `json:"orderId"`
+	Amount  float64 `json:"amount"`
+	Source  string  `json:"source"`
+}
+
+type Payment struct {
+	Id        string        `json:"id"`
+	OrderId   string        `json:"orderId"`
+	Amount    float64       `json:"amount"`
+	Refunded  float64       `json:"refunded"`
+	Status    PaymentStatus `json:"status"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// PaymentEvent is a verified webhook notification. Providers may deliver the
+// same event more than once; Id stays the same across deliveries.
+type PaymentEvent struct {
+	Id        string           `json:"id"`
+	Type      PaymentEventType `json:"type"`
+	PaymentId string           `json:"paymentId"`
+	OrderId   string           `json:"orderId"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
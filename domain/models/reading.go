@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// ReadingProgress is where a user stopped reading a book. A user has one
+// progress per book, so the id is made of the user and book ids.
+type ReadingProgress struct {
+	Id              string    `json:"id" bson:"_id"`
+	UserId          string    `json:"userId" bson:"userId"`
+	BookId          string    `json:"bookId" bson:"bookId"`
+	SectionId       string    `json:"sectionId" bson:"sectionId"`
+	PercentComplete float64   `json:"percentComplete" bson:"percentComplete"`
+	UpdatedAt       time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+func ReadingProgressId(userId string, bookId string) string {
+	return userId + ":" + bookId
+}
+
+type Bookmark struct {
+	Id        string    `json:"id" bson:"_id"`
+	UserId    string    `json:"userId" bson:"userId"`
+	BookId    string    `json:"bookId" bson:"bookId"`
+	SectionId string    `json:"sectionId" bson:"sectionId"`
+	Note      string    `json:"note" bson:"note"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Highlight marks the text between Start and End, counted in characters of
+// the section content. Text keeps a copy of the highlighted text.
+type Highlight struct {
+	Id        string    `json:"id" bson:"_id"`
+	UserId    string    `json:"userId" bson:"userId"`
+	BookId    string    `json:"bookId" bson:"bookId"`
+	SectionId string    `json:"sectionId" bson:"sectionId"`
+	Start     int       `json:"start" bson:"start"`
+	End       int       `json:"end" bson:"end"`
+	Text      string    `json:"text" bson:"text"`
+	Note      string    `json:"note" bson:"note"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type ReviewStatus string
+
+const (
+	ReviewVisible ReviewStatus = "VISIBLE"
+	ReviewHidden  ReviewStatus = "HIDDEN"
+)
+
+// Review is a reader's rating of a book they own. A user reviews a book at
+// most once, so the id is made of the user and book ids. Hidden reviews are
+// only listed to admins and do not count towards the book rating.
+type Review struct {
+	Id          string       `json:"id" bson:"_id"`
+	BookId      string       `json:"bookId" bson:"bookId"`
+	UserId      string       `json:"userId" bson:"userId"`
+	Rating      int          `json:"rating" bson:"rating"`
+	Text        string       `json:"text" bson:"text"`
+	Status      ReviewStatus `json:"status" bson:"status"`
+	ModeratedBy string       `json:"moderatedBy,omitempty" bson:"moderatedBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt" bson:"updatedAt"`
+}
+
+func ReviewId(userId string, bookId string) string {
+	return userId + ":" + bookId
+}
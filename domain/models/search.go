@@ -0,0 +1,15 @@
+package models
+
+type BookSearch struct {
+	Query           string
+	LanguageCode    string
+	MinPrice        *float64
+	MaxPrice        *float64
+	State           StateBook
+	IncludeSections bool
+}
+
+type BookSearchResult struct {
+	Book  `bson:",inline"`
+	Score float64 `json:"score" bson:"score"`
+}
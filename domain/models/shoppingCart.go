@@ -2,8 +2,11 @@ package models
 
 import "time"
 
+// BookId is a book in a cart. Price is what the buyer chose to pay; without
+// it the book is charged at its suggested price.
 type BookId struct {
-	Book string `json:"book" bson:"book"`
+	Book  string   `json:"book" bson:"book" validate:"required"`
+	Price *float64 `json:"price,omitempty" bson:"price,omitempty" validate:"min=0"`
 }
 
 type ShoppingCart struct {
@@ -11,4 +14,5 @@ type ShoppingCart struct {
 	UserId    string    `json:"userId" bson:"userId"`
 	Books     []BookId  `json:"books" bson:"books"`
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	Version   int       `json:"version" bson:"version"`
 }
@@ -3,8 +3,8 @@ package models
 import "time"
 
 type SocialNetwork struct {
-	Name string `json:"name" bson:"name"`
-	Url  string `json:"url" bson:"url"`
+	Name string `json:"name" bson:"name" validate:"required,max=50"`
+	Url  string `json:"url" bson:"url" validate:"required,url"`
 }
 
 type User struct {
@@ -20,6 +20,7 @@ type User struct {
 	CreatedAt       time.Time       `json:"createdAt" bson:"createdAt"`
 	UpdatedAt       time.Time       `json:"updatedAt" bson:"updatedAt"`
 	SocialNetworks  []SocialNetwork `json:"socialNetworks" bson:"socialNetworks"`
+	Version         int             `json:"version" bson:"version"`
 }
 
 type RegisteredUser struct {
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// BookVersion is a published copy of the content of a book and of its
+// sections. Versions are numbered from one and never change once saved;
+// readers see the one the book's PublishedVersion points to while authors keep
+// editing the book's own content and sections as a draft.
+type BookVersion struct {
+	Id           string        `json:"id" bson:"_id"`
+	BookId       string        `json:"bookId" bson:"bookId"`
+	Number       int           `json:"number" bson:"number"`
+	Content      []BookContent `json:"content,omitempty" bson:"content,omitempty"`
+	Sections     []BookSection `json:"sections,omitempty" bson:"sections,omitempty"`
+	ReleaseNotes string        `json:"releaseNotes" bson:"releaseNotes"`
+	PublishedBy  string        `json:"publishedBy,omitempty" bson:"publishedBy,omitempty"`
+	PublishedAt  time.Time     `json:"publishedAt" bson:"publishedAt"`
+}
+
+func BookVersionId(bookId string, number int) string {
+	return bookId + ":" + strconv.Itoa(number)
+}
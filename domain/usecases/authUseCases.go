@@ -0,0 +1,165 @@
+package usecases
+
+import (
+	"github.com/google/uuid"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"time"
+)
+
+const (
+	accessTokenDuration  = 15 * time.Minute
+	refreshTokenDuration = 7 * 24 * time.Hour
+)
+
+type AuthUseCase struct {
+	datastore   domain.DatabaseGateway
+	tokens      domain.TokenGateway
+	userUseCase UserUseCase
+}
+
+func NewAuthUseCase(datastore domain.DatabaseGateway, tokens domain.TokenGateway, userUseCase UserUseCase) AuthUseCase {
+	return AuthUseCase{
+		datastore:   datastore,
+		tokens:      tokens,
+		userUseCase: userUseCase,
+	}
+}
+
+func (authUseCase AuthUseCase) Login(registeredUser *models.RegisteredUser) (*dtos.AuthTokensResponseDto, error) {
+	user, err := authUseCase.userUseCase.ValidateUser(registeredUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return authUseCase.issueTokens(user)
+}
+
+// RefreshTokens rotates the refresh token: the one presented is revoked and a
+// new access/refresh pair is issued, so each refresh token works only once.
+func (authUseCase AuthUseCase) RefreshTokens(refreshToken string) (*dtos.AuthTokensResponseDto, error) {
+	claims, err := authUseCase.verifyToken(refreshToken, models.RefreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := authUseCase.datastore.GetUserById(claims.Subject)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	revoked, err := authUseCase.revokeToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !revoked {
+		return nil, domain.ErrRevokedToken
+	}
+
+	return authUseCase.issueTokens(user)
+}
+
+func (authUseCase AuthUseCase) Logout(claims *models.TokenClaims, refreshToken string) error {
+	if refreshToken != "" {
+		refreshClaims, err := authUseCase.verifyToken(refreshToken, models.RefreshTokenType)
+		if err != nil {
+			return err
+		}
+
+		if refreshClaims.Subject != claims.Subject {
+			return domain.ErrInvalidToken
+		}
+
+		_, err = authUseCase.revokeToken(refreshClaims)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := authUseCase.revokeToken(claims)
+	return err
+}
+
+// Authenticate verifies an access token and loads the user it was issued to,
+// so role changes take effect without waiting for the token to expire.
+func (authUseCase AuthUseCase) Authenticate(accessToken string) (*models.TokenClaims, *models.User, error) {
+	claims, err := authUseCase.verifyToken(accessToken, models.AccessTokenType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := authUseCase.datastore.GetUserById(claims.Subject)
+	if err != nil {
+		return nil, nil, domain.ErrInvalidToken
+	}
+
+	return claims, user, nil
+}
+
+func (authUseCase AuthUseCase) verifyToken(token string, tokenType models.TokenType) (*models.TokenClaims, error) {
+	claims, err := authUseCase.tokens.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, domain.ErrInvalidToken
+	}
+
+	revoked, err := authUseCase.datastore.IsTokenRevoked(claims.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, domain.ErrRevokedToken
+	}
+
+	return claims, nil
+}
+
+// revokeToken reports whether the token was revoked by this call rather than
+// before it.
+func (authUseCase AuthUseCase) revokeToken(claims *models.TokenClaims) (bool, error) {
+	return authUseCase.datastore.RevokeToken(&models.RevokedToken{
+		Id:        claims.Id,
+		UserId:    claims.Subject,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	})
+}
+
+func (authUseCase AuthUseCase) issueTokens(user *models.User) (*dtos.AuthTokensResponseDto, error) {
+	now := time.Now()
+
+	accessToken, err := authUseCase.issueToken(user.Id, models.AccessTokenType, now, accessTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := authUseCase.issueToken(user.Id, models.RefreshTokenType, now, refreshTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.AuthTokensResponseDto{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenDuration.Seconds()),
+		User:         dtos.NewUserResponseDto(user),
+	}, nil
+}
+
+func (authUseCase AuthUseCase) issueToken(userId string, tokenType models.TokenType, now time.Time, duration time.Duration) (string, error) {
+	id, _ := uuid.NewRandom()
+
+	return authUseCase.tokens.IssueToken(&models.TokenClaims{
+		Id:        id.String(),
+		Subject:   userId,
+		Type:      tokenType,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(duration).Unix(),
+	})
+}
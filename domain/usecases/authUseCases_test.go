@@ -0,0 +1,206 @@
+package usecases
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+	"time"
+)
+
+func TestLoginIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	password, _ := hashPassword("test1234")
+	user := &models.User{
+		Id:       "1234567890",
+		Email:    "test@example.com",
+		Password: password,
+	}
+
+	registerUser := &models.RegisteredUser{
+		Email:    "test@example.com",
+		Password: "test1234",
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(user, nil)
+	app.Tokens.On("IssueToken", mock.Anything).Return("token", nil)
+
+	tokens, err := AuthUseCase{
+		datastore:   app.DataStore,
+		tokens:      app.Tokens,
+		userUseCase: UserUseCase{datastore: app.DataStore},
+	}.Login(registerUser)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "token", tokens.AccessToken)
+	assert.Equal(t, "token", tokens.RefreshToken)
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
+	app.Tokens.MethodCalled("IssueToken", mock.Anything)
+}
+
+func TestLoginIsWrongInvalidPassword(t *testing.T) {
+	app := test.CreateApp()
+
+	registerUser := &models.RegisteredUser{
+		Email:    "test@example.com",
+		Password: "test1234",
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, errors.New("USER_NOT_FOUND"))
+
+	_, err := AuthUseCase{
+		datastore:   app.DataStore,
+		tokens:      app.Tokens,
+		userUseCase: UserUseCase{datastore: app.DataStore},
+	}.Login(registerUser)
+
+	assert.EqualError(t, err, "INVALID_USER_OR_PASSWORD")
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
+}
+
+func TestRefreshTokensIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	claims := &models.TokenClaims{
+		Id:        "312312",
+		Subject:   "1234567890",
+		Type:      models.RefreshTokenType,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+	user := &models.User{
+		Id:    "1234567890",
+		Email: "test@example.com",
+	}
+
+	app.Tokens.On("ParseToken", "refresh").Return(claims, nil)
+	app.Tokens.On("IssueToken", mock.Anything).Return("token", nil)
+	app.DataStore.On("IsTokenRevoked", "312312").Return(false, nil)
+	app.DataStore.On("GetUserById", "1234567890").Return(user, nil)
+	app.DataStore.On("RevokeToken", mock.Anything).Return(true, nil)
+
+	_, err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.RefreshTokens("refresh")
+
+	assert.Nil(t, err)
+	app.DataStore.MethodCalled("RevokeToken", mock.Anything)
+	app.Tokens.MethodCalled("IssueToken", mock.Anything)
+}
+
+func TestRefreshTokensIsWrongRevokedToken(t *testing.T) {
+	app := test.CreateApp()
+
+	claims := &models.TokenClaims{
+		Id:      "312312",
+		Subject: "1234567890",
+		Type:    models.RefreshTokenType,
+	}
+
+	app.Tokens.On("ParseToken", "refresh").Return(claims, nil)
+	app.DataStore.On("IsTokenRevoked", "312312").Return(true, nil)
+
+	_, err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.RefreshTokens("refresh")
+
+	assert.EqualError(t, err, "REVOKED_TOKEN")
+	app.DataStore.MethodCalled("IsTokenRevoked", "312312")
+}
+
+func TestRefreshTokensIsWrongSpentConcurrently(t *testing.T) {
+	app := test.CreateApp()
+
+	claims := &models.TokenClaims{
+		Id:        "312312",
+		Subject:   "1234567890",
+		Type:      models.RefreshTokenType,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	app.Tokens.On("ParseToken", "refresh").Return(claims, nil)
+	app.DataStore.On("IsTokenRevoked", "312312").Return(false, nil)
+	app.DataStore.On("GetUserById", "1234567890").Return(&models.User{Id: "1234567890"}, nil)
+	app.DataStore.On("RevokeToken", mock.Anything).Return(false, nil)
+
+	_, err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.RefreshTokens("refresh")
+
+	assert.Equal(t, domain.ErrRevokedToken, err)
+	app.Tokens.AssertNotCalled(t, "IssueToken", mock.Anything)
+}
+
+func TestRefreshTokensIsWrongAccessToken(t *testing.T) {
+	app := test.CreateApp()
+
+	claims := &models.TokenClaims{
+		Id:      "312312",
+		Subject: "1234567890",
+		Type:    models.AccessTokenType,
+	}
+
+	app.Tokens.On("ParseToken", "access").Return(claims, nil)
+
+	_, err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.RefreshTokens("access")
+
+	assert.EqualError(t, err, "INVALID_TOKEN")
+	app.Tokens.MethodCalled("ParseToken", "access")
+}
+
+func TestLogoutIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	accessClaims := &models.TokenClaims{
+		Id:      "111",
+		Subject: "1234567890",
+		Type:    models.AccessTokenType,
+	}
+	refreshClaims := &models.TokenClaims{
+		Id:      "222",
+		Subject: "1234567890",
+		Type:    models.RefreshTokenType,
+	}
+
+	app.Tokens.On("ParseToken", "refresh").Return(refreshClaims, nil)
+	app.DataStore.On("IsTokenRevoked", "222").Return(false, nil)
+	app.DataStore.On("RevokeToken", mock.Anything).Return(true, nil)
+
+	err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.Logout(accessClaims, "refresh")
+
+	assert.Nil(t, err)
+	app.DataStore.MethodCalled("RevokeToken", mock.Anything)
+}
+
+func TestAuthenticateIsWrongConnectionFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	claims := &models.TokenClaims{
+		Id:      "312312",
+		Subject: "1234567890",
+		Type:    models.AccessTokenType,
+	}
+
+	app.Tokens.On("ParseToken", "access").Return(claims, nil)
+	app.DataStore.On("IsTokenRevoked", "312312").Return(false, errors.New("CONNECTION_FAIL"))
+
+	_, _, err := AuthUseCase{
+		datastore: app.DataStore,
+		tokens:    app.Tokens,
+	}.Authenticate("access")
+
+	assert.NotNil(t, err, "CONNECTION_FAIL")
+	app.DataStore.MethodCalled("IsTokenRevoked", "312312")
+}
@@ -0,0 +1,305 @@
+package usecases
+
+import (
+	"github.com/google/uuid"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"strings"
+)
+
+// The content editing methods below load the book, apply the change to a copy
+// of its content and save the content together with the sections it adds,
+// changes or drops, so Book.Content and the bookSections collection stay in
+// step. Chapters are addressed by their zero based position in the book. Each
+// takes the version of the book the change was made against, or 0 for the
+// stored one, and fails with ErrVersionConflict when the book changed since.
+
+func (bookUseCase BookUseCase) AddChapter(actor *models.User, bookId string, version int, chapter *dtos.ChapterDto) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(chapter.Chapter) == "" {
+		return nil, domain.ErrInvalidBookContent
+	}
+
+	content := copyContent(book.Content)
+	position, err := targetPosition(chapter.Position, len(content))
+	if err != nil {
+		return nil, err
+	}
+
+	newChapter := models.BookContent{Chapter: chapter.Chapter, Sections: []models.BookSectionId{}}
+	content = append(content[:position], append([]models.BookContent{newChapter}, content[position:]...)...)
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, nil, nil)
+}
+
+// UpdateChapter renames the chapter when a title is given and moves it when a
+// position is given.
+func (bookUseCase BookUseCase) UpdateChapter(actor *models.User, bookId string, version int, index int, chapter *dtos.ChapterDto) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content := copyContent(book.Content)
+	if index < 0 || index >= len(content) {
+		return nil, domain.ErrChapterNotFound
+	}
+
+	if strings.TrimSpace(chapter.Chapter) != "" {
+		content[index].Chapter = chapter.Chapter
+	}
+
+	if chapter.Position != nil {
+		moved := content[index]
+		content = append(content[:index], content[index+1:]...)
+		position, err := targetPosition(chapter.Position, len(content))
+		if err != nil {
+			return nil, err
+		}
+		content = append(content[:position], append([]models.BookContent{moved}, content[position:]...)...)
+	}
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, nil, nil)
+}
+
+// DeleteChapter removes the chapter and every section in it.
+func (bookUseCase BookUseCase) DeleteChapter(actor *models.User, bookId string, version int, index int) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content := copyContent(book.Content)
+	if index < 0 || index >= len(content) {
+		return nil, domain.ErrChapterNotFound
+	}
+
+	var deletedSectionIds []string
+	for _, section := range content[index].Sections {
+		deletedSectionIds = append(deletedSectionIds, section.SectionId)
+	}
+	content = append(content[:index], content[index+1:]...)
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, nil, deletedSectionIds)
+}
+
+func (bookUseCase BookUseCase) AddSection(actor *models.User, bookId string, version int, chapterIndex int, section *dtos.SectionDto) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content := copyContent(book.Content)
+	if chapterIndex < 0 || chapterIndex >= len(content) {
+		return nil, domain.ErrChapterNotFound
+	}
+
+	sections := content[chapterIndex].Sections
+	position, err := targetPosition(section.Position, len(sections))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := uuid.NewRandom()
+	newSection := models.BookSection{
+		Id:      id.String(),
+		Title:   section.Title,
+		Content: section.Content,
+	}
+	if err := bookUseCase.renderSection(book.Id, &newSection); err != nil {
+		return nil, err
+	}
+
+	sectionId := models.BookSectionId{SectionId: newSection.Id}
+	content[chapterIndex].Sections = append(sections[:position], append([]models.BookSectionId{sectionId}, sections[position:]...)...)
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, []models.BookSection{newSection}, nil)
+}
+
+func (bookUseCase BookUseCase) UpdateSection(actor *models.User, bookId string, version int, sectionId string, section *dtos.SectionDto) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, found := findSection(book.Content, sectionId); !found {
+		return nil, domain.ErrSectionNotFound
+	}
+
+	updatedSection := models.BookSection{
+		Id:      sectionId,
+		Title:   section.Title,
+		Content: section.Content,
+	}
+	if err := bookUseCase.renderSection(book.Id, &updatedSection); err != nil {
+		return nil, err
+	}
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, book.Content, []models.BookSection{updatedSection}, nil)
+}
+
+// MoveSection moves a section within its chapter or into another chapter of
+// the same book.
+func (bookUseCase BookUseCase) MoveSection(actor *models.User, bookId string, version int, sectionId string, move *dtos.SectionMoveDto) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content := copyContent(book.Content)
+	chapterIndex, sectionIndex, found := findSection(content, sectionId)
+	if !found {
+		return nil, domain.ErrSectionNotFound
+	}
+
+	if move.Chapter < 0 || move.Chapter >= len(content) {
+		return nil, domain.ErrChapterNotFound
+	}
+
+	sections := content[chapterIndex].Sections
+	moved := sections[sectionIndex]
+	content[chapterIndex].Sections = append(sections[:sectionIndex], sections[sectionIndex+1:]...)
+
+	sections = content[move.Chapter].Sections
+	position, err := targetPosition(move.Position, len(sections))
+	if err != nil {
+		return nil, err
+	}
+	content[move.Chapter].Sections = append(sections[:position], append([]models.BookSectionId{moved}, sections[position:]...)...)
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, nil, nil)
+}
+
+func (bookUseCase BookUseCase) DeleteSection(actor *models.User, bookId string, version int, sectionId string) (*models.Book, error) {
+	book, err := bookUseCase.contentBook(actor, bookId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content := copyContent(book.Content)
+	chapterIndex, sectionIndex, found := findSection(content, sectionId)
+	if !found {
+		return nil, domain.ErrSectionNotFound
+	}
+
+	sections := content[chapterIndex].Sections
+	content[chapterIndex].Sections = append(sections[:sectionIndex], sections[sectionIndex+1:]...)
+
+	return bookUseCase.datastore.SaveBookContent(book.Id, book.Version, content, nil, []string{sectionId})
+}
+
+func (bookUseCase BookUseCase) editableBook(actor *models.User, bookId string) (*models.Book, error) {
+	book, err := bookUseCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireBookAuthorOrAdmin(actor, book); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// contentBook loads a book for a content change and checks it is still at the
+// version the change was made against.
+func (bookUseCase BookUseCase) contentBook(actor *models.User, bookId string, version int) (*models.Book, error) {
+	book, err := bookUseCase.editableBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := matchVersion(version, book.Version); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// renderSection renders a section being added to or changed in the book,
+// resolving its links against the other sections of the book.
+func (bookUseCase BookUseCase) renderSection(bookId string, section *models.BookSection) error {
+	stored, err := bookUseCase.datastore.GetSectionsByBookId(bookId)
+	if err != nil {
+		return err
+	}
+
+	rendered := []models.BookSection{*section}
+	renderSections(rendered, withSection(stored.Sections, *section))
+	*section = rendered[0]
+	return nil
+}
+
+// removedSections returns the sections of stored that content no longer
+// references. Content may only reference sections that already belong to the
+// book; new sections are added through AddSection.
+func removedSections(stored []models.BookContent, content []models.BookContent) ([]string, error) {
+	owned := map[string]bool{}
+	for _, chapter := range stored {
+		for _, section := range chapter.Sections {
+			owned[section.SectionId] = true
+		}
+	}
+
+	for _, chapter := range content {
+		for _, section := range chapter.Sections {
+			if !owned[section.SectionId] {
+				return nil, domain.ErrInvalidBookContent
+			}
+			delete(owned, section.SectionId)
+		}
+	}
+
+	var removed []string
+	for _, chapter := range stored {
+		for _, section := range chapter.Sections {
+			if owned[section.SectionId] {
+				removed = append(removed, section.SectionId)
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+func copyContent(content []models.BookContent) []models.BookContent {
+	copied := make([]models.BookContent, 0, len(content))
+	for _, chapter := range content {
+		sections := make([]models.BookSectionId, len(chapter.Sections))
+		copy(sections, chapter.Sections)
+		copied = append(copied, models.BookContent{Chapter: chapter.Chapter, Sections: sections})
+	}
+
+	return copied
+}
+
+func findSection(content []models.BookContent, sectionId string) (int, int, bool) {
+	for chapterIndex, chapter := range content {
+		for sectionIndex, section := range chapter.Sections {
+			if section.SectionId == sectionId {
+				return chapterIndex, sectionIndex, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// targetPosition resolves an optional insert position into a list of the
+// given length, defaulting to the end.
+func targetPosition(position *int, length int) (int, error) {
+	if position == nil {
+		return length, nil
+	}
+
+	if *position < 0 || *position > length {
+		return 0, domain.ErrInvalidPosition
+	}
+
+	return *position, nil
+}
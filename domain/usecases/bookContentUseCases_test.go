@@ -0,0 +1,184 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"testing"
+)
+
+func bookWithContent() *models.Book {
+	return &models.Book{
+		Id:      "312312",
+		Authors: []models.Author{{AuthorId: "211212"}},
+		Content: []models.BookContent{
+			{Chapter: "one", Sections: []models.BookSectionId{{SectionId: "a"}, {SectionId: "b"}}},
+			{Chapter: "two", Sections: []models.BookSectionId{{SectionId: "c"}}},
+		},
+		Version: 3,
+	}
+}
+
+func TestAddSectionIsOk(t *testing.T) {
+	app := test.CreateApp()
+	position := 1
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+	app.DataStore.On("GetSectionsByBookId", "312312").Return(&models.BookSections{}, nil)
+	app.DataStore.On("SaveBookContent", "312312", 3, mock.MatchedBy(func(content []models.BookContent) bool {
+		sections := content[0].Sections
+		return len(sections) == 3 && sections[0].SectionId == "a" && sections[2].SectionId == "b"
+	}), mock.MatchedBy(func(sections []models.BookSection) bool {
+		return len(sections) == 1 && sections[0].Id != "" && sections[0].Title == "new"
+	}), []string(nil)).Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.AddSection(authorUser, "312312", 0, 0, &dtos.SectionDto{Title: "new", Position: &position})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestAddSectionIsWrongPosition(t *testing.T) {
+	app := test.CreateApp()
+	position := 5
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.AddSection(authorUser, "312312", 3, 0, &dtos.SectionDto{Title: "new", Position: &position})
+
+	assert.Equal(t, domain.ErrInvalidPosition, err)
+}
+
+func TestAddSectionIsWrongStaleVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.AddSection(authorUser, "312312", 2, 0, &dtos.SectionDto{Title: "new"})
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	app.DataStore.AssertNotCalled(t, "SaveBookContent", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMoveSectionAcrossChaptersIsOk(t *testing.T) {
+	app := test.CreateApp()
+	position := 0
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+	app.DataStore.On("SaveBookContent", "312312", 3, []models.BookContent{
+		{Chapter: "one", Sections: []models.BookSectionId{{SectionId: "b"}}},
+		{Chapter: "two", Sections: []models.BookSectionId{{SectionId: "a"}, {SectionId: "c"}}},
+	}, []models.BookSection(nil), []string(nil)).Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.MoveSection(authorUser, "312312", 0, "a", &dtos.SectionMoveDto{Chapter: 1, Position: &position})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestDeleteChapterDeletesItsSections(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+	app.DataStore.On("SaveBookContent", "312312", 3, []models.BookContent{
+		{Chapter: "two", Sections: []models.BookSectionId{{SectionId: "c"}}},
+	}, []models.BookSection(nil), []string{"a", "b"}).Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.DeleteChapter(authorUser, "312312", 0, 0)
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateSectionRendersMarkdown(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+	app.DataStore.On("GetSectionsByBookId", "312312").Return(&models.BookSections{Sections: []models.BookSection{
+		{Id: "a", Title: "Getting Started"},
+		{Id: "b", Title: "Old title"},
+	}}, nil)
+	app.DataStore.On("SaveBookContent", "312312", 3, mock.Anything, []models.BookSection{{
+		Id:      "b",
+		Title:   "Setup",
+		Content: "Read [the start](#getting-started) <script>x</script>",
+		Html:    `<p>Read <a href="#section-a">the start</a> &lt;script&gt;x&lt;/script&gt;</p>`,
+	}}, []string(nil)).Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateSection(authorUser, "312312", 3, "b", &dtos.SectionDto{Title: "Setup", Content: "Read [the start](#getting-started) <script>x</script>"})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateSectionIsWrongOtherBook(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateSection(authorUser, "312312", 0, "z", &dtos.SectionDto{Title: "new"})
+
+	assert.Equal(t, domain.ErrSectionNotFound, err)
+}
+
+func TestAddChapterIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.AddChapter(&models.User{Id: "1234567890"}, "312312", 0, &dtos.ChapterDto{Chapter: "new"})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestUpdateBookDeletesDroppedSections(t *testing.T) {
+	app := test.CreateApp()
+
+	book := bookWithContent()
+	book.Content = book.Content[:1]
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+	app.DataStore.On("UpdateBook", book, []string{"c"}).Return(book, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, book)
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateBookIsWrongForeignSection(t *testing.T) {
+	app := test.CreateApp()
+
+	book := bookWithContent()
+	book.Content[1].Sections = append(book.Content[1].Sections, models.BookSectionId{SectionId: "z"})
+
+	app.DataStore.On("GetBookById", "312312").Return(bookWithContent(), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, book)
+
+	assert.Equal(t, domain.ErrInvalidBookContent, err)
+	app.DataStore.AssertNotCalled(t, "UpdateBook", mock.Anything, mock.Anything)
+}
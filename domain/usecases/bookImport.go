@@ -0,0 +1,349 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"leanpub-app/domain/validation"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// manuscriptManifest lists the files of a manuscript in the order they are
+// read, one path per line relative to it.
+const manuscriptManifest = "Book.txt"
+
+// maxManuscriptFileSize bounds what is read from each file, since archives
+// can unpack to far more than they weigh.
+const maxManuscriptFileSize = 2 << 20
+
+var (
+	manuscriptHeading   = regexp.MustCompile(`^(#{1,2})[ \t]+(.+?)(?:[ \t]+#+)?[ \t]*$`)
+	manuscriptFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	manuscriptMarkdown  = map[string]bool{".md": true, ".markdown": true}
+	errManuscriptTooBig = errors.New("too large")
+)
+
+// manuscript collects the chapters read from the files of a manuscript. Text
+// before the first section heading of a chapter becomes a section titled
+// after the chapter.
+type manuscript struct {
+	content []dtos.BookContentDto
+	section *models.BookSection
+	lines   []string
+}
+
+// ImportBook creates a book from a manuscript: a Book.txt manifest listing
+// Markdown files in order, either at the root of files or in one of its
+// directories. "# " headings start chapters and "## " headings start
+// sections; deeper headings stay in the section. The book is validated and
+// saved like one sent to SaveBook, with the metadata in book, and every file
+// read is reported with what was skipped in it.
+func (bookUseCase BookUseCase) ImportBook(actor *models.User, files fs.FS, book *dtos.BookDto) (*models.BookImport, error) {
+	if err := requireAuthorOrAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	root, err := manuscriptRoot(files)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := models.ImportedFile{File: path.Join(root, manuscriptManifest), Warnings: []string{}}
+	listed, err := readManifest(files, root, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	report := []models.ImportedFile{manifest}
+	var imported manuscript
+	for _, name := range listed {
+		report = append(report, imported.read(files, name))
+	}
+	report = append(report, unlistedFiles(files, root, listed)...)
+
+	content := imported.finish()
+	if len(content) == 0 {
+		return nil, domain.ErrInvalidManuscript
+	}
+
+	newBook := *book
+	newBook.Content = content
+	if len(newBook.Authors) == 0 {
+		newBook.Authors = []models.Author{{AuthorId: actor.Id}}
+	}
+	if newBook.AuthorCount == 0 {
+		newBook.AuthorCount = len(newBook.Authors)
+	}
+	if strings.TrimSpace(newBook.Title) == "" {
+		newBook.Title = content[0].Chapter
+		report[0].Warnings = append(report[0].Warnings, fmt.Sprintf("no title given, used the first chapter %q", newBook.Title))
+	}
+
+	if err := validation.Validate(&newBook); err != nil {
+		return nil, err
+	}
+
+	saved, err := bookUseCase.SaveBook(actor, &newBook)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BookImport{Book: saved, Files: report}, nil
+}
+
+// manuscriptRoot finds the directory holding the manifest: the root of files
+// or, as when a manuscript directory is zipped, the first directory in it
+// that has one.
+func manuscriptRoot(files fs.FS) (string, error) {
+	if _, err := fs.Stat(files, manuscriptManifest); err == nil {
+		return ".", nil
+	}
+
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return "", domain.ErrInvalidManuscript
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if _, err := fs.Stat(files, path.Join(entry.Name(), manuscriptManifest)); err == nil {
+			return entry.Name(), nil
+		}
+	}
+
+	return "", domain.ErrInvalidManuscript
+}
+
+// readManifest returns the files the manifest lists, as paths in files. Paths
+// leaving the manuscript and files listed twice are reported and skipped.
+func readManifest(files fs.FS, root string, report *models.ImportedFile) ([]string, error) {
+	text, err := readManuscriptFile(files, report.File)
+	if err != nil {
+		return nil, domain.ErrInvalidManuscript
+	}
+
+	var listed []string
+	seen := map[string]bool{}
+	for number, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, `\`, "/"))
+		if line == "" {
+			continue
+		}
+
+		cleaned := path.Clean(line)
+		name := path.Join(root, cleaned)
+		if cleaned == "." || !fs.ValidPath(cleaned) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: %q is outside the manuscript, skipped", number+1, line))
+			continue
+		}
+
+		if seen[name] {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: %q is listed twice, skipped", number+1, line))
+			continue
+		}
+
+		seen[name] = true
+		listed = append(listed, name)
+	}
+
+	return listed, nil
+}
+
+// unlistedFiles reports the Markdown files of the manuscript the manifest
+// leaves out, which are not imported.
+func unlistedFiles(files fs.FS, root string, listed []string) []models.ImportedFile {
+	included := map[string]bool{}
+	for _, name := range listed {
+		included[name] = true
+	}
+
+	var unlisted []string
+	fs.WalkDir(files, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if entry.IsDir() && name != root && strings.HasPrefix(entry.Name(), ".") {
+			return fs.SkipDir
+		}
+
+		if !entry.IsDir() && !included[name] && manuscriptMarkdown[strings.ToLower(path.Ext(name))] {
+			unlisted = append(unlisted, name)
+		}
+		return nil
+	})
+	sort.Strings(unlisted)
+
+	var report []models.ImportedFile
+	for _, name := range unlisted {
+		report = append(report, models.ImportedFile{
+			File:     name,
+			Warnings: []string{"not listed in " + manuscriptManifest + ", skipped"},
+		})
+	}
+
+	return report
+}
+
+// read adds the chapters and sections of the file to the manuscript. A file
+// that does not start with a heading continues the section before it, so a
+// long chapter can be split across files.
+func (imported *manuscript) read(files fs.FS, name string) models.ImportedFile {
+	report := models.ImportedFile{File: name, Warnings: []string{}}
+
+	text, err := readManuscriptFile(files, name)
+	switch {
+	case errors.Is(err, errManuscriptTooBig):
+		report.Warnings = append(report.Warnings, fmt.Sprintf("larger than %d bytes, skipped", maxManuscriptFileSize))
+		return report
+	case err != nil:
+		report.Warnings = append(report.Warnings, "not found, skipped")
+		return report
+	}
+
+	if !utf8.ValidString(text) {
+		report.Warnings = append(report.Warnings, "not valid UTF-8, invalid characters replaced")
+		text = strings.ToValidUTF8(text, "\ufffd")
+	}
+
+	if strings.TrimSpace(text) == "" {
+		report.Warnings = append(report.Warnings, "empty")
+		return report
+	}
+
+	// Keep the text continued from the file before in a paragraph of its own.
+	imported.addLine("")
+
+	var fence string
+	for number, line := range strings.Split(text, "\n") {
+		if fence != "" {
+			if closing := strings.TrimSpace(line); strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+				fence = ""
+			}
+			imported.addLine(line)
+			continue
+		}
+
+		if match := manuscriptFence.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+		} else if match := manuscriptHeading.FindStringSubmatch(line); match != nil {
+			if len(match[1]) == 1 {
+				imported.startChapter(match[2])
+				report.Chapters++
+				continue
+			}
+
+			if imported.startChapterOnce(name) {
+				report.Chapters++
+				report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: section before any chapter, added to chapter %q", number+1, imported.chapterTitle()))
+			}
+			imported.startSection(match[2])
+			report.Sections++
+			continue
+		}
+
+		if imported.section == nil && strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if imported.section == nil {
+			if imported.startChapterOnce(name) {
+				report.Chapters++
+				report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: text before any chapter, added to chapter %q", number+1, imported.chapterTitle()))
+			}
+			imported.startSection(imported.chapterTitle())
+			report.Sections++
+		}
+		imported.addLine(line)
+	}
+
+	if fence != "" {
+		report.Warnings = append(report.Warnings, "code block left open at the end of the file")
+	}
+
+	return report
+}
+
+func (imported *manuscript) startChapter(title string) {
+	imported.endSection()
+	imported.content = append(imported.content, dtos.BookContentDto{Chapter: title, Sections: []models.BookSection{}})
+}
+
+// startChapterOnce starts a chapter titled after the file when there is no
+// chapter to add to yet, and reports whether it did.
+func (imported *manuscript) startChapterOnce(name string) bool {
+	if len(imported.content) > 0 {
+		return false
+	}
+
+	imported.startChapter(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+	return true
+}
+
+func (imported *manuscript) chapterTitle() string {
+	return imported.content[len(imported.content)-1].Chapter
+}
+
+func (imported *manuscript) startSection(title string) {
+	imported.endSection()
+	imported.section = &models.BookSection{Title: title}
+}
+
+func (imported *manuscript) addLine(line string) {
+	if imported.section != nil {
+		imported.lines = append(imported.lines, line)
+	}
+}
+
+// endSection adds the section being read to the last chapter, without the
+// blank lines around its text.
+func (imported *manuscript) endSection() {
+	if imported.section == nil {
+		return
+	}
+
+	imported.section.Content = strings.Trim(strings.Join(imported.lines, "\n"), "\n")
+	chapter := &imported.content[len(imported.content)-1]
+	chapter.Sections = append(chapter.Sections, *imported.section)
+
+	imported.section = nil
+	imported.lines = nil
+}
+
+func (imported *manuscript) finish() []dtos.BookContentDto {
+	imported.endSection()
+	return imported.content
+}
+
+// readManuscriptFile reads a text file of the manuscript with Unix line
+// endings and without a byte order mark.
+func readManuscriptFile(files fs.FS, name string) (string, error) {
+	file, err := files.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxManuscriptFileSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) > maxManuscriptFileSize {
+		return "", errManuscriptTooBig
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil
+}
@@ -0,0 +1,186 @@
+package usecases
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func manuscriptFile(text string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(text)}
+}
+
+// expectImport captures the book and sections the import saves.
+func expectImport(app *test.Application, saved *models.Book) (*models.Book, *[]models.BookSection) {
+	book := &models.Book{}
+	sections := &[]models.BookSection{}
+	app.DataStore.On("SaveBook", mock.MatchedBy(func(newBook *models.Book) bool {
+		*book = *newBook
+		return true
+	}), mock.MatchedBy(func(newSections []models.BookSection) bool {
+		*sections = newSections
+		return true
+	})).Return(saved, nil)
+
+	return book, sections
+}
+
+func TestImportBookIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	files := fstest.MapFS{
+		"manuscript/Book.txt":    manuscriptFile("intro.md\r\n\r\n./part-one.md\npart-two.md\n"),
+		"manuscript/intro.md":    manuscriptFile("# Introduction\n\nWhy Go.\n\n## Audience\n\nEveryone.\n"),
+		"manuscript/part-one.md": manuscriptFile("# Basics\n\n## Types\n\n```go\n# not a heading\n## nor this\n```\n\n### Kept in the section\n\nText"),
+		"manuscript/part-two.md": manuscriptFile("More on types.\n"),
+	}
+	book, saved := expectImport(app, &models.Book{Id: "imported"})
+
+	imported, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(authorUser, files, &dtos.BookDto{Title: "Go"})
+
+	require.Nil(t, err)
+	assert.Equal(t, "imported", imported.Book.Id)
+	assert.Equal(t, []models.ImportedFile{
+		{File: "manuscript/Book.txt", Warnings: []string{}},
+		{File: "manuscript/intro.md", Chapters: 1, Sections: 2, Warnings: []string{}},
+		{File: "manuscript/part-one.md", Chapters: 1, Sections: 1, Warnings: []string{}},
+		{File: "manuscript/part-two.md", Warnings: []string{}},
+	}, imported.Files)
+
+	sections := *saved
+	assert.Equal(t, "Go", book.Title)
+	assert.Equal(t, []models.Author{{AuthorId: authorUser.Id}}, book.Authors)
+	assert.Equal(t, models.StateUnpublished, book.State)
+	require.Len(t, book.Content, 2)
+	assert.Equal(t, "Introduction", book.Content[0].Chapter)
+	assert.Len(t, book.Content[0].Sections, 2)
+	assert.Equal(t, "Basics", book.Content[1].Chapter)
+	assert.Len(t, book.Content[1].Sections, 1)
+
+	require.Len(t, sections, 3)
+	assert.Equal(t, "Introduction", sections[0].Title)
+	assert.Equal(t, "Why Go.", sections[0].Content)
+	assert.Equal(t, "Audience", sections[1].Title)
+	assert.Equal(t, "Everyone.", sections[1].Content)
+	assert.Equal(t, "Types", sections[2].Title)
+	assert.Equal(t, "```go\n# not a heading\n## nor this\n```\n\n### Kept in the section\n\nText\n\nMore on types.", sections[2].Content)
+	assert.Contains(t, sections[2].Html, `<pre><code class="language-go"># not a heading`)
+}
+
+func TestImportBookReportsSkippedFiles(t *testing.T) {
+	app := test.CreateApp()
+
+	files := fstest.MapFS{
+		"Book.txt":     manuscriptFile("notes.md\n../secret.md\nmissing.md\nnotes.md\nempty.md\n"),
+		"notes.md":     manuscriptFile("Loose text\n\n## A section\n\nBody"),
+		"empty.md":     manuscriptFile("\n\n"),
+		"draft.md":     manuscriptFile("# Draft"),
+		".git/HEAD.md": manuscriptFile("ignored"),
+	}
+	book, saved := expectImport(app, &models.Book{})
+
+	imported, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(authorUser, files, &dtos.BookDto{})
+
+	require.Nil(t, err)
+	assert.Equal(t, []models.ImportedFile{
+		{File: "Book.txt", Warnings: []string{
+			`line 2: "../secret.md" is outside the manuscript, skipped`,
+			`line 4: "notes.md" is listed twice, skipped`,
+			`no title given, used the first chapter "notes"`,
+		}},
+		{File: "notes.md", Chapters: 1, Sections: 2, Warnings: []string{`line 1: text before any chapter, added to chapter "notes"`}},
+		{File: "missing.md", Warnings: []string{"not found, skipped"}},
+		{File: "empty.md", Warnings: []string{"empty"}},
+		{File: "draft.md", Warnings: []string{"not listed in Book.txt, skipped"}},
+	}, imported.Files)
+
+	sections := *saved
+	assert.Equal(t, "notes", book.Title)
+	assert.Equal(t, "notes", sections[0].Title)
+	assert.Equal(t, "Loose text", sections[0].Content)
+}
+
+func TestImportBookIsWrongWithoutManifest(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(authorUser, fstest.MapFS{"intro.md": manuscriptFile("# Intro")}, &dtos.BookDto{})
+
+	assert.Equal(t, domain.ErrInvalidManuscript, err)
+}
+
+func TestImportBookIsWrongWithoutContent(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(authorUser, fstest.MapFS{"Book.txt": manuscriptFile("missing.md")}, &dtos.BookDto{})
+
+	assert.Equal(t, domain.ErrInvalidManuscript, err)
+	app.DataStore.AssertNotCalled(t, "SaveBook", mock.Anything, mock.Anything)
+}
+
+func TestImportBookIsWrongInvalidBook(t *testing.T) {
+	app := test.CreateApp()
+
+	files := fstest.MapFS{
+		"Book.txt": manuscriptFile("long.md"),
+		"long.md":  manuscriptFile("# " + strings.Repeat("Long ", 50) + "\n\nText\n"),
+	}
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(authorUser, files, &dtos.BookDto{})
+
+	require.True(t, errors.Is(err, domain.ErrValidation), "the first chapter is too long to be the title")
+	assert.Equal(t, "title", err.(*domain.Error).Details[0].Field)
+	app.DataStore.AssertNotCalled(t, "SaveBook", mock.Anything, mock.Anything)
+}
+
+func TestImportBookIsWrongNotAuthenticated(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(nil, fstest.MapFS{}, &dtos.BookDto{})
+
+	assert.Equal(t, domain.ErrUnauthorized, err)
+}
+
+func TestImportBookIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(readerUser, fstest.MapFS{}, &dtos.BookDto{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestImportBookIsWrongForOtherAuthors(t *testing.T) {
+	app := test.CreateApp()
+
+	files := fstest.MapFS{
+		"Book.txt": manuscriptFile("intro.md"),
+		"intro.md": manuscriptFile("# Intro"),
+	}
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.ImportBook(readerUser, files, &dtos.BookDto{Authors: []models.Author{{AuthorId: authorUser.Id}}})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"strings"
+	"time"
+)
+
+// bookTransitions lists, for each target state, the states a book may move
+// to it from. Books saved before states were enforced have no state and are
+// treated as unpublished.
+var bookTransitions = map[models.StateBook][]models.StateBook{
+	models.StatePublished:   {models.StateUnpublished, models.StateRetired},
+	models.StateUnpublished: {models.StatePublished},
+	models.StateRetired:     {models.StatePublished},
+	models.StateClosed:      {models.StateUnpublished, models.StatePublished, models.StateRetired},
+}
+
+// PublishBook makes the book available to readers. The first time, its draft
+// becomes version 1 in the same write as the state change; later changes
+// reach readers through PublishVersion.
+func (bookUseCase BookUseCase) PublishBook(actor *models.User, id string) (*models.Book, error) {
+	storedBook, transition, err := bookUseCase.bookTransition(actor, id, models.StatePublished)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedBook.LatestVersion > 0 {
+		return bookUseCase.datastore.ChangeBookState(id, storedBook.State, transition)
+	}
+
+	version, err := newVersion(bookUseCase.datastore, actor, storedBook, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return bookUseCase.datastore.PublishBook(id, storedBook.State, transition, version)
+}
+
+func (bookUseCase BookUseCase) UnpublishBook(actor *models.User, id string) (*models.Book, error) {
+	return bookUseCase.changeBookState(actor, id, models.StateUnpublished)
+}
+
+func (bookUseCase BookUseCase) RetireBook(actor *models.User, id string) (*models.Book, error) {
+	return bookUseCase.changeBookState(actor, id, models.StateRetired)
+}
+
+func (bookUseCase BookUseCase) CloseBook(actor *models.User, id string) (*models.Book, error) {
+	return bookUseCase.changeBookState(actor, id, models.StateClosed)
+}
+
+func (bookUseCase BookUseCase) changeBookState(actor *models.User, id string, to models.StateBook) (*models.Book, error) {
+	storedBook, transition, err := bookUseCase.bookTransition(actor, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookUseCase.datastore.ChangeBookState(id, storedBook.State, transition)
+}
+
+// bookTransition checks that actor may move the book to the state and returns
+// the stored book with the transition to record.
+func (bookUseCase BookUseCase) bookTransition(actor *models.User, id string, to models.StateBook) (*models.Book, *models.BookStateTransition, error) {
+	storedBook, err := bookUseCase.datastore.GetBookById(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := requireBookAuthorOrAdmin(actor, storedBook); err != nil {
+		return nil, nil, err
+	}
+
+	if !canTransition(storedBook.State, to) {
+		return nil, nil, domain.ErrInvalidStateTransition
+	}
+
+	if to == models.StatePublished {
+		if err := validatePublishable(storedBook); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return storedBook, &models.BookStateTransition{
+		From:      storedBook.State,
+		To:        to,
+		ActorId:   actor.Id,
+		ChangedAt: time.Now(),
+	}, nil
+}
+
+func canTransition(from models.StateBook, to models.StateBook) bool {
+	if from == "" {
+		from = models.StateUnpublished
+	}
+
+	for _, allowed := range bookTransitions[to] {
+		if allowed == from {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validatePublishable checks that a book has a title, at least one chapter,
+// a price readers can pay and royalty shares that can be split.
+func validatePublishable(book *models.Book) error {
+	if strings.TrimSpace(book.Title) == "" || len(book.Content) == 0 || book.MinimumPrice < 0 {
+		return domain.ErrBookNotPublishable
+	}
+
+	for _, author := range book.Authors {
+		if author.RoyaltyShare < 0 {
+			return domain.ErrBookNotPublishable
+		}
+	}
+
+	return nil
+}
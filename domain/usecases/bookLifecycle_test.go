@@ -0,0 +1,202 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+func publishableBook(state models.StateBook) *models.Book {
+	return &models.Book{
+		Id:           "312312",
+		Authors:      []models.Author{{AuthorId: "211212"}},
+		Title:        "test",
+		Content:      []models.BookContent{{Chapter: "test"}},
+		MinimumPrice: 10,
+		State:        state,
+	}
+}
+
+func TestPublishBookIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	versioned := publishableBook(models.StatePublished)
+	versioned.LatestVersion = 1
+	versioned.PublishedVersion = 1
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StateUnpublished), nil)
+	app.DataStore.On("GetSectionsByBookId", "312312").Return(&models.BookSections{Sections: []models.BookSection{}}, nil)
+	app.DataStore.On("PublishBook", "312312", models.StateUnpublished, mock.MatchedBy(func(transition *models.BookStateTransition) bool {
+		return transition.To == models.StatePublished && transition.ActorId == authorUser.Id && !transition.ChangedAt.IsZero()
+	}), mock.MatchedBy(func(version *models.BookVersion) bool {
+		return version.BookId == "312312" && version.Number == 1 && version.PublishedBy == authorUser.Id
+	})).Return(versioned, nil)
+
+	book, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishBook(authorUser, "312312")
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.StatePublished, book.State)
+	assert.Equal(t, 1, book.PublishedVersion)
+	app.DataStore.AssertNotCalled(t, "ChangeBookState", mock.Anything, mock.Anything, mock.Anything)
+	app.DataStore.AssertNotCalled(t, "SaveBookVersion", mock.Anything)
+}
+
+func TestPublishBookAgainKeepsItsVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	retired := publishableBook(models.StateRetired)
+	retired.LatestVersion = 2
+	retired.PublishedVersion = 1
+	published := *retired
+	published.State = models.StatePublished
+	app.DataStore.On("GetBookById", "312312").Return(retired, nil)
+	app.DataStore.On("ChangeBookState", "312312", models.StateRetired, mock.Anything).Return(&published, nil)
+
+	book, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishBook(authorUser, "312312")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, book.PublishedVersion)
+	app.DataStore.AssertNotCalled(t, "SaveBookVersion", mock.Anything)
+}
+
+func TestPublishBookWithoutStateIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	versioned := publishableBook(models.StatePublished)
+	versioned.LatestVersion = 1
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(""), nil)
+	app.DataStore.On("GetSectionsByBookId", "312312").Return(&models.BookSections{}, nil)
+	app.DataStore.On("PublishBook", "312312", models.StateBook(""), mock.Anything, mock.Anything).Return(versioned, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishBook(adminUser, "312312")
+
+	assert.Nil(t, err)
+}
+
+func TestPublishBookIsWrongNotPublishable(t *testing.T) {
+	app := test.CreateApp()
+
+	book := publishableBook(models.StateUnpublished)
+	book.Content = nil
+	app.DataStore.On("GetBookById", "312312").Return(book, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishBook(authorUser, "312312")
+
+	assert.Equal(t, domain.ErrBookNotPublishable, err)
+	app.DataStore.AssertNotCalled(t, "ChangeBookState", mock.Anything, mock.Anything, mock.Anything)
+	app.DataStore.AssertNotCalled(t, "PublishBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRetireBookIsWrongTransition(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StateUnpublished), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.RetireBook(authorUser, "312312")
+
+	assert.Equal(t, domain.ErrInvalidStateTransition, err)
+}
+
+func TestCloseBookIsWrongAlreadyClosed(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StateClosed), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.CloseBook(adminUser, "312312")
+
+	assert.Equal(t, domain.ErrInvalidStateTransition, err)
+}
+
+func TestUnpublishBookIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StatePublished), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UnpublishBook(&models.User{Id: "1234567890"}, "312312")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestGetBookByIdIsWrongUnpublishedForAnonymous(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StateUnpublished), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookById(nil, "312312")
+
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+func TestGetBookIndexIsWrongUnpublishedForReader(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StateUnpublished), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookIndex(readerUser, "312312")
+
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+	app.DataStore.AssertNotCalled(t, "GetSectionsByBookId", mock.Anything)
+}
+
+func TestGetBookIndexShowsUnpublishedToAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	book := publishableBook(models.StateUnpublished)
+	app.DataStore.On("GetBookById", "312312").Return(book, nil)
+	expectPublishedVersion(app, book)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookIndex(authorUser, "312312")
+
+	assert.Nil(t, err)
+}
+
+func TestGetBooksByAuthorShowsEveryStateToAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBooksByAuthor", authorUser.Id, models.StateBook(""), mock.Anything).Return(&[]models.Book{}, int64(0), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBooksByAuthor(authorUser, authorUser.Id, models.ListOptions{})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateBookKeepsStoredState(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "312312").Return(publishableBook(models.StatePublished), nil)
+	app.DataStore.On("UpdateBook", mock.MatchedBy(func(book *models.Book) bool {
+		return book.State == models.StatePublished
+	}), mock.Anything).Return(publishableBook(models.StatePublished), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, &models.Book{Id: "312312", State: models.StateClosed})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
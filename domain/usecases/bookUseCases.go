@@ -5,6 +5,7 @@ import (
 	"leanpub-app/domain"
 	"leanpub-app/domain/models"
 	"leanpub-app/domain/models/dtos"
+	"strings"
 )
 
 type BookUseCase struct {
@@ -17,8 +18,16 @@ func NewBookUseCase(datastore domain.DatabaseGateway) BookUseCase {
 	}
 }
 
-func (bookUseCase BookUseCase) SaveBook(book *dtos.BookDto) (*models.Book, error) {
-	var bookSection []interface{}
+func (bookUseCase BookUseCase) SaveBook(actor *models.User, book *dtos.BookDto) (*models.Book, error) {
+	if err := requireAuthorOrAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	if !actor.IsAdmin && !isBookAuthor(actor, &models.Book{Authors: book.Authors}) {
+		return nil, domain.ErrForbidden
+	}
+
+	var bookSection []models.BookSection
 	var newContents []models.BookContent
 	for _, content := range book.Content {
 		var sections []models.BookSectionId
@@ -45,18 +54,14 @@ func (bookUseCase BookUseCase) SaveBook(book *dtos.BookDto) (*models.Book, error
 
 		newContents = append(newContents, newContent)
 	}
-
-	err := bookUseCase.datastore.SaveBookSections(bookSection)
-	if err != nil {
-		return nil, err
-	}
+	renderSections(bookSection, bookSection)
 
 	id, _ := uuid.NewRandom()
 
 	newBook := models.Book{
 		Id: id.String(),
 		Authors: book.Authors,
-		AuthorCount: book.AuthorCount,
+		AuthorCount: len(book.Authors),
 		Title: book.Title,
 		AboutTheBook: book.AboutTheBook,
 		Description: book.Description,
@@ -64,45 +69,75 @@ func (bookUseCase BookUseCase) SaveBook(book *dtos.BookDto) (*models.Book, error
 		CoverImage: book.CoverImage,
 		MinimumPrice: book.MinimumPrice,
 		SuggestedPrice: book.SuggestedPrice,
-		Reviews: book.Reviews,
-		State: book.State,
-		CreatedAt: book.CreatedAt,
-		UpdatedAt: book.UpdatedAt,
+		State: models.StateUnpublished,
 		LanguageName: book.LanguageName,
 		LanguageCode: book.LanguageCode,
 		Categories: book.Categories,
 		ReadingOptions: book.ReadingOptions,
 	}
 
-	return bookUseCase.datastore.SaveBook(&newBook)
+	return bookUseCase.datastore.SaveBook(&newBook, bookSection)
 }
 
 func (bookUseCase BookUseCase) SaveBookSections(bookSections []interface{}) error {
 	return bookUseCase.datastore.SaveBookSections(bookSections)
 }
 
-func (bookUseCase BookUseCase) GetBooks() (*[]models.Book, error) {
-	return bookUseCase.datastore.GetBooks()
+func (bookUseCase BookUseCase) GetBooks(actor *models.User, listOptions models.ListOptions) (*models.Page, error) {
+	listOptions, err := normalizeListOptions(listOptions, models.Book{})
+	if err != nil {
+		return nil, err
+	}
+
+	books, total, err := bookUseCase.datastore.GetBooks(catalogState(actor), listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(books, total, listOptions), nil
 }
 
-func (bookUseCase BookUseCase) GetBookIndex(id string) (*[]models.Index, error) {
-	bookIndex, err := bookUseCase.datastore.GetBookIndex(id)
+// GetBookIndex lists the chapters and sections of the published version of
+// the book. Books actor cannot see are reported as not found.
+func (bookUseCase BookUseCase) GetBookIndex(actor *models.User, id string) (*[]models.Index, error) {
+	book, err := bookUseCase.datastore.GetBookById(id)
 	if err != nil {
 		return nil, err
 	}
 
+	if !canSeeBook(actor, book) {
+		return nil, domain.ErrBookNotFound
+	}
+
+	version, err := publishedVersion(bookUseCase.datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := indexContent(version.Content, versionSection(version))
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// indexContent lists every chapter of content with the titles of its
+// sections, loading each section with section. The EPUB table of contents is
+// built from it too, so both stay the same.
+func indexContent(content []models.BookContent, section func(id string) (*models.BookSection, error)) ([]models.Index, error) {
 	var response []models.Index
 
-	for _, content := range bookIndex.Content {
+	for _, content := range content {
 		var sections []models.BookSectionIndex
-		for _, section := range content.Sections{
-			bookSection, err := bookUseCase.GetBookSectionById(section.SectionId)
+		for _, sectionId := range content.Sections {
+			bookSection, err := section(sectionId.SectionId)
 			if err != nil {
 				return nil, err
 			}
 
 			newSection := models.BookSectionIndex{
-				Id: bookSection.Id,
+				Id:    bookSection.Id,
 				Title: bookSection.Title,
 			}
 
@@ -110,40 +145,208 @@ func (bookUseCase BookUseCase) GetBookIndex(id string) (*[]models.Index, error)
 		}
 
 		newResponse := models.Index{
-			Chapter: content.Chapter,
+			Chapter:  content.Chapter,
 			Sections: sections,
 		}
 
 		response = append(response, newResponse)
 	}
 
-	return &response, nil
+	return response, nil
 }
 
-func (bookUseCase BookUseCase) GetSectionsByBookId(bookId string) (*models.BookSections, error) {
-	return bookUseCase.datastore.GetSectionsByBookId(bookId)
+// GetSectionsByBookId returns every section of the published version to
+// readers who may read the whole book and only the sample sections to
+// everyone else.
+func (bookUseCase BookUseCase) GetSectionsByBookId(actor *models.User, bookId string) (*models.BookSections, error) {
+	book, err := bookUseCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := readableBook(bookUseCase.datastore, actor, book)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := publishedVersion(bookUseCase.datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	if full {
+		return &models.BookSections{Sections: version.Sections}, nil
+	}
+
+	sample := sampleSectionIds(version.Content)
+	readable := []models.BookSection{}
+	for _, section := range version.Sections {
+		if sample[section.Id] {
+			readable = append(readable, section)
+		}
+	}
+
+	return &models.BookSections{Sections: readable}, nil
 }
 
-func (bookUseCase BookUseCase) GetBookSectionById(id string) (*models.BookSection, error){
-	return bookUseCase.datastore.GetBookSectionById(id)
+// GetBookSectionById returns a section of the published version of a book
+// the caller may read, or one of its sample sections.
+func (bookUseCase BookUseCase) GetBookSectionById(actor *models.User, id string) (*models.BookSection, error) {
+	book, err := bookUseCase.datastore.GetBookBySectionId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := readableBook(bookUseCase.datastore, actor, book)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := publishedVersion(bookUseCase.datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	section, err := versionSection(version)(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !full && !sampleSectionIds(version.Content)[id] {
+		return nil, domain.ErrBookNotOwned
+	}
+
+	return section, nil
 }
 
-func (bookUseCase BookUseCase) GetBookById(id string) (*models.Book, error) {
-	return bookUseCase.datastore.GetBookById(id)
+func (bookUseCase BookUseCase) GetBookById(actor *models.User, id string) (*models.Book, error) {
+	book, err := bookUseCase.datastore.GetBookById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canSeeBook(actor, book) {
+		return nil, domain.ErrBookNotFound
+	}
+
+	return book, nil
 }
 
-func (bookUseCase BookUseCase) GetBooksByAuthor(authorId string) (*[]models.Book, error) {
-	return bookUseCase.datastore.GetBooksByAuthor(authorId)
+// GetBooksByAuthor lists every book of the author to the author themselves
+// and to admins, and only the published ones to everyone else.
+func (bookUseCase BookUseCase) GetBooksByAuthor(actor *models.User, authorId string, listOptions models.ListOptions) (*models.Page, error) {
+	listOptions, err := normalizeListOptions(listOptions, models.Book{})
+	if err != nil {
+		return nil, err
+	}
+
+	state := catalogState(actor)
+	if actor != nil && actor.Id == authorId {
+		state = ""
+	}
+
+	books, total, err := bookUseCase.datastore.GetBooksByAuthor(authorId, state, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(books, total, listOptions), nil
 }
 
-func (bookUseCase BookUseCase) GetBooksByCategory(category string) (*[]models.Book, error) {
-	return bookUseCase.datastore.GetBooksByCategory(category)
+func (bookUseCase BookUseCase) GetBooksByCategory(actor *models.User, category string, listOptions models.ListOptions) (*models.Page, error) {
+	listOptions, err := normalizeListOptions(listOptions, models.Book{})
+	if err != nil {
+		return nil, err
+	}
+
+	books, total, err := bookUseCase.datastore.GetBooksByCategory(category, catalogState(actor), listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(books, total, listOptions), nil
+}
+
+// SearchBooks ranks the matching books by relevance. Results are always
+// ordered by score, so a sort option is rejected. Only admins may search
+// books that are not published.
+func (bookUseCase BookUseCase) SearchBooks(actor *models.User, search models.BookSearch, listOptions models.ListOptions) (*models.Page, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, domain.ErrInvalidSearch
+	}
+
+	if search.MinPrice != nil && search.MaxPrice != nil && *search.MinPrice > *search.MaxPrice {
+		return nil, domain.ErrInvalidSearch
+	}
+
+	if len(listOptions.Sort) > 0 {
+		return nil, domain.ErrInvalidSortField
+	}
+
+	if state := catalogState(actor); state != "" {
+		search.State = state
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Book{})
+	if err != nil {
+		return nil, err
+	}
+
+	results, total, err := bookUseCase.datastore.SearchBooks(search, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(results, total, listOptions), nil
 }
 
-func (bookUseCase BookUseCase) DeleteBook(id string) error {
-	return bookUseCase.datastore.DeleteBook(id)
+// DeleteBook deletes the book. A non-zero version must be the stored version.
+func (bookUseCase BookUseCase) DeleteBook(actor *models.User, id string, version int) error {
+	storedBook, err := bookUseCase.datastore.GetBookById(id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireBookAuthorOrAdmin(actor, storedBook); err != nil {
+		return err
+	}
+
+	version, err = matchVersion(version, storedBook.Version)
+	if err != nil {
+		return err
+	}
+
+	return bookUseCase.datastore.DeleteBook(id, version)
 }
 
-func (bookUseCase BookUseCase) UpdateBook(book *models.Book) (*models.Book, error) {
-	return bookUseCase.datastore.UpdateBook(book)
+func (bookUseCase BookUseCase) UpdateBook(actor *models.User, book *models.Book) (*models.Book, error) {
+	storedBook, err := bookUseCase.datastore.GetBookById(book.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireBookAuthorOrAdmin(actor, storedBook); err != nil {
+		return nil, err
+	}
+
+	book.Version, err = matchVersion(book.Version, storedBook.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	book.State = storedBook.State
+	book.CreatedAt = storedBook.CreatedAt
+	book.Transitions = storedBook.Transitions
+	book.Reviews = storedBook.Reviews
+	book.Rating = storedBook.Rating
+	book.LatestVersion = storedBook.LatestVersion
+	book.PublishedVersion = storedBook.PublishedVersion
+
+	removed, err := removedSections(storedBook.Content, book.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookUseCase.datastore.UpdateBook(book, removed)
 }
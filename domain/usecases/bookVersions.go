@@ -0,0 +1,227 @@
+package usecases
+
+import (
+	"fmt"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+)
+
+// The content and sections of a book are its draft: authors edit them and
+// preview them with PreviewBook. Readers see the version the book's
+// PublishedVersion points to, which PublishVersion copies from the draft and
+// RollbackVersion moves back to an earlier one.
+
+// PublishVersion copies the draft of a published book into a new version,
+// makes it the one readers see and tells the users who own the book that it
+// is available. Unpublished books get their first version from PublishBook.
+func (bookUseCase BookUseCase) PublishVersion(actor *models.User, bookId string, version *dtos.VersionDto) (*models.BookVersion, error) {
+	book, err := bookUseCase.editableBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.State != models.StatePublished {
+		return nil, domain.ErrBookNotPublished
+	}
+
+	if len(book.Content) == 0 {
+		return nil, domain.ErrBookNotPublishable
+	}
+
+	published, err := newVersion(bookUseCase.datastore, actor, book, version.ReleaseNotes)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = bookUseCase.datastore.SaveBookVersion(published)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bookUseCase.notifyOwners(actor, book, published); err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// RollbackVersion shows readers an earlier version again. The draft is left
+// as it is, and publishing again numbers the new version after the latest one.
+func (bookUseCase BookUseCase) RollbackVersion(actor *models.User, bookId string, number int) (*models.Book, error) {
+	book, err := bookUseCase.editableBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if number < 1 || number > book.LatestVersion {
+		return nil, domain.ErrVersionNotFound
+	}
+
+	return bookUseCase.datastore.SetPublishedVersion(book.Id, number)
+}
+
+// PreviewBook shows the draft of the book the way readers will see it once
+// published, as a version numbered 0.
+func (bookUseCase BookUseCase) PreviewBook(actor *models.User, bookId string) (*models.BookVersion, error) {
+	book, err := bookUseCase.editableBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	return draftVersion(bookUseCase.datastore, book)
+}
+
+// GetBookVersion returns a version with its content and sections, which only
+// the authors of the book and admins may read whole; readers get the
+// published one through the section endpoints.
+func (bookUseCase BookUseCase) GetBookVersion(actor *models.User, bookId string, number int) (*models.BookVersion, error) {
+	book, err := bookUseCase.editableBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookUseCase.datastore.GetBookVersion(book.Id, number)
+}
+
+// GetBookVersions lists the versions of a book, newest first unless sorted
+// otherwise, with their release notes but without their content.
+func (bookUseCase BookUseCase) GetBookVersions(actor *models.User, bookId string, listOptions models.ListOptions) (*models.Page, error) {
+	book, err := bookUseCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canSeeBook(actor, book) {
+		return nil, domain.ErrBookNotFound
+	}
+
+	listOptions, err = normalizeListOptions(listOptions, models.BookVersion{}, "content", "sections")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(listOptions.Sort) == 0 {
+		listOptions.Sort = []models.SortField{{Field: "number", Descending: true}}
+	}
+
+	versions, total, err := bookUseCase.datastore.GetBookVersions(book.Id, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(versions, total, listOptions), nil
+}
+
+// newVersion copies the draft of the book into an unsaved version numbered
+// after its latest one.
+func newVersion(datastore domain.DatabaseGateway, actor *models.User, book *models.Book, releaseNotes string) (*models.BookVersion, error) {
+	version, err := draftVersion(datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	version.Number = book.LatestVersion + 1
+	version.ReleaseNotes = releaseNotes
+	version.PublishedBy = actor.Id
+	return version, nil
+}
+
+// notifyOwners tells the users who own the book, other than its authors and
+// actor, that a new version is available.
+func (bookUseCase BookUseCase) notifyOwners(actor *models.User, book *models.Book, version *models.BookVersion) error {
+	ownerIds, err := bookUseCase.datastore.GetBookOwnerIds(book.Id)
+	if err != nil {
+		return err
+	}
+
+	skipped := map[string]bool{actor.Id: true}
+	for _, author := range book.Authors {
+		skipped[author.AuthorId] = true
+	}
+
+	var notifications []models.Notification
+	for _, ownerId := range ownerIds {
+		if skipped[ownerId] {
+			continue
+		}
+
+		notifications = append(notifications, models.Notification{
+			UserId:  ownerId,
+			Type:    models.NotificationBookUpdated,
+			BookId:  book.Id,
+			Version: version.Number,
+			Message: fmt.Sprintf("Version %d of %q is available.", version.Number, book.Title),
+		})
+	}
+
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	return bookUseCase.datastore.SaveNotifications(notifications)
+}
+
+// publishedVersion returns what readers of the book see. Books published
+// before versions were kept have no published version and show their draft.
+func publishedVersion(datastore domain.DatabaseGateway, book *models.Book) (*models.BookVersion, error) {
+	if book.PublishedVersion == 0 {
+		return draftVersion(datastore, book)
+	}
+
+	return datastore.GetBookVersion(book.Id, book.PublishedVersion)
+}
+
+// draftVersion collects the content of the book and its sections, in the
+// order of the content, into an unsaved version.
+func draftVersion(datastore domain.DatabaseGateway, book *models.Book) (*models.BookVersion, error) {
+	bookSections, err := datastore.GetSectionsByBookId(book.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	renderStaleSections(bookSections.Sections)
+
+	stored := map[string]models.BookSection{}
+	for _, section := range bookSections.Sections {
+		stored[section.Id] = section
+	}
+
+	sections := []models.BookSection{}
+	for _, id := range contentSectionIds(book.Content) {
+		if section, found := stored[id]; found {
+			sections = append(sections, section)
+		}
+	}
+
+	return &models.BookVersion{
+		BookId:   book.Id,
+		Content:  book.Content,
+		Sections: sections,
+	}, nil
+}
+
+// versionSection finds a section of the version by id.
+func versionSection(version *models.BookVersion) func(id string) (*models.BookSection, error) {
+	return func(id string) (*models.BookSection, error) {
+		for _, section := range version.Sections {
+			if section.Id == id {
+				section := section
+				return &section, nil
+			}
+		}
+
+		return nil, domain.ErrSectionNotFound
+	}
+}
+
+func contentSectionIds(content []models.BookContent) []string {
+	var ids []string
+	for _, chapter := range content {
+		for _, section := range chapter.Sections {
+			ids = append(ids, section.SectionId)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,182 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"testing"
+)
+
+func TestPublishVersionIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "2", "1")
+	book.Title = "Go"
+	book.LatestVersion = 1
+	book.PublishedVersion = 1
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{
+		{Id: "1", Content: "one"},
+		{Id: "2", Content: "two"},
+		{Id: "removed"},
+	}}, nil)
+	app.DataStore.On("SaveBookVersion", mock.MatchedBy(func(version *models.BookVersion) bool {
+		return version.Number == 2 && version.ReleaseNotes == "typos" && version.PublishedBy == authorUser.Id
+	})).Return(&models.Book{Id: "book", LatestVersion: 2, PublishedVersion: 2}, nil)
+	app.DataStore.On("GetBookOwnerIds", "book").Return([]string{readerUser.Id, authorUser.Id}, nil)
+	app.DataStore.On("SaveNotifications", []models.Notification{{
+		UserId:  readerUser.Id,
+		Type:    models.NotificationBookUpdated,
+		BookId:  "book",
+		Version: 2,
+		Message: `Version 2 of "Go" is available.`,
+	}}).Return(nil)
+
+	version, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishVersion(authorUser, "book", &dtos.VersionDto{ReleaseNotes: "typos"})
+
+	require.Nil(t, err)
+	assert.Equal(t, 2, version.Number)
+	assert.Equal(t, []string{"2", "1"}, contentSectionIds(version.Content))
+	require.Len(t, version.Sections, 2, "sections left out of the content are not kept")
+	assert.Equal(t, "2", version.Sections[0].Id)
+	assert.Equal(t, "<p>two</p>", version.Sections[0].Html)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestPublishVersionWithoutOtherOwnersSendsNothing(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book", "1"), nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{}, nil)
+	app.DataStore.On("SaveBookVersion", mock.Anything).Return(&models.Book{}, nil)
+	app.DataStore.On("GetBookOwnerIds", "book").Return([]string{adminUser.Id}, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishVersion(adminUser, "book", &dtos.VersionDto{})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertNotCalled(t, "SaveNotifications", mock.Anything)
+}
+
+func TestPublishVersionIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book", "1"), nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishVersion(readerUser, "book", &dtos.VersionDto{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+	app.DataStore.AssertNotCalled(t, "SaveBookVersion", mock.Anything)
+}
+
+func TestPublishVersionIsWrongWithoutContent(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(&models.Book{Id: "book", Authors: []models.Author{{AuthorId: authorUser.Id}}, State: models.StatePublished}, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishVersion(authorUser, "book", &dtos.VersionDto{})
+
+	assert.Equal(t, domain.ErrBookNotPublishable, err)
+	app.DataStore.AssertNotCalled(t, "SaveBookVersion", mock.Anything)
+}
+
+func TestPublishVersionIsWrongNotPublished(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	book.State = models.StateUnpublished
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PublishVersion(authorUser, "book", &dtos.VersionDto{})
+
+	assert.Equal(t, domain.ErrBookNotPublished, err)
+	app.DataStore.AssertNotCalled(t, "SaveBookVersion", mock.Anything)
+}
+
+func TestRollbackVersionIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	book.LatestVersion = 3
+	book.PublishedVersion = 3
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("SetPublishedVersion", "book", 2).Return(&models.Book{Id: "book", LatestVersion: 3, PublishedVersion: 2}, nil)
+
+	rolledBack, err := BookUseCase{
+		datastore: app.DataStore,
+	}.RollbackVersion(authorUser, "book", 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, rolledBack.PublishedVersion)
+}
+
+func TestRollbackVersionIsWrongUnknownVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	book.LatestVersion = 2
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+
+	for _, number := range []int{0, 3} {
+		_, err := BookUseCase{
+			datastore: app.DataStore,
+		}.RollbackVersion(authorUser, "book", number)
+
+		assert.Equal(t, domain.ErrVersionNotFound, err)
+	}
+	app.DataStore.AssertNotCalled(t, "SetPublishedVersion", mock.Anything, mock.Anything)
+}
+
+func TestPreviewBookShowsTheDraft(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	book.LatestVersion = 1
+	book.PublishedVersion = 1
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{{Id: "1", Content: "draft"}}}, nil)
+
+	preview, err := BookUseCase{
+		datastore: app.DataStore,
+	}.PreviewBook(authorUser, "book")
+
+	require.Nil(t, err)
+	assert.Equal(t, 0, preview.Number)
+	assert.Equal(t, "<p>draft</p>", preview.Sections[0].Html)
+	app.DataStore.AssertNotCalled(t, "GetBookVersion", mock.Anything, mock.Anything)
+}
+
+func TestGetBookVersionsHidesContent(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book", "1"), nil)
+	app.DataStore.On("GetBookVersions", "book", mock.MatchedBy(func(listOptions models.ListOptions) bool {
+		return len(listOptions.Sort) == 1 && listOptions.Sort[0].Field == "number" && listOptions.Sort[0].Descending
+	})).Return(&[]models.BookVersion{{Number: 2}, {Number: 1}}, int64(2), nil)
+
+	page, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookVersions(readerUser, "book", models.ListOptions{})
+
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), page.Total)
+
+	_, err = BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookVersions(readerUser, "book", models.ListOptions{Fields: []string{"sections"}})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,15 @@
+package usecases
+
+import "leanpub-app/domain"
+
+// matchVersion returns the version an update must be written at. expected is
+// the version the client read the resource at, or 0 when it did not send one
+// and the update applies to the stored version. The gateway compares the
+// version again when it writes, so a change made in between still fails.
+func matchVersion(expected int, stored int) (int, error) {
+	if expected != 0 && expected != stored {
+		return 0, domain.ErrVersionConflict
+	}
+
+	return stored, nil
+}
@@ -0,0 +1,60 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+func TestUpdateBookIsWrongStaleVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	storedBook := publishableBook(models.StateUnpublished)
+	storedBook.Version = 3
+	app.DataStore.On("GetBookById", "312312").Return(storedBook, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, &models.Book{Id: "312312", Title: "test", Version: 2})
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	app.DataStore.AssertNotCalled(t, "UpdateBook", mock.Anything, mock.Anything)
+}
+
+func TestUpdateBookWithoutVersionWritesStoredVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	storedBook := publishableBook(models.StateUnpublished)
+	storedBook.Version = 3
+	app.DataStore.On("GetBookById", "312312").Return(storedBook, nil)
+	app.DataStore.On("UpdateBook", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Version == 3
+	}), mock.Anything).Return(storedBook, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, &models.Book{Id: "312312", Title: "test"})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateShoppingCartIsWrongStaleVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetShoppingCartById", "cart").Return(&models.ShoppingCart{
+		Id:      "cart",
+		UserId:  readerUser.Id,
+		Version: 2,
+	}, nil)
+
+	_, err := ShoppingCartUseCase{
+		datastore: app.DataStore,
+	}.UpdateShoppingCart(readerUser, &models.ShoppingCart{Id: "cart", Version: 1})
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	app.DataStore.AssertNotCalled(t, "UpdateShoppingCart", mock.Anything)
+}
@@ -0,0 +1,256 @@
+package usecases
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"leanpub-app/domain/models"
+	"text/template"
+	"time"
+)
+
+const epubMimetype = "application/epub+zip"
+
+// epubCoverTypes maps the image types every EPUB 3 reading system supports to
+// the extension of the cover file. Covers of other types are left out.
+var epubCoverTypes = map[string]string{
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+}
+
+// epubBook is everything written to an EPUB package. Chapters follow
+// Book.Content.
+type epubBook struct {
+	Id       string
+	Title    string
+	Creators []string
+	Language string
+	Modified time.Time
+	Chapters []epubChapter
+	Cover    *models.File
+}
+
+type epubChapter struct {
+	File     string
+	Title    string
+	Sections []epubSection
+}
+
+// epubSection holds the rendered Html of a section, which is already escaped.
+type epubSection struct {
+	Id    string
+	Title string
+	Html  string
+}
+
+// newEpubChapters lays out the chapters of index, rendering every section
+// from sections. Links between sections point into the chapter files.
+func newEpubChapters(index []models.Index, sections map[string]models.BookSection) []epubChapter {
+	files := map[string]string{}
+	var book []models.BookSection
+	for position, chapter := range index {
+		for _, section := range chapter.Sections {
+			files[section.Id] = epubChapterFile(position)
+			book = append(book, sections[section.Id])
+		}
+	}
+
+	links := sectionLinks(book, func(id string) string {
+		return files[id] + "#" + sectionAnchor(id)
+	})
+
+	var chapters []epubChapter
+	for position, chapter := range index {
+		epubChapter := epubChapter{
+			File:  epubChapterFile(position),
+			Title: chapter.Chapter,
+		}
+
+		for _, section := range chapter.Sections {
+			epubChapter.Sections = append(epubChapter.Sections, epubSection{
+				Id:    section.Id,
+				Title: section.Title,
+				Html:  renderSection(sections[section.Id], links),
+			})
+		}
+
+		chapters = append(chapters, epubChapter)
+	}
+
+	return chapters
+}
+
+func epubChapterFile(position int) string {
+	return fmt.Sprintf("chapter-%d.xhtml", position+1)
+}
+
+type epubDocument struct {
+	name     string
+	template *template.Template
+	data     interface{}
+}
+
+type epubChapterData struct {
+	Book    epubBook
+	Chapter epubChapter
+}
+
+// CoverFile is the name of the cover inside the package, empty without one.
+func (book epubBook) CoverFile() string {
+	if book.Cover == nil {
+		return ""
+	}
+
+	return "cover" + epubCoverTypes[book.Cover.ContentType]
+}
+
+// writeEpub writes book as an EPUB 3 package. The mimetype entry goes first
+// and uncompressed so readers can recognise the file by its first bytes.
+func writeEpub(w io.Writer, book epubBook) error {
+	archive := zip.NewWriter(w)
+
+	mimetype := []byte(epubMimetype)
+	entry, err := archive.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := entry.Write(mimetype); err != nil {
+		return err
+	}
+
+	documents := []epubDocument{
+		{"META-INF/container.xml", epubContainer, book},
+		{"OEBPS/content.opf", epubPackageDocument, book},
+		{"OEBPS/nav.xhtml", epubNav, book},
+	}
+	for _, chapter := range book.Chapters {
+		documents = append(documents, epubDocument{"OEBPS/" + chapter.File, epubChapterDocument, epubChapterData{book, chapter}})
+	}
+
+	for _, document := range documents {
+		entry, err := archive.Create(document.name)
+		if err != nil {
+			return err
+		}
+
+		if err := document.template.Execute(entry, document.data); err != nil {
+			return err
+		}
+	}
+
+	if book.Cover != nil {
+		entry, err := archive.Create("OEBPS/" + book.CoverFile())
+		if err != nil {
+			return err
+		}
+
+		if _, err := entry.Write(book.Cover.Data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+var epubFuncs = template.FuncMap{
+	"escape": html.EscapeString,
+	"modified": func(modified time.Time) string {
+		return modified.UTC().Format("2006-01-02T15:04:05Z")
+	},
+}
+
+var epubContainer = template.Must(template.New("container").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`))
+
+var epubPackageDocument = template.Must(template.New("package").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{escape .Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{escape .Id}}</dc:identifier>
+    <dc:title>{{escape .Title}}</dc:title>
+{{- range .Creators}}
+    <dc:creator>{{escape .}}</dc:creator>
+{{- end}}
+    <dc:language>{{escape .Language}}</dc:language>
+    <meta property="dcterms:modified">{{modified .Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+{{- if .Cover}}
+    <item id="cover" href="{{.CoverFile}}" media-type="{{.Cover.ContentType}}" properties="cover-image"/>
+{{- end}}
+{{- range $position, $chapter := .Chapters}}
+    <item id="chapter-{{$position}}" href="{{$chapter.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="nav"/>
+{{- range $position, $chapter := .Chapters}}
+    <itemref idref="chapter-{{$position}}"/>
+{{- end}}
+  </spine>
+</package>
+`))
+
+var epubNav = template.Must(template.New("nav").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{escape .Language}}" lang="{{escape .Language}}">
+  <head>
+    <title>{{escape .Title}}</title>
+  </head>
+  <body>
+    <nav epub:type="toc" id="toc">
+      <h1>{{escape .Title}}</h1>
+      <ol>
+{{- range .Chapters}}
+        <li>
+          <a href="{{.File}}">{{escape .Title}}</a>
+{{- if .Sections}}
+          <ol>
+{{- $file := .File}}
+{{- range .Sections}}
+            <li><a href="{{$file}}#section-{{escape .Id}}">{{escape .Title}}</a></li>
+{{- end}}
+          </ol>
+{{- end}}
+        </li>
+{{- end}}
+      </ol>
+    </nav>
+  </body>
+</html>
+`))
+
+var epubChapterDocument = template.Must(template.New("chapter").Funcs(epubFuncs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="{{escape .Book.Language}}" lang="{{escape .Book.Language}}">
+  <head>
+    <title>{{escape .Chapter.Title}}</title>
+  </head>
+  <body>
+    <h1>{{escape .Chapter.Title}}</h1>
+{{- range .Chapter.Sections}}
+    <section id="section-{{escape .Id}}">
+      <h2>{{escape .Title}}</h2>
+{{.Html}}
+    </section>
+{{- end}}
+  </body>
+</html>
+`))
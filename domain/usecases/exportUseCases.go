@@ -0,0 +1,152 @@
+package usecases
+
+import (
+	"bytes"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultLanguage is written to books without a LanguageCode, since EPUB
+// packages must declare one.
+const defaultLanguage = "en"
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ExportUseCase builds downloadable copies of the books a reader may read in
+// full.
+type ExportUseCase struct {
+	datastore domain.DatabaseGateway
+	files     domain.FileGateway
+}
+
+func NewExportUseCase(datastore domain.DatabaseGateway, files domain.FileGateway) ExportUseCase {
+	return ExportUseCase{
+		datastore: datastore,
+		files:     files,
+	}
+}
+
+// ExportEpub builds an EPUB 3 package of the published version of the book.
+// Like the sections past the sample, it is only available to readers who own
+// the book, its authors, subscribers and admins.
+func (useCase ExportUseCase) ExportEpub(actor *models.User, bookId string) (*models.File, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	book, err := useCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := readableBook(useCase.datastore, actor, book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !full {
+		return nil, domain.ErrBookNotOwned
+	}
+
+	version, err := publishedVersion(useCase.datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := map[string]models.BookSection{}
+	for _, section := range version.Sections {
+		sections[section.Id] = section
+	}
+
+	index, err := indexContent(version.Content, versionSection(version))
+	if err != nil {
+		return nil, err
+	}
+
+	creators, err := useCase.creators(book)
+	if err != nil {
+		return nil, err
+	}
+
+	epub := epubBook{
+		Id:       book.Id,
+		Title:    book.Title,
+		Creators: creators,
+		Language: book.LanguageCode,
+		Modified: book.UpdatedAt,
+		Chapters: newEpubChapters(index, sections),
+		Cover:    useCase.cover(book),
+	}
+	if epub.Language == "" {
+		epub.Language = defaultLanguage
+	}
+	if epub.Modified.IsZero() {
+		epub.Modified = time.Now()
+	}
+
+	var data bytes.Buffer
+	if err := writeEpub(&data, epub); err != nil {
+		return nil, err
+	}
+
+	return &models.File{
+		Name:        exportFileName(book) + ".epub",
+		ContentType: epubMimetype,
+		Data:        data.Bytes(),
+	}, nil
+}
+
+// creators lists the names of the authors of the book, skipping authors
+// without one and authors whose account was deleted.
+func (useCase ExportUseCase) creators(book *models.Book) ([]string, error) {
+	var creators []string
+	for _, author := range book.Authors {
+		user, err := useCase.datastore.GetUserById(author.AuthorId)
+		if err == domain.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if user.Name != "" {
+			creators = append(creators, user.Name)
+		}
+	}
+
+	return creators, nil
+}
+
+// cover downloads the cover of the book. A cover that cannot be downloaded or
+// that reading systems may not display is left out rather than failing the
+// export.
+func (useCase ExportUseCase) cover(book *models.Book) *models.File {
+	if book.CoverImage == "" {
+		return nil
+	}
+
+	cover, err := useCase.files.GetFile(book.CoverImage)
+	if err != nil {
+		return nil
+	}
+
+	if _, supported := epubCoverTypes[cover.ContentType]; !supported {
+		return nil
+	}
+
+	return cover
+}
+
+// exportFileName turns the title of the book into a file name, falling back
+// to its id for titles without letters or digits.
+func exportFileName(book *models.Book) string {
+	name := strings.Trim(unsafeFileNameCharacters.ReplaceAllString(strings.ToLower(book.Title), "-"), "-")
+	if name == "" {
+		return book.Id
+	}
+
+	return name
+}
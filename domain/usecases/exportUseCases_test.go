@@ -0,0 +1,204 @@
+package usecases
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"strings"
+	"testing"
+)
+
+// epubEntries reads every entry of an EPUB package by name, in order.
+func epubEntries(t *testing.T, data []byte) ([]string, map[string]string) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.Nil(t, err)
+
+	var names []string
+	entries := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.Nil(t, err)
+		content, err := io.ReadAll(reader)
+		require.Nil(t, err)
+
+		names = append(names, file.Name)
+		entries[file.Name] = string(content)
+	}
+
+	return names, entries
+}
+
+func exportableBook() *models.Book {
+	book := sampleBook("book", "1", "2")
+	book.Title = "Go & You"
+	book.LanguageCode = "es"
+	book.CoverImage = "https://example.com/cover.png"
+	book.Content = append(book.Content, models.BookContent{Chapter: "second", Sections: []models.BookSectionId{{SectionId: "3"}}})
+	return book
+}
+
+func TestExportEpubIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(exportableBook(), nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{
+		{Id: "3", Title: "Third", Content: "last"},
+		{Id: "1", Title: "First", Content: "one\n\ntwo <b>"},
+		{Id: "2", Title: "Second", Content: "more"},
+	}}, nil)
+	app.DataStore.On("GetUserById", authorUser.Id).Return(&models.User{Id: authorUser.Id, Name: "Ana"}, nil)
+	app.Files.On("GetFile", "https://example.com/cover.png").Return(&models.File{ContentType: "image/png", Data: []byte("png")}, nil)
+
+	file, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(readerUser, "book")
+
+	require.Nil(t, err)
+	assert.Equal(t, "go-you.epub", file.Name)
+	assert.Equal(t, epubMimetype, file.ContentType)
+
+	names, entries := epubEntries(t, file.Data)
+	assert.Equal(t, []string{
+		"mimetype",
+		"META-INF/container.xml",
+		"OEBPS/content.opf",
+		"OEBPS/nav.xhtml",
+		"OEBPS/chapter-1.xhtml",
+		"OEBPS/chapter-2.xhtml",
+		"OEBPS/cover.png",
+	}, names)
+	assert.Equal(t, epubMimetype, entries["mimetype"])
+
+	archive, _ := zip.NewReader(bytes.NewReader(file.Data), int64(len(file.Data)))
+	assert.Equal(t, zip.Store, archive.File[0].Method)
+
+	for name, content := range entries {
+		if name == "mimetype" || name == "OEBPS/cover.png" {
+			continue
+		}
+
+		decoder := xml.NewDecoder(strings.NewReader(content))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err, name)
+		}
+	}
+
+	assert.Contains(t, entries["OEBPS/content.opf"], "<dc:title>Go &amp; You</dc:title>")
+	assert.Contains(t, entries["OEBPS/content.opf"], "<dc:creator>Ana</dc:creator>")
+	assert.Contains(t, entries["OEBPS/content.opf"], "<dc:language>es</dc:language>")
+	assert.Contains(t, entries["OEBPS/content.opf"], `href="cover.png" media-type="image/png" properties="cover-image"`)
+	assert.Regexp(t, `(?s)chapter-1.xhtml#section-1">First.*chapter-1.xhtml#section-2">Second.*chapter-2.xhtml#section-3">Third`, entries["OEBPS/nav.xhtml"])
+	assert.Contains(t, entries["OEBPS/chapter-1.xhtml"], "<p>one</p>")
+	assert.Contains(t, entries["OEBPS/chapter-1.xhtml"], "<p>two &lt;b&gt;</p>")
+}
+
+func TestExportEpubLinksSectionsAcrossChapters(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(exportableBook(), nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{
+		{Id: "1", Title: "First", Content: "See [the third](#third)[^1].\n\n[^1]: A note."},
+		{Id: "2", Title: "Second", Content: "```go\nfmt.Println(\"<b>\")\n```"},
+		{Id: "3", Title: "Third", Html: "<p>stale</p>", Content: "Back to [the first](#1)."},
+	}}, nil)
+	app.DataStore.On("GetUserById", authorUser.Id).Return(&models.User{Id: authorUser.Id}, nil)
+	app.Files.On("GetFile", mock.Anything).Return(nil, domain.ErrFileNotFound)
+
+	file, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(authorUser, "book")
+
+	require.Nil(t, err)
+	_, entries := epubEntries(t, file.Data)
+	assert.Contains(t, entries["OEBPS/chapter-1.xhtml"], `<a href="chapter-2.xhtml#section-3">the third</a>`)
+	assert.Contains(t, entries["OEBPS/chapter-1.xhtml"], `<li id="section-1-fn-1">A note.`)
+	assert.Contains(t, entries["OEBPS/chapter-1.xhtml"], `<pre><code class="language-go">fmt.Println(&#34;&lt;b&gt;&#34;)`)
+	assert.Contains(t, entries["OEBPS/chapter-2.xhtml"], `<a href="chapter-1.xhtml#section-1">the first</a>`)
+	assert.NotContains(t, entries["OEBPS/chapter-2.xhtml"], "stale")
+}
+
+func TestExportEpubIsWrongNotOwned(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(exportableBook(), nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(false, nil)
+
+	_, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(readerUser, "book")
+
+	assert.Equal(t, domain.ErrBookNotOwned, err)
+	app.DataStore.AssertNotCalled(t, "GetSectionsByBookId", mock.Anything)
+}
+
+func TestExportEpubSkipsDeletedAuthors(t *testing.T) {
+	app := test.CreateApp()
+
+	book := exportableBook()
+	book.Authors = append(book.Authors, models.Author{AuthorId: "deleted"})
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{{Id: "1"}, {Id: "2"}, {Id: "3"}}}, nil)
+	app.DataStore.On("GetUserById", authorUser.Id).Return(&models.User{Id: authorUser.Id, Name: "Ana"}, nil)
+	app.DataStore.On("GetUserById", "deleted").Return(nil, domain.ErrUserNotFound)
+	app.Files.On("GetFile", mock.Anything).Return(nil, domain.ErrFileNotFound)
+
+	file, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(authorUser, "book")
+
+	require.Nil(t, err)
+	_, entries := epubEntries(t, file.Data)
+	assert.Contains(t, entries["OEBPS/content.opf"], "Ana")
+}
+
+func TestExportEpubIsWrongAuthorLookupFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(exportableBook(), nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{{Id: "1"}, {Id: "2"}, {Id: "3"}}}, nil)
+	app.DataStore.On("GetUserById", authorUser.Id).Return(nil, errors.New("CONNECTION_FAIL"))
+
+	_, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(authorUser, "book")
+
+	assert.EqualError(t, err, "CONNECTION_FAIL")
+}
+
+func TestExportEpubLeavesOutMissingCover(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(exportableBook(), nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{Sections: []models.BookSection{{Id: "1"}, {Id: "2"}, {Id: "3"}}}, nil)
+	app.DataStore.On("GetUserById", authorUser.Id).Return(&models.User{Id: authorUser.Id}, nil)
+	app.Files.On("GetFile", mock.Anything).Return(nil, errors.New("TIMEOUT"))
+
+	file, err := ExportUseCase{
+		datastore: app.DataStore,
+		files:     app.Files,
+	}.ExportEpub(authorUser, "book")
+
+	require.Nil(t, err)
+	names, entries := epubEntries(t, file.Data)
+	assert.NotContains(t, names, "OEBPS/cover.png")
+	assert.NotContains(t, entries["OEBPS/content.opf"], "cover-image")
+	assert.NotContains(t, entries["OEBPS/content.opf"], "dc:creator")
+}
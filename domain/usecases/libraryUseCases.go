@@ -0,0 +1,139 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+)
+
+// sampleSections is the number of sections, counted from the start of the
+// book, that anyone who can see a book may read without owning it.
+const sampleSections = 3
+
+type LibraryUseCase struct {
+	datastore domain.DatabaseGateway
+}
+
+func NewLibraryUseCase(datastore domain.DatabaseGateway) LibraryUseCase {
+	return LibraryUseCase{
+		datastore: datastore,
+	}
+}
+
+// ClaimFreeBook adds a published book with a minimum price of 0 to the
+// caller's library without going through checkout.
+func (useCase LibraryUseCase) ClaimFreeBook(actor *models.User, bookId string) (*models.Entitlement, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	book, err := useCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.State != models.StatePublished {
+		return nil, domain.ErrBookNotAvailable
+	}
+
+	if book.MinimumPrice > 0 {
+		return nil, domain.ErrBookNotFree
+	}
+
+	entitlement := models.Entitlement{
+		UserId: actor.Id,
+		BookId: book.Id,
+		Source: models.EntitlementFree,
+	}
+
+	if err := useCase.datastore.SaveEntitlement(&entitlement); err != nil {
+		return nil, err
+	}
+
+	return &entitlement, nil
+}
+
+// GetLibrary lists the books a user owns together with how they got them.
+// Deleting a book deletes the entitlements to it, and a book deleted while
+// the library is read is left out of it.
+func (useCase LibraryUseCase) GetLibrary(actor *models.User, userId string, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireSelfOrAdmin(actor, userId); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Entitlement{})
+	if err != nil {
+		return nil, err
+	}
+
+	entitlements, total, err := useCase.datastore.GetEntitlementsByUser(userId, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	bookIds := make([]string, 0, len(*entitlements))
+	for _, entitlement := range *entitlements {
+		bookIds = append(bookIds, entitlement.BookId)
+	}
+
+	books, err := useCase.datastore.GetBooksByIds(bookIds)
+	if err != nil {
+		return nil, err
+	}
+
+	booksById := map[string]*models.Book{}
+	for i := range *books {
+		booksById[(*books)[i].Id] = &(*books)[i]
+	}
+
+	library := []models.LibraryItem{}
+	for _, entitlement := range *entitlements {
+		book, found := booksById[entitlement.BookId]
+		if !found {
+			continue
+		}
+
+		library = append(library, models.LibraryItem{Entitlement: entitlement, Book: book})
+	}
+
+	return newPage(&library, total, listOptions), nil
+}
+
+// canReadBook reports whether actor may read every section of a book: its
+// authors, admins, subscribers and users who own the book.
+func canReadBook(datastore domain.DatabaseGateway, actor *models.User, book *models.Book) (bool, error) {
+	if actor == nil {
+		return false, nil
+	}
+
+	if actor.IsAdmin || actor.HasSubscription || isBookAuthor(actor, book) {
+		return true, nil
+	}
+
+	return datastore.HasEntitlement(actor.Id, book.Id)
+}
+
+// sampleSectionIds returns the ids of the sections of content readable
+// without owning the book.
+func sampleSectionIds(content []models.BookContent) map[string]bool {
+	ids := map[string]bool{}
+	for _, chapter := range content {
+		for _, section := range chapter.Sections {
+			if len(ids) == sampleSections {
+				return ids
+			}
+			ids[section.SectionId] = true
+		}
+	}
+
+	return ids
+}
+
+// readableBook tells whether actor may read all of the book or only its
+// sample. Books actor cannot see are reported as not found.
+func readableBook(datastore domain.DatabaseGateway, actor *models.User, book *models.Book) (bool, error) {
+	if !canSeeBook(actor, book) {
+		return false, domain.ErrBookNotFound
+	}
+
+	return canReadBook(datastore, actor, book)
+}
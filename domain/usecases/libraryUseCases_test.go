@@ -0,0 +1,206 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+var readerUser = &models.User{Id: "reader"}
+
+// sampleBook returns a published book with one chapter holding the given
+// sections.
+func sampleBook(id string, sectionIds ...string) *models.Book {
+	var sections []models.BookSectionId
+	for _, sectionId := range sectionIds {
+		sections = append(sections, models.BookSectionId{SectionId: sectionId})
+	}
+
+	return &models.Book{
+		Id:      id,
+		Authors: []models.Author{{AuthorId: authorUser.Id}},
+		Content: []models.BookContent{{Chapter: "test", Sections: sections}},
+		State:   models.StatePublished,
+	}
+}
+
+// expectPublishedVersion makes version 1 of book, holding the given sections
+// or an empty one for each section of its content, the one readers see.
+func expectPublishedVersion(app *test.Application, book *models.Book, sections ...models.BookSection) *models.BookVersion {
+	if len(sections) == 0 {
+		for _, id := range contentSectionIds(book.Content) {
+			sections = append(sections, models.BookSection{Id: id})
+		}
+	}
+
+	book.LatestVersion = 1
+	book.PublishedVersion = 1
+	version := &models.BookVersion{
+		Id:       models.BookVersionId(book.Id, 1),
+		BookId:   book.Id,
+		Number:   1,
+		Content:  copyContent(book.Content),
+		Sections: sections,
+	}
+	app.DataStore.On("GetBookVersion", book.Id, 1).Return(version, nil)
+
+	return version
+}
+
+func TestGetBookSectionByIdIsWrongNotOwned(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2", "3", "4")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookBySectionId", "4").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(false, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookSectionById(readerUser, "4")
+
+	assert.Equal(t, domain.ErrBookNotOwned, err)
+	app.DataStore.AssertNotCalled(t, "GetBookSectionById", mock.Anything)
+}
+
+func TestGetBookSectionByIdOwnedIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2", "3", "4")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookBySectionId", "4").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+
+	section, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookSectionById(readerUser, "4")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "4", section.Id)
+}
+
+func TestGetBookSectionByIdSubscriberIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2", "3", "4")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookBySectionId", "4").Return(book, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookSectionById(&models.User{Id: "subscriber", HasSubscription: true}, "4")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertNotCalled(t, "HasEntitlement", mock.Anything, mock.Anything)
+}
+
+func TestGetSectionsByBookIdReturnsSampleWithoutOwnership(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book", "1", "2", "3", "4"), nil)
+	app.DataStore.On("GetSectionsByBookId", "book").Return(&models.BookSections{
+		Sections: []models.BookSection{{Id: "4"}, {Id: "3"}, {Id: "2"}, {Id: "1"}},
+	}, nil)
+
+	sections, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetSectionsByBookId(nil, "book")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []models.BookSection{{Id: "1"}, {Id: "2"}, {Id: "3"}}, sections.Sections)
+}
+
+func TestClaimFreeBookIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book"), nil)
+	app.DataStore.On("SaveEntitlement", &models.Entitlement{
+		UserId: readerUser.Id,
+		BookId: "book",
+		Source: models.EntitlementFree,
+	}).Return(nil)
+
+	_, err := LibraryUseCase{
+		datastore: app.DataStore,
+	}.ClaimFreeBook(readerUser, "book")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestClaimFreeBookIsWrongPaidBook(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book")
+	book.MinimumPrice = 5
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+
+	_, err := LibraryUseCase{
+		datastore: app.DataStore,
+	}.ClaimFreeBook(readerUser, "book")
+
+	assert.Equal(t, domain.ErrBookNotFree, err)
+	app.DataStore.AssertNotCalled(t, "SaveEntitlement", mock.Anything)
+}
+
+func TestGetLibraryIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := LibraryUseCase{
+		datastore: app.DataStore,
+	}.GetLibrary(readerUser, "other", models.ListOptions{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestPayOrderGrantsEntitlements(t *testing.T) {
+	app := test.CreateApp()
+
+	paidOrder := &models.Order{
+		Id:     "order",
+		UserId: readerUser.Id,
+		Items:  []models.OrderItem{{BookId: "1"}, {BookId: "2"}},
+		Status: models.OrderPaid,
+	}
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: readerUser.Id, Status: models.OrderPending}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.Anything).Return(&models.Order{Id: "order", UserId: readerUser.Id, Status: models.OrderPaying}, nil)
+	app.Payments.On("Authorize", mock.Anything).Return(&models.Payment{Id: "payment"}, nil)
+	app.Payments.On("Capture", "payment").Return(&models.Payment{Id: "payment"}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.Anything).Return(paidOrder, nil)
+	app.DataStore.On("SaveEntitlement", mock.MatchedBy(func(entitlement *models.Entitlement) bool {
+		return entitlement.UserId == readerUser.Id && entitlement.OrderId == "order" && entitlement.Source == models.EntitlementPurchase
+	})).Return(nil).Twice()
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(readerUser, "order", "tok_visa")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestGetLibrarySkipsDeletedBooks(t *testing.T) {
+	app := test.CreateApp()
+
+	entitlements := []models.Entitlement{
+		{Id: "1", UserId: readerUser.Id, BookId: "book", Source: models.EntitlementFree},
+		{Id: "2", UserId: readerUser.Id, BookId: "deleted", Source: models.EntitlementFree},
+	}
+
+	app.DataStore.On("GetEntitlementsByUser", readerUser.Id, mock.Anything).Return(&entitlements, int64(2), nil)
+	app.DataStore.On("GetBooksByIds", []string{"book", "deleted"}).Return(&[]models.Book{*sampleBook("book")}, nil)
+
+	page, err := LibraryUseCase{
+		datastore: app.DataStore,
+	}.GetLibrary(readerUser, readerUser.Id, models.ListOptions{})
+
+	assert.Nil(t, err)
+	library := *page.Items.(*[]models.LibraryItem)
+	assert.Len(t, library, 1)
+	assert.Equal(t, "book", library[0].Book.Id)
+	app.DataStore.AssertNotCalled(t, "GetBookById", mock.Anything)
+}
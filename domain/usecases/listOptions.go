@@ -0,0 +1,83 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// normalizeListOptions applies the default page size and translates the
+// JSON field names used by clients for sort and fields into the stored
+// document field names of model. Unknown or hidden fields are rejected.
+func normalizeListOptions(options models.ListOptions, model interface{}, hiddenFields ...string) (models.ListOptions, error) {
+	if options.Offset < 0 || options.Limit < 0 {
+		return options, domain.ErrInvalidPagination
+	}
+
+	if options.Limit == 0 {
+		options.Limit = defaultPageLimit
+	}
+
+	if options.Limit > maxPageLimit {
+		options.Limit = maxPageLimit
+	}
+
+	fields := documentFields(model)
+	for _, hiddenField := range hiddenFields {
+		delete(fields, hiddenField)
+	}
+
+	var sort []models.SortField
+	for _, sortField := range options.Sort {
+		field, ok := fields[sortField.Field]
+		if !ok {
+			return options, domain.ErrInvalidSortField
+		}
+		sort = append(sort, models.SortField{Field: field, Descending: sortField.Descending})
+	}
+	options.Sort = sort
+
+	var projection []string
+	for _, name := range options.Fields {
+		field, ok := fields[name]
+		if !ok {
+			return options, domain.ErrInvalidField
+		}
+		projection = append(projection, field)
+	}
+	options.Fields = projection
+
+	return options, nil
+}
+
+// documentFields maps the json name of each field of model to its bson name.
+func documentFields(model interface{}) map[string]string {
+	fields := map[string]string{}
+	modelType := reflect.TypeOf(model)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		bsonName := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+		fields[jsonName] = bsonName
+	}
+
+	return fields
+}
+
+func newPage(items interface{}, total int64, listOptions models.ListOptions) *models.Page {
+	return &models.Page{
+		Items:  items,
+		Total:  total,
+		Offset: listOptions.Offset,
+		Limit:  listOptions.Limit,
+	}
+}
@@ -0,0 +1,51 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+)
+
+// NotificationUseCase lets users read the notifications sent to them, like
+// the ones telling owners a new version of a book is available.
+type NotificationUseCase struct {
+	datastore domain.DatabaseGateway
+}
+
+func NewNotificationUseCase(datastore domain.DatabaseGateway) NotificationUseCase {
+	return NotificationUseCase{
+		datastore: datastore,
+	}
+}
+
+// GetNotifications lists the notifications of a user, newest first unless
+// sorted otherwise, to the user themselves and to admins.
+func (useCase NotificationUseCase) GetNotifications(actor *models.User, userId string, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireSelfOrAdmin(actor, userId); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Notification{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(listOptions.Sort) == 0 {
+		listOptions.Sort = []models.SortField{{Field: "createdAt", Descending: true}}
+	}
+
+	notifications, total, err := useCase.datastore.GetNotificationsByUser(userId, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(notifications, total, listOptions), nil
+}
+
+// MarkNotificationRead marks one of the caller's notifications as read.
+func (useCase NotificationUseCase) MarkNotificationRead(actor *models.User, userId string, id string) (*models.Notification, error) {
+	if err := requireSelfOrAdmin(actor, userId); err != nil {
+		return nil, err
+	}
+
+	return useCase.datastore.MarkNotificationRead(userId, id)
+}
@@ -0,0 +1,49 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+func TestGetNotificationsIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetNotificationsByUser", readerUser.Id, mock.MatchedBy(func(listOptions models.ListOptions) bool {
+		return len(listOptions.Sort) == 1 && listOptions.Sort[0].Field == "createdAt" && listOptions.Sort[0].Descending
+	})).Return(&[]models.Notification{{Id: "notification"}}, int64(1), nil)
+
+	page, err := NotificationUseCase{
+		datastore: app.DataStore,
+	}.GetNotifications(readerUser, readerUser.Id, models.ListOptions{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), page.Total)
+}
+
+func TestGetNotificationsIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := NotificationUseCase{
+		datastore: app.DataStore,
+	}.GetNotifications(readerUser, authorUser.Id, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+	app.DataStore.AssertNotCalled(t, "GetNotificationsByUser", mock.Anything, mock.Anything)
+}
+
+func TestMarkNotificationReadIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("MarkNotificationRead", readerUser.Id, "notification").Return(&models.Notification{Id: "notification", Read: true}, nil)
+
+	notification, err := NotificationUseCase{
+		datastore: app.DataStore,
+	}.MarkNotificationRead(readerUser, readerUser.Id, "notification")
+
+	assert.Nil(t, err)
+	assert.True(t, notification.Read)
+}
@@ -0,0 +1,344 @@
+package usecases
+
+import (
+	"github.com/google/uuid"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"log"
+	"time"
+)
+
+// orderTransitions lists, for each target status, the statuses an order may
+// move to it from.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderPending:   {models.OrderPaying},
+	models.OrderPaying:    {models.OrderPending},
+	models.OrderPaid:      {models.OrderPending, models.OrderPaying},
+	models.OrderFulfilled: {models.OrderPaid},
+	models.OrderRefunded:  {models.OrderPaid, models.OrderFulfilled},
+}
+
+type OrderUseCase struct {
+	datastore domain.DatabaseGateway
+	payments  domain.PaymentGateway
+}
+
+func NewOrderUseCase(datastore domain.DatabaseGateway, payments domain.PaymentGateway) OrderUseCase {
+	return OrderUseCase{
+		datastore: datastore,
+		payments:  payments,
+	}
+}
+
+// Checkout turns a cart into a pending order. Every book is charged the price
+// the buyer chose, checked against the book as it is at checkout, and the
+// cart is emptied together with creating the order.
+func (useCase OrderUseCase) Checkout(actor *models.User, cartId string) (*models.Order, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	shoppingCart, err := useCase.datastore.GetShoppingCartById(cartId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireSelfOrAdmin(actor, shoppingCart.UserId); err != nil {
+		return nil, err
+	}
+
+	var items []models.OrderItem
+	total := 0.0
+	seen := map[string]bool{}
+	for _, bookId := range shoppingCart.Books {
+		if seen[bookId.Book] {
+			continue
+		}
+		seen[bookId.Book] = true
+
+		book, err := useCase.datastore.GetBookById(bookId.Book)
+		if err != nil {
+			return nil, err
+		}
+
+		if book.State != models.StatePublished {
+			return nil, domain.ErrBookNotAvailable
+		}
+
+		price, err := chosenPrice(book, bookId)
+		if err != nil {
+			return nil, err
+		}
+
+		item := models.OrderItem{
+			BookId:         book.Id,
+			Title:          book.Title,
+			MinimumPrice:   book.MinimumPrice,
+			SuggestedPrice: book.SuggestedPrice,
+			Price:          price,
+			Royalties:      royaltySplit(book.Authors, price),
+		}
+		items = append(items, item)
+		total += item.Price
+	}
+
+	if len(items) == 0 {
+		return nil, domain.ErrEmptyCart
+	}
+
+	id, _ := uuid.NewRandom()
+	order := models.Order{
+		Id:     id.String(),
+		UserId: shoppingCart.UserId,
+		CartId: shoppingCart.Id,
+		Items:  items,
+		Total:  roundPrice(total),
+		Status: models.OrderPending,
+	}
+
+	return useCase.datastore.SaveOrder(&order, shoppingCart.Id)
+}
+
+// GetOrders lists the orders of the caller.
+func (useCase OrderUseCase) GetOrders(actor *models.User, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	return useCase.GetOrdersByUser(actor, actor.Id, listOptions)
+}
+
+func (useCase OrderUseCase) GetOrdersByUser(actor *models.User, userId string, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireSelfOrAdmin(actor, userId); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Order{})
+	if err != nil {
+		return nil, err
+	}
+
+	orders, total, err := useCase.datastore.GetOrdersByUser(userId, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(orders, total, listOptions), nil
+}
+
+func (useCase OrderUseCase) GetOrderById(actor *models.User, id string) (*models.Order, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	order, err := useCase.datastore.GetOrderById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireSelfOrAdmin(actor, order.UserId); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// PayOrder charges the order total to the given payment source and marks the
+// order paid. The order is claimed by moving it to PAYING before the provider
+// is called, so of two concurrent payments only one charges the buyer. A
+// failed payment puts the order back to PENDING, and a capture the order
+// could not be marked paid with is refunded.
+func (useCase OrderUseCase) PayOrder(actor *models.User, id string, source string) (*models.Order, error) {
+	order, err := useCase.GetOrderById(actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canChangeOrderStatus(order.Status, models.OrderPaying) {
+		return nil, domain.ErrInvalidOrderTransition
+	}
+
+	order, err = useCase.datastore.ChangeOrderStatus(order.Id, order.Status, &models.OrderStatusChange{
+		From:      order.Status,
+		To:        models.OrderPaying,
+		ChangedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := useCase.payments.Authorize(&models.PaymentRequest{
+		OrderId: order.Id,
+		Amount:  order.Total,
+		Source:  source,
+	})
+	if err == nil {
+		payment, err = useCase.payments.Capture(payment.Id)
+	}
+	if err != nil {
+		useCase.releaseOrder(order)
+		return nil, err
+	}
+
+	paidOrder, err := useCase.changeOrderStatus(order, models.OrderPaid, payment.Id)
+	if err != nil {
+		if storedOrder, storedErr := useCase.datastore.GetOrderById(order.Id); storedErr == nil && storedOrder.PaymentId == payment.Id {
+			return nil, err
+		}
+		if _, refundErr := useCase.payments.Refund(payment.Id, payment.Amount); refundErr != nil {
+			log.Printf("refunding payment %s of order %s: %v", payment.Id, order.Id, refundErr)
+		}
+		useCase.releaseOrder(order)
+		return nil, err
+	}
+
+	return paidOrder, nil
+}
+
+// releaseOrder puts an order PayOrder claimed back to PENDING so that it can
+// be paid again. The order stays PAYING if that fails.
+func (useCase OrderUseCase) releaseOrder(order *models.Order) {
+	_, err := useCase.datastore.ChangeOrderStatus(order.Id, models.OrderPaying, &models.OrderStatusChange{
+		From:      models.OrderPaying,
+		To:        models.OrderPending,
+		ChangedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("releasing order %s: %v", order.Id, err)
+	}
+}
+
+func (useCase OrderUseCase) FulfillOrder(actor *models.User, id string) (*models.Order, error) {
+	order, err := useCase.adminOrder(actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return useCase.changeOrderStatus(order, models.OrderFulfilled, "")
+}
+
+// RefundOrder returns the whole payment of the order to the buyer.
+func (useCase OrderUseCase) RefundOrder(actor *models.User, id string) (*models.Order, error) {
+	order, err := useCase.adminOrder(actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canChangeOrderStatus(order.Status, models.OrderRefunded) {
+		return nil, domain.ErrInvalidOrderTransition
+	}
+
+	if order.PaymentId != "" {
+		if _, err := useCase.payments.Refund(order.PaymentId, order.Total); err != nil {
+			return nil, err
+		}
+	}
+
+	return useCase.changeOrderStatus(order, models.OrderRefunded, "")
+}
+
+// HandlePaymentWebhook applies a provider notification to its order. Events
+// the order already reflects, such as a repeated delivery, are acknowledged
+// without changing anything.
+func (useCase OrderUseCase) HandlePaymentWebhook(payload []byte, signature string) error {
+	event, err := useCase.payments.VerifyWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	order, err := useCase.datastore.GetOrderById(event.OrderId)
+	if err != nil {
+		return err
+	}
+
+	var to models.OrderStatus
+	switch event.Type {
+	case models.PaymentCapturedEvent:
+		to = models.OrderPaid
+	case models.PaymentRefundedEvent:
+		to = models.OrderRefunded
+	default:
+		return nil
+	}
+
+	if !canChangeOrderStatus(order.Status, to) {
+		return nil
+	}
+
+	_, err = useCase.changeOrderStatus(order, to, event.PaymentId)
+	return err
+}
+
+func (useCase OrderUseCase) adminOrder(actor *models.User, id string) (*models.Order, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	return useCase.datastore.GetOrderById(id)
+}
+
+// changeOrderStatus moves the order to the given status. When the order was
+// moved there concurrently, for instance by a payment webhook, the stored
+// order is returned instead of an error.
+func (useCase OrderUseCase) changeOrderStatus(order *models.Order, to models.OrderStatus, paymentId string) (*models.Order, error) {
+	if !canChangeOrderStatus(order.Status, to) {
+		return nil, domain.ErrInvalidOrderTransition
+	}
+
+	changedOrder, err := useCase.datastore.ChangeOrderStatus(order.Id, order.Status, &models.OrderStatusChange{
+		From:      order.Status,
+		To:        to,
+		PaymentId: paymentId,
+		ChangedAt: time.Now(),
+	})
+	if err == nil {
+		if err := useCase.updateEntitlements(changedOrder); err != nil {
+			return nil, err
+		}
+		return changedOrder, nil
+	}
+
+	if err != domain.ErrInvalidOrderTransition {
+		return nil, err
+	}
+
+	storedOrder, storedErr := useCase.datastore.GetOrderById(order.Id)
+	if storedErr != nil || storedOrder.Status != to {
+		return nil, err
+	}
+
+	return storedOrder, nil
+}
+
+// updateEntitlements adds the books of a paid order to the buyer's library and
+// takes them back when the order is refunded.
+func (useCase OrderUseCase) updateEntitlements(order *models.Order) error {
+	switch order.Status {
+	case models.OrderPaid:
+		for _, item := range order.Items {
+			err := useCase.datastore.SaveEntitlement(&models.Entitlement{
+				UserId:  order.UserId,
+				BookId:  item.BookId,
+				Source:  models.EntitlementPurchase,
+				OrderId: order.Id,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case models.OrderRefunded:
+		return useCase.datastore.DeleteEntitlementsByOrder(order.Id)
+	}
+
+	return nil
+}
+
+func canChangeOrderStatus(from models.OrderStatus, to models.OrderStatus) bool {
+	for _, allowed := range orderTransitions[to] {
+		if allowed == from {
+			return true
+		}
+	}
+
+	return false
+}
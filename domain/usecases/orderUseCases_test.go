@@ -0,0 +1,413 @@
+package usecases
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	infraDatastore "leanpub-app/infra/datastore"
+	"leanpub-app/infra/payments"
+	"sync"
+	"testing"
+	"time"
+)
+
+func authorCart() *models.ShoppingCart {
+	return &models.ShoppingCart{
+		Id:     "cart",
+		UserId: authorUser.Id,
+		Books:  []models.BookId{{Book: "1"}, {Book: "2"}, {Book: "1"}},
+	}
+}
+
+func pricedBook(id string, minimumPrice float64, suggestedPrice float64) *models.Book {
+	return &models.Book{
+		Id:             id,
+		Title:          "book " + id,
+		MinimumPrice:   minimumPrice,
+		SuggestedPrice: suggestedPrice,
+		State:          models.StatePublished,
+	}
+}
+
+func TestCheckoutIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetShoppingCartById", "cart").Return(authorCart(), nil)
+	app.DataStore.On("GetBookById", "1").Return(pricedBook("1", 5, 9.999), nil)
+	app.DataStore.On("GetBookById", "2").Return(pricedBook("2", 7.5, 3), nil)
+
+	var order *models.Order
+	app.DataStore.On("SaveOrder", mock.MatchedBy(func(order *models.Order) bool {
+		return order.UserId == authorUser.Id && order.Status == models.OrderPending && order.Id != ""
+	}), "cart").Run(func(args mock.Arguments) {
+		order = args.Get(0).(*models.Order)
+	}).Return(&models.Order{}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Nil(t, err)
+	assert.Len(t, order.Items, 2)
+	assert.Equal(t, 10.0, order.Items[0].Price)
+	assert.Equal(t, 7.5, order.Items[1].Price)
+	assert.Equal(t, 17.5, order.Total)
+}
+
+func TestCheckoutUsesChosenPrices(t *testing.T) {
+	app := test.CreateApp()
+
+	book := pricedBook("1", 5, 20)
+	book.Authors = []models.Author{{AuthorId: "a"}, {AuthorId: "b"}}
+	app.DataStore.On("GetShoppingCartById", "cart").Return(&models.ShoppingCart{
+		Id:     "cart",
+		UserId: authorUser.Id,
+		Books:  []models.BookId{{Book: "1", Price: offer(6)}},
+	}, nil)
+	app.DataStore.On("GetBookById", "1").Return(book, nil)
+
+	var order *models.Order
+	app.DataStore.On("SaveOrder", mock.Anything, "cart").Run(func(args mock.Arguments) {
+		order = args.Get(0).(*models.Order)
+	}).Return(&models.Order{}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 6.0, order.Total)
+	assert.Equal(t, []models.Royalty{{AuthorId: "a", Amount: 2.4}, {AuthorId: "b", Amount: 2.4}}, order.Items[0].Royalties)
+}
+
+func TestCheckoutIsWrongMinimumPriceRaised(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetShoppingCartById", "cart").Return(&models.ShoppingCart{
+		Id:     "cart",
+		UserId: authorUser.Id,
+		Books:  []models.BookId{{Book: "1", Price: offer(6)}},
+	}, nil)
+	app.DataStore.On("GetBookById", "1").Return(pricedBook("1", 8, 20), nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Equal(t, domain.ErrBelowMinimumPrice, err)
+	app.DataStore.AssertNotCalled(t, "SaveOrder", mock.Anything, mock.Anything)
+}
+
+func TestCheckoutIsWrongEmptyCart(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetShoppingCartById", "cart").Return(&models.ShoppingCart{Id: "cart", UserId: authorUser.Id}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Equal(t, domain.ErrEmptyCart, err)
+	app.DataStore.AssertNotCalled(t, "SaveOrder", mock.Anything, mock.Anything)
+}
+
+func TestCheckoutIsWrongUnpublishedBook(t *testing.T) {
+	app := test.CreateApp()
+
+	book := pricedBook("1", 5, 10)
+	book.State = models.StateRetired
+	app.DataStore.On("GetShoppingCartById", "cart").Return(authorCart(), nil)
+	app.DataStore.On("GetBookById", "1").Return(book, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Equal(t, domain.ErrBookNotAvailable, err)
+	app.DataStore.AssertNotCalled(t, "SaveOrder", mock.Anything, mock.Anything)
+}
+
+func TestCheckoutIsWrongOtherUserCart(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetShoppingCartById", "cart").Return(&models.ShoppingCart{Id: "cart", UserId: "other"}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.Checkout(authorUser, "cart")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestGetOrderByIdIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: "other"}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.GetOrderById(authorUser, "order")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestPayOrderIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Total: 17.5, Status: models.OrderPending}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPaying
+	})).Return(&models.Order{Id: "order", UserId: authorUser.Id, Total: 17.5, Status: models.OrderPaying}, nil)
+	app.Payments.On("Authorize", &models.PaymentRequest{OrderId: "order", Amount: 17.5, Source: "tok_visa"}).Return(&models.Payment{Id: "payment"}, nil)
+	app.Payments.On("Capture", "payment").Return(&models.Payment{Id: "payment", Status: models.PaymentCaptured}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPaid && change.PaymentId == "payment"
+	})).Return(&models.Order{Id: "order", Status: models.OrderPaid, PaymentId: "payment"}, nil)
+
+	order, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_visa")
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderPaid, order.Status)
+}
+
+func TestPayOrderIsWrongDeclined(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPending}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.Anything).Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPaying}, nil)
+	app.Payments.On("Authorize", mock.Anything).Return(nil, domain.ErrPaymentDeclined)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPending
+	})).Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPending}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_declined")
+
+	assert.Equal(t, domain.ErrPaymentDeclined, err)
+	app.Payments.AssertNotCalled(t, "Capture", mock.Anything)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestPayOrderIsWrongBeingPaid(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPending}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.Anything).Return(nil, domain.ErrInvalidOrderTransition)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_visa")
+
+	assert.Equal(t, domain.ErrInvalidOrderTransition, err)
+	app.Payments.AssertNotCalled(t, "Authorize", mock.Anything)
+}
+
+func TestPayOrderRefundsWhenNotMarkedPaid(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Total: 17.5, Status: models.OrderPending}, nil).Once()
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.Anything).Return(&models.Order{Id: "order", UserId: authorUser.Id, Total: 17.5, Status: models.OrderPaying}, nil)
+	app.Payments.On("Authorize", mock.Anything).Return(&models.Payment{Id: "payment"}, nil)
+	app.Payments.On("Capture", "payment").Return(&models.Payment{Id: "payment", Amount: 17.5}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPaid
+	})).Return(nil, errors.New("DATABASE_DOWN"))
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Status: models.OrderPaying}, nil)
+	app.Payments.On("Refund", "payment", 17.5).Return(&models.Payment{Id: "payment", Status: models.PaymentRefunded}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPending
+	})).Return(&models.Order{Id: "order", Status: models.OrderPending}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_visa")
+
+	assert.Equal(t, errors.New("DATABASE_DOWN"), err)
+	app.Payments.AssertExpectations(t)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestPayOrderConcurrentlyChargesOnce(t *testing.T) {
+	datastore := infraDatastore.NewMemoryGatewayImpl()
+	gateway := payments.NewFakePaymentGatewayImpl().(*payments.FakePaymentGatewayImpl)
+	gateway.Delay = 10 * time.Millisecond
+
+	shoppingCart, err := datastore.SaveShoppingCart(&models.ShoppingCart{UserId: authorUser.Id})
+	assert.Nil(t, err)
+	_, err = datastore.SaveOrder(&models.Order{Id: "order", UserId: authorUser.Id, Total: 17.5, Status: models.OrderPending}, shoppingCart.Id)
+	assert.Nil(t, err)
+
+	useCase := NewOrderUseCase(datastore, gateway)
+
+	const attempts = 8
+	errs := make(chan error, attempts)
+	var wait sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := useCase.PayOrder(authorUser, "order", "tok_visa")
+			errs <- err
+		}()
+	}
+	wait.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.Equal(t, domain.ErrInvalidOrderTransition, err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+
+	captures := 0
+	for _, webhook := range gateway.Webhooks() {
+		event, err := gateway.VerifyWebhook(webhook.Payload, webhook.Signature)
+		assert.Nil(t, err)
+		if event.Type == models.PaymentCapturedEvent {
+			captures++
+		}
+	}
+	assert.Equal(t, 1, captures)
+
+	order, err := datastore.GetOrderById("order")
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderPaid, order.Status)
+}
+
+func TestPayOrderIsWrongAlreadyPaid(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPaid}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_visa")
+
+	assert.Equal(t, domain.ErrInvalidOrderTransition, err)
+	app.Payments.AssertNotCalled(t, "Authorize", mock.Anything)
+}
+
+func TestPayOrderAfterWebhookIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPending}, nil).Once()
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.Anything).Return(&models.Order{Id: "order", UserId: authorUser.Id, Status: models.OrderPaying}, nil)
+	app.Payments.On("Authorize", mock.Anything).Return(&models.Payment{Id: "payment"}, nil)
+	app.Payments.On("Capture", "payment").Return(&models.Payment{Id: "payment"}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPaying, mock.Anything).Return(nil, domain.ErrInvalidOrderTransition)
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Status: models.OrderPaid, PaymentId: "payment"}, nil)
+
+	order, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.PayOrder(authorUser, "order", "tok_visa")
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderPaid, order.Status)
+}
+
+func TestHandlePaymentWebhookIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	payload := []byte("{}")
+	app.Payments.On("VerifyWebhook", payload, "signature").Return(&models.PaymentEvent{Type: models.PaymentCapturedEvent, OrderId: "order", PaymentId: "payment"}, nil)
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Status: models.OrderPending}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderPending, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderPaid && change.PaymentId == "payment"
+	})).Return(&models.Order{Id: "order", Status: models.OrderPaid}, nil)
+
+	err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.HandlePaymentWebhook(payload, "signature")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestHandlePaymentWebhookIgnoresDuplicate(t *testing.T) {
+	app := test.CreateApp()
+
+	app.Payments.On("VerifyWebhook", mock.Anything, mock.Anything).Return(&models.PaymentEvent{Type: models.PaymentCapturedEvent, OrderId: "order"}, nil)
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Status: models.OrderPaid}, nil)
+
+	err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.HandlePaymentWebhook([]byte("{}"), "signature")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertNotCalled(t, "ChangeOrderStatus", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandlePaymentWebhookIsWrongSignature(t *testing.T) {
+	app := test.CreateApp()
+
+	app.Payments.On("VerifyWebhook", mock.Anything, mock.Anything).Return(nil, domain.ErrInvalidWebhook)
+
+	err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.HandlePaymentWebhook([]byte("{}"), "forged")
+
+	assert.Equal(t, domain.ErrInvalidWebhook, err)
+	app.DataStore.AssertNotCalled(t, "GetOrderById", mock.Anything)
+}
+
+func TestRefundOrderIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Total: 10, PaymentId: "payment", Status: models.OrderFulfilled}, nil)
+	app.Payments.On("Refund", "payment", 10.0).Return(&models.Payment{Id: "payment", Status: models.PaymentRefunded}, nil)
+	app.DataStore.On("ChangeOrderStatus", "order", models.OrderFulfilled, mock.MatchedBy(func(change *models.OrderStatusChange) bool {
+		return change.To == models.OrderRefunded && !change.ChangedAt.IsZero()
+	})).Return(&models.Order{Id: "order", Status: models.OrderRefunded}, nil)
+	app.DataStore.On("DeleteEntitlementsByOrder", "order").Return(nil)
+
+	order, err := OrderUseCase{
+		datastore: app.DataStore,
+		payments:  app.Payments,
+	}.RefundOrder(adminUser, "order")
+
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderRefunded, order.Status)
+	app.Payments.AssertExpectations(t)
+}
+
+func TestFulfillOrderIsWrongTransition(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetOrderById", "order").Return(&models.Order{Id: "order", Status: models.OrderPending}, nil)
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.FulfillOrder(adminUser, "order")
+
+	assert.Equal(t, domain.ErrInvalidOrderTransition, err)
+	app.DataStore.AssertNotCalled(t, "ChangeOrderStatus", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFulfillOrderIsWrongNotAdmin(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := OrderUseCase{
+		datastore: app.DataStore,
+	}.FulfillOrder(authorUser, "order")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
@@ -0,0 +1,44 @@
+package usecases
+
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/bcrypt"
+	"leanpub-app/domain"
+)
+
+// maxPasswordBytes is as much of a password as bcrypt reads. It ignores the
+// rest, so longer passwords are refused rather than cut.
+const maxPasswordBytes = 72
+
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordBytes {
+		return "", domain.ErrValidation.WithDetails([]domain.FieldError{{
+			Field:   "password",
+			Code:    "TOO_LONG",
+			Message: "must be at most 72 bytes long",
+		}})
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func isPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
+// verifyPassword reports whether password matches the stored value. Records
+// saved before hashing was introduced hold the plaintext, so those are
+// compared in constant time and flagged as legacy to be rehashed.
+func verifyPassword(stored string, password string) (valid bool, legacy bool) {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true
+}
@@ -0,0 +1,102 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+)
+
+// The policies below receive the authenticated caller as actor, which is nil
+// for anonymous requests. Anonymous callers get ErrUnauthorized and
+// authenticated callers lacking the right get ErrForbidden.
+
+func requireAuthenticated(actor *models.User) error {
+	if actor == nil {
+		return domain.ErrUnauthorized
+	}
+
+	return nil
+}
+
+func requireAdmin(actor *models.User) error {
+	if actor == nil {
+		return domain.ErrUnauthorized
+	}
+
+	if !actor.IsAdmin {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+// requireAuthorOrAdmin lets users an admin made authors, and admins, create
+// books.
+func requireAuthorOrAdmin(actor *models.User) error {
+	if actor == nil {
+		return domain.ErrUnauthorized
+	}
+
+	if !actor.IsAuthor && !actor.IsAdmin {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+func requireSelfOrAdmin(actor *models.User, userId string) error {
+	if actor == nil {
+		return domain.ErrUnauthorized
+	}
+
+	if actor.Id != userId && !actor.IsAdmin {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+func requireBookAuthorOrAdmin(actor *models.User, book *models.Book) error {
+	if actor == nil {
+		return domain.ErrUnauthorized
+	}
+
+	if !actor.IsAdmin && !isBookAuthor(actor, book) {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+func isBookAuthor(actor *models.User, book *models.Book) bool {
+	if actor == nil {
+		return false
+	}
+
+	for _, author := range book.Authors {
+		if author.AuthorId == actor.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// catalogState is the state the catalog is narrowed to for actor. Admins see
+// books in every state, everyone else only published ones.
+func catalogState(actor *models.User) models.StateBook {
+	if actor != nil && actor.IsAdmin {
+		return ""
+	}
+
+	return models.StatePublished
+}
+
+// canSeeBook reports whether actor may read a book outside the catalog. Books
+// that are not published stay visible to their authors and to admins.
+func canSeeBook(actor *models.User, book *models.Book) bool {
+	if book.State == models.StatePublished {
+		return true
+	}
+
+	return actor != nil && (actor.IsAdmin || isBookAuthor(actor, book))
+}
@@ -0,0 +1,144 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"testing"
+)
+
+func TestGetUsersIsWrongAnonymous(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.GetUsers(nil, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrUnauthorized, err)
+}
+
+func TestGetUsersIsWrongNotAdmin(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.GetUsers(authorUser, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestGetUserByIdIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.GetUserById(authorUser, "1234567890")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestSaveUserIgnoresAdminFlagFromAnonymous(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{
+		Email:           "test@example.com",
+		Password:        "test1234",
+		IsAuthor:        true,
+		IsAdmin:         true,
+		HasSubscription: true,
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, domain.ErrUserNotFound)
+	app.DataStore.On("SaveUser", mock.Anything).Return(user, nil)
+
+	savedUser, err := UserUseCase{
+		datastore: app.DataStore,
+	}.SaveUser(nil, user)
+
+	assert.Nil(t, err)
+	assert.False(t, savedUser.IsAuthor)
+	assert.False(t, savedUser.IsAdmin)
+	assert.False(t, savedUser.HasSubscription)
+}
+
+func TestUpdateUserKeepsStoredAdminFlag(t *testing.T) {
+	app := test.CreateApp()
+
+	storedUser := &models.User{Id: "1234567890", Password: "hash"}
+	user := &models.User{Id: "1234567890", IsAuthor: true, IsAdmin: true}
+
+	app.DataStore.On("GetUserById", "1234567890").Return(storedUser, nil)
+	app.DataStore.On("UpdateUser", mock.Anything).Return(user, nil)
+
+	updatedUser, err := UserUseCase{
+		datastore: app.DataStore,
+	}.UpdateUser(&models.User{Id: "1234567890"}, user)
+
+	assert.Nil(t, err)
+	assert.False(t, updatedUser.IsAuthor)
+	assert.False(t, updatedUser.IsAdmin)
+	assert.Equal(t, "hash", updatedUser.Password)
+}
+
+func TestUpdateBookIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	book := &models.Book{Id: "312312", Authors: []models.Author{{AuthorId: "211212"}}}
+
+	app.DataStore.On("GetBookById", "312312").Return(book, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(&models.User{Id: "1234567890", IsAuthor: true}, &models.Book{Id: "312312"})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestSaveBookIsWrongNotAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SaveBook(&models.User{Id: "1234567890"}, &dtos.BookDto{
+		Authors: []models.Author{{AuthorId: "1234567890"}},
+	})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestSaveBookIsWrongNotListedAuthor(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SaveBook(&models.User{Id: "1234567890", IsAuthor: true}, &dtos.BookDto{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestGetShoppingCartByIdIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	shoppingCart := &models.ShoppingCart{Id: "312312", UserId: "1234567890"}
+
+	app.DataStore.On("GetShoppingCartById", "312312").Return(shoppingCart, nil)
+
+	_, err := ShoppingCartUseCase{
+		datastore: app.DataStore,
+	}.GetShoppingCartById(authorUser, "312312")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
+
+func TestGetShoppingCartsIsWrongNotAdmin(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := ShoppingCartUseCase{
+		datastore: app.DataStore,
+	}.GetShoppingCarts(authorUser, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+}
@@ -0,0 +1,84 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"math"
+	"sort"
+)
+
+// authorRoyaltyRate is the part of every sale paid out to the book authors.
+const authorRoyaltyRate = 0.8
+
+// chosenPrice is what the buyer pays for a book in the cart: the price they
+// chose, or the suggested price when they did not choose one. It is never
+// below the minimum price, and a minimum price of 0 makes the book free.
+func chosenPrice(book *models.Book, item models.BookId) (float64, error) {
+	if item.Price == nil {
+		return roundPrice(math.Max(book.SuggestedPrice, book.MinimumPrice)), nil
+	}
+
+	price := roundPrice(*item.Price)
+	if price < 0 || price < book.MinimumPrice {
+		return 0, domain.ErrBelowMinimumPrice
+	}
+
+	return price, nil
+}
+
+// royaltySplit divides the author royalty of a sale between the authors by
+// their royalty share, or evenly when none of them has a positive one. The
+// royalty is split in whole cents by largest remainder, so the amounts add up
+// to it and none is negative; negative shares count as 0.
+func royaltySplit(authors []models.Author, price float64) []models.Royalty {
+	if len(authors) == 0 {
+		return nil
+	}
+
+	shares := make([]float64, len(authors))
+	totalShare := 0.0
+	for i, author := range authors {
+		shares[i] = math.Max(author.RoyaltyShare, 0)
+		totalShare += shares[i]
+	}
+	if totalShare == 0 {
+		for i := range shares {
+			shares[i] = 1
+		}
+		totalShare = float64(len(shares))
+	}
+
+	royalty := int64(math.Max(math.Round(price*authorRoyaltyRate*100), 0))
+	cents := make([]int64, len(authors))
+	remainders := make([]float64, len(authors))
+	left := royalty
+	for i, share := range shares {
+		exact := float64(royalty) * share / totalShare
+		cents[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(cents[i])
+		left -= cents[i]
+	}
+
+	order := make([]int, len(authors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+	for i := 0; left > 0; i = (i + 1) % len(order) {
+		cents[order[i]]++
+		left--
+	}
+
+	royalties := make([]models.Royalty, 0, len(authors))
+	for i, author := range authors {
+		royalties = append(royalties, models.Royalty{AuthorId: author.AuthorId, Amount: float64(cents[i]) / 100})
+	}
+
+	return royalties
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
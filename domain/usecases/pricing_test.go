@@ -0,0 +1,90 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+func offer(price float64) *float64 {
+	return &price
+}
+
+func TestChosenPriceIsOk(t *testing.T) {
+	book := pricedBook("1", 5, 15)
+
+	price, err := chosenPrice(book, models.BookId{Book: "1", Price: offer(7.255)})
+	assert.Nil(t, err)
+	assert.Equal(t, 7.26, price)
+
+	price, err = chosenPrice(book, models.BookId{Book: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 15.0, price)
+
+	price, err = chosenPrice(pricedBook("2", 0, 10), models.BookId{Book: "2", Price: offer(0)})
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, price)
+}
+
+func TestChosenPriceIsWrongBelowMinimum(t *testing.T) {
+	_, err := chosenPrice(pricedBook("1", 5, 15), models.BookId{Book: "1", Price: offer(4.99)})
+	assert.Equal(t, domain.ErrBelowMinimumPrice, err)
+
+	_, err = chosenPrice(pricedBook("2", 0, 10), models.BookId{Book: "2", Price: offer(-1)})
+	assert.Equal(t, domain.ErrBelowMinimumPrice, err)
+}
+
+func TestRoyaltySplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		shares  []float64
+		price   float64
+		amounts []float64
+	}{
+		{"by share", []float64{3, 1}, 10, []float64{6, 2}},
+		{"evenly without shares", []float64{0, 0, 0}, 10, []float64{2.67, 2.67, 2.66}},
+		{"uneven shares and odd cents", []float64{2, 1}, 10.01, []float64{5.34, 2.67}},
+		{"largest remainder gets the cent", []float64{1, 2}, 0.05, []float64{0.01, 0.03}},
+		{"fewer cents than authors", []float64{1, 1, 1, 1}, 0.03, []float64{0.01, 0.01, 0, 0}},
+		{"negative share counts as none", []float64{2, -1}, 10, []float64{8, 0}},
+		{"free book", []float64{1, 1}, 0, []float64{0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var authors []models.Author
+			for i, share := range test.shares {
+				authors = append(authors, models.Author{AuthorId: string(rune('a' + i)), RoyaltyShare: share})
+			}
+
+			royalties := royaltySplit(authors, test.price)
+
+			var amounts []float64
+			for i, royalty := range royalties {
+				assert.Equal(t, authors[i].AuthorId, royalty.AuthorId)
+				amounts = append(amounts, royalty.Amount)
+			}
+			assert.Equal(t, test.amounts, amounts)
+		})
+	}
+
+	assert.Nil(t, royaltySplit(nil, 10))
+}
+
+func TestSaveShoppingCartIsWrongBelowMinimumPrice(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "1").Return(pricedBook("1", 5, 15), nil)
+
+	_, err := ShoppingCartUseCase{
+		datastore: app.DataStore,
+	}.SaveShoppingCart(authorUser, &models.ShoppingCart{
+		Books: []models.BookId{{Book: "1", Price: offer(2)}},
+	})
+
+	assert.Equal(t, domain.ErrBelowMinimumPrice, err)
+	app.DataStore.AssertNotCalled(t, "SaveShoppingCart", mock.Anything)
+}
@@ -0,0 +1,182 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"math"
+)
+
+// ReadingUseCase keeps each reader's progress, bookmarks and highlights. They
+// can only point at sections the reader may read.
+type ReadingUseCase struct {
+	datastore domain.DatabaseGateway
+}
+
+func NewReadingUseCase(datastore domain.DatabaseGateway) ReadingUseCase {
+	return ReadingUseCase{
+		datastore: datastore,
+	}
+}
+
+func (useCase ReadingUseCase) GetProgress(actor *models.User, bookId string) (*models.ReadingProgress, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	return useCase.datastore.GetReadingProgress(actor.Id, bookId)
+}
+
+// UpdateProgress records the section the caller reached. The percentage
+// counts the sections up to and including it, in the order of Book.Content.
+func (useCase ReadingUseCase) UpdateProgress(actor *models.User, bookId string, progress *dtos.ProgressDto) (*models.ReadingProgress, error) {
+	version, err := useCase.readableSection(actor, bookId, progress.SectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	position, total := 0, 0
+	for _, chapter := range version.Content {
+		for _, section := range chapter.Sections {
+			total++
+			if section.SectionId == progress.SectionId {
+				position = total
+			}
+		}
+	}
+
+	return useCase.datastore.SaveReadingProgress(&models.ReadingProgress{
+		UserId:          actor.Id,
+		BookId:          version.BookId,
+		SectionId:       progress.SectionId,
+		PercentComplete: math.Round(float64(position)/float64(total)*1000) / 10,
+	})
+}
+
+func (useCase ReadingUseCase) GetBookmarks(actor *models.User, bookId string, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Bookmark{})
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks, total, err := useCase.datastore.GetBookmarks(actor.Id, bookId, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(bookmarks, total, listOptions), nil
+}
+
+func (useCase ReadingUseCase) AddBookmark(actor *models.User, bookId string, bookmark *dtos.BookmarkDto) (*models.Bookmark, error) {
+	version, err := useCase.readableSection(actor, bookId, bookmark.SectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return useCase.datastore.SaveBookmark(&models.Bookmark{
+		UserId:    actor.Id,
+		BookId:    version.BookId,
+		SectionId: bookmark.SectionId,
+		Note:      bookmark.Note,
+	})
+}
+
+func (useCase ReadingUseCase) DeleteBookmark(actor *models.User, id string) error {
+	if err := requireAuthenticated(actor); err != nil {
+		return err
+	}
+
+	return useCase.datastore.DeleteBookmark(actor.Id, id)
+}
+
+func (useCase ReadingUseCase) GetHighlights(actor *models.User, bookId string, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Highlight{})
+	if err != nil {
+		return nil, err
+	}
+
+	highlights, total, err := useCase.datastore.GetHighlights(actor.Id, bookId, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(highlights, total, listOptions), nil
+}
+
+// AddHighlight highlights part of a section. Start and End count characters,
+// not bytes, of the section content.
+func (useCase ReadingUseCase) AddHighlight(actor *models.User, bookId string, highlight *dtos.HighlightDto) (*models.Highlight, error) {
+	version, err := useCase.readableSection(actor, bookId, highlight.SectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	section, err := versionSection(version)(highlight.SectionId)
+	if err != nil {
+		return nil, err
+	}
+
+	content := []rune(section.Content)
+	if highlight.Start < 0 || highlight.End <= highlight.Start || highlight.End > len(content) {
+		return nil, domain.ErrInvalidHighlight
+	}
+
+	return useCase.datastore.SaveHighlight(&models.Highlight{
+		UserId:    actor.Id,
+		BookId:    version.BookId,
+		SectionId: section.Id,
+		Start:     highlight.Start,
+		End:       highlight.End,
+		Text:      string(content[highlight.Start:highlight.End]),
+		Note:      highlight.Note,
+	})
+}
+
+func (useCase ReadingUseCase) DeleteHighlight(actor *models.User, id string) error {
+	if err := requireAuthenticated(actor); err != nil {
+		return err
+	}
+
+	return useCase.datastore.DeleteHighlight(actor.Id, id)
+}
+
+// readableSection loads the published version of the book after checking
+// that the section belongs to it and that the caller may read the section.
+func (useCase ReadingUseCase) readableSection(actor *models.User, bookId string, sectionId string) (*models.BookVersion, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	book, err := useCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := readableBook(useCase.datastore, actor, book)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := publishedVersion(useCase.datastore, book)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, found := findSection(version.Content, sectionId); !found {
+		return nil, domain.ErrSectionNotFound
+	}
+
+	if !full && !sampleSectionIds(version.Content)[sectionId] {
+		return nil, domain.ErrBookNotOwned
+	}
+
+	return version, nil
+}
@@ -0,0 +1,110 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"testing"
+)
+
+func TestUpdateProgressIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2", "3")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(false, nil)
+	app.DataStore.On("SaveReadingProgress", &models.ReadingProgress{
+		UserId:          readerUser.Id,
+		BookId:          "book",
+		SectionId:       "2",
+		PercentComplete: 66.7,
+	}).Return(&models.ReadingProgress{}, nil)
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.UpdateProgress(readerUser, "book", &dtos.ProgressDto{SectionId: "2"})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateProgressIsWrongSectionNotInBook(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.UpdateProgress(readerUser, "book", &dtos.ProgressDto{SectionId: "other"})
+
+	assert.Equal(t, domain.ErrSectionNotFound, err)
+	app.DataStore.AssertNotCalled(t, "SaveReadingProgress", mock.Anything)
+}
+
+func TestAddBookmarkIsWrongNotOwned(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1", "2", "3", "4")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(false, nil)
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.AddBookmark(readerUser, "book", &dtos.BookmarkDto{SectionId: "4"})
+
+	assert.Equal(t, domain.ErrBookNotOwned, err)
+	app.DataStore.AssertNotCalled(t, "SaveBookmark", mock.Anything)
+}
+
+func TestAddBookmarkIsWrongNotAuthenticated(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.AddBookmark(nil, "book", &dtos.BookmarkDto{SectionId: "1"})
+
+	assert.Equal(t, domain.ErrUnauthorized, err)
+}
+
+func TestAddHighlightCopiesText(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	expectPublishedVersion(app, book, models.BookSection{Id: "1", Content: "¡Hola mundo!"})
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+	app.DataStore.On("SaveHighlight", mock.MatchedBy(func(highlight *models.Highlight) bool {
+		return highlight.Text == "Hola" && highlight.UserId == readerUser.Id && highlight.Note == "greeting"
+	})).Return(&models.Highlight{}, nil)
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.AddHighlight(readerUser, "book", &dtos.HighlightDto{SectionId: "1", Start: 1, End: 5, Note: "greeting"})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestAddHighlightIsWrongOutOfRange(t *testing.T) {
+	app := test.CreateApp()
+
+	book := sampleBook("book", "1")
+	expectPublishedVersion(app, book, models.BookSection{Id: "1", Content: "short"})
+	app.DataStore.On("GetBookById", "book").Return(book, nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+
+	_, err := ReadingUseCase{
+		datastore: app.DataStore,
+	}.AddHighlight(readerUser, "book", &dtos.HighlightDto{SectionId: "1", Start: 2, End: 10})
+
+	assert.Equal(t, domain.ErrInvalidHighlight, err)
+	app.DataStore.AssertNotCalled(t, "SaveHighlight", mock.Anything)
+}
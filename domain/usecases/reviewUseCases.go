@@ -0,0 +1,218 @@
+package usecases
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+)
+
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+// ReviewUseCase lets owners rate the books in their library. Book.Reviews and
+// Book.Rating are recounted from the visible reviews after every change, so
+// clients cannot set them.
+type ReviewUseCase struct {
+	datastore domain.DatabaseGateway
+}
+
+func NewReviewUseCase(datastore domain.DatabaseGateway) ReviewUseCase {
+	return ReviewUseCase{
+		datastore: datastore,
+	}
+}
+
+func (useCase ReviewUseCase) AddReview(actor *models.User, bookId string, review *dtos.ReviewDto) (*models.Review, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	if err := validateRating(review.Rating); err != nil {
+		return nil, err
+	}
+
+	book, err := useCase.visibleBook(actor, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := useCase.datastore.HasEntitlement(actor.Id, book.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !owned {
+		return nil, domain.ErrBookNotOwned
+	}
+
+	savedReview, err := useCase.datastore.SaveReview(&models.Review{
+		BookId: book.Id,
+		UserId: actor.Id,
+		Rating: review.Rating,
+		Text:   review.Text,
+		Status: models.ReviewVisible,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := useCase.refreshRating(book.Id); err != nil {
+		return nil, err
+	}
+
+	return savedReview, nil
+}
+
+// GetReviews lists the reviews of a book. Hidden reviews are only listed to
+// admins.
+func (useCase ReviewUseCase) GetReviews(actor *models.User, bookId string, listOptions models.ListOptions) (*models.Page, error) {
+	if _, err := useCase.visibleBook(actor, bookId); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.Review{})
+	if err != nil {
+		return nil, err
+	}
+
+	includeHidden := actor != nil && actor.IsAdmin
+	reviews, total, err := useCase.datastore.GetReviewsByBook(bookId, includeHidden, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(reviews, total, listOptions), nil
+}
+
+// UpdateReview changes the rating and text of the caller's own review. A
+// hidden review stays hidden.
+func (useCase ReviewUseCase) UpdateReview(actor *models.User, bookId string, id string, review *dtos.ReviewDto) (*models.Review, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	if err := validateRating(review.Rating); err != nil {
+		return nil, err
+	}
+
+	storedReview, err := useCase.storedReview(bookId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedReview.UserId != actor.Id {
+		return nil, domain.ErrForbidden
+	}
+
+	storedReview.Rating = review.Rating
+	storedReview.Text = review.Text
+
+	updatedReview, err := useCase.datastore.UpdateReview(storedReview)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := useCase.refreshRating(bookId); err != nil {
+		return nil, err
+	}
+
+	return updatedReview, nil
+}
+
+// DeleteReview deletes a review on behalf of its writer or an admin.
+func (useCase ReviewUseCase) DeleteReview(actor *models.User, bookId string, id string) error {
+	if err := requireAuthenticated(actor); err != nil {
+		return err
+	}
+
+	storedReview, err := useCase.storedReview(bookId, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireSelfOrAdmin(actor, storedReview.UserId); err != nil {
+		return err
+	}
+
+	if err := useCase.datastore.DeleteReview(id); err != nil {
+		return err
+	}
+
+	return useCase.refreshRating(bookId)
+}
+
+func (useCase ReviewUseCase) HideReview(actor *models.User, bookId string, id string) (*models.Review, error) {
+	return useCase.moderateReview(actor, bookId, id, models.ReviewHidden)
+}
+
+func (useCase ReviewUseCase) ShowReview(actor *models.User, bookId string, id string) (*models.Review, error) {
+	return useCase.moderateReview(actor, bookId, id, models.ReviewVisible)
+}
+
+func (useCase ReviewUseCase) moderateReview(actor *models.User, bookId string, id string, status models.ReviewStatus) (*models.Review, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	storedReview, err := useCase.storedReview(bookId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	storedReview.Status = status
+	storedReview.ModeratedBy = actor.Id
+
+	updatedReview, err := useCase.datastore.UpdateReview(storedReview)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := useCase.refreshRating(bookId); err != nil {
+		return nil, err
+	}
+
+	return updatedReview, nil
+}
+
+func (useCase ReviewUseCase) visibleBook(actor *models.User, bookId string) (*models.Book, error) {
+	book, err := useCase.datastore.GetBookById(bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canSeeBook(actor, book) {
+		return nil, domain.ErrBookNotFound
+	}
+
+	return book, nil
+}
+
+// storedReview loads a review of the given book. Reviews of other books are
+// reported as not found.
+func (useCase ReviewUseCase) storedReview(bookId string, id string) (*models.Review, error) {
+	review, err := useCase.datastore.GetReviewById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if review.BookId != bookId {
+		return nil, domain.ErrReviewNotFound
+	}
+
+	return review, nil
+}
+
+func (useCase ReviewUseCase) refreshRating(bookId string) error {
+	_, err := useCase.datastore.RefreshBookRating(bookId)
+	return err
+}
+
+func validateRating(rating int) error {
+	if rating < minRating || rating > maxRating {
+		return domain.ErrInvalidRating
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package usecases
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"leanpub-app/app/test"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"testing"
+)
+
+func TestAddReviewIsOk(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book"), nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(true, nil)
+	app.DataStore.On("SaveReview", &models.Review{
+		BookId: "book",
+		UserId: readerUser.Id,
+		Rating: 4,
+		Text:   "good",
+		Status: models.ReviewVisible,
+	}).Return(&models.Review{Id: "review"}, nil)
+	app.DataStore.On("RefreshBookRating", "book").Return(&models.Book{}, nil)
+
+	review, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.AddReview(readerUser, "book", &dtos.ReviewDto{Rating: 4, Text: "good"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "review", review.Id)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestAddReviewIsWrongNotOwned(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book"), nil)
+	app.DataStore.On("HasEntitlement", readerUser.Id, "book").Return(false, nil)
+
+	_, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.AddReview(readerUser, "book", &dtos.ReviewDto{Rating: 4})
+
+	assert.Equal(t, domain.ErrBookNotOwned, err)
+	app.DataStore.AssertNotCalled(t, "SaveReview", mock.Anything)
+}
+
+func TestAddReviewIsWrongRating(t *testing.T) {
+	app := test.CreateApp()
+
+	for _, rating := range []int{0, 6} {
+		_, err := ReviewUseCase{
+			datastore: app.DataStore,
+		}.AddReview(readerUser, "book", &dtos.ReviewDto{Rating: rating})
+
+		assert.Equal(t, domain.ErrInvalidRating, err)
+	}
+}
+
+func TestUpdateReviewIsWrongOtherUser(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetReviewById", "review").Return(&models.Review{Id: "review", BookId: "book", UserId: "other"}, nil)
+
+	_, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.UpdateReview(readerUser, "book", "review", &dtos.ReviewDto{Rating: 1})
+
+	assert.Equal(t, domain.ErrForbidden, err)
+	app.DataStore.AssertNotCalled(t, "UpdateReview", mock.Anything)
+}
+
+func TestUpdateReviewIsWrongOtherBook(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetReviewById", "review").Return(&models.Review{Id: "review", BookId: "other", UserId: readerUser.Id}, nil)
+
+	_, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.UpdateReview(readerUser, "book", "review", &dtos.ReviewDto{Rating: 1})
+
+	assert.Equal(t, domain.ErrReviewNotFound, err)
+}
+
+func TestDeleteReviewByAdminRefreshesRating(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetReviewById", "review").Return(&models.Review{Id: "review", BookId: "book", UserId: "other"}, nil)
+	app.DataStore.On("DeleteReview", "review").Return(nil)
+	app.DataStore.On("RefreshBookRating", "book").Return(&models.Book{}, nil)
+
+	err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.DeleteReview(adminUser, "book", "review")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestHideReviewIsWrongNotAdmin(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.HideReview(readerUser, "book", "review")
+
+	assert.Equal(t, domain.ErrForbidden, err)
+	app.DataStore.AssertNotCalled(t, "UpdateReview", mock.Anything)
+}
+
+func TestGetReviewsIncludesHiddenForAdmins(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetBookById", "book").Return(sampleBook("book"), nil)
+	app.DataStore.On("GetReviewsByBook", "book", true, mock.Anything).Return(&[]models.Review{}, int64(0), nil)
+
+	_, err := ReviewUseCase{
+		datastore: app.DataStore,
+	}.GetReviews(adminUser, "book", models.ListOptions{})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestUpdateBookKeepsStoredReviews(t *testing.T) {
+	app := test.CreateApp()
+
+	storedBook := publishableBook(models.StatePublished)
+	storedBook.Reviews = 3
+	storedBook.Rating = 4.33
+	app.DataStore.On("GetBookById", storedBook.Id).Return(storedBook, nil)
+	app.DataStore.On("UpdateBook", mock.MatchedBy(func(book *models.Book) bool {
+		return book.Reviews == 3 && book.Rating == 4.33
+	}), mock.Anything).Return(storedBook, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.UpdateBook(authorUser, &models.Book{Id: storedBook.Id, Reviews: 1000, Rating: 5})
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
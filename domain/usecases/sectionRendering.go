@@ -0,0 +1,96 @@
+package usecases
+
+import (
+	"leanpub-app/domain/markdown"
+	"leanpub-app/domain/models"
+)
+
+// sectionAnchor is the id a rendered section is shown under, which links
+// between sections point to.
+func sectionAnchor(id string) string {
+	return "section-" + id
+}
+
+// sectionLinks resolves links between the sections of a book, given by id or
+// by the slug of the title, to the href of the section. When two titles share
+// a slug the first section wins.
+func sectionLinks(sections []models.BookSection, href func(id string) string) func(target string) (string, bool) {
+	ids := map[string]bool{}
+	slugs := map[string]string{}
+	for _, section := range sections {
+		ids[section.Id] = true
+
+		slug := markdown.Slug(section.Title)
+		if _, taken := slugs[slug]; slug != "" && !taken {
+			slugs[slug] = section.Id
+		}
+	}
+
+	return func(target string) (string, bool) {
+		if ids[target] {
+			return href(target), true
+		}
+
+		if id, found := slugs[target]; found {
+			return href(id), true
+		}
+
+		return "", false
+	}
+}
+
+// renderSection renders the Markdown of the section. Footnote ids start with
+// the anchor of the section so sections can be shown together.
+func renderSection(section models.BookSection, links func(target string) (string, bool)) string {
+	return markdown.Render(section.Content, markdown.Options{
+		IdPrefix:    sectionAnchor(section.Id) + "-",
+		SectionLink: links,
+	})
+}
+
+// renderSections fills in the Html of sections, resolving their links against
+// every section of the book. Links are resolved to ids when a section is
+// saved, so renaming the section they point to does not break them.
+func renderSections(sections []models.BookSection, book []models.BookSection) {
+	links := bookSectionLinks(book)
+	for i := range sections {
+		sections[i].Html = renderSection(sections[i], links)
+	}
+}
+
+// renderStaleSections renders the sections of a book saved before sections
+// were rendered on save, which have Content but no Html.
+func renderStaleSections(book []models.BookSection) {
+	links := bookSectionLinks(book)
+	for i, section := range book {
+		if section.Html == "" && section.Content != "" {
+			book[i].Html = renderSection(section, links)
+		}
+	}
+}
+
+func bookSectionLinks(book []models.BookSection) func(target string) (string, bool) {
+	return sectionLinks(book, func(id string) string {
+		return "#" + sectionAnchor(id)
+	})
+}
+
+// withSection returns the sections of a book with section added, or in
+// place of the stored section with its id.
+func withSection(sections []models.BookSection, section models.BookSection) []models.BookSection {
+	book := make([]models.BookSection, 0, len(sections)+1)
+	replaced := false
+	for _, stored := range sections {
+		if stored.Id == section.Id {
+			stored = section
+			replaced = true
+		}
+		book = append(book, stored)
+	}
+
+	if !replaced {
+		book = append(book, section)
+	}
+
+	return book
+}
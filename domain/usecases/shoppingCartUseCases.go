@@ -15,22 +15,110 @@ func NewShoppingCartUseCase(datastore domain.DatabaseGateway) ShoppingCartUseCas
 	}
 }
 
-func (useCase ShoppingCartUseCase) SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error)  {
+func (useCase ShoppingCartUseCase) SaveShoppingCart(actor *models.User, shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error)  {
+	if shoppingCart.UserId == "" && actor != nil {
+		shoppingCart.UserId = actor.Id
+	}
+
+	if err := requireSelfOrAdmin(actor, shoppingCart.UserId); err != nil {
+		return nil, err
+	}
+
+	if err := useCase.validatePrices(shoppingCart); err != nil {
+		return nil, err
+	}
+
 	return useCase.datastore.SaveShoppingCart(shoppingCart)
 }
 
-func (useCase ShoppingCartUseCase) GetShoppingCarts() (*[]models.ShoppingCart, error) {
-	return useCase.datastore.GetShoppingCarts()
+func (useCase ShoppingCartUseCase) GetShoppingCarts(actor *models.User, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.ShoppingCart{})
+	if err != nil {
+		return nil, err
+	}
+
+	shoppingCarts, total, err := useCase.datastore.GetShoppingCarts(listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(shoppingCarts, total, listOptions), nil
 }
 
-func (useCase ShoppingCartUseCase) GetShoppingCartById(id string) (*models.ShoppingCart, error) {
-	return useCase.datastore.GetShoppingCartById(id)
+func (useCase ShoppingCartUseCase) GetShoppingCartById(actor *models.User, id string) (*models.ShoppingCart, error) {
+	if err := requireAuthenticated(actor); err != nil {
+		return nil, err
+	}
+
+	shoppingCart, err := useCase.datastore.GetShoppingCartById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireSelfOrAdmin(actor, shoppingCart.UserId); err != nil {
+		return nil, err
+	}
+
+	return shoppingCart, nil
 }
 
-func (useCase ShoppingCartUseCase) DeleteShoppingCart(id string) error {
-	return useCase.datastore.DeleteShoppingCart(id)
+// DeleteShoppingCart deletes the cart. A non-zero version must be the stored
+// version.
+func (useCase ShoppingCartUseCase) DeleteShoppingCart(actor *models.User, id string, version int) error {
+	storedShoppingCart, err := useCase.GetShoppingCartById(actor, id)
+	if err != nil {
+		return err
+	}
+
+	version, err = matchVersion(version, storedShoppingCart.Version)
+	if err != nil {
+		return err
+	}
+
+	return useCase.datastore.DeleteShoppingCart(id, version)
 }
 
-func (useCase ShoppingCartUseCase) UpdateShoppingCart(shoppingCart *models.ShoppingCart)	(*models.ShoppingCart, error) {
+func (useCase ShoppingCartUseCase) UpdateShoppingCart(actor *models.User, shoppingCart *models.ShoppingCart)	(*models.ShoppingCart, error) {
+	storedShoppingCart, err := useCase.GetShoppingCartById(actor, shoppingCart.Id)
+	if err != nil {
+		return nil, err
+	}
+	shoppingCart.Version, err = matchVersion(shoppingCart.Version, storedShoppingCart.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	shoppingCart.UserId = storedShoppingCart.UserId
+	shoppingCart.CreatedAt = storedShoppingCart.CreatedAt
+
+	if err := useCase.validatePrices(shoppingCart); err != nil {
+		return nil, err
+	}
+
 	return useCase.datastore.UpdateShoppingCart(shoppingCart)
+}
+
+// validatePrices checks the prices the buyer chose against the minimum price
+// of each book. Checkout checks them again in case a minimum price went up.
+func (useCase ShoppingCartUseCase) validatePrices(shoppingCart *models.ShoppingCart) error {
+	for _, item := range shoppingCart.Books {
+		if item.Price == nil {
+			continue
+		}
+
+		book, err := useCase.datastore.GetBookById(item.Book)
+		if err != nil {
+			return err
+		}
+
+		if _, err := chosenPrice(book, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
\ No newline at end of file
@@ -1,7 +1,6 @@
 package usecases
 
 import (
-	"errors"
 	"leanpub-app/domain"
 	"leanpub-app/domain/models"
 )
@@ -16,37 +15,152 @@ func NewUserUseCase(datastore domain.DatabaseGateway) UserUseCase {
 	}
 }
 
-func (userUseCase UserUseCase) SaveUser(user *models.User) (*models.User, error) {
-	var (
-		registeredUser models.RegisteredUser
-		User           models.User
-	)
-	registeredUser.Email, registeredUser.Password = user.Email, user.Password
+func (userUseCase UserUseCase) SaveUser(actor *models.User, user *models.User) (*models.User, error) {
+	if actor == nil || !actor.IsAdmin {
+		user.IsAuthor = false
+		user.IsAdmin = false
+		user.HasSubscription = false
+	}
+
+	_, err := userUseCase.datastore.GetUserByEmail(user.Email)
+	if err == nil {
+		return nil, domain.ErrRegisteredEmail
+	}
+	if err != domain.ErrUserNotFound {
+		return nil, err
+	}
 
-	userUseCase.datastore.ValidateUser(&registeredUser, &User)
-	if User.Email == user.Email {
-		return nil, errors.New("REGISTERED_EMAIL")
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return nil, err
 	}
+	user.Password = hash
 
 	return userUseCase.datastore.SaveUser(user)
 }
 
-func (userUseCase UserUseCase) ValidateUser(registeredUser *models.RegisteredUser, user *models.User) (*models.User, error) {
-	return userUseCase.datastore.ValidateUser(registeredUser, user)
+// BootstrapAdmin makes sure the user with the email exists and is an admin,
+// so a new install has someone to make other users authors or admins. An
+// existing user keeps their password.
+func (userUseCase UserUseCase) BootstrapAdmin(email string, password string) (*models.User, error) {
+	user, err := userUseCase.datastore.GetUserByEmail(email)
+	if err == domain.ErrUserNotFound {
+		admin := &models.User{Email: email, Password: password, IsAdmin: true}
+		return userUseCase.SaveUser(admin, admin)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsAdmin {
+		return user, nil
+	}
+
+	user.IsAdmin = true
+	return userUseCase.datastore.UpdateUser(user)
 }
 
-func (userUseCase UserUseCase) GetUsers() (*[]models.User, error) {
-	return userUseCase.datastore.GetUsers()
+func (userUseCase UserUseCase) ValidateUser(registeredUser *models.RegisteredUser) (*models.User, error) {
+	user, err := userUseCase.datastore.GetUserByEmail(registeredUser.Email)
+	if err != nil {
+		return nil, domain.ErrInvalidUserOrPassword
+	}
+
+	valid, legacy := verifyPassword(user.Password, registeredUser.Password)
+	if !valid {
+		return nil, domain.ErrInvalidUserOrPassword
+	}
+
+	if legacy {
+		hash, err := hashPassword(registeredUser.Password)
+		if err == nil {
+			user.Password = hash
+			userUseCase.datastore.UpdateUser(user)
+		}
+	}
+
+	return user, nil
+}
+
+func (userUseCase UserUseCase) GetUsers(actor *models.User, listOptions models.ListOptions) (*models.Page, error) {
+	if err := requireAdmin(actor); err != nil {
+		return nil, err
+	}
+
+	listOptions, err := normalizeListOptions(listOptions, models.User{}, "password")
+	if err != nil {
+		return nil, err
+	}
+
+	users, total, err := userUseCase.datastore.GetUsers(listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(users, total, listOptions), nil
 }
 
-func (userUseCase UserUseCase) GetUserById(id string) (*models.User, error) {
+func (userUseCase UserUseCase) GetUserById(actor *models.User, id string) (*models.User, error) {
+	if err := requireSelfOrAdmin(actor, id); err != nil {
+		return nil, err
+	}
+
 	return userUseCase.datastore.GetUserById(id)
 }
 
-func (userUseCase UserUseCase) DeleteUser(id string) error {
-	return userUseCase.datastore.DeleteUser(id)
+// DeleteUser deletes the user. A non-zero version must be the stored version.
+func (userUseCase UserUseCase) DeleteUser(actor *models.User, id string, version int) error {
+	if err := requireSelfOrAdmin(actor, id); err != nil {
+		return err
+	}
+
+	storedUser, err := userUseCase.datastore.GetUserById(id)
+	if err != nil {
+		return err
+	}
+
+	version, err = matchVersion(version, storedUser.Version)
+	if err != nil {
+		return err
+	}
+
+	return userUseCase.datastore.DeleteUser(id, version)
 }
 
-func (userUseCase UserUseCase) UpdateUser(user *models.User) (*models.User, error) {
+// UpdateUser keeps the creation date, and the stored admin and subscription
+// flags unless the caller is an admin, so users cannot grant themselves
+// privileges. A non-zero user.Version must be the stored version.
+func (userUseCase UserUseCase) UpdateUser(actor *models.User, user *models.User) (*models.User, error) {
+	if err := requireSelfOrAdmin(actor, user.Id); err != nil {
+		return nil, err
+	}
+
+	storedUser, err := userUseCase.datastore.GetUserById(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Version, err = matchVersion(user.Version, storedUser.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	user.CreatedAt = storedUser.CreatedAt
+	if !actor.IsAdmin {
+		user.IsAuthor = storedUser.IsAuthor
+		user.IsAdmin = storedUser.IsAdmin
+		user.HasSubscription = storedUser.HasSubscription
+	}
+
+	if user.Password == "" {
+		user.Password = storedUser.Password
+	} else {
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hash
+	}
+
 	return userUseCase.datastore.UpdateUser(user)
 }
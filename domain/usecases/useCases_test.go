@@ -5,13 +5,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
 	"leanpub-app/app/test"
+	"leanpub-app/domain"
 	"leanpub-app/domain/models"
 	"leanpub-app/domain/models/dtos"
+	"strings"
 	"testing"
 	"time"
 )
 
+var adminUser = &models.User{Id: "9999999999", IsAdmin: true}
+var authorUser = &models.User{Id: "211212", IsAuthor: true}
+
 func TestSaveUserIsOk(t *testing.T) {
 	app := test.CreateApp()
 
@@ -31,15 +37,37 @@ func TestSaveUserIsOk(t *testing.T) {
 	}
 
 	app.DataStore.On("SaveUser", mock.Anything).Return(user, nil)
-	app.DataStore.On("ValidateUser", mock.Anything, mock.Anything).Return(user, nil)
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, domain.ErrUserNotFound)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.SaveUser(user)
+	}.SaveUser(nil, user)
 
 	assert.Nil(t, err)
+	assert.NotEqual(t, "test1234", user.Password)
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("test1234")))
 	app.DataStore.MethodCalled("SaveUser", mock.Anything)
-	app.DataStore.MethodCalled("ValidateUser", mock.Anything)
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
+}
+
+func TestSaveUserIsWrongRegisteredEmail(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{
+		Id:       "1234567890",
+		Email:    "test@example.com",
+		Password: "test1234",
+		Name:     "test",
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(user, nil)
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.SaveUser(nil, user)
+
+	assert.EqualError(t, err, "REGISTERED_EMAIL")
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
 }
 
 func TestSaveUserIsWrongConnectionFailed(t *testing.T) {
@@ -61,16 +89,81 @@ func TestSaveUserIsWrongConnectionFailed(t *testing.T) {
 	}
 
 	app.DataStore.On("SaveUser", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
-	app.DataStore.On("ValidateUser", mock.Anything, mock.Anything).Return(nil, nil)
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, domain.ErrUserNotFound)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.SaveUser(user)
+	}.SaveUser(nil, user)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
 	app.DataStore.MethodCalled("SaveUser", mock.Anything)
 }
 
+func TestSaveUserIsWrongEmailLookupFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{Email: "test@example.com", Password: "test1234"}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.SaveUser(nil, user)
+
+	assert.EqualError(t, err, "CONNECTION_FAIL")
+	app.DataStore.AssertNotCalled(t, "SaveUser", mock.Anything)
+}
+
+func TestSaveUserIsWrongPasswordOver72Bytes(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{Email: "test@example.com", Password: strings.Repeat("ñ", 37)}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, domain.ErrUserNotFound)
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.SaveUser(nil, user)
+
+	assert.True(t, errors.Is(err, domain.ErrValidation), "bcrypt would ignore what follows the 72nd byte")
+	app.DataStore.AssertNotCalled(t, "SaveUser", mock.Anything)
+}
+
+func TestBootstrapAdminCreatesAdmin(t *testing.T) {
+	app := test.CreateApp()
+
+	app.DataStore.On("GetUserByEmail", "admin@example.com").Return(nil, domain.ErrUserNotFound)
+	app.DataStore.On("SaveUser", mock.MatchedBy(func(user *models.User) bool {
+		return user.IsAdmin && user.Password != "admin1234"
+	})).Return(&models.User{Id: "1", Email: "admin@example.com", IsAdmin: true}, nil)
+
+	admin, err := UserUseCase{
+		datastore: app.DataStore,
+	}.BootstrapAdmin("admin@example.com", "admin1234")
+
+	assert.Nil(t, err)
+	assert.True(t, admin.IsAdmin)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestBootstrapAdminPromotesExistingUser(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{Id: "1", Email: "admin@example.com", Password: "hash", Version: 3}
+	app.DataStore.On("GetUserByEmail", "admin@example.com").Return(user, nil)
+	app.DataStore.On("UpdateUser", mock.MatchedBy(func(user *models.User) bool {
+		return user.IsAdmin && user.Password == "hash" && user.Version == 3
+	})).Return(user, nil)
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.BootstrapAdmin("admin@example.com", "admin1234")
+
+	assert.Nil(t, err)
+	app.DataStore.AssertNotCalled(t, "SaveUser", mock.Anything)
+	app.DataStore.AssertExpectations(t)
+}
+
 func TestValidateUserIsOk(t *testing.T) {
 	app := test.CreateApp()
 
@@ -94,32 +187,49 @@ func TestValidateUserIsOk(t *testing.T) {
 		Password: "test1234",
 	}
 
-	app.DataStore.On("ValidateUser", mock.Anything, mock.Anything).Return(user, nil)
+	user.Password, _ = hashPassword(user.Password)
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(user, nil)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.ValidateUser(registerUser, user)
+	}.ValidateUser(registerUser)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("ValidateUser", mock.Anything)
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
 }
 
-func TestValidateUserIsWrongConnectionFailed(t *testing.T) {
+func TestValidateUserIsWrongInvalidPassword(t *testing.T) {
 	app := test.CreateApp()
 
+	password, _ := hashPassword("test1234")
 	user := &models.User{
-		Id:              "1234567890",
-		Email:           "test@example.com",
-		Password:        "test1234",
-		Name:            "test",
-		About:           "test",
-		AvatarUrl:       "test",
-		CreatedAt:       time.Time{},
-		IsAdmin:         false,
-		HasSubscription: false,
-		IsAuthor:        false,
-		SocialNetworks:  []models.SocialNetwork{{Name: "Facebook", Url: "url"}},
-		UpdatedAt:       time.Time{},
+		Id:       "1234567890",
+		Email:    "test@example.com",
+		Password: password,
+	}
+
+	registerUser := &models.RegisteredUser{
+		Email:    "test@example.com",
+		Password: "wrong",
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(user, nil)
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.ValidateUser(registerUser)
+
+	assert.EqualError(t, err, "INVALID_USER_OR_PASSWORD")
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
+}
+
+func TestValidateUserUpgradesLegacyPassword(t *testing.T) {
+	app := test.CreateApp()
+
+	user := &models.User{
+		Id:       "1234567890",
+		Email:    "test@example.com",
+		Password: "test1234",
 	}
 
 	registerUser := &models.RegisteredUser{
@@ -127,14 +237,36 @@ func TestValidateUserIsWrongConnectionFailed(t *testing.T) {
 		Password: "test1234",
 	}
 
-	app.DataStore.On("ValidateUser", mock.Anything, mock.Anything).Return(nil, errors.New("UNREGISTERED_USER"))
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(user, nil)
+	app.DataStore.On("GetUserById", mock.Anything).Return(user, nil)
+	app.DataStore.On("UpdateUser", mock.Anything).Return(user, nil)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.ValidateUser(registerUser, user)
+	}.ValidateUser(registerUser)
 
-	assert.NotNil(t, err, "UNREGISTERED_USER")
-	app.DataStore.MethodCalled("ValidateUser", mock.Anything)
+	assert.Nil(t, err)
+	assert.True(t, isPasswordHash(user.Password))
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
+	app.DataStore.MethodCalled("UpdateUser", mock.Anything)
+}
+
+func TestValidateUserIsWrongConnectionFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	registerUser := &models.RegisteredUser{
+		Email:    "test@example.com",
+		Password: "test1234",
+	}
+
+	app.DataStore.On("GetUserByEmail", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.ValidateUser(registerUser)
+
+	assert.NotNil(t, err, "INVALID_USER_OR_PASSWORD")
+	app.DataStore.MethodCalled("GetUserByEmail", mock.Anything)
 }
 
 func TestUpdateUserIsOk(t *testing.T) {
@@ -155,11 +287,12 @@ func TestUpdateUserIsOk(t *testing.T) {
 		UpdatedAt:       time.Time{},
 	}
 
+	app.DataStore.On("GetUserById", mock.Anything).Return(user, nil)
 	app.DataStore.On("UpdateUser", mock.Anything).Return(user, nil)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.UpdateUser(user)
+	}.UpdateUser(user, user)
 
 	assert.Nil(t, err)
 	app.DataStore.MethodCalled("UpdateUser", mock.Anything)
@@ -183,11 +316,12 @@ func TestUpdateUserIsWrongConnectionFailed(t *testing.T) {
 		UpdatedAt:       time.Time{},
 	}
 
+	app.DataStore.On("GetUserById", mock.Anything).Return(user, nil)
 	app.DataStore.On("UpdateUser", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.UpdateUser(user)
+	}.UpdateUser(user, user)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
 	app.DataStore.MethodCalled("UpdateUser", mock.Anything)
@@ -197,28 +331,44 @@ func TestDeleteUserIsOk(t *testing.T) {
 	app := test.CreateApp()
 	Id := "xxx1234"
 
-	app.DataStore.On("DeleteUser", mock.Anything).Return(nil)
+	app.DataStore.On("GetUserById", Id).Return(&models.User{Id: Id, Version: 3}, nil)
+	app.DataStore.On("DeleteUser", Id, 3).Return(nil)
 
 	err := UserUseCase{
 		datastore: app.DataStore,
-	}.DeleteUser(Id)
+	}.DeleteUser(adminUser, Id, 0)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("DeleteUser", mock.Anything)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestDeleteUserIsWrongStaleVersion(t *testing.T) {
+	app := test.CreateApp()
+	Id := "xxx1234"
+
+	app.DataStore.On("GetUserById", Id).Return(&models.User{Id: Id, Version: 3}, nil)
+
+	err := UserUseCase{
+		datastore: app.DataStore,
+	}.DeleteUser(adminUser, Id, 2)
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	app.DataStore.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
 }
 
 func TestDeleteUserIsWrongConnectionFailed(t *testing.T) {
 	app := test.CreateApp()
 	Id := "xxx1234"
 
-	app.DataStore.On("DeleteUser", mock.Anything).Return(errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetUserById", Id).Return(&models.User{Id: Id}, nil)
+	app.DataStore.On("DeleteUser", mock.Anything, mock.Anything).Return(errors.New("CONNECTION_FAIL"))
 
 	err := UserUseCase{
 		datastore: app.DataStore,
-	}.DeleteUser(Id)
+	}.DeleteUser(adminUser, Id, 0)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
-	app.DataStore.MethodCalled("DeleteUser", mock.Anything)
+	app.DataStore.MethodCalled("DeleteUser", Id, 0)
 }
 
 func TestGetUsersIsOk(t *testing.T) {
@@ -239,11 +389,11 @@ func TestGetUsersIsOk(t *testing.T) {
 		UpdatedAt:       time.Time{}},
 	}
 
-	app.DataStore.On("GetUsers", mock.Anything).Return(&users, nil)
+	app.DataStore.On("GetUsers", mock.Anything).Return(&users, int64(1), nil)
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.GetUsers()
+	}.GetUsers(adminUser, models.ListOptions{})
 
 	assert.Nil(t, err)
 	app.DataStore.MethodCalled("GetUsers", mock.Anything)
@@ -252,14 +402,14 @@ func TestGetUsersIsOk(t *testing.T) {
 func TestGetUsersIsWrongConnectionFailed(t *testing.T) {
 	app := test.CreateApp()
 
-	app.DataStore.On("GetUsers").Return(nil, errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetUsers", mock.Anything).Return(nil, int64(0), errors.New("CONNECTION_FAIL"))
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.GetUsers()
+	}.GetUsers(adminUser, models.ListOptions{})
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
-	app.DataStore.MethodCalled("GetUsers")
+	app.DataStore.MethodCalled("GetUsers", mock.Anything)
 }
 
 func TestGetUserByIdIsOk(t *testing.T) {
@@ -285,7 +435,7 @@ func TestGetUserByIdIsOk(t *testing.T) {
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.GetUserById(Id)
+	}.GetUserById(adminUser, Id)
 
 	assert.Nil(t, err)
 	app.DataStore.MethodCalled("GetUserById", mock.Anything)
@@ -299,7 +449,7 @@ func TestGetUserByIdIsWrongConnectionFailed(t *testing.T) {
 
 	_, err := UserUseCase{
 		datastore: app.DataStore,
-	}.GetUserById(Id)
+	}.GetUserById(adminUser, Id)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
 	app.DataStore.MethodCalled("GetUserById", mock.Anything)
@@ -367,16 +517,65 @@ func TestSaveBookIsOk(t *testing.T) {
 		}},
 	}
 
-	app.DataStore.On("SaveBook", mock.Anything).Return(savedBook, nil)
-	app.DataStore.On("SaveBookSections", mock.Anything).Return(nil)
+	app.DataStore.On("SaveBook", mock.Anything, mock.Anything).Return(savedBook, nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.SaveBook(bookDto)
+	}.SaveBook(authorUser, bookDto)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("SaveBook", mock.Anything)
-	app.DataStore.MethodCalled("SaveBookSections", mock.Anything)
+	app.DataStore.MethodCalled("SaveBook", mock.Anything, mock.Anything)
+}
+
+func TestSaveBookPassesSectionsWithContent(t *testing.T) {
+	app := test.CreateApp()
+
+	bookDto := &dtos.BookDto{
+		Authors: []models.Author{{AuthorId: "211212"}},
+		Title:   "test",
+		Content: []dtos.BookContentDto{
+			{Chapter: "one", Sections: []models.BookSection{{Title: "first"}, {Title: "second"}}},
+			{Chapter: "two"},
+		},
+	}
+
+	app.DataStore.On("SaveBook", mock.MatchedBy(func(book *models.Book) bool {
+		return len(book.Content) == 2 && len(book.Content[0].Sections) == 2 && len(book.Content[1].Sections) == 0
+	}), mock.MatchedBy(func(sections []models.BookSection) bool {
+		return len(sections) == 2 && sections[0].Title == "first" && sections[0].Id != ""
+	})).Return(&models.Book{}, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SaveBook(authorUser, bookDto)
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestSaveBookRendersSectionsLinkingEachOther(t *testing.T) {
+	app := test.CreateApp()
+
+	bookDto := &dtos.BookDto{
+		Authors: []models.Author{{AuthorId: "211212"}},
+		Title:   "test",
+		Content: []dtos.BookContentDto{
+			{Chapter: "one", Sections: []models.BookSection{{Title: "Intro", Content: "Go to [the end](#the-end)."}}},
+			{Chapter: "two", Sections: []models.BookSection{{Title: "The End", Content: "*Done*"}}},
+		},
+	}
+
+	app.DataStore.On("SaveBook", mock.Anything, mock.MatchedBy(func(sections []models.BookSection) bool {
+		return sections[0].Html == `<p>Go to <a href="#section-`+sections[1].Id+`">the end</a>.</p>` &&
+			sections[1].Html == "<p><em>Done</em></p>"
+	})).Return(&models.Book{}, nil)
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SaveBook(authorUser, bookDto)
+
+	assert.Nil(t, err)
+	app.DataStore.AssertExpectations(t)
 }
 
 func TestSaveBookIsWrongConnectionFailed(t *testing.T) {
@@ -413,16 +612,14 @@ func TestSaveBookIsWrongConnectionFailed(t *testing.T) {
 		}},
 	}
 
-	app.DataStore.On("SaveBook", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
-	app.DataStore.On("SaveBookSections", mock.Anything).Return(nil)
+	app.DataStore.On("SaveBook", mock.Anything, mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.SaveBook(bookDto)
+	}.SaveBook(authorUser, bookDto)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
-	app.DataStore.MethodCalled("SaveBook", mock.Anything)
-	app.DataStore.MethodCalled("SaveBookSections", mock.Anything)
+	app.DataStore.MethodCalled("SaveBook", mock.Anything, mock.Anything)
 }
 
 func TestSaveBookSectionsIsOk(t *testing.T) {
@@ -475,72 +672,66 @@ func TestGetBooksIsOk(t *testing.T) {
 		}},
 	}}
 
-	app.DataStore.On("GetBooks", mock.Anything).Return(book, nil)
+	app.DataStore.On("GetBooks", mock.Anything, mock.Anything).Return(book, int64(1), nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooks()
+	}.GetBooks(nil, models.ListOptions{})
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("GetBooks", mock.Anything)
+	app.DataStore.MethodCalled("GetBooks", mock.Anything, mock.Anything)
 }
 
 func TestGetBooksIsWrongConnectionFailed(t *testing.T) {
 	app := test.CreateApp()
 
-	app.DataStore.On("GetBooks", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetBooks", mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooks()
+	}.GetBooks(nil, models.ListOptions{})
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
-	app.DataStore.MethodCalled("GetBooks", mock.Anything)
+	app.DataStore.MethodCalled("GetBooks", mock.Anything, mock.Anything)
 }
 
 func TestGetBookIndex(t *testing.T) {
 	app := test.CreateApp()
 
 	id := "12312312"
-	bookIndex := &models.BookIndex{
-		Content: []models.BookContent{{
-			Chapter: "test",
-			Sections: []models.BookSectionId{{
-				SectionId: "312312",
-			}},
-		}},
-	}
-
-	section := &models.BookSection{
-		Id: "21312",
+	book := sampleBook(id, "312312")
+	expectPublishedVersion(app, book, models.BookSection{
+		Id: "312312",
 		Title: "test",
 		Content: "test",
-	}
-
-	app.DataStore.On("GetBookIndex", mock.Anything).Return(bookIndex, nil)
-	app.DataStore.On("GetBookSectionById", mock.Anything).Return(section, nil)
+	})
+	app.DataStore.On("GetBookById", id).Return(book, nil)
 
-	_, err := BookUseCase{
+	index, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookIndex(id)
+	}.GetBookIndex(nil, id)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("GetBookIndex", mock.Anything)
-	app.DataStore.MethodCalled("GetBookSectionById", mock.Anything)
+	assert.Equal(t, []models.Index{{
+		Chapter: "test",
+		Sections: []models.BookSectionIndex{{Id: "312312", Title: "test"}},
+	}}, *index)
 }
 
 func TestGetBookIndexWrongConnectionFailed(t *testing.T) {
 	app := test.CreateApp()
 
 	id := "12312312"
-	app.DataStore.On("GetBookIndex", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	book := sampleBook(id, "312312")
+	book.PublishedVersion = 1
+	app.DataStore.On("GetBookById", id).Return(book, nil)
+	app.DataStore.On("GetBookVersion", id, 1).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookIndex(id)
+	}.GetBookIndex(nil, id)
 
-	assert.NotNil(t, err, "CONNECTION_FAIL")
-	app.DataStore.MethodCalled("GetBookIndex", mock.Anything)
+	assert.EqualError(t, err, "CONNECTION_FAIL")
 }
 
 func TestGetSectionsByBookIdIsOk(t *testing.T) {
@@ -555,11 +746,12 @@ func TestGetSectionsByBookIdIsOk(t *testing.T) {
 		}},
 	}
 
+	app.DataStore.On("GetBookById", bookId).Return(sampleBook(bookId, "312312"), nil)
 	app.DataStore.On("GetSectionsByBookId", mock.Anything).Return(sections, nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetSectionsByBookId(bookId)
+	}.GetSectionsByBookId(nil, bookId)
 
 	assert.Nil(t, err)
 	app.DataStore.MethodCalled("GetSectionsByBookId", mock.Anything)
@@ -569,11 +761,12 @@ func TestGetSectionsByBookIdWrongConnectionFailed(t *testing.T) {
 	app := test.CreateApp()
 	bookId := "12312312"
 
+	app.DataStore.On("GetBookById", bookId).Return(sampleBook(bookId), nil)
 	app.DataStore.On("GetSectionsByBookId", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetSectionsByBookId(bookId)
+	}.GetSectionsByBookId(nil, bookId)
 
 	assert.NotNil(t, err, "CONNECTION_FAIL")
 	app.DataStore.MethodCalled("GetSectionsByBookId", mock.Anything)
@@ -582,36 +775,75 @@ func TestGetSectionsByBookIdWrongConnectionFailed(t *testing.T) {
 func TestGetBookSectionByIdIsOk(t *testing.T) {
 	app := test.CreateApp()
 
-	bookSection := &models.BookSection{
-		Id: "31231212",
+	id := "21312312"
+	bookSection := models.BookSection{
+		Id: id,
 		Title: "test",
 		Content: "test",
+		Html: "<p>test</p>",
 	}
+
+	book := sampleBook("12312312", id)
+	expectPublishedVersion(app, book, bookSection)
+	app.DataStore.On("GetBookBySectionId", id).Return(book, nil)
+
+	section, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookSectionById(nil, id)
+
+	assert.Nil(t, err)
+	assert.Equal(t, bookSection, *section)
+}
+
+func TestGetBookSectionByIdRendersSectionsWithoutHtml(t *testing.T) {
+	app := test.CreateApp()
+
 	id := "21312312"
+	bookSection := models.BookSection{Id: id, Title: "test", Content: "See [next](#next-one)"}
 
-	app.DataStore.On("GetBookSectionById", mock.Anything).Return(bookSection, nil)
+	app.DataStore.On("GetBookBySectionId", id).Return(sampleBook("12312312", id, "2"), nil)
+	app.DataStore.On("GetSectionsByBookId", "12312312").Return(&models.BookSections{Sections: []models.BookSection{
+		bookSection,
+		{Id: "2", Title: "Next one"},
+	}}, nil)
 
-	_, err := BookUseCase{
+	section, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookSectionById(id)
+	}.GetBookSectionById(nil, id)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("GetBookSectionById", mock.Anything)
+	assert.Equal(t, `<p>See <a href="#section-2">next</a></p>`, section.Html)
 }
 
-func TestGetBookSectionByIdWrongConnectionFailed(t *testing.T) {
+func TestGetBookSectionByIdShowsThePublishedVersion(t *testing.T) {
 	app := test.CreateApp()
 
 	id := "21312312"
+	book := sampleBook("12312312", "other")
+	expectPublishedVersion(app, book)
+	app.DataStore.On("GetBookBySectionId", id).Return(book, nil)
 
-	app.DataStore.On("GetBookSectionById", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBookSectionById(nil, id)
+
+	assert.Equal(t, domain.ErrSectionNotFound, err)
+}
+
+func TestGetBookSectionByIdWrongConnectionFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	id := "21312312"
+	book := sampleBook("12312312", id)
+	book.PublishedVersion = 1
+	app.DataStore.On("GetBookBySectionId", id).Return(book, nil)
+	app.DataStore.On("GetBookVersion", "12312312", 1).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookSectionById(id)
+	}.GetBookSectionById(nil, id)
 
-	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
-	app.DataStore.MethodCalled("GetBookSectionById", mock.Anything)
+	assert.EqualError(t, err, "CONNECTION_FAIL")
 }
 
 func TestGetBookByIdIsOk(t *testing.T) {
@@ -651,7 +883,7 @@ func TestGetBookByIdIsOk(t *testing.T) {
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookById(id)
+	}.GetBookById(adminUser, id)
 
 	assert.Nil(t, err)
 	app.DataStore.MethodCalled("GetBookById", mock.Anything)
@@ -666,7 +898,7 @@ func TestGetBookByIdWrongConnectionFailed(t *testing.T) {
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBookById(id)
+	}.GetBookById(adminUser, id)
 
 	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
 	app.DataStore.MethodCalled("GetBookById", mock.Anything)
@@ -705,14 +937,14 @@ func TestGetBooksByAuthorIsOk(t *testing.T) {
 	}}
 	authorId := "21312312"
 
-	app.DataStore.On("GetBooksByAuthor", mock.Anything).Return(books, nil)
+	app.DataStore.On("GetBooksByAuthor", mock.Anything, mock.Anything, mock.Anything).Return(books, int64(1), nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooksByAuthor(authorId)
+	}.GetBooksByAuthor(nil, authorId, models.ListOptions{})
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("GetBooksByAuthor", mock.Anything)
+	app.DataStore.MethodCalled("GetBooksByAuthor", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestGetBooksByAuthorWrongConnectionFailed(t *testing.T) {
@@ -720,14 +952,14 @@ func TestGetBooksByAuthorWrongConnectionFailed(t *testing.T) {
 
 	authorId := "21312312"
 
-	app.DataStore.On("GetBooksByAuthor", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetBooksByAuthor", mock.Anything, mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooksByAuthor(authorId)
+	}.GetBooksByAuthor(nil, authorId, models.ListOptions{})
 
 	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
-	app.DataStore.MethodCalled("GetBooksByAuthor", mock.Anything)
+	app.DataStore.MethodCalled("GetBooksByAuthor", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestGetBooksByCategoryIsOk(t *testing.T) {
@@ -763,14 +995,14 @@ func TestGetBooksByCategoryIsOk(t *testing.T) {
 	}}
 	category := "Go"
 
-	app.DataStore.On("GetBooksByCategory", mock.Anything).Return(books, nil)
+	app.DataStore.On("GetBooksByCategory", mock.Anything, mock.Anything, mock.Anything).Return(books, int64(1), nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooksByCategory(category)
+	}.GetBooksByCategory(nil, category, models.ListOptions{})
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("GetBooksByCategory", mock.Anything)
+	app.DataStore.MethodCalled("GetBooksByCategory", mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestGetBooksByCategoryWrongConnectionFailed(t *testing.T) {
@@ -778,14 +1010,69 @@ func TestGetBooksByCategoryWrongConnectionFailed(t *testing.T) {
 
 	category := "Go"
 
-	app.DataStore.On("GetBooksByCategory", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetBooksByCategory", mock.Anything, mock.Anything, mock.Anything).Return(nil, int64(0), errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.GetBooksByCategory(category)
+	}.GetBooksByCategory(nil, category, models.ListOptions{})
 
 	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
-	app.DataStore.MethodCalled("GetBooksByCategory", mock.Anything)
+	app.DataStore.MethodCalled("GetBooksByCategory", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearchBooksPagesInTheDatastore(t *testing.T) {
+	app := test.CreateApp()
+
+	results := &[]models.BookSearchResult{
+		{Book: models.Book{Id: "3", Title: "go"}, Score: 5},
+	}
+	search := models.BookSearch{Query: "go", State: models.StatePublished}
+	paging := mock.MatchedBy(func(listOptions models.ListOptions) bool {
+		return listOptions.Offset == 1 && listOptions.Limit == 1
+	})
+
+	app.DataStore.On("SearchBooks", search, paging).Return(results, int64(3), nil)
+
+	page, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SearchBooks(nil, models.BookSearch{Query: "  go "}, models.ListOptions{Offset: 1, Limit: 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, results, page.Items)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestSearchBooksWithoutQueryFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SearchBooks(nil, models.BookSearch{Query: " "}, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrInvalidSearch, err)
+	app.DataStore.AssertNotCalled(t, "SearchBooks", mock.Anything, mock.Anything)
+}
+
+func TestSearchBooksWithInvalidPriceRangeFailed(t *testing.T) {
+	app := test.CreateApp()
+	minPrice, maxPrice := 20.0, 10.0
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SearchBooks(nil, models.BookSearch{Query: "go", MinPrice: &minPrice, MaxPrice: &maxPrice}, models.ListOptions{})
+
+	assert.Equal(t, domain.ErrInvalidSearch, err)
+}
+
+func TestSearchBooksWithSortFailed(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.SearchBooks(nil, models.BookSearch{Query: "go"}, models.ListOptions{Sort: []models.SortField{{Field: "title"}}})
+
+	assert.Equal(t, domain.ErrInvalidSortField, err)
 }
 
 func TestDeleteBookIsOk(t *testing.T) {
@@ -793,14 +1080,30 @@ func TestDeleteBookIsOk(t *testing.T) {
 
 	id := "21312312"
 
-	app.DataStore.On("DeleteBook", mock.Anything).Return(nil)
+	app.DataStore.On("GetBookById", mock.Anything).Return(&models.Book{Id: id, Authors: []models.Author{{AuthorId: "211212"}}, Version: 2}, nil)
+	app.DataStore.On("DeleteBook", id, 2).Return(nil)
 
 	err := BookUseCase{
 		datastore: app.DataStore,
-	}.DeleteBook(id)
+	}.DeleteBook(authorUser, id, 2)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("DeleteBook", mock.Anything)
+	app.DataStore.AssertExpectations(t)
+}
+
+func TestDeleteBookIsWrongStaleVersion(t *testing.T) {
+	app := test.CreateApp()
+
+	id := "21312312"
+
+	app.DataStore.On("GetBookById", mock.Anything).Return(&models.Book{Id: id, Authors: []models.Author{{AuthorId: "211212"}}, Version: 2}, nil)
+
+	err := BookUseCase{
+		datastore: app.DataStore,
+	}.DeleteBook(authorUser, id, 1)
+
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	app.DataStore.AssertNotCalled(t, "DeleteBook", mock.Anything, mock.Anything)
 }
 
 func TestDeleteBookWrongConnectionFailed(t *testing.T) {
@@ -808,14 +1111,15 @@ func TestDeleteBookWrongConnectionFailed(t *testing.T) {
 
 	id := "21312312"
 
-	app.DataStore.On("DeleteBook", mock.Anything).Return(errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetBookById", mock.Anything).Return(&models.Book{Id: id, Authors: []models.Author{{AuthorId: "211212"}}}, nil)
+	app.DataStore.On("DeleteBook", mock.Anything, mock.Anything).Return(errors.New("CONNECTION_FAIL"))
 
 	err := BookUseCase{
 		datastore: app.DataStore,
-	}.DeleteBook(id)
+	}.DeleteBook(authorUser, id, 0)
 
 	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
-	app.DataStore.MethodCalled("DeleteBook", mock.Anything)
+	app.DataStore.MethodCalled("DeleteBook", id, 0)
 }
 
 func TestUpdateBookIsOk(t *testing.T) {
@@ -850,14 +1154,15 @@ func TestUpdateBookIsOk(t *testing.T) {
 		}},
 	}
 
-	app.DataStore.On("UpdateBook", mock.Anything).Return(book, nil)
+	app.DataStore.On("GetBookById", mock.Anything).Return(book, nil)
+	app.DataStore.On("UpdateBook", mock.Anything, mock.Anything).Return(book, nil)
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.UpdateBook(book)
+	}.UpdateBook(authorUser, book)
 
 	assert.Nil(t, err)
-	app.DataStore.MethodCalled("UpdateBook", mock.Anything)
+	app.DataStore.MethodCalled("UpdateBook", mock.Anything, mock.Anything)
 }
 
 func TestUpdateBookWrongConnectionFailed(t *testing.T) {
@@ -892,12 +1197,49 @@ func TestUpdateBookWrongConnectionFailed(t *testing.T) {
 		}},
 	}
 
-	app.DataStore.On("UpdateBook", mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
+	app.DataStore.On("GetBookById", mock.Anything).Return(book, nil)
+	app.DataStore.On("UpdateBook", mock.Anything, mock.Anything).Return(nil, errors.New("CONNECTION_FAIL"))
 
 	_, err := BookUseCase{
 		datastore: app.DataStore,
-	}.UpdateBook(book)
+	}.UpdateBook(authorUser, book)
 
 	assert.NotNil(t, err, errors.New("CONNECTION_FAIL"))
-	app.DataStore.MethodCalled("UpdateBook", mock.Anything)
-}
\ No newline at end of file
+	app.DataStore.MethodCalled("UpdateBook", mock.Anything, mock.Anything)
+}
+func TestGetBooksAppliesDefaultPageAndSortFields(t *testing.T) {
+	app := test.CreateApp()
+
+	books := &[]models.Book{}
+	app.DataStore.On("GetBooks", models.StatePublished, models.ListOptions{
+		Limit: 20,
+		Sort:  []models.SortField{{Field: "_id", Descending: true}},
+	}).Return(books, int64(0), nil)
+
+	page, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBooks(nil, models.ListOptions{Sort: []models.SortField{{Field: "id", Descending: true}}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 20, page.Limit)
+}
+
+func TestGetBooksIsWrongSortField(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := BookUseCase{
+		datastore: app.DataStore,
+	}.GetBooks(nil, models.ListOptions{Sort: []models.SortField{{Field: "unknown"}}})
+
+	assert.EqualError(t, err, "INVALID_SORT_FIELD")
+}
+
+func TestGetUsersIsWrongPasswordField(t *testing.T) {
+	app := test.CreateApp()
+
+	_, err := UserUseCase{
+		datastore: app.DataStore,
+	}.GetUsers(adminUser, models.ListOptions{Fields: []string{"password"}})
+
+	assert.EqualError(t, err, "INVALID_FIELD")
+}
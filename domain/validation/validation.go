@@ -0,0 +1,210 @@
+// Package validation checks request payloads against the rules declared in
+// the `validate` tags of their fields and reports every failing field at
+// once.
+//
+// A tag lists rules separated by commas:
+//
+//	required     the field must not be empty
+//	min=N        numbers must be at least N, strings at least N characters long
+//	max=N        numbers must be at most N, strings at most N characters long
+//	             and lists at most N items long
+//	maxbytes=N   strings must be at most N bytes long once UTF-8 encoded
+//	oneof=A B C  the field must be one of the values
+//	email        the field must be an email address
+//	url          the field must be an http or https URL
+//	language     the field must be a language code such as "en" or "pt-BR"
+//
+// Rules other than required are not checked on empty fields. Structs, and
+// lists and pointers of structs, are checked field by field.
+package validation
+
+import (
+	"fmt"
+	"leanpub-app/domain"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var languageCode = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// Validate checks value, a struct or a pointer to one, and returns
+// domain.ErrValidation listing the failing fields, or nil when there are
+// none.
+func Validate(value interface{}) error {
+	var details []domain.FieldError
+	validateValue(reflect.ValueOf(value), "", &details)
+
+	if len(details) == 0 {
+		return nil
+	}
+
+	return domain.ErrValidation.WithDetails(details)
+}
+
+func validateValue(value reflect.Value, path string, details *[]domain.FieldError) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			validateValue(value.Elem(), path, details)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), details)
+		}
+	case reflect.Struct:
+		validateStruct(value, path, details)
+	}
+}
+
+func validateStruct(value reflect.Value, path string, details *[]domain.FieldError) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := fieldName(field)
+		if fieldPath == "-" {
+			continue
+		}
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		if tag := field.Tag.Get("validate"); tag != "" {
+			if detail, failed := checkRules(value.Field(i), tag); failed {
+				detail.Field = fieldPath
+				*details = append(*details, detail)
+				continue
+			}
+		}
+
+		validateValue(value.Field(i), fieldPath, details)
+	}
+}
+
+// fieldName names a field the way clients send it.
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// checkRules returns the first rule of the tag the value breaks.
+func checkRules(value reflect.Value, tag string) (domain.FieldError, bool) {
+	empty := value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+	if value.Kind() == reflect.String {
+		empty = strings.TrimSpace(value.String()) == ""
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, argument := rule, ""
+		if separator := strings.Index(rule, "="); separator >= 0 {
+			name, argument = rule[:separator], rule[separator+1:]
+		}
+
+		if name == "required" {
+			if empty {
+				return domain.FieldError{Code: "REQUIRED", Message: "is required"}, true
+			}
+			continue
+		}
+
+		if empty {
+			continue
+		}
+
+		if detail, failed := checkRule(value, name, argument); failed {
+			return detail, true
+		}
+	}
+
+	return domain.FieldError{}, false
+}
+
+func checkRule(value reflect.Value, name string, argument string) (domain.FieldError, bool) {
+	switch name {
+	case "min":
+		limit, _ := strconv.ParseFloat(argument, 64)
+		if size(value) < limit {
+			if value.Kind() == reflect.String {
+				return domain.FieldError{Code: "TOO_SHORT", Message: "must be at least " + argument + " characters long"}, true
+			}
+			return domain.FieldError{Code: "TOO_SMALL", Message: "must be at least " + argument}, true
+		}
+	case "max":
+		limit, _ := strconv.ParseFloat(argument, 64)
+		if size(value) > limit {
+			switch value.Kind() {
+			case reflect.String:
+				return domain.FieldError{Code: "TOO_LONG", Message: "must be at most " + argument + " characters long"}, true
+			case reflect.Slice, reflect.Array:
+				return domain.FieldError{Code: "TOO_MANY", Message: "must have at most " + argument + " items"}, true
+			}
+			return domain.FieldError{Code: "TOO_LARGE", Message: "must be at most " + argument}, true
+		}
+	case "maxbytes":
+		limit, _ := strconv.Atoi(argument)
+		if len(value.String()) > limit {
+			return domain.FieldError{Code: "TOO_LONG", Message: "must be at most " + argument + " bytes long"}, true
+		}
+	case "oneof":
+		allowed := strings.Fields(argument)
+		for _, option := range allowed {
+			if value.String() == option {
+				return domain.FieldError{}, false
+			}
+		}
+		return domain.FieldError{Code: "NOT_ALLOWED", Message: "must be one of " + strings.Join(allowed, ", ")}, true
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+		if err != nil || address.Address != value.String() {
+			return domain.FieldError{Code: "INVALID_EMAIL", Message: "must be an email address"}, true
+		}
+	case "url":
+		parsed, err := url.Parse(value.String())
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return domain.FieldError{Code: "INVALID_URL", Message: "must be an http or https URL"}, true
+		}
+	case "language":
+		if !languageCode.MatchString(value.String()) {
+			return domain.FieldError{Code: "INVALID_LANGUAGE_CODE", Message: "must be a language code such as en or pt-BR"}, true
+		}
+	default:
+		panic("validation: unknown rule " + name)
+	}
+
+	return domain.FieldError{}, false
+}
+
+// size is the number a min or max rule compares: the value of a number, the
+// length in characters of a string and the length of a list.
+func size(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.Ptr:
+		if value.IsNil() {
+			return 0
+		}
+		return size(value.Elem())
+	}
+
+	return 0
+}
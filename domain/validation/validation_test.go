@@ -0,0 +1,100 @@
+package validation
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"leanpub-app/domain/models/dtos"
+	"strings"
+	"testing"
+)
+
+// fieldCodes maps each failing field to the code it failed with.
+func fieldCodes(t *testing.T, err error) map[string]string {
+	var validationErr *domain.Error
+	require.True(t, errors.As(err, &validationErr))
+	require.True(t, errors.Is(err, domain.ErrValidation))
+
+	codes := map[string]string{}
+	for _, detail := range validationErr.Details {
+		codes[detail.Field] = detail.Code
+	}
+	return codes
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	price := -1.0
+	err := Validate(&dtos.BookDto{
+		Authors:        []models.Author{{RoyaltyShare: -1}},
+		MinimumPrice:   -5,
+		LanguageCode:   "english",
+		CoverImage:     "javascript:alert(1)",
+		ReadingOptions: []models.ReadingOption{{Option: "pdf"}, {}},
+	})
+
+	assert.Equal(t, map[string]string{
+		"authors[0].authorId":      "REQUIRED",
+		"authors[0].royaltyShare":  "TOO_SMALL",
+		"title":                    "REQUIRED",
+		"coverImage":               "INVALID_URL",
+		"minimumPrice":             "TOO_SMALL",
+		"languageCode":             "INVALID_LANGUAGE_CODE",
+		"readingOptions[1].option": "REQUIRED",
+	}, fieldCodes(t, err))
+
+	err = Validate(dtos.CreateShoppingCartDto{Books: []models.BookId{{Book: "book"}, {Price: &price}}})
+	assert.Equal(t, map[string]string{
+		"books[1].book":  "REQUIRED",
+		"books[1].price": "TOO_SMALL",
+	}, fieldCodes(t, err))
+
+	err = Validate(struct {
+		Format string `json:"format" validate:"oneof=PDF EPUB"`
+	}{Format: "DOC"})
+	assert.Equal(t, map[string]string{"format": "NOT_ALLOWED"}, fieldCodes(t, err))
+}
+
+func TestValidateUser(t *testing.T) {
+	err := Validate(&dtos.CreateUserDto{
+		Email:          "not an email",
+		Password:       string(make([]byte, 73)),
+		SocialNetworks: []models.SocialNetwork{{Name: "site", Url: "ftp://example.com"}},
+	})
+
+	assert.Equal(t, map[string]string{
+		"email":                 "INVALID_EMAIL",
+		"password":              "TOO_LONG",
+		"socialNetworks[0].url": "INVALID_URL",
+	}, fieldCodes(t, err))
+}
+
+func TestValidatePasswordBytes(t *testing.T) {
+	password := strings.Repeat("é", 40)
+
+	err := Validate(&dtos.CreateUserDto{Email: "reader@example.com", Password: password})
+	assert.Equal(t, map[string]string{"password": "TOO_LONG"}, fieldCodes(t, err), "40 characters take 80 bytes")
+
+	err = Validate(&dtos.UpdateUserDto{Id: "1", Email: "reader@example.com", Password: password})
+	assert.Equal(t, map[string]string{"password": "TOO_LONG"}, fieldCodes(t, err))
+
+	assert.Nil(t, Validate(&dtos.CreateUserDto{Email: "reader@example.com", Password: strings.Repeat("é", 36)}))
+}
+
+func TestValidateAcceptsValidValues(t *testing.T) {
+	assert.Nil(t, Validate(&dtos.CreateUserDto{
+		Email:          "reader@example.com",
+		Password:       "correct horse",
+		AvatarUrl:      "https://example.com/avatar.png",
+		SocialNetworks: []models.SocialNetwork{{Name: "site", Url: "https://example.com"}},
+	}))
+
+	assert.Nil(t, Validate(&dtos.BookDto{
+		Title:        "Go",
+		Authors:      []models.Author{{AuthorId: "author"}},
+		LanguageCode: "pt-BR",
+	}))
+
+	assert.Nil(t, Validate(&dtos.ReviewDto{}), "values without rules are valid")
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"os"
+	"strings"
+	"time"
+)
+
+const jwtHeader = `{"alg":"HS256","typ":"JWT"}`
+
+type JwtGatewayImpl struct {
+	secret []byte
+}
+
+// NewJwtGatewayImpl signs tokens with the jwt.secret environment variable and
+// panics without it, so a server never starts signing with a secret nobody
+// configured. Only when jwt.dev is "true" is a random secret generated
+// instead, and tokens then only survive until the process restarts.
+func NewJwtGatewayImpl() domain.TokenGateway {
+	secret := []byte(os.Getenv("jwt.secret"))
+	if len(secret) == 0 {
+		if os.Getenv("jwt.dev") != "true" {
+			panic("jwt.secret is not set")
+		}
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+
+	return &JwtGatewayImpl{secret: secret}
+}
+
+func (jwtImpl *JwtGatewayImpl) IssueToken(claims *models.TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encodeSegment([]byte(jwtHeader)) + "." + encodeSegment(payload)
+	return unsigned + "." + encodeSegment(jwtImpl.sign(unsigned)), nil
+}
+
+func (jwtImpl *JwtGatewayImpl) ParseToken(token string) (*models.TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, domain.ErrInvalidToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	var fields struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &fields); err != nil || fields.Alg != "HS256" {
+		return nil, domain.ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, jwtImpl.sign(parts[0]+"."+parts[1])) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	var claims models.TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, domain.ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func (jwtImpl *JwtGatewayImpl) sign(unsigned string) []byte {
+	mac := hmac.New(sha256.New, jwtImpl.secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func encodeSegment(segment []byte) string {
+	return base64.RawURLEncoding.EncodeToString(segment)
+}
@@ -0,0 +1,14 @@
+package datastore
+
+import "leanpub-app/domain/models"
+
+// sectionIds lists the ids of every section referenced by a book's content.
+func sectionIds(content []models.BookContent) []string {
+	var ids []string
+	for _, chapter := range content {
+		for _, section := range chapter.Sections {
+			ids = append(ids, section.SectionId)
+		}
+	}
+	return ids
+}
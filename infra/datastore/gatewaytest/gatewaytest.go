@@ -0,0 +1,1114 @@
+// Package gatewaytest holds the contract every domain.DatabaseGateway
+// implementation must satisfy. Backends run it from their own tests with
+// RunDatabaseGatewayTests so they are all checked against the same scenarios.
+package gatewaytest
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RunDatabaseGatewayTests runs every scenario against a fresh gateway from
+// newGateway. Scenarios generate unique ids and values, so they can also run
+// against a shared database.
+func RunDatabaseGatewayTests(t *testing.T, newGateway func() domain.DatabaseGateway) {
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, gateway domain.DatabaseGateway)
+	}{
+		{"UserLifecycle", testUserLifecycle},
+		{"UserNotFound", testUserNotFound},
+		{"UserEmailsAreUnique", testUserEmailsAreUnique},
+		{"BookLifecycle", testBookLifecycle},
+		{"BookNotFound", testBookNotFound},
+		{"BooksByCategory", testBooksByCategory},
+		{"BooksByAuthor", testBooksByAuthor},
+		{"BooksPagination", testBooksPagination},
+		{"BookStateTransitions", testBookStateTransitions},
+		{"BookSections", testBookSections},
+		{"BookContent", testBookContent},
+		{"BookWithSections", testBookWithSections},
+		{"BookSearch", testBookSearch},
+		{"ShoppingCartLifecycle", testShoppingCartLifecycle},
+		{"ShoppingCartNotFound", testShoppingCartNotFound},
+		{"OrderLifecycle", testOrderLifecycle},
+		{"Entitlements", testEntitlements},
+		{"LibraryAfterBookDelete", testLibraryAfterBookDelete},
+		{"BookBySectionId", testBookBySectionId},
+		{"ReadingProgress", testReadingProgress},
+		{"Bookmarks", testBookmarks},
+		{"Highlights", testHighlights},
+		{"Reviews", testReviews},
+		{"BookVersions", testBookVersions},
+		{"PublishBook", testPublishBook},
+		{"VersionConflicts", testVersionConflicts},
+		{"Notifications", testNotifications},
+		{"RevokedTokens", testRevokedTokens},
+	}
+
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.name, func(t *testing.T) {
+			scenario.run(t, newGateway())
+		})
+	}
+}
+
+func newId() string {
+	id, _ := uuid.NewRandom()
+	return id.String()
+}
+
+func newBook(authorId string, categories ...string) *models.Book {
+	return &models.Book{
+		Id:             newId(),
+		Authors:        []models.Author{{AuthorId: authorId}},
+		AuthorCount:    1,
+		Title:          "test",
+		Description:    "test",
+		MinimumPrice:   10,
+		SuggestedPrice: 20,
+		State:          models.StateUnpublished,
+		Categories:     categories,
+	}
+}
+
+func testUserLifecycle(t *testing.T, gateway domain.DatabaseGateway) {
+	email := newId() + "@example.com"
+	user, err := gateway.SaveUser(&models.User{
+		Name:           "test",
+		Email:          email,
+		Password:       "hash",
+		SocialNetworks: []models.SocialNetwork{{Name: "Facebook", Url: "url"}},
+	})
+	require.Nil(t, err)
+	assert.NotEmpty(t, user.Id)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	storedUser, err := gateway.GetUserById(user.Id)
+	require.Nil(t, err)
+	assert.Equal(t, email, storedUser.Email)
+	assert.Equal(t, "hash", storedUser.Password)
+	assert.Equal(t, user.SocialNetworks, storedUser.SocialNetworks)
+
+	storedUser, err = gateway.GetUserByEmail(email)
+	require.Nil(t, err)
+	assert.Equal(t, user.Id, storedUser.Id)
+
+	storedUser.Name = "updated"
+	_, err = gateway.UpdateUser(storedUser)
+	require.Nil(t, err)
+
+	storedUser, err = gateway.GetUserById(user.Id)
+	require.Nil(t, err)
+	assert.Equal(t, "updated", storedUser.Name)
+
+	users, _, err := gateway.GetUsers(models.ListOptions{})
+	require.Nil(t, err)
+	assert.Contains(t, userIds(*users), user.Id)
+
+	assert.Equal(t, domain.ErrVersionConflict, gateway.DeleteUser(user.Id, storedUser.Version-1))
+	require.Nil(t, gateway.DeleteUser(user.Id, storedUser.Version))
+
+	_, err = gateway.GetUserById(user.Id)
+	assert.EqualError(t, err, "USER_NOT_FOUND")
+}
+
+func testUserNotFound(t *testing.T, gateway domain.DatabaseGateway) {
+	_, err := gateway.GetUserById(newId())
+	assert.EqualError(t, err, "USER_NOT_FOUND")
+
+	_, err = gateway.GetUserByEmail(newId() + "@example.com")
+	assert.EqualError(t, err, "USER_NOT_FOUND")
+
+	_, err = gateway.UpdateUser(&models.User{Id: newId()})
+	assert.EqualError(t, err, "USER_NOT_FOUND")
+
+	assert.Nil(t, gateway.DeleteUser(newId(), 1))
+}
+
+func testUserEmailsAreUnique(t *testing.T, gateway domain.DatabaseGateway) {
+	email := newId() + "@example.com"
+	_, err := gateway.SaveUser(&models.User{Email: email})
+	require.Nil(t, err)
+
+	_, err = gateway.SaveUser(&models.User{Email: email})
+	assert.Equal(t, domain.ErrRegisteredEmail, err)
+
+	user, err := gateway.SaveUser(&models.User{Email: newId() + "@example.com"})
+	require.Nil(t, err)
+
+	user.Email = email
+	_, err = gateway.UpdateUser(user)
+	assert.Equal(t, domain.ErrRegisteredEmail, err)
+}
+
+func testBookLifecycle(t *testing.T, gateway domain.DatabaseGateway) {
+	book := newBook(newId(), "test")
+	_, err := gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+	assert.False(t, book.CreatedAt.IsZero())
+
+	storedBook, err := gateway.GetBookById(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, book.Title, storedBook.Title)
+	assert.Equal(t, book.Authors, storedBook.Authors)
+	assert.Equal(t, book.MinimumPrice, storedBook.MinimumPrice)
+
+	storedBook.Title = "updated"
+	_, err = gateway.UpdateBook(storedBook, nil)
+	require.Nil(t, err)
+
+	storedBook, err = gateway.GetBookById(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, "updated", storedBook.Title)
+
+	books, _, err := gateway.GetBooks("", models.ListOptions{})
+	require.Nil(t, err)
+	assert.Contains(t, bookIds(*books), book.Id)
+
+	assert.Equal(t, domain.ErrVersionConflict, gateway.DeleteBook(book.Id, storedBook.Version-1))
+	require.Nil(t, gateway.DeleteBook(book.Id, storedBook.Version))
+
+	_, err = gateway.GetBookById(book.Id)
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+func testBookNotFound(t *testing.T, gateway domain.DatabaseGateway) {
+	_, err := gateway.GetBookById(newId())
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+
+	_, err = gateway.UpdateBook(&models.Book{Id: newId()}, nil)
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+
+	assert.Nil(t, gateway.DeleteBook(newId(), 1))
+}
+
+// testBooksByCategory checks the $all semantics: a book matches when the
+// requested category is one of its categories.
+func testBooksByCategory(t *testing.T, gateway domain.DatabaseGateway) {
+	category := newId()
+	other := newId()
+	matching := newBook(newId(), category, other)
+	single := newBook(newId(), category)
+	unrelated := newBook(newId(), other)
+
+	for _, book := range []*models.Book{matching, single, unrelated} {
+		_, err := gateway.SaveBook(book, nil)
+		require.Nil(t, err)
+	}
+
+	books, total, err := gateway.GetBooksByCategory(category, "", models.ListOptions{})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{matching.Id, single.Id}, bookIds(*books))
+	assert.Equal(t, int64(2), total)
+
+	books, _, err = gateway.GetBooksByCategory(newId(), "", models.ListOptions{})
+	require.Nil(t, err)
+	assert.Empty(t, *books)
+}
+
+func testBooksByAuthor(t *testing.T, gateway domain.DatabaseGateway) {
+	authorId := newId()
+	coAuthored := newBook(newId())
+	coAuthored.Authors = append(coAuthored.Authors, models.Author{AuthorId: authorId})
+	solo := newBook(authorId)
+	unrelated := newBook(newId())
+
+	for _, book := range []*models.Book{coAuthored, solo, unrelated} {
+		_, err := gateway.SaveBook(book, nil)
+		require.Nil(t, err)
+	}
+
+	books, _, err := gateway.GetBooksByAuthor(authorId, "", models.ListOptions{})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{coAuthored.Id, solo.Id}, bookIds(*books))
+}
+
+// testBooksPagination checks sorting, offset, limit, projection and that the
+// total counts every match rather than the returned page.
+func testBooksPagination(t *testing.T, gateway domain.DatabaseGateway) {
+	category := newId()
+	var saved []*models.Book
+	for _, title := range []string{"b", "c", "a", "d"} {
+		book := newBook(newId(), category)
+		book.Title = title
+		_, err := gateway.SaveBook(book, nil)
+		require.Nil(t, err)
+		saved = append(saved, book)
+	}
+
+	books, total, err := gateway.GetBooksByCategory(category, "", models.ListOptions{
+		Offset: 1,
+		Limit:  2,
+		Sort:   []models.SortField{{Field: "title", Descending: true}},
+		Fields: []string{"title"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	require.Len(t, *books, 2)
+	assert.Equal(t, "c", (*books)[0].Title)
+	assert.Equal(t, "b", (*books)[1].Title)
+	assert.Equal(t, saved[1].Id, (*books)[0].Id)
+	assert.Empty(t, (*books)[0].Description)
+	assert.Empty(t, (*books)[0].Categories)
+
+	books, total, err = gateway.GetBooksByCategory(category, "", models.ListOptions{Offset: 10, Limit: 2})
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Empty(t, *books)
+}
+
+// testBookSections checks the index projection and that GetSectionsByBookId
+// joins only the sections referenced from the book's content.
+func testBookSections(t *testing.T, gateway domain.DatabaseGateway) {
+	first := models.BookSection{Id: newId(), Title: "first", Content: "first"}
+	second := models.BookSection{Id: newId(), Title: "second", Content: "second"}
+	foreign := models.BookSection{Id: newId(), Title: "foreign", Content: "foreign"}
+
+	err := gateway.SaveBookSections([]interface{}{first, second, foreign})
+	require.Nil(t, err)
+
+	book := newBook(newId())
+	book.Content = []models.BookContent{
+		{Chapter: "one", Sections: []models.BookSectionId{{SectionId: first.Id}}},
+		{Chapter: "two", Sections: []models.BookSectionId{{SectionId: second.Id}}},
+	}
+	_, err = gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+
+	bookIndex, err := gateway.GetBookIndex(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, book.Content, bookIndex.Content)
+
+	sections, err := gateway.GetSectionsByBookId(book.Id)
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []models.BookSection{first, second}, sections.Sections)
+
+	section, err := gateway.GetBookSectionById(second.Id)
+	require.Nil(t, err)
+	assert.Equal(t, second, *section)
+
+	_, err = gateway.GetBookSectionById(newId())
+	assert.NotNil(t, err)
+
+	sections, err = gateway.GetSectionsByBookId(newId())
+	require.Nil(t, err)
+	assert.Empty(t, sections.Sections)
+
+	err = gateway.SaveBookSection(&first)
+	assert.NotNil(t, err, "sections ids are unique")
+}
+
+func testShoppingCartLifecycle(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	shoppingCart, err := gateway.SaveShoppingCart(&models.ShoppingCart{
+		UserId: userId,
+		Books:  []models.BookId{{Book: newId()}},
+	})
+	require.Nil(t, err)
+	assert.NotEmpty(t, shoppingCart.Id)
+
+	storedShoppingCart, err := gateway.GetShoppingCartById(shoppingCart.Id)
+	require.Nil(t, err)
+	assert.Equal(t, userId, storedShoppingCart.UserId)
+	assert.Equal(t, shoppingCart.Books, storedShoppingCart.Books)
+
+	price := 7.5
+	storedShoppingCart.Books = append(storedShoppingCart.Books, models.BookId{Book: newId(), Price: &price})
+	_, err = gateway.UpdateShoppingCart(storedShoppingCart)
+	require.Nil(t, err)
+
+	storedShoppingCart, err = gateway.GetShoppingCartById(shoppingCart.Id)
+	require.Nil(t, err)
+	assert.Len(t, storedShoppingCart.Books, 2)
+	assert.Nil(t, storedShoppingCart.Books[0].Price)
+	assert.Equal(t, &price, storedShoppingCart.Books[1].Price)
+
+	shoppingCarts, _, err := gateway.GetShoppingCarts(models.ListOptions{})
+	require.Nil(t, err)
+	assert.Contains(t, shoppingCartIds(*shoppingCarts), shoppingCart.Id)
+
+	assert.Equal(t, domain.ErrVersionConflict, gateway.DeleteShoppingCart(shoppingCart.Id, storedShoppingCart.Version-1))
+	require.Nil(t, gateway.DeleteShoppingCart(shoppingCart.Id, storedShoppingCart.Version))
+
+	_, err = gateway.GetShoppingCartById(shoppingCart.Id)
+	assert.EqualError(t, err, "SHOPPING_CART_NOT_FOUND")
+}
+
+func testShoppingCartNotFound(t *testing.T, gateway domain.DatabaseGateway) {
+	_, err := gateway.GetShoppingCartById(newId())
+	assert.EqualError(t, err, "SHOPPING_CART_NOT_FOUND")
+
+	_, err = gateway.UpdateShoppingCart(&models.ShoppingCart{Id: newId()})
+	assert.EqualError(t, err, "SHOPPING_CART_NOT_FOUND")
+
+	assert.Nil(t, gateway.DeleteShoppingCart(newId(), 1))
+}
+
+// testOrderLifecycle checks that saving an order empties its cart and that
+// status changes only apply from the expected status.
+func testOrderLifecycle(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	shoppingCart, err := gateway.SaveShoppingCart(&models.ShoppingCart{
+		UserId: userId,
+		Books:  []models.BookId{{Book: newId()}},
+	})
+	require.Nil(t, err)
+
+	order := &models.Order{
+		Id:     newId(),
+		UserId: userId,
+		CartId: shoppingCart.Id,
+		Items:  []models.OrderItem{{BookId: shoppingCart.Books[0].Book, Price: 12.5}},
+		Total:  12.5,
+		Status: models.OrderPending,
+	}
+	savedOrder, err := gateway.SaveOrder(order, shoppingCart.Id)
+	require.Nil(t, err)
+	assert.False(t, savedOrder.CreatedAt.IsZero())
+
+	storedShoppingCart, err := gateway.GetShoppingCartById(shoppingCart.Id)
+	require.Nil(t, err)
+	assert.Empty(t, storedShoppingCart.Books)
+
+	storedOrder, err := gateway.GetOrderById(order.Id)
+	require.Nil(t, err)
+	assert.Equal(t, order.Items, storedOrder.Items)
+	assert.Equal(t, models.OrderPending, storedOrder.Status)
+
+	orders, total, err := gateway.GetOrdersByUser(userId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, []string{order.Id}, orderIds(*orders))
+
+	paymentId := newId()
+	paidOrder, err := gateway.ChangeOrderStatus(order.Id, models.OrderPending, &models.OrderStatusChange{
+		From:      models.OrderPending,
+		To:        models.OrderPaid,
+		PaymentId: paymentId,
+		ChangedAt: time.Now(),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, models.OrderPaid, paidOrder.Status)
+	assert.Equal(t, paymentId, paidOrder.PaymentId)
+	assert.Len(t, paidOrder.History, 1)
+
+	fulfilledOrder, err := gateway.ChangeOrderStatus(order.Id, models.OrderPaid, &models.OrderStatusChange{
+		From:      models.OrderPaid,
+		To:        models.OrderFulfilled,
+		ChangedAt: time.Now(),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, paymentId, fulfilledOrder.PaymentId, "a change without a payment keeps the stored one")
+
+	_, err = gateway.ChangeOrderStatus(order.Id, models.OrderPending, &models.OrderStatusChange{
+		From: models.OrderPending,
+		To:   models.OrderPaid,
+	})
+	assert.Equal(t, domain.ErrInvalidOrderTransition, err)
+
+	_, err = gateway.GetOrderById(newId())
+	assert.EqualError(t, err, "ORDER_NOT_FOUND")
+
+	_, err = gateway.SaveOrder(&models.Order{Id: newId(), UserId: userId}, newId())
+	assert.EqualError(t, err, "SHOPPING_CART_NOT_FOUND")
+
+	orders, _, err = gateway.GetOrdersByUser(userId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Len(t, *orders, 1, "an order is not kept when its cart is missing")
+}
+
+// testEntitlements checks that a user owns a book once, that entitlements are
+// listed per user and that refunding an order only removes its own.
+func testEntitlements(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	orderId := newId()
+	purchased := &models.Entitlement{UserId: userId, BookId: newId(), Source: models.EntitlementPurchase, OrderId: orderId}
+	claimed := &models.Entitlement{UserId: userId, BookId: newId(), Source: models.EntitlementFree}
+
+	owned, err := gateway.HasEntitlement(userId, purchased.BookId)
+	require.Nil(t, err)
+	assert.False(t, owned)
+
+	require.Nil(t, gateway.SaveEntitlement(purchased))
+	require.Nil(t, gateway.SaveEntitlement(claimed))
+	require.Nil(t, gateway.SaveEntitlement(&models.Entitlement{UserId: userId, BookId: claimed.BookId, Source: models.EntitlementPurchase, OrderId: orderId}))
+
+	owned, err = gateway.HasEntitlement(userId, purchased.BookId)
+	require.Nil(t, err)
+	assert.True(t, owned)
+
+	entitlements, total, err := gateway.GetEntitlementsByUser(userId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.ElementsMatch(t, []string{purchased.Id, claimed.Id}, entitlementIds(*entitlements))
+
+	require.Nil(t, gateway.DeleteEntitlementsByOrder(orderId))
+
+	owned, err = gateway.HasEntitlement(userId, purchased.BookId)
+	require.Nil(t, err)
+	assert.False(t, owned)
+
+	owned, err = gateway.HasEntitlement(userId, claimed.BookId)
+	require.Nil(t, err)
+	assert.True(t, owned, "the first entitlement to a book is kept")
+}
+
+// testLibraryAfterBookDelete checks that deleting a book deletes the
+// entitlements to it, so the books of a library can still all be read.
+func testLibraryAfterBookDelete(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	kept := newBook(newId())
+	deleted := newBook(newId())
+	for _, book := range []*models.Book{kept, deleted} {
+		_, err := gateway.SaveBook(book, nil)
+		require.Nil(t, err)
+		require.Nil(t, gateway.SaveEntitlement(&models.Entitlement{UserId: userId, BookId: book.Id, Source: models.EntitlementFree}))
+	}
+
+	books, err := gateway.GetBooksByIds([]string{kept.Id, deleted.Id, newId()})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{kept.Id, deleted.Id}, bookIds(*books))
+
+	require.Nil(t, gateway.DeleteBook(deleted.Id, deleted.Version))
+
+	entitlements, total, err := gateway.GetEntitlementsByUser(userId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, *entitlements, 1)
+	assert.Equal(t, kept.Id, (*entitlements)[0].BookId)
+
+	books, err = gateway.GetBooksByIds([]string{kept.Id, deleted.Id})
+	require.Nil(t, err)
+	assert.Equal(t, []string{kept.Id}, bookIds(*books))
+}
+
+func testBookBySectionId(t *testing.T, gateway domain.DatabaseGateway) {
+	book := newBook(newId())
+	section := models.BookSection{Id: newId(), Title: "section"}
+	book.Content = []models.BookContent{{Chapter: "chapter", Sections: []models.BookSectionId{{SectionId: section.Id}}}}
+	_, err := gateway.SaveBook(book, []models.BookSection{section})
+	require.Nil(t, err)
+
+	storedBook, err := gateway.GetBookBySectionId(section.Id)
+	require.Nil(t, err)
+	assert.Equal(t, book.Id, storedBook.Id)
+
+	_, err = gateway.GetBookBySectionId(newId())
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+func testReadingProgress(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	bookId := newId()
+
+	_, err := gateway.GetReadingProgress(userId, bookId)
+	assert.Equal(t, domain.ErrReadingProgressNotFound, err)
+
+	_, err = gateway.SaveReadingProgress(&models.ReadingProgress{UserId: userId, BookId: bookId, SectionId: "1", PercentComplete: 50})
+	require.Nil(t, err)
+	_, err = gateway.SaveReadingProgress(&models.ReadingProgress{UserId: userId, BookId: bookId, SectionId: "2", PercentComplete: 100})
+	require.Nil(t, err)
+
+	progress, err := gateway.GetReadingProgress(userId, bookId)
+	require.Nil(t, err)
+	assert.Equal(t, "2", progress.SectionId)
+	assert.Equal(t, 100.0, progress.PercentComplete)
+
+	_, err = gateway.GetReadingProgress(newId(), bookId)
+	assert.Equal(t, domain.ErrReadingProgressNotFound, err)
+}
+
+func testBookmarks(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	bookId := newId()
+
+	first, err := gateway.SaveBookmark(&models.Bookmark{UserId: userId, BookId: bookId, SectionId: "1", Note: "first"})
+	require.Nil(t, err)
+	second, err := gateway.SaveBookmark(&models.Bookmark{UserId: userId, BookId: bookId, SectionId: "2"})
+	require.Nil(t, err)
+	_, err = gateway.SaveBookmark(&models.Bookmark{UserId: newId(), BookId: bookId, SectionId: "1"})
+	require.Nil(t, err)
+
+	bookmarks, total, err := gateway.GetBookmarks(userId, bookId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.ElementsMatch(t, []string{first.Id, second.Id}, bookmarkIds(*bookmarks))
+
+	assert.Equal(t, domain.ErrBookmarkNotFound, gateway.DeleteBookmark(newId(), first.Id), "only the owner can delete a bookmark")
+	require.Nil(t, gateway.DeleteBookmark(userId, first.Id))
+	assert.Equal(t, domain.ErrBookmarkNotFound, gateway.DeleteBookmark(userId, first.Id))
+
+	bookmarks, total, err = gateway.GetBookmarks(userId, bookId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, []string{second.Id}, bookmarkIds(*bookmarks))
+}
+
+func testHighlights(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	bookId := newId()
+
+	highlight, err := gateway.SaveHighlight(&models.Highlight{UserId: userId, BookId: bookId, SectionId: "1", Start: 0, End: 4, Text: "text", Note: "note"})
+	require.Nil(t, err)
+	assert.NotEmpty(t, highlight.Id)
+
+	highlights, total, err := gateway.GetHighlights(userId, bookId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "text", (*highlights)[0].Text)
+	assert.Equal(t, "note", (*highlights)[0].Note)
+
+	assert.Equal(t, domain.ErrHighlightNotFound, gateway.DeleteHighlight(newId(), highlight.Id), "only the owner can delete a highlight")
+	require.Nil(t, gateway.DeleteHighlight(userId, highlight.Id))
+
+	_, total, err = gateway.GetHighlights(userId, bookId, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func testReviews(t *testing.T, gateway domain.DatabaseGateway) {
+	book := newBook(newId())
+	savedBook, err := gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+	edited := *savedBook
+
+	first, err := gateway.SaveReview(&models.Review{BookId: book.Id, UserId: newId(), Rating: 5, Status: models.ReviewVisible})
+	require.Nil(t, err)
+	second, err := gateway.SaveReview(&models.Review{BookId: book.Id, UserId: newId(), Rating: 2, Status: models.ReviewVisible})
+	require.Nil(t, err)
+	_, err = gateway.SaveReview(&models.Review{BookId: book.Id, UserId: first.UserId, Rating: 1, Status: models.ReviewVisible})
+	assert.Equal(t, domain.ErrReviewExists, err)
+
+	storedBook, err := gateway.RefreshBookRating(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 2, storedBook.Reviews)
+	assert.Equal(t, 3.5, storedBook.Rating)
+	assert.Equal(t, savedBook.Version, storedBook.Version, "a rating refresh is not a write to the book")
+
+	edited.Title = "edited"
+	storedBook, err = gateway.UpdateBook(&edited, nil)
+	require.Nil(t, err, "an edit read before the refresh still applies")
+	assert.Equal(t, 2, storedBook.Reviews)
+	assert.Equal(t, 3.5, storedBook.Rating)
+
+	second.Status = models.ReviewHidden
+	_, err = gateway.UpdateReview(second)
+	require.Nil(t, err)
+
+	reviews, total, err := gateway.GetReviewsByBook(book.Id, false, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, []string{first.Id}, reviewIds(*reviews))
+
+	reviews, total, err = gateway.GetReviewsByBook(book.Id, true, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.ElementsMatch(t, []string{first.Id, second.Id}, reviewIds(*reviews))
+
+	storedBook, err = gateway.RefreshBookRating(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 1, storedBook.Reviews)
+	assert.Equal(t, 5.0, storedBook.Rating)
+
+	require.Nil(t, gateway.DeleteReview(first.Id))
+	assert.Equal(t, domain.ErrReviewNotFound, gateway.DeleteReview(first.Id))
+
+	_, err = gateway.GetReviewById(first.Id)
+	assert.Equal(t, domain.ErrReviewNotFound, err)
+
+	_, err = gateway.UpdateReview(first)
+	assert.Equal(t, domain.ErrReviewNotFound, err)
+
+	storedBook, err = gateway.RefreshBookRating(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, 0, storedBook.Reviews)
+	assert.Equal(t, 0.0, storedBook.Rating)
+
+	_, err = gateway.RefreshBookRating(newId())
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+// testBookVersions checks that saving a version moves the book to it, that
+// numbers are not reused, that the published version can be moved back and
+// that the sections of old versions still lead to the book until it is
+// deleted.
+func testBookVersions(t *testing.T, gateway domain.DatabaseGateway) {
+	removed := models.BookSection{Id: newId(), Title: "removed", Content: "removed"}
+	book := newBook(newId())
+	book.Content = []models.BookContent{{Chapter: "one", Sections: []models.BookSectionId{{SectionId: removed.Id}}}}
+	_, err := gateway.SaveBook(book, []models.BookSection{removed})
+	require.Nil(t, err)
+
+	_, err = gateway.GetBookVersion(book.Id, 1)
+	assert.Equal(t, domain.ErrVersionNotFound, err)
+
+	storedBook, err := gateway.SaveBookVersion(&models.BookVersion{BookId: book.Id, Number: 1, Content: book.Content, Sections: []models.BookSection{removed}})
+	require.Nil(t, err)
+	assert.Equal(t, 1, storedBook.LatestVersion)
+	assert.Equal(t, 1, storedBook.PublishedVersion)
+
+	storedBook, err = gateway.SaveBookVersion(&models.BookVersion{BookId: book.Id, Number: 2, ReleaseNotes: "second"})
+	require.Nil(t, err)
+	assert.Equal(t, 2, storedBook.LatestVersion)
+	assert.Equal(t, 2, storedBook.PublishedVersion)
+
+	_, err = gateway.SaveBookVersion(&models.BookVersion{BookId: book.Id, Number: 2})
+	assert.Equal(t, domain.ErrVersionExists, err)
+
+	_, err = gateway.SaveBookVersion(&models.BookVersion{BookId: newId(), Number: 1})
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+
+	version, err := gateway.GetBookVersion(book.Id, 1)
+	require.Nil(t, err)
+	assert.Equal(t, models.BookVersionId(book.Id, 1), version.Id)
+	assert.Equal(t, []models.BookSection{removed}, version.Sections)
+
+	versions, total, err := gateway.GetBookVersions(book.Id, models.ListOptions{Sort: []models.SortField{{Field: "number", Descending: true}}})
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 2, (*versions)[0].Number)
+	assert.Equal(t, "second", (*versions)[0].ReleaseNotes)
+	assert.Empty(t, (*versions)[1].Sections, "versions are listed without their sections")
+
+	storedBook, err = gateway.SetPublishedVersion(book.Id, 1)
+	require.Nil(t, err)
+	assert.Equal(t, 2, storedBook.LatestVersion)
+	assert.Equal(t, 1, storedBook.PublishedVersion)
+
+	_, err = gateway.SetPublishedVersion(book.Id, 3)
+	assert.Equal(t, domain.ErrVersionNotFound, err)
+
+	storedBook.Content = nil
+	_, err = gateway.UpdateBook(storedBook, []string{removed.Id})
+	require.Nil(t, err)
+
+	storedBook, err = gateway.GetBookBySectionId(removed.Id)
+	require.Nil(t, err, "sections only kept by a version still lead to the book")
+	assert.Equal(t, book.Id, storedBook.Id)
+
+	require.Nil(t, gateway.DeleteBook(book.Id, storedBook.Version))
+	_, err = gateway.GetBookVersion(book.Id, 1)
+	assert.Equal(t, domain.ErrVersionNotFound, err)
+	_, err = gateway.GetBookBySectionId(removed.Id)
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+// testPublishBook checks that publishing a book saves its first version with
+// the state change, and neither when the state has moved on.
+func testPublishBook(t *testing.T, gateway domain.DatabaseGateway) {
+	section := models.BookSection{Id: newId(), Title: "test", Content: "test"}
+	book := newBook(newId())
+	_, err := gateway.SaveBook(book, []models.BookSection{section})
+	require.Nil(t, err)
+
+	transition := &models.BookStateTransition{From: models.StateUnpublished, To: models.StatePublished, ChangedAt: time.Now()}
+	storedBook, err := gateway.PublishBook(book.Id, models.StateUnpublished, transition, &models.BookVersion{Number: 1, Sections: []models.BookSection{section}})
+	require.Nil(t, err)
+	assert.Equal(t, models.StatePublished, storedBook.State)
+	assert.Equal(t, 1, storedBook.LatestVersion)
+	assert.Equal(t, 1, storedBook.PublishedVersion)
+	assert.Len(t, storedBook.Transitions, 1)
+
+	version, err := gateway.GetBookVersion(book.Id, 1)
+	require.Nil(t, err)
+	assert.Equal(t, []models.BookSection{section}, version.Sections)
+
+	_, err = gateway.PublishBook(book.Id, models.StateUnpublished, transition, &models.BookVersion{Number: 2})
+	assert.Equal(t, domain.ErrInvalidStateTransition, err)
+	_, err = gateway.GetBookVersion(book.Id, 2)
+	assert.Equal(t, domain.ErrVersionNotFound, err, "no version is saved without the state change")
+
+	_, err = gateway.PublishBook(newId(), models.StateUnpublished, transition, &models.BookVersion{Number: 1})
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+// testNotifications checks that owners of a book can be listed and that
+// users only see and mark their own notifications.
+// testVersionConflicts checks that updates compare and swap the version, so
+// the second of two writers that read the same version fails.
+func testVersionConflicts(t *testing.T, gateway domain.DatabaseGateway) {
+	user, err := gateway.SaveUser(&models.User{Email: newId() + "@example.com"})
+	require.Nil(t, err)
+	assert.Equal(t, 1, user.Version)
+
+	first, err := gateway.GetUserById(user.Id)
+	require.Nil(t, err)
+	second, err := gateway.GetUserById(user.Id)
+	require.Nil(t, err)
+
+	first.Name = "first"
+	updatedUser, err := gateway.UpdateUser(first)
+	require.Nil(t, err)
+	assert.Equal(t, 2, updatedUser.Version)
+
+	second.Name = "second"
+	_, err = gateway.UpdateUser(second)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+
+	storedUser, err := gateway.GetUserById(user.Id)
+	require.Nil(t, err)
+	assert.Equal(t, "first", storedUser.Name)
+	assert.Equal(t, 2, storedUser.Version)
+
+	book := newBook(newId())
+	_, err = gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, book.Version)
+
+	storedBook, err := gateway.GetBookById(book.Id)
+	require.Nil(t, err)
+	changedBook, err := gateway.SaveBookContent(book.Id, storedBook.Version, []models.BookContent{{Chapter: "Intro"}}, nil, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, changedBook.Version, "every write to a book counts")
+
+	staleSection := models.BookSection{Id: newId(), Title: "stale", Content: "stale"}
+	_, err = gateway.SaveBookContent(book.Id, storedBook.Version, []models.BookContent{{Chapter: "Stale", Sections: []models.BookSectionId{{SectionId: staleSection.Id}}}}, []models.BookSection{staleSection}, nil)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+	_, err = gateway.GetBookSectionById(staleSection.Id)
+	assert.NotNil(t, err, "a conflicting content change writes no sections")
+
+	storedBook.Title = "stale"
+	_, err = gateway.UpdateBook(storedBook, nil)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+
+	changedBook.Title = "current"
+	updatedBook, err := gateway.UpdateBook(changedBook, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 3, updatedBook.Version)
+
+	shoppingCart, err := gateway.SaveShoppingCart(&models.ShoppingCart{UserId: newId()})
+	require.Nil(t, err)
+	assert.Equal(t, 1, shoppingCart.Version)
+
+	stale := *shoppingCart
+	shoppingCart.Books = []models.BookId{{Book: newId()}}
+	updatedShoppingCart, err := gateway.UpdateShoppingCart(shoppingCart)
+	require.Nil(t, err)
+	assert.Equal(t, 2, updatedShoppingCart.Version)
+
+	_, err = gateway.UpdateShoppingCart(&stale)
+	assert.Equal(t, domain.ErrVersionConflict, err)
+}
+
+func testNotifications(t *testing.T, gateway domain.DatabaseGateway) {
+	userId := newId()
+	bookId := newId()
+	require.Nil(t, gateway.SaveEntitlement(&models.Entitlement{UserId: userId, BookId: bookId, Source: models.EntitlementFree}))
+	require.Nil(t, gateway.SaveEntitlement(&models.Entitlement{UserId: newId(), BookId: newId(), Source: models.EntitlementFree}))
+
+	ownerIds, err := gateway.GetBookOwnerIds(bookId)
+	require.Nil(t, err)
+	assert.Equal(t, []string{userId}, ownerIds)
+
+	require.Nil(t, gateway.SaveNotifications(nil))
+	require.Nil(t, gateway.SaveNotifications([]models.Notification{
+		{UserId: userId, Type: models.NotificationBookUpdated, BookId: bookId, Version: 2, Message: "second"},
+		{UserId: newId(), Type: models.NotificationBookUpdated, BookId: bookId, Version: 2, Message: "other"},
+	}))
+
+	notifications, total, err := gateway.GetNotificationsByUser(userId, models.ListOptions{})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), total)
+	notification := (*notifications)[0]
+	assert.NotEmpty(t, notification.Id)
+	assert.False(t, notification.CreatedAt.IsZero())
+	assert.Equal(t, "second", notification.Message)
+	assert.False(t, notification.Read)
+
+	_, err = gateway.MarkNotificationRead(newId(), notification.Id)
+	assert.Equal(t, domain.ErrNotificationNotFound, err, "only the recipient can mark a notification")
+
+	read, err := gateway.MarkNotificationRead(userId, notification.Id)
+	require.Nil(t, err)
+	assert.True(t, read.Read)
+}
+
+func testRevokedTokens(t *testing.T, gateway domain.DatabaseGateway) {
+	token := &models.RevokedToken{
+		Id:        newId(),
+		UserId:    newId(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	revoked, err := gateway.IsTokenRevoked(token.Id)
+	require.Nil(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = gateway.RevokeToken(token)
+	require.Nil(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = gateway.RevokeToken(token)
+	require.Nil(t, err)
+	assert.False(t, revoked, "a token is only revoked once")
+
+	revoked, err = gateway.IsTokenRevoked(token.Id)
+	require.Nil(t, err)
+	assert.True(t, revoked)
+}
+
+func userIds(users []models.User) []string {
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	return ids
+}
+
+// testBookContent checks that saving content upserts the given sections,
+// replaces the chapter list and deletes the dropped sections.
+func testBookContent(t *testing.T, gateway domain.DatabaseGateway) {
+	kept := models.BookSection{Id: newId(), Title: "kept", Content: "test"}
+	dropped := models.BookSection{Id: newId(), Title: "dropped", Content: "test"}
+	require.Nil(t, gateway.SaveBookSections([]interface{}{kept, dropped}))
+
+	book := newBook(newId())
+	book.Content = []models.BookContent{{Chapter: "test", Sections: []models.BookSectionId{{SectionId: kept.Id}, {SectionId: dropped.Id}}}}
+	_, err := gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+
+	added := models.BookSection{Id: newId(), Title: "added", Content: "test"}
+	kept.Title = "renamed"
+	content := []models.BookContent{{Chapter: "renamed", Sections: []models.BookSectionId{{SectionId: added.Id}, {SectionId: kept.Id}}}}
+	savedBook, err := gateway.SaveBookContent(book.Id, book.Version, content, []models.BookSection{added, kept}, []string{dropped.Id})
+	require.Nil(t, err)
+	assert.Equal(t, content, savedBook.Content)
+
+	storedBook, err := gateway.GetBookById(book.Id)
+	require.Nil(t, err)
+	assert.Equal(t, content, storedBook.Content)
+
+	section, err := gateway.GetBookSectionById(kept.Id)
+	require.Nil(t, err)
+	assert.Equal(t, "renamed", section.Title)
+
+	_, err = gateway.GetBookSectionById(added.Id)
+	assert.Nil(t, err)
+
+	_, err = gateway.GetBookSectionById(dropped.Id)
+	assert.NotNil(t, err)
+
+	_, err = gateway.SaveBookContent(newId(), 1, content, nil, nil)
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+// testBookWithSections checks that a book is saved together with its
+// sections, that a failed save leaves neither behind, and that updates and
+// deletes remove the sections they drop.
+func testBookWithSections(t *testing.T, gateway domain.DatabaseGateway) {
+	first := models.BookSection{Id: newId(), Title: "first", Content: "first"}
+	second := models.BookSection{Id: newId(), Title: "second", Content: "second"}
+	book := newBook(newId())
+	book.Content = []models.BookContent{{Chapter: "one", Sections: []models.BookSectionId{{SectionId: first.Id}, {SectionId: second.Id}}}}
+
+	_, err := gateway.SaveBook(book, []models.BookSection{first, second})
+	require.Nil(t, err)
+
+	sections, err := gateway.GetSectionsByBookId(book.Id)
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []models.BookSection{first, second}, sections.Sections)
+
+	book.Content[0].Sections = book.Content[0].Sections[:1]
+	_, err = gateway.UpdateBook(book, []string{second.Id})
+	require.Nil(t, err)
+
+	_, err = gateway.GetBookSectionById(second.Id)
+	assert.Equal(t, domain.ErrSectionNotFound, err)
+
+	require.Nil(t, gateway.DeleteBook(book.Id, book.Version))
+	_, err = gateway.GetBookSectionById(first.Id)
+	assert.NotNil(t, err)
+
+	existing := models.BookSection{Id: newId(), Title: "existing", Content: "existing"}
+	require.Nil(t, gateway.SaveBookSection(&existing))
+
+	failed := newBook(newId())
+	_, err = gateway.SaveBook(failed, []models.BookSection{existing})
+	assert.NotNil(t, err)
+
+	_, err = gateway.GetBookById(failed.Id)
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+
+	_, err = gateway.SaveBook(newBook(newId()), nil)
+	assert.Nil(t, err)
+}
+
+// testBookStateTransitions checks that a state change only applies from the
+// expected state, is recorded in the history and narrows the state filter.
+func testBookStateTransitions(t *testing.T, gateway domain.DatabaseGateway) {
+	category := newId()
+	book := newBook(newId(), category)
+	_, err := gateway.SaveBook(book, nil)
+	require.Nil(t, err)
+
+	books, _, err := gateway.GetBooksByCategory(category, models.StatePublished, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Empty(t, *books)
+
+	actorId := newId()
+	changedBook, err := gateway.ChangeBookState(book.Id, models.StateUnpublished, &models.BookStateTransition{
+		From:      models.StateUnpublished,
+		To:        models.StatePublished,
+		ActorId:   actorId,
+		ChangedAt: time.Now(),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, models.StatePublished, changedBook.State)
+	require.Len(t, changedBook.Transitions, 1)
+	assert.Equal(t, actorId, changedBook.Transitions[0].ActorId)
+
+	books, _, err = gateway.GetBooksByCategory(category, models.StatePublished, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{book.Id}, bookIds(*books))
+
+	_, err = gateway.ChangeBookState(book.Id, models.StateUnpublished, &models.BookStateTransition{
+		From: models.StateUnpublished,
+		To:   models.StateClosed,
+	})
+	assert.Equal(t, domain.ErrInvalidStateTransition, err)
+
+	_, err = gateway.ChangeBookState(newId(), models.StateUnpublished, &models.BookStateTransition{
+		From: models.StateUnpublished,
+		To:   models.StatePublished,
+	})
+	assert.EqualError(t, err, "BOOK_NOT_FOUND")
+}
+
+// testBookSearch checks ranking by field weight, paging, the language, price
+// and state filters and matching through the sections of the published
+// version only.
+func testBookSearch(t *testing.T, gateway domain.DatabaseGateway) {
+	term := "t" + strings.ReplaceAll(newId(), "-", "")
+
+	inTitle := newBook(newId())
+	inTitle.Title = term
+	inDescription := newBook(newId())
+	inDescription.Description = "a book about " + term
+	expensive := newBook(newId())
+	expensive.AboutTheBook = term
+	expensive.MinimumPrice = 50
+	otherLanguage := newBook(newId())
+	otherLanguage.Title = term
+	otherLanguage.LanguageCode = "es"
+	inSection := newBook(newId())
+	inDraft := newBook(newId())
+	draft := models.BookSection{Id: newId(), Title: "test", Content: "about " + term}
+	inDraft.Content = []models.BookContent{{Chapter: "test", Sections: []models.BookSectionId{{SectionId: draft.Id}}}}
+
+	for _, book := range []*models.Book{inTitle, inDescription, expensive, otherLanguage, inSection, inDraft} {
+		if book.LanguageCode == "" {
+			book.LanguageCode = "en"
+		}
+		var sections []models.BookSection
+		if book == inDraft {
+			sections = []models.BookSection{draft}
+		}
+		_, err := gateway.SaveBook(book, sections)
+		require.Nil(t, err)
+	}
+
+	published := models.BookSection{Id: newId(), Title: "test", Content: "about " + term}
+	_, err := gateway.SaveBookVersion(&models.BookVersion{BookId: inSection.Id, Number: 1, Sections: []models.BookSection{published}})
+	require.Nil(t, err)
+
+	results, total, err := gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en"}, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{inTitle.Id, expensive.Id, inDescription.Id}, searchResultIds(*results), "ranked by field weight")
+
+	results, total, err = gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en"}, models.ListOptions{Offset: 1, Limit: 1})
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{expensive.Id}, searchResultIds(*results))
+	assert.Greater(t, (*results)[0].Score, 0.0)
+
+	maxPrice := 20.0
+	results, _, err = gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en", MaxPrice: &maxPrice}, models.ListOptions{})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{inTitle.Id, inDescription.Id}, searchResultIds(*results))
+
+	results, total, err = gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en", IncludeSections: true}, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.ElementsMatch(t, []string{inTitle.Id, inDescription.Id, expensive.Id, inSection.Id}, searchResultIds(*results), "draft sections are not searched")
+
+	results, total, err = gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en", IncludeSections: true}, models.ListOptions{Offset: 3, Limit: 2})
+	require.Nil(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Len(t, *results, 1)
+
+	_, err = gateway.SaveBookVersion(&models.BookVersion{BookId: inSection.Id, Number: 2})
+	require.Nil(t, err)
+	results, _, err = gateway.SearchBooks(models.BookSearch{Query: term, LanguageCode: "en", IncludeSections: true}, models.ListOptions{})
+	require.Nil(t, err)
+	assert.NotContains(t, searchResultIds(*results), inSection.Id, "only the published version is searched")
+
+	results, total, err = gateway.SearchBooks(models.BookSearch{Query: term, State: models.StatePublished}, models.ListOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+	assert.Empty(t, *results)
+}
+
+func searchResultIds(results []models.BookSearchResult) []string {
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.Id)
+	}
+	return ids
+}
+
+func bookIds(books []models.Book) []string {
+	var ids []string
+	for _, book := range books {
+		ids = append(ids, book.Id)
+	}
+	return ids
+}
+
+func shoppingCartIds(shoppingCarts []models.ShoppingCart) []string {
+	var ids []string
+	for _, shoppingCart := range shoppingCarts {
+		ids = append(ids, shoppingCart.Id)
+	}
+	return ids
+}
+
+func orderIds(orders []models.Order) []string {
+	var ids []string
+	for _, order := range orders {
+		ids = append(ids, order.Id)
+	}
+	return ids
+}
+
+func entitlementIds(entitlements []models.Entitlement) []string {
+	var ids []string
+	for _, entitlement := range entitlements {
+		ids = append(ids, entitlement.Id)
+	}
+	return ids
+}
+
+func bookmarkIds(bookmarks []models.Bookmark) []string {
+	var ids []string
+	for _, bookmark := range bookmarks {
+		ids = append(ids, bookmark.Id)
+	}
+	return ids
+}
+
+func reviewIds(reviews []models.Review) []string {
+	var ids []string
+	for _, review := range reviews {
+		ids = append(ids, review.Id)
+	}
+	return ids
+}
@@ -0,0 +1,248 @@
+package datastore
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"leanpub-app/domain/models"
+	"sort"
+	"strings"
+)
+
+// memoryCollection keeps BSON encoded documents in insertion order, which
+// mirrors Mongo's natural order and gives callers copies rather than shared
+// pointers. It is not safe for concurrent use on its own.
+type memoryCollection struct {
+	ids       []string
+	documents map[string][]byte
+}
+
+func newMemoryCollection() *memoryCollection {
+	return &memoryCollection{
+		documents: map[string][]byte{},
+	}
+}
+
+func (collection *memoryCollection) insert(id string, document interface{}) error {
+	if _, ok := collection.documents[id]; ok {
+		return errors.New("DUPLICATE_KEY")
+	}
+
+	return collection.upsert(id, document)
+}
+
+func (collection *memoryCollection) upsert(id string, document interface{}) error {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := collection.documents[id]; !ok {
+		collection.ids = append(collection.ids, id)
+	}
+	collection.documents[id] = data
+
+	return nil
+}
+
+func (collection *memoryCollection) find(id string, document interface{}) (bool, error) {
+	data, ok := collection.documents[id]
+	if !ok {
+		return false, nil
+	}
+
+	return true, bson.Unmarshal(data, document)
+}
+
+func (collection *memoryCollection) exists(id string) bool {
+	_, ok := collection.documents[id]
+	return ok
+}
+
+func (collection *memoryCollection) delete(id string) {
+	if _, ok := collection.documents[id]; !ok {
+		return
+	}
+
+	delete(collection.documents, id)
+	for i, storedId := range collection.ids {
+		if storedId == id {
+			collection.ids = append(collection.ids[:i], collection.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// each decodes every document in insertion order, stopping at the first
+// error returned by decode.
+func (collection *memoryCollection) each(decode func(data []byte) error) error {
+	for _, id := range collection.ids {
+		if err := decode(collection.documents[id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list returns the documents accepted by matches after applying the sort,
+// offset, limit and projection of listOptions, together with the number of
+// matching documents before paging.
+func (collection *memoryCollection) list(matches func(data []byte) (bool, error), listOptions models.ListOptions) ([][]byte, int64, error) {
+	var documents [][]byte
+	err := collection.each(func(data []byte) error {
+		ok, err := matches(data)
+		if ok {
+			documents = append(documents, data)
+		}
+		return err
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(listOptions.Sort) > 0 {
+		sort.SliceStable(documents, func(i, j int) bool {
+			return compareDocuments(documents[i], documents[j], listOptions.Sort) < 0
+		})
+	}
+
+	total := int64(len(documents))
+	start := listOptions.Offset
+	if start > len(documents) {
+		start = len(documents)
+	}
+	end := len(documents)
+	if listOptions.Limit > 0 && start+listOptions.Limit < end {
+		end = start + listOptions.Limit
+	}
+	documents = documents[start:end]
+
+	if len(listOptions.Fields) > 0 {
+		for i, data := range documents {
+			projected, err := project(data, listOptions.Fields)
+			if err != nil {
+				return nil, 0, err
+			}
+			documents[i] = projected
+		}
+	}
+
+	return documents, total, nil
+}
+
+func compareDocuments(first []byte, second []byte, sortFields []models.SortField) int {
+	for _, sortField := range sortFields {
+		result := compareFields(first, second, sortField.Field)
+		if sortField.Descending {
+			result = -result
+		}
+
+		if result != 0 {
+			return result
+		}
+	}
+
+	return compareFields(first, second, "_id")
+}
+
+func compareFields(first []byte, second []byte, field string) int {
+	path := strings.Split(field, ".")
+	firstValue, _ := bson.Raw(first).LookupErr(path...)
+	secondValue, _ := bson.Raw(second).LookupErr(path...)
+
+	return compareValues(firstValue, secondValue)
+}
+
+// compareValues orders values the way Mongo sorts mixed types: missing and
+// null first, then numbers, strings, documents, arrays, booleans and dates.
+func compareValues(first bson.RawValue, second bson.RawValue) int {
+	firstRank, secondRank := typeRank(first), typeRank(second)
+	if firstRank != secondRank {
+		return compareNumbers(float64(firstRank), float64(secondRank))
+	}
+
+	switch firstRank {
+	case 1:
+		return compareNumbers(numberValue(first), numberValue(second))
+	case 2:
+		return strings.Compare(first.StringValue(), second.StringValue())
+	case 5:
+		if first.Boolean() == second.Boolean() {
+			return 0
+		}
+		if !first.Boolean() {
+			return -1
+		}
+		return 1
+	case 6:
+		return compareNumbers(float64(first.DateTime()), float64(second.DateTime()))
+	default:
+		return 0
+	}
+}
+
+func typeRank(value bson.RawValue) int {
+	switch value.Type {
+	case bsontype.Int32, bsontype.Int64, bsontype.Double:
+		return 1
+	case bsontype.String:
+		return 2
+	case bsontype.EmbeddedDocument:
+		return 3
+	case bsontype.Array:
+		return 4
+	case bsontype.Boolean:
+		return 5
+	case bsontype.DateTime:
+		return 6
+	default:
+		return 0
+	}
+}
+
+func numberValue(value bson.RawValue) float64 {
+	switch value.Type {
+	case bsontype.Int32:
+		return float64(value.Int32())
+	case bsontype.Int64:
+		return float64(value.Int64())
+	default:
+		return value.Double()
+	}
+}
+
+func compareNumbers(first float64, second float64) int {
+	switch {
+	case first < second:
+		return -1
+	case first > second:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// project keeps _id and the given top-level fields, like a Mongo inclusion
+// projection.
+func project(data []byte, fields []string) ([]byte, error) {
+	var document bson.D
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	included := map[string]bool{"_id": true}
+	for _, field := range fields {
+		included[field] = true
+	}
+
+	var projected bson.D
+	for _, element := range document {
+		if included[element.Key] {
+			projected = append(projected, element)
+		}
+	}
+
+	return bson.Marshal(projected)
+}
@@ -0,0 +1,1630 @@
+package datastore
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryGatewayImpl is an in-process DatabaseGateway for local development
+// and tests. It reproduces the observable behaviour of MongoGatewayImpl,
+// including its error values, without needing a Mongo server.
+type MemoryGatewayImpl struct {
+	mutex       sync.RWMutex
+	collections map[string]*memoryCollection
+}
+
+func NewMemoryGatewayImpl() domain.DatabaseGateway {
+	return &MemoryGatewayImpl{
+		collections: map[string]*memoryCollection{
+			users:         newMemoryCollection(),
+			books:         newMemoryCollection(),
+			bookSections:  newMemoryCollection(),
+			shoppingCarts: newMemoryCollection(),
+			revokedTokens: newMemoryCollection(),
+			orders:        newMemoryCollection(),
+			entitlements:  newMemoryCollection(),
+
+			readingProgress: newMemoryCollection(),
+			bookmarks:       newMemoryCollection(),
+			highlights:      newMemoryCollection(),
+			reviews:         newMemoryCollection(),
+			bookVersions:    newMemoryCollection(),
+			notifications:   newMemoryCollection(),
+		},
+	}
+}
+
+func (memoryImpl *MemoryGatewayImpl) Setup() {}
+
+func matchAll(data []byte) (bool, error) {
+	return true, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveUser(user *models.User) (*models.User, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[users]
+
+	registeredUser, err := userByEmail(collection, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if registeredUser != nil {
+		return nil, domain.ErrRegisteredEmail
+	}
+
+	id, _ := uuid.NewRandom()
+	user.Id = id.String()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	user.Version = 1
+
+	err = collection.upsert(user.Id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetUserByEmail(email string) (*models.User, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[users]
+
+	user, err := userByEmail(collection, email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// userByEmail returns the user with the email, or nil when there is none.
+// Emails are unique, like under the index the mongo gateway creates.
+func userByEmail(collection *memoryCollection, email string) (*models.User, error) {
+	var user *models.User
+	err := collection.each(func(data []byte) error {
+		var storedUser models.User
+		if err := bson.Unmarshal(data, &storedUser); err != nil {
+			return err
+		}
+
+		if user == nil && storedUser.Email == email {
+			user = &storedUser
+		}
+		return nil
+	})
+
+	return user, err
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetUsers(listOptions models.ListOptions) (*[]models.User, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[users]
+
+	documents, total, err := collection.list(matchAll, listOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	for _, data := range documents {
+		var user models.User
+		if err := bson.Unmarshal(data, &user); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return &users, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetUserById(id string) (*models.User, error) {
+	var user *models.User
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[users]
+
+	found, err := collection.find(id, &user)
+	if err != nil || !found {
+		return nil, domain.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteUser(id string, version int) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[users]
+
+	var storedUser models.User
+	found, err := collection.find(id, &storedUser)
+	if err != nil || !found {
+		return err
+	}
+
+	if storedUser.Version != version {
+		return domain.ErrVersionConflict
+	}
+
+	collection.delete(id)
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) UpdateUser(user *models.User) (*models.User, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[users]
+
+	var storedUser models.User
+	found, err := collection.find(user.Id, &storedUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrUserNotFound
+	}
+
+	if storedUser.Version != user.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	registeredUser, err := userByEmail(collection, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if registeredUser != nil && registeredUser.Id != user.Id {
+		return nil, domain.ErrRegisteredEmail
+	}
+
+	user.Version++
+	user.UpdatedAt = time.Now()
+
+	err = collection.upsert(user.Id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SaveBook checks every section id before writing anything, so a failed save
+// leaves no sections behind, like the Mongo transaction.
+func (memoryImpl *MemoryGatewayImpl) SaveBook(book *models.Book, sections []models.BookSection) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+	sectionCollection := memoryImpl.collections[bookSections]
+
+	seen := map[string]bool{}
+	for _, section := range sections {
+		if seen[section.Id] || sectionCollection.exists(section.Id) {
+			return nil, errors.New("DUPLICATE_KEY")
+		}
+		seen[section.Id] = true
+	}
+
+	for _, section := range sections {
+		section := section
+		if err := sectionCollection.insert(section.Id, &section); err != nil {
+			return nil, err
+		}
+	}
+
+	book.CreatedAt = time.Now()
+	book.UpdatedAt = time.Now()
+	book.Version = 1
+
+	err := collection.upsert(book.Id, book)
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveBookSection(bookSection *models.BookSection) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[bookSections]
+
+	return collection.insert(bookSection.Id, bookSection)
+}
+
+// SaveBookSections mirrors InsertMany: an empty slice is rejected and
+// documents before a duplicate id stay inserted.
+func (memoryImpl *MemoryGatewayImpl) SaveBookSections(sections []interface{}) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[bookSections]
+
+	if len(sections) == 0 {
+		return mongo.ErrEmptySlice
+	}
+
+	for _, section := range sections {
+		data, err := bson.Marshal(section)
+		if err != nil {
+			return err
+		}
+
+		var document struct {
+			Id string `bson:"_id"`
+		}
+		if err := bson.Unmarshal(data, &document); err != nil {
+			return err
+		}
+
+		if err := collection.insert(document.Id, section); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBooks(state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return memoryImpl.findBooks(state, func(book *models.Book) bool {
+		return true
+	}, listOptions)
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookIndex(id string) (*models.BookIndex, error) {
+	var book *models.Book
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	var bookIndex models.BookIndex
+	found, err := collection.find(id, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if found {
+		bookIndex.Content = book.Content
+	}
+
+	return &bookIndex, nil
+}
+
+// GetSectionsByBookId reproduces the $lookup on content.sections.sectionId:
+// matching sections come back in the bookSections collection order.
+func (memoryImpl *MemoryGatewayImpl) GetSectionsByBookId(bookId string) (*models.BookSections, error) {
+	var book *models.Book
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	var sections models.BookSections
+	found, err := collection.find(bookId, &book)
+	if err != nil || !found {
+		return &sections, err
+	}
+
+	sectionIds := map[string]bool{}
+	for _, content := range book.Content {
+		for _, section := range content.Sections {
+			sectionIds[section.SectionId] = true
+		}
+	}
+
+	sections.Sections = []models.BookSection{}
+	err = memoryImpl.collections[bookSections].each(func(data []byte) error {
+		var section models.BookSection
+		if err := bson.Unmarshal(data, &section); err != nil {
+			return err
+		}
+
+		if sectionIds[section.Id] {
+			sections.Sections = append(sections.Sections, section)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sections, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookSectionById(id string) (*models.BookSection, error) {
+	var section *models.BookSection
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[bookSections]
+
+	found, err := collection.find(id, &section)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrSectionNotFound
+	}
+
+	return section, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookById(id string) (*models.Book, error) {
+	var book *models.Book
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	found, err := collection.find(id, &book)
+	if err != nil || !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	return book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBooksByIds(ids []string) (*[]models.Book, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	books := []models.Book{}
+	for _, id := range ids {
+		var book models.Book
+		found, err := collection.find(id, &book)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			books = append(books, book)
+		}
+	}
+
+	return &books, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBooksByAuthor(authorId string, state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return memoryImpl.findBooks(state, func(book *models.Book) bool {
+		for _, author := range book.Authors {
+			if author.AuthorId == authorId {
+				return true
+			}
+		}
+		return false
+	}, listOptions)
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBooksByCategory(category string, state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return memoryImpl.findBooks(state, func(book *models.Book) bool {
+		for _, bookCategory := range book.Categories {
+			if bookCategory == category {
+				return true
+			}
+		}
+		return false
+	}, listOptions)
+}
+
+func (memoryImpl *MemoryGatewayImpl) SearchBooks(search models.BookSearch, listOptions models.ListOptions) (*[]models.BookSearchResult, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	terms := searchTerms(search.Query)
+
+	versionScores := map[string]float64{}
+	if search.IncludeSections {
+		err := memoryImpl.collections[bookVersions].each(func(data []byte) error {
+			var version models.BookVersion
+			if err := bson.Unmarshal(data, &version); err != nil {
+				return err
+			}
+
+			for _, section := range version.Sections {
+				versionScores[version.Id] += textScore(terms, map[string]string{
+					"title":   section.Title,
+					"content": section.Content,
+				}, sectionSearchWeights)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	scores := map[string]float64{}
+	var candidates []models.Book
+	err := memoryImpl.collections[books].each(func(data []byte) error {
+		var book models.Book
+		if err := bson.Unmarshal(data, &book); err != nil {
+			return err
+		}
+
+		if !matchesBookSearch(&book, search) {
+			return nil
+		}
+
+		score := textScore(terms, map[string]string{
+			"title":        book.Title,
+			"categories":   strings.Join(book.Categories, " "),
+			"aboutTheBook": book.AboutTheBook,
+			"description":  book.Description,
+		}, bookSearchWeights)
+		if book.PublishedVersion > 0 {
+			score += versionScores[models.BookVersionId(book.Id, book.PublishedVersion)]
+		}
+
+		if score > 0 {
+			scores[book.Id] = score
+			candidates = append(candidates, book)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids, total := rankSearchScores(scores, listOptions)
+	return searchResults(ids, candidates, scores), total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) findBooks(state models.StateBook, matches func(book *models.Book) bool, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var book models.Book
+		if err := bson.Unmarshal(data, &book); err != nil {
+			return false, err
+		}
+		return (state == "" || book.State == state) && matches(&book), nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var books []models.Book
+	for _, data := range documents {
+		var book models.Book
+		if err := bson.Unmarshal(data, &book); err != nil {
+			return nil, 0, err
+		}
+		books = append(books, book)
+	}
+
+	return &books, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveBookContent(bookId string, version int, content []models.BookContent, sections []models.BookSection, deletedSectionIds []string) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	var book models.Book
+	found, err := collection.find(bookId, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	if book.Version != version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	for _, section := range sections {
+		section := section
+		if err := memoryImpl.collections[bookSections].upsert(section.Id, &section); err != nil {
+			return nil, err
+		}
+	}
+
+	book.Content = content
+	book.UpdatedAt = time.Now()
+	book.Version++
+	if err := collection.upsert(bookId, &book); err != nil {
+		return nil, err
+	}
+
+	for _, id := range deletedSectionIds {
+		memoryImpl.collections[bookSections].delete(id)
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) ChangeBookState(id string, from models.StateBook, transition *models.BookStateTransition) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	var book models.Book
+	found, err := collection.find(id, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	if book.State != from {
+		return nil, domain.ErrInvalidStateTransition
+	}
+
+	book.State = transition.To
+	book.UpdatedAt = transition.ChangedAt
+	book.Transitions = append(book.Transitions, *transition)
+	book.Version++
+
+	err = collection.upsert(id, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) PublishBook(id string, from models.StateBook, transition *models.BookStateTransition, version *models.BookVersion) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+	versionCollection := memoryImpl.collections[bookVersions]
+
+	version.BookId = id
+	version.Id = models.BookVersionId(id, version.Number)
+	version.PublishedAt = transition.ChangedAt
+
+	var book models.Book
+	found, err := collection.find(id, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	if book.State != from {
+		return nil, domain.ErrInvalidStateTransition
+	}
+
+	if versionCollection.exists(version.Id) {
+		return nil, domain.ErrVersionExists
+	}
+
+	if err := versionCollection.insert(version.Id, version); err != nil {
+		return nil, err
+	}
+
+	book.State = transition.To
+	book.LatestVersion = version.Number
+	book.PublishedVersion = version.Number
+	book.UpdatedAt = transition.ChangedAt
+	book.Transitions = append(book.Transitions, *transition)
+	book.Version++
+
+	err = collection.upsert(id, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteBook(id string, version int) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	var book models.Book
+	found, err := collection.find(id, &book)
+	if err != nil || !found {
+		return err
+	}
+
+	if book.Version != version {
+		return domain.ErrVersionConflict
+	}
+
+	collection.delete(id)
+	for _, sectionId := range sectionIds(book.Content) {
+		memoryImpl.collections[bookSections].delete(sectionId)
+	}
+
+	var versionIds []string
+	err = memoryImpl.collections[bookVersions].each(func(data []byte) error {
+		var version models.BookVersion
+		if err := bson.Unmarshal(data, &version); err != nil {
+			return err
+		}
+
+		if version.BookId == id {
+			versionIds = append(versionIds, version.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, versionId := range versionIds {
+		memoryImpl.collections[bookVersions].delete(versionId)
+	}
+
+	var entitlementIds []string
+	err = memoryImpl.collections[entitlements].each(func(data []byte) error {
+		var entitlement models.Entitlement
+		if err := bson.Unmarshal(data, &entitlement); err != nil {
+			return err
+		}
+
+		if entitlement.BookId == id {
+			entitlementIds = append(entitlementIds, entitlement.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entitlementId := range entitlementIds {
+		memoryImpl.collections[entitlements].delete(entitlementId)
+	}
+
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) UpdateBook(book *models.Book, deletedSectionIds []string) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	var storedBook models.Book
+	found, err := collection.find(book.Id, &storedBook)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	if storedBook.Version != book.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	book.Version++
+	book.UpdatedAt = time.Now()
+	book.Reviews = storedBook.Reviews
+	book.Rating = storedBook.Rating
+
+	err = collection.upsert(book.Id, book)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range deletedSectionIds {
+		memoryImpl.collections[bookSections].delete(id)
+	}
+
+	return book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[shoppingCarts]
+
+	id, _ := uuid.NewRandom()
+	shoppingCart.Id = id.String()
+	shoppingCart.CreatedAt = time.Now()
+	shoppingCart.Version = 1
+
+	err := collection.upsert(shoppingCart.Id, shoppingCart)
+	if err != nil {
+		return nil, err
+	}
+
+	return shoppingCart, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetShoppingCarts(listOptions models.ListOptions) (*[]models.ShoppingCart, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[shoppingCarts]
+
+	documents, total, err := collection.list(matchAll, listOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var shoppingCart []models.ShoppingCart
+	for _, data := range documents {
+		var cart models.ShoppingCart
+		if err := bson.Unmarshal(data, &cart); err != nil {
+			return nil, 0, err
+		}
+		shoppingCart = append(shoppingCart, cart)
+	}
+
+	return &shoppingCart, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetShoppingCartById(id string) (*models.ShoppingCart, error) {
+	var shoppingCart *models.ShoppingCart
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[shoppingCarts]
+
+	found, err := collection.find(id, &shoppingCart)
+	if err != nil || !found {
+		return nil, domain.ErrShoppingCartNotFound
+	}
+
+	return shoppingCart, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteShoppingCart(id string, version int) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[shoppingCarts]
+
+	var storedShoppingCart models.ShoppingCart
+	found, err := collection.find(id, &storedShoppingCart)
+	if err != nil || !found {
+		return err
+	}
+
+	if storedShoppingCart.Version != version {
+		return domain.ErrVersionConflict
+	}
+
+	collection.delete(id)
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) UpdateShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[shoppingCarts]
+
+	var storedShoppingCart models.ShoppingCart
+	found, err := collection.find(shoppingCart.Id, &storedShoppingCart)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrShoppingCartNotFound
+	}
+
+	if storedShoppingCart.Version != shoppingCart.Version {
+		return nil, domain.ErrVersionConflict
+	}
+
+	shoppingCart.Version++
+
+	err = collection.upsert(shoppingCart.Id, shoppingCart)
+	if err != nil {
+		return nil, err
+	}
+
+	return shoppingCart, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveOrder(order *models.Order, cartId string) (*models.Order, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[orders]
+	cartCollection := memoryImpl.collections[shoppingCarts]
+
+	var shoppingCart models.ShoppingCart
+	found, err := cartCollection.find(cartId, &shoppingCart)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrShoppingCartNotFound
+	}
+
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+
+	if err := collection.insert(order.Id, order); err != nil {
+		return nil, err
+	}
+
+	shoppingCart.Books = []models.BookId{}
+	shoppingCart.Version++
+	if err := cartCollection.upsert(cartId, &shoppingCart); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetOrdersByUser(userId string, listOptions models.ListOptions) (*[]models.Order, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[orders]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var order models.Order
+		if err := bson.Unmarshal(data, &order); err != nil {
+			return false, err
+		}
+		return order.UserId == userId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var orders []models.Order
+	for _, data := range documents {
+		var order models.Order
+		if err := bson.Unmarshal(data, &order); err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+
+	return &orders, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetOrderById(id string) (*models.Order, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[orders]
+
+	var order models.Order
+	found, err := collection.find(id, &order)
+	if err != nil || !found {
+		return nil, domain.ErrOrderNotFound
+	}
+
+	return &order, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) ChangeOrderStatus(id string, from models.OrderStatus, change *models.OrderStatusChange) (*models.Order, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[orders]
+
+	var order models.Order
+	found, err := collection.find(id, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrOrderNotFound
+	}
+
+	if order.Status != from {
+		return nil, domain.ErrInvalidOrderTransition
+	}
+
+	order.Status = change.To
+	order.UpdatedAt = change.ChangedAt
+	if change.PaymentId != "" {
+		order.PaymentId = change.PaymentId
+	}
+	order.History = append(order.History, *change)
+
+	err = collection.upsert(id, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveEntitlement(entitlement *models.Entitlement) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[entitlements]
+
+	entitlement.Id = models.EntitlementId(entitlement.UserId, entitlement.BookId)
+	if collection.exists(entitlement.Id) {
+		return nil
+	}
+	entitlement.CreatedAt = time.Now()
+
+	return collection.insert(entitlement.Id, entitlement)
+}
+
+func (memoryImpl *MemoryGatewayImpl) HasEntitlement(userId string, bookId string) (bool, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[entitlements]
+
+	return collection.exists(models.EntitlementId(userId, bookId)), nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetEntitlementsByUser(userId string, listOptions models.ListOptions) (*[]models.Entitlement, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[entitlements]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var entitlement models.Entitlement
+		if err := bson.Unmarshal(data, &entitlement); err != nil {
+			return false, err
+		}
+		return entitlement.UserId == userId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entitlements []models.Entitlement
+	for _, data := range documents {
+		var entitlement models.Entitlement
+		if err := bson.Unmarshal(data, &entitlement); err != nil {
+			return nil, 0, err
+		}
+		entitlements = append(entitlements, entitlement)
+	}
+
+	return &entitlements, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteEntitlementsByOrder(orderId string) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[entitlements]
+
+	var ids []string
+	err := collection.each(func(data []byte) error {
+		var entitlement models.Entitlement
+		if err := bson.Unmarshal(data, &entitlement); err != nil {
+			return err
+		}
+		if entitlement.OrderId == orderId {
+			ids = append(ids, entitlement.Id)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		collection.delete(id)
+	}
+
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookBySectionId(sectionId string) (*models.Book, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[books]
+
+	var found *models.Book
+	err := collection.each(func(data []byte) error {
+		var book models.Book
+		if err := bson.Unmarshal(data, &book); err != nil {
+			return err
+		}
+		for _, id := range sectionIds(book.Content) {
+			if id == sectionId && found == nil {
+				found = &book
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if found != nil {
+		return found, nil
+	}
+
+	var bookId string
+	err = memoryImpl.collections[bookVersions].each(func(data []byte) error {
+		var version models.BookVersion
+		if err := bson.Unmarshal(data, &version); err != nil {
+			return err
+		}
+		for _, section := range version.Sections {
+			if section.Id == sectionId && bookId == "" {
+				bookId = version.BookId
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var book models.Book
+	ok, err := collection.find(bookId, &book)
+	if err != nil || !ok {
+		return nil, domain.ErrBookNotFound
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveBookVersion(version *models.BookVersion) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+	versionCollection := memoryImpl.collections[bookVersions]
+
+	version.Id = models.BookVersionId(version.BookId, version.Number)
+	version.PublishedAt = time.Now()
+
+	if versionCollection.exists(version.Id) {
+		return nil, domain.ErrVersionExists
+	}
+
+	var book models.Book
+	found, err := collection.find(version.BookId, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	if err := versionCollection.insert(version.Id, version); err != nil {
+		return nil, err
+	}
+
+	book.LatestVersion = version.Number
+	book.PublishedVersion = version.Number
+	book.UpdatedAt = version.PublishedAt
+	book.Version++
+	if err := collection.upsert(book.Id, &book); err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookVersion(bookId string, number int) (*models.BookVersion, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[bookVersions]
+
+	var version models.BookVersion
+	found, err := collection.find(models.BookVersionId(bookId, number), &version)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrVersionNotFound
+	}
+
+	return &version, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookVersions(bookId string, listOptions models.ListOptions) (*[]models.BookVersion, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[bookVersions]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var version models.BookVersion
+		if err := bson.Unmarshal(data, &version); err != nil {
+			return false, err
+		}
+		return version.BookId == bookId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var versions []models.BookVersion
+	for _, data := range documents {
+		var version models.BookVersion
+		if err := bson.Unmarshal(data, &version); err != nil {
+			return nil, 0, err
+		}
+		if len(listOptions.Fields) == 0 {
+			version.Content = nil
+			version.Sections = nil
+		}
+		versions = append(versions, version)
+	}
+
+	return &versions, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SetPublishedVersion(bookId string, number int) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	if !memoryImpl.collections[bookVersions].exists(models.BookVersionId(bookId, number)) {
+		return nil, domain.ErrVersionNotFound
+	}
+
+	var book models.Book
+	found, err := collection.find(bookId, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	book.PublishedVersion = number
+	book.UpdatedAt = time.Now()
+	book.Version++
+	if err := collection.upsert(bookId, &book); err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookOwnerIds(bookId string) ([]string, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[entitlements]
+
+	userIds := []string{}
+	seen := map[string]bool{}
+	err := collection.each(func(data []byte) error {
+		var entitlement models.Entitlement
+		if err := bson.Unmarshal(data, &entitlement); err != nil {
+			return err
+		}
+		if entitlement.BookId == bookId && !seen[entitlement.UserId] {
+			seen[entitlement.UserId] = true
+			userIds = append(userIds, entitlement.UserId)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return userIds, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveNotifications(newNotifications []models.Notification) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[notifications]
+
+	for i := range newNotifications {
+		id, _ := uuid.NewRandom()
+		newNotifications[i].Id = id.String()
+		newNotifications[i].CreatedAt = time.Now()
+
+		if err := collection.insert(newNotifications[i].Id, &newNotifications[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetNotificationsByUser(userId string, listOptions models.ListOptions) (*[]models.Notification, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[notifications]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var notification models.Notification
+		if err := bson.Unmarshal(data, &notification); err != nil {
+			return false, err
+		}
+		return notification.UserId == userId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []models.Notification
+	for _, data := range documents {
+		var notification models.Notification
+		if err := bson.Unmarshal(data, &notification); err != nil {
+			return nil, 0, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return &notifications, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) MarkNotificationRead(userId string, id string) (*models.Notification, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[notifications]
+
+	var notification models.Notification
+	found, err := collection.find(id, &notification)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found || notification.UserId != userId {
+		return nil, domain.ErrNotificationNotFound
+	}
+
+	notification.Read = true
+	if err := collection.upsert(id, &notification); err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveReadingProgress(progress *models.ReadingProgress) (*models.ReadingProgress, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[readingProgress]
+
+	progress.Id = models.ReadingProgressId(progress.UserId, progress.BookId)
+	progress.UpdatedAt = time.Now()
+
+	err := collection.upsert(progress.Id, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetReadingProgress(userId string, bookId string) (*models.ReadingProgress, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[readingProgress]
+
+	var progress models.ReadingProgress
+	found, err := collection.find(models.ReadingProgressId(userId, bookId), &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrReadingProgressNotFound
+	}
+
+	return &progress, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveBookmark(bookmark *models.Bookmark) (*models.Bookmark, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[bookmarks]
+
+	id, _ := uuid.NewRandom()
+	bookmark.Id = id.String()
+	bookmark.CreatedAt = time.Now()
+
+	err := collection.insert(bookmark.Id, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookmark, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetBookmarks(userId string, bookId string, listOptions models.ListOptions) (*[]models.Bookmark, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[bookmarks]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var bookmark models.Bookmark
+		if err := bson.Unmarshal(data, &bookmark); err != nil {
+			return false, err
+		}
+		return bookmark.UserId == userId && bookmark.BookId == bookId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var bookmarks []models.Bookmark
+	for _, data := range documents {
+		var bookmark models.Bookmark
+		if err := bson.Unmarshal(data, &bookmark); err != nil {
+			return nil, 0, err
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+
+	return &bookmarks, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteBookmark(userId string, id string) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[bookmarks]
+
+	var bookmark models.Bookmark
+	found, err := collection.find(id, &bookmark)
+	if err != nil {
+		return err
+	}
+
+	if !found || bookmark.UserId != userId {
+		return domain.ErrBookmarkNotFound
+	}
+
+	collection.delete(id)
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveHighlight(highlight *models.Highlight) (*models.Highlight, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[highlights]
+
+	id, _ := uuid.NewRandom()
+	highlight.Id = id.String()
+	highlight.CreatedAt = time.Now()
+
+	err := collection.insert(highlight.Id, highlight)
+	if err != nil {
+		return nil, err
+	}
+
+	return highlight, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetHighlights(userId string, bookId string, listOptions models.ListOptions) (*[]models.Highlight, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[highlights]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var highlight models.Highlight
+		if err := bson.Unmarshal(data, &highlight); err != nil {
+			return false, err
+		}
+		return highlight.UserId == userId && highlight.BookId == bookId, nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var highlights []models.Highlight
+	for _, data := range documents {
+		var highlight models.Highlight
+		if err := bson.Unmarshal(data, &highlight); err != nil {
+			return nil, 0, err
+		}
+		highlights = append(highlights, highlight)
+	}
+
+	return &highlights, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteHighlight(userId string, id string) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[highlights]
+
+	var highlight models.Highlight
+	found, err := collection.find(id, &highlight)
+	if err != nil {
+		return err
+	}
+
+	if !found || highlight.UserId != userId {
+		return domain.ErrHighlightNotFound
+	}
+
+	collection.delete(id)
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) SaveReview(review *models.Review) (*models.Review, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[reviews]
+
+	review.Id = models.ReviewId(review.UserId, review.BookId)
+	review.CreatedAt = time.Now()
+	review.UpdatedAt = review.CreatedAt
+
+	if collection.exists(review.Id) {
+		return nil, domain.ErrReviewExists
+	}
+
+	err := collection.insert(review.Id, review)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetReviewById(id string) (*models.Review, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[reviews]
+
+	var review models.Review
+	found, err := collection.find(id, &review)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrReviewNotFound
+	}
+
+	return &review, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) GetReviewsByBook(bookId string, includeHidden bool, listOptions models.ListOptions) (*[]models.Review, int64, error) {
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[reviews]
+
+	documents, total, err := collection.list(func(data []byte) (bool, error) {
+		var review models.Review
+		if err := bson.Unmarshal(data, &review); err != nil {
+			return false, err
+		}
+		return review.BookId == bookId && (includeHidden || review.Status == models.ReviewVisible), nil
+	}, listOptions)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reviews []models.Review
+	for _, data := range documents {
+		var review models.Review
+		if err := bson.Unmarshal(data, &review); err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return &reviews, total, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) UpdateReview(review *models.Review) (*models.Review, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[reviews]
+
+	if !collection.exists(review.Id) {
+		return nil, domain.ErrReviewNotFound
+	}
+
+	review.UpdatedAt = time.Now()
+
+	err := collection.upsert(review.Id, review)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) DeleteReview(id string) error {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[reviews]
+
+	if !collection.exists(id) {
+		return domain.ErrReviewNotFound
+	}
+
+	collection.delete(id)
+	return nil
+}
+
+func (memoryImpl *MemoryGatewayImpl) RefreshBookRating(bookId string) (*models.Book, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[books]
+
+	var book models.Book
+	found, err := collection.find(bookId, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, domain.ErrBookNotFound
+	}
+
+	count, sum := 0, 0
+	err = memoryImpl.collections[reviews].each(func(data []byte) error {
+		var review models.Review
+		if err := bson.Unmarshal(data, &review); err != nil {
+			return err
+		}
+
+		if review.BookId == bookId && review.Status == models.ReviewVisible {
+			count++
+			sum += review.Rating
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	book.Reviews = count
+	book.Rating = averageRating(count, sum)
+
+	err = collection.upsert(bookId, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+// RevokeToken reports whether the token was revoked by this call, so only one
+// of several concurrent revocations of a token succeeds.
+func (memoryImpl *MemoryGatewayImpl) RevokeToken(token *models.RevokedToken) (bool, error) {
+	memoryImpl.mutex.Lock()
+	defer memoryImpl.mutex.Unlock()
+	collection := memoryImpl.collections[revokedTokens]
+
+	if collection.exists(token.Id) {
+		return false, nil
+	}
+
+	err := collection.insert(token.Id, token)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsTokenRevoked ignores entries past their expiry, matching the TTL index
+// that purges them from Mongo.
+func (memoryImpl *MemoryGatewayImpl) IsTokenRevoked(id string) (bool, error) {
+	var token *models.RevokedToken
+	memoryImpl.mutex.RLock()
+	defer memoryImpl.mutex.RUnlock()
+	collection := memoryImpl.collections[revokedTokens]
+
+	found, err := collection.find(id, &token)
+	if err != nil || !found {
+		return false, err
+	}
+
+	return token.ExpiresAt.After(time.Now()), nil
+}
@@ -0,0 +1,10 @@
+package datastore
+
+import (
+	"leanpub-app/infra/datastore/gatewaytest"
+	"testing"
+)
+
+func TestMemoryGatewayImpl(t *testing.T) {
+	gatewaytest.RunDatabaseGatewayTests(t, NewMemoryGatewayImpl)
+}
@@ -2,7 +2,6 @@ package datastore
 
 import (
 	"context"
-	"errors"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,19 +18,68 @@ const (
 	books         = "books"
 	bookSections  = "bookSections"
 	shoppingCarts = "shoppingCarts"
+	revokedTokens = "revokedTokens"
+	orders        = "orders"
+	entitlements  = "entitlements"
+
+	readingProgress = "readingProgress"
+	bookmarks       = "bookmarks"
+	highlights      = "highlights"
+	reviews         = "reviews"
+	bookVersions    = "bookVersions"
+	notifications   = "notifications"
 )
 
 type MongoGatewayImpl struct {
-	client *mongo.Client
+	client       *mongo.Client
+	transactions bool
 }
 
 func NewMongoGatewayImpl() domain.DatabaseGateway {
 	return &MongoGatewayImpl{}
 }
 
+// findOptions translates list options into skip, limit, sort and projection.
+// Sorted queries get _id as a final key so pages stay stable across requests.
+func findOptions(listOptions models.ListOptions) *options.FindOptions {
+	opts := options.Find().SetSkip(int64(listOptions.Offset))
+	if listOptions.Limit > 0 {
+		opts.SetLimit(int64(listOptions.Limit))
+	}
+
+	if len(listOptions.Sort) > 0 {
+		sort := bson.D{}
+		sortedById := false
+		for _, field := range listOptions.Sort {
+			order := 1
+			if field.Descending {
+				order = -1
+			}
+			sort = append(sort, bson.E{Key: field.Field, Value: order})
+			sortedById = sortedById || field.Field == "_id"
+		}
+
+		if !sortedById {
+			sort = append(sort, bson.E{Key: "_id", Value: 1})
+		}
+		opts.SetSort(sort)
+	}
+
+	if len(listOptions.Fields) > 0 {
+		projection := bson.D{}
+		for _, field := range listOptions.Fields {
+			projection = append(projection, bson.E{Key: field, Value: 1})
+		}
+		opts.SetProjection(projection)
+	}
+
+	return opts
+}
+
 func (mongoImpl *MongoGatewayImpl) Setup() {
 	var err error
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	opt := options.Client()
 	opt.ApplyURI(os.Getenv("mongo.url"))
 	mongoImpl.client, err = mongo.Connect(ctx, opt)
@@ -39,10 +87,170 @@ func (mongoImpl *MongoGatewayImpl) Setup() {
 	if err != nil {
 		panic(err)
 	}
+
+	var hello bson.M
+	err = mongoImpl.client.Database("admin").RunCommand(ctx, bson.D{{"isMaster", 1}}).Decode(&hello)
+	if err != nil {
+		panic(err)
+	}
+
+	_, replicaSet := hello["setName"]
+	mongoImpl.transactions = replicaSet || hello["msg"] == "isdbgrid"
+
+	_, err = mongoImpl.client.Database(database).Collection(users).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"email", 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(revokedTokens).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"expiresAt", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(orders).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"userId", 1}},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(entitlements).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"userId", 1}}},
+		{Keys: bson.D{{"orderId", 1}}},
+		{Keys: bson.D{{"bookId", 1}}},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, name := range []string{bookmarks, highlights} {
+		_, err = mongoImpl.client.Database(database).Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{"userId", 1}, {"bookId", 1}},
+		})
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(reviews).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"bookId", 1}, {"status", 1}},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(bookVersions).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"bookId", 1}, {"number", -1}}},
+		{Keys: bson.D{{"sections._id", 1}}},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(notifications).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"userId", 1}, {"createdAt", -1}},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(books).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{"title", "text"},
+			{"categories", "text"},
+			{"aboutTheBook", "text"},
+			{"description", "text"},
+		},
+		Options: options.Index().SetName("bookSearch").SetWeights(bson.D{
+			{"title", bookSearchWeights["title"]},
+			{"categories", bookSearchWeights["categories"]},
+			{"aboutTheBook", bookSearchWeights["aboutTheBook"]},
+			{"description", bookSearchWeights["description"]},
+		}),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = mongoImpl.client.Database(database).Collection(bookVersions).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{"sections.title", "text"},
+			{"sections.content", "text"},
+		},
+		Options: options.Index().SetName("versionSearch").SetWeights(bson.D{
+			{"sections.title", sectionSearchWeights["title"]},
+			{"sections.content", sectionSearchWeights["content"]},
+		}),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// withTransaction runs fn in a transaction when the server supports them.
+// Standalone servers do not, so there fn runs on a plain session and callers
+// have to undo partial writes themselves.
+func (mongoImpl *MongoGatewayImpl) withTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) error) error {
+	session, err := mongoImpl.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	if !mongoImpl.transactions {
+		return mongo.WithSession(ctx, session, fn)
+	}
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// versionFilter matches the document with the id while it still has the
+// version. Documents written before versions were counted have none and match
+// version 0.
+func versionFilter(id string, version int) bson.D {
+	if version == 0 {
+		return bson.D{{"_id", id}, {"version", bson.D{{"$in", bson.A{0, nil}}}}}
+	}
+
+	return bson.D{{"_id", id}, {"version", version}}
+}
+
+// missedVersion tells why an update filtered by versionFilter matched
+// nothing: the document is gone, or another write changed its version.
+func missedVersion(ctx context.Context, collection *mongo.Collection, id string, notFound error) error {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+
+	return domain.ErrVersionConflict
 }
 
 func (mongoImpl *MongoGatewayImpl) SaveUser(user *models.User) (*models.User, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	opts := options.Update().SetUpsert(true)
 	collection := mongoImpl.client.Database(database).Collection(users)
 
@@ -50,9 +258,12 @@ func (mongoImpl *MongoGatewayImpl) SaveUser(user *models.User) (*models.User, er
 	user.Id = id.String()
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	user.Version = 1
 
 	_, err := collection.UpdateOne(ctx, bson.M{"_id": user.Id}, bson.D{{"$set", user}}, opts)
-
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, domain.ErrRegisteredEmail
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -60,96 +271,142 @@ func (mongoImpl *MongoGatewayImpl) SaveUser(user *models.User) (*models.User, er
 	return user, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) ValidateUser(registeredUser *models.RegisteredUser, user *models.User) (*models.User, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+func (mongoImpl *MongoGatewayImpl) GetUserByEmail(email string) (*models.User, error) {
+	var user *models.User
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(users)
 
-	err := collection.FindOne(ctx, bson.M{"email": registeredUser.Email}).Decode(&user)
-	if err != nil {
-		return nil, errors.New("INVALID_USER_OR_PASSWORD")
+	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrUserNotFound
 	}
-
-	if user.Password != registeredUser.Password {
-		return nil, errors.New("INVALID_USER_OR_PASSWORD")
+	if err != nil {
+		return nil, err
 	}
 
 	return user, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) GetUsers() (*[]models.User, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+func (mongoImpl *MongoGatewayImpl) GetUsers(listOptions models.ListOptions) (*[]models.User, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(users)
+	filter := bson.M{}
 
-	cursor, err := collection.Find(ctx, bson.M{})
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
 	}
 
 	var users []models.User
 	err = cursor.All(ctx, &users)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &users, nil
+	return &users, total, nil
 }
 
 func (mongoImpl *MongoGatewayImpl) GetUserById(id string) (*models.User, error) {
 	var user *models.User
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(users)
 
 	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrUserNotFound
+	}
 	if err != nil {
-		return nil, errors.New("USER_NOT_FOUND")
+		return nil, err
 	}
 
 	return user, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) DeleteUser(id string) error {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+func (mongoImpl *MongoGatewayImpl) DeleteUser(id string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(users)
 
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	result, err := collection.DeleteOne(ctx, versionFilter(id, version))
 	if err != nil {
 		return err
 	}
+	if result.DeletedCount == 0 {
+		return missedVersion(ctx, collection, id, nil)
+	}
 
-	return err
+	return nil
 }
 
 func (mongoImpl *MongoGatewayImpl) UpdateUser(user *models.User) (*models.User, error) {
-	var userE *models.User
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	opts := options.Update().SetUpsert(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(users)
 
-	err := collection.FindOne(ctx, bson.M{"_id": user.Id}).Decode(&userE)
-	if err != nil {
-		return nil, errors.New("USER_NOT_FOUND")
-	}
-
+	version := user.Version
+	user.Version = version + 1
 	user.UpdatedAt = time.Now()
 
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": user.Id}, bson.D{{"$set", user}}, opts)
+	result, err := collection.UpdateOne(ctx, versionFilter(user.Id, version), bson.D{{"$set", user}})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, domain.ErrRegisteredEmail
+	}
 	if err != nil {
 		return nil, err
 	}
+	if result.MatchedCount == 0 {
+		return nil, missedVersion(ctx, collection, user.Id, domain.ErrUserNotFound)
+	}
 
 	return user, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) SaveBook(book *models.Book) (*models.Book, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+// SaveBook inserts the sections of a new book together with the book. When
+// the server cannot run transactions the sections are deleted again if the
+// book cannot be written.
+func (mongoImpl *MongoGatewayImpl) SaveBook(book *models.Book, sections []models.BookSection) (*models.Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	opts := options.Update().SetUpsert(true)
 	collection := mongoImpl.client.Database(database).Collection(books)
+	sectionCollection := mongoImpl.client.Database(database).Collection(bookSections)
 
 	book.CreatedAt = time.Now()
 	book.UpdatedAt = time.Now()
+	book.Version = 1
+
+	documents := make([]interface{}, 0, len(sections))
+	sectionIds := bson.A{}
+	for _, section := range sections {
+		documents = append(documents, section)
+		sectionIds = append(sectionIds, section.Id)
+	}
+
+	inserted := false
+	err := mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		if len(documents) > 0 {
+			if _, err := sectionCollection.InsertMany(ctx, documents); err != nil {
+				return err
+			}
+			inserted = true
+		}
+
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": book.Id}, bson.D{{"$set", book}}, opts)
+		return err
+	})
 
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": book.Id}, bson.D{{"$set", book}}, opts)
 	if err != nil {
+		if !mongoImpl.transactions && inserted {
+			sectionCollection.DeleteMany(ctx, bson.D{{"_id", bson.D{{"$in", sectionIds}}}})
+		}
 		return nil, err
 	}
 
@@ -157,7 +414,8 @@ func (mongoImpl *MongoGatewayImpl) SaveBook(book *models.Book) (*models.Book, er
 }
 
 func (mongoImpl *MongoGatewayImpl) SaveBookSection(bookSection *models.BookSection) error {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(bookSections)
 
 	_, err := collection.InsertOne(ctx, bookSection)
@@ -165,33 +423,21 @@ func (mongoImpl *MongoGatewayImpl) SaveBookSection(bookSection *models.BookSecti
 }
 
 func (mongoImpl *MongoGatewayImpl) SaveBookSections(sections []interface{}) error {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(bookSections)
 
 	_, err := collection.InsertMany(ctx, sections)
 	return err
 }
 
-func (mongoImpl *MongoGatewayImpl) GetBooks() (*[]models.Book, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(books)
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
-	}
-
-	var books []models.Book
-	err = cursor.All(ctx, &books)
-	if err != nil {
-		return nil, err
-	}
-
-	return &books, nil
+func (mongoImpl *MongoGatewayImpl) GetBooks(state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return mongoImpl.findBooks(withState(bson.D{}, state), listOptions)
 }
 
 func (mongoImpl *MongoGatewayImpl) GetBookIndex(id string) (*models.BookIndex, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(books)
 
 	pipeline := make([]bson.D, 0, 0)
@@ -224,7 +470,8 @@ func (mongoImpl *MongoGatewayImpl) GetBookIndex(id string) (*models.BookIndex, e
 }
 
 func (mongoImpl *MongoGatewayImpl) GetSectionsByBookId(bookId string) (*models.BookSections, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(books)
 
 	pipeline := make([]bson.D, 0, 0)
@@ -267,10 +514,14 @@ func (mongoImpl *MongoGatewayImpl) GetSectionsByBookId(bookId string) (*models.B
 
 func (mongoImpl *MongoGatewayImpl) GetBookSectionById(id string) (*models.BookSection, error) {
 	var section *models.BookSection
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(bookSections)
 
 	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&section)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrSectionNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -280,27 +531,32 @@ func (mongoImpl *MongoGatewayImpl) GetBookSectionById(id string) (*models.BookSe
 
 func (mongoImpl *MongoGatewayImpl) GetBookById(id string) (*models.Book, error) {
 	var book *models.Book
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(books)
 
 	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrBookNotFound
+	}
 	if err != nil {
-		return nil, errors.New("BOOK_NOT_FOUND")
+		return nil, err
 	}
 
 	return book, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) GetBooksByAuthor(authorId string) (*[]models.Book, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
+func (mongoImpl *MongoGatewayImpl) GetBooksByIds(ids []string) (*[]models.Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 	collection := mongoImpl.client.Database(database).Collection(books)
 
-	cursor, err := collection.Find(ctx, bson.M{"authors.authorId": authorId})
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
 	if err != nil {
 		return nil, err
 	}
 
-	var books []models.Book
+	books := []models.Book{}
 	err = cursor.All(ctx, &books)
 	if err != nil {
 		return nil, err
@@ -309,11 +565,12 @@ func (mongoImpl *MongoGatewayImpl) GetBooksByAuthor(authorId string) (*[]models.
 	return &books, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) GetBooksByCategory(category string) (*[]models.Book, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(books)
+func (mongoImpl *MongoGatewayImpl) GetBooksByAuthor(authorId string, state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return mongoImpl.findBooks(withState(bson.D{{"authors.authorId", authorId}}, state), listOptions)
+}
 
-	cursor, err := collection.Find(ctx, bson.D{
+func (mongoImpl *MongoGatewayImpl) GetBooksByCategory(category string, state models.StateBook, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	return mongoImpl.findBooks(withState(bson.D{
 		{"categories",
 			bson.D{
 				{"$all",
@@ -323,129 +580,1305 @@ func (mongoImpl *MongoGatewayImpl) GetBooksByCategory(category string) (*[]model
 				},
 			},
 		},
-	})
+	}, state), listOptions)
+}
+
+// withState narrows a book filter to a single state. An empty state matches
+// books in any state.
+func withState(filter bson.D, state models.StateBook) bson.D {
+	if state == "" {
+		return filter
+	}
+	return append(filter, bson.E{Key: "state", Value: state})
+}
+
+// SearchBooks runs a $text query over the book index, which Mongo sorts by
+// score and pages itself. When sections are included, the score of each
+// book's published version is added to it, so only the ids and scores of the
+// matches are ranked here and just the books of the page are loaded.
+func (mongoImpl *MongoGatewayImpl) SearchBooks(search models.BookSearch, listOptions models.ListOptions) (*[]models.BookSearchResult, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
+	textScore := bson.D{{"$meta", "textScore"}}
+
+	filter := bookSearchFilter(search)
+	textFilter := append(bson.D{{"$text", bson.D{{"$search", search.Query}}}}, filter...)
+
+	if !search.IncludeSections {
+		total, err := collection.CountDocuments(ctx, textFilter)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		opts := options.Find().
+			SetProjection(bson.D{{"score", textScore}}).
+			SetSort(bson.D{{"score", textScore}, {"_id", 1}}).
+			SetSkip(int64(listOptions.Offset))
+		if listOptions.Limit > 0 {
+			opts.SetLimit(int64(listOptions.Limit))
+		}
+
+		cursor, err := collection.Find(ctx, textFilter, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		results := []models.BookSearchResult{}
+		err = cursor.All(ctx, &results)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return &results, total, nil
+	}
 
+	cursor, err := collection.Find(ctx, textFilter, options.Find().SetProjection(bson.D{{"_id", 1}, {"score", textScore}}))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	var books []models.Book
-	err = cursor.All(ctx, &books)
+	var matches []struct {
+		Id    string  `bson:"_id"`
+		Score float64 `bson:"score"`
+	}
+	err = cursor.All(ctx, &matches)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &books, nil
-}
+	scores := map[string]float64{}
+	for _, match := range matches {
+		scores[match.Id] = match.Score
+	}
 
-func (mongoImpl *MongoGatewayImpl) DeleteBook(id string) error {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(books)
+	cursor, err = mongoImpl.client.Database(database).Collection(bookVersions).Find(ctx, bson.D{{"$text", bson.D{{"$search", search.Query}}}},
+		options.Find().SetProjection(bson.D{{"_id", 1}, {"bookId", 1}, {"score", textScore}}))
+	if err != nil {
+		return nil, 0, err
+	}
 
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	var versions []struct {
+		Id     string  `bson:"_id"`
+		BookId string  `bson:"bookId"`
+		Score  float64 `bson:"score"`
+	}
+	err = cursor.All(ctx, &versions)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	return err
-}
+	if len(versions) > 0 {
+		versionScores := map[string]float64{}
+		bookIds := bson.A{}
+		for _, version := range versions {
+			versionScores[version.Id] = version.Score
+			bookIds = append(bookIds, version.BookId)
+		}
 
-func (mongoImpl *MongoGatewayImpl) UpdateBook(book *models.Book) (*models.Book, error) {
-	var bookE *models.Book
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	opts := options.Update().SetUpsert(true)
-	collection := mongoImpl.client.Database(database).Collection(books)
+		publishedFilter := append(bson.D{{"_id", bson.D{{"$in", bookIds}}}}, filter...)
+		cursor, err = collection.Find(ctx, publishedFilter, options.Find().SetProjection(bson.D{{"_id", 1}, {"publishedVersion", 1}}))
+		if err != nil {
+			return nil, 0, err
+		}
 
-	err := collection.FindOne(ctx, bson.M{"_id": book.Id}).Decode(&bookE)
-	if err != nil {
-		return nil, errors.New("BOOK_NOT_FOUND")
+		var published []struct {
+			Id               string `bson:"_id"`
+			PublishedVersion int    `bson:"publishedVersion"`
+		}
+		err = cursor.All(ctx, &published)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, book := range published {
+			if score := versionScores[models.BookVersionId(book.Id, book.PublishedVersion)]; score > 0 {
+				scores[book.Id] += score
+			}
+		}
 	}
 
-	book.UpdatedAt = time.Now()
+	ids, total := rankSearchScores(scores, listOptions)
+	if len(ids) == 0 {
+		return &[]models.BookSearchResult{}, total, nil
+	}
 
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": book.Id}, bson.D{{"$set", book}}, opts)
+	page, err := mongoImpl.GetBooksByIds(ids)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return book, nil
+	return searchResults(ids, *page, scores), total, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	opts := options.Update().SetUpsert(true)
-	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
-
-	id, _ := uuid.NewRandom()
-	shoppingCart.Id = id.String()
-	shoppingCart.CreatedAt = time.Now()
+// bookSearchFilter holds the non-text conditions of a search.
+func bookSearchFilter(search models.BookSearch) bson.D {
+	filter := bson.D{}
+	if search.LanguageCode != "" {
+		filter = append(filter, bson.E{Key: "languageCode", Value: search.LanguageCode})
+	}
+	if search.State != "" {
+		filter = append(filter, bson.E{Key: "state", Value: search.State})
+	}
 
-	_, err := collection.UpdateOne(ctx, bson.M{"_id": shoppingCart.Id}, bson.D{{"$set", shoppingCart}}, opts)
-	if err != nil {
-		return nil, err
+	price := bson.D{}
+	if search.MinPrice != nil {
+		price = append(price, bson.E{Key: "$gte", Value: *search.MinPrice})
+	}
+	if search.MaxPrice != nil {
+		price = append(price, bson.E{Key: "$lte", Value: *search.MaxPrice})
+	}
+	if len(price) > 0 {
+		filter = append(filter, bson.E{Key: "minimumPrice", Value: price})
 	}
 
-	return shoppingCart, nil
+	return filter
 }
 
-func (mongoImpl *MongoGatewayImpl) GetShoppingCarts() (*[]models.ShoppingCart, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+func (mongoImpl *MongoGatewayImpl) findBooks(filter interface{}, listOptions models.ListOptions) (*[]models.Book, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
 
-	cursor, err := collection.Find(ctx, bson.M{})
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	var shoppingCart []models.ShoppingCart
-	err = cursor.All(ctx, &shoppingCart)
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	var books []models.Book
+	err = cursor.All(ctx, &books)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return &shoppingCart, nil
+	return &books, total, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) GetShoppingCartById(id string) (*models.ShoppingCart, error) {
-	var shoppingCart *models.ShoppingCart
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+// SaveBookContent writes the sections, the content that references them and
+// deletes the removed sections in one transaction, which a change to the book
+// since version was read aborts. Without transactions the writes happen in
+// that order, so an interrupted edit can leave unreferenced sections behind
+// but never a reference to a missing one, and the version is checked before
+// the sections are written as well as when the content is.
+func (mongoImpl *MongoGatewayImpl) SaveBookContent(bookId string, version int, content []models.BookContent, sections []models.BookSection, deletedSectionIds []string) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
+	sectionCollection := mongoImpl.client.Database(database).Collection(bookSections)
+
+	err := mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		count, err := collection.CountDocuments(ctx, versionFilter(bookId, version))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return missedVersion(ctx, collection, bookId, domain.ErrBookNotFound)
+		}
+
+		for _, section := range sections {
+			_, err := sectionCollection.UpdateOne(ctx, bson.M{"_id": section.Id}, bson.D{{"$set", section}}, options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = collection.FindOneAndUpdate(ctx, versionFilter(bookId, version), bson.D{
+			{"$set", bson.D{{"content", content}, {"updatedAt", time.Now()}}},
+			{"$inc", bson.D{{"version", 1}}},
+		}, opts).Decode(&book)
+		if err == mongo.ErrNoDocuments {
+			return missedVersion(ctx, collection, bookId, domain.ErrBookNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		return deleteSections(ctx, sectionCollection, deletedSectionIds)
+	})
 
-	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&shoppingCart)
 	if err != nil {
-		return nil, errors.New("SHOPPING_CART_NOT_FOUND")
+		return nil, err
 	}
 
-	return shoppingCart, nil
+	return book, nil
 }
 
-func (mongoImpl *MongoGatewayImpl) DeleteShoppingCart(id string) error {
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
-
-	_, err := collection.DeleteOne(ctx, bson.M{"_id": id})
-	if err != nil {
-		return err
+func deleteSections(ctx context.Context, collection *mongo.Collection, ids []string) error {
+	if len(ids) == 0 {
+		return nil
 	}
 
+	_, err := collection.DeleteMany(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}})
 	return err
 }
 
-func (mongoImpl MongoGatewayImpl) UpdateShoppingCart(shoppingCart *models.ShoppingCart)	(*models.ShoppingCart, error) {
-	var shoppingCartE *models.ShoppingCart
-	ctx, _ := context.WithTimeout(context.Background(), 30+time.Second)
-	opts := options.Update().SetUpsert(true)
-	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+// ChangeBookState moves a book out of the from state and records the
+// transition in a single update, so a concurrent change makes it fail instead
+// of being overwritten.
+func (mongoImpl *MongoGatewayImpl) ChangeBookState(id string, from models.StateBook, transition *models.BookStateTransition) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(books)
 
-	err := collection.FindOne(ctx, bson.M{"_id": shoppingCart.Id}).Decode(&shoppingCartE)
-	if err != nil {
-		return nil, errors.New("SHOPPING_CART_NOT_FOUND")
+	err := collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}, {"state", from}}, bson.D{
+		{"$set", bson.D{{"state", transition.To}, {"updatedAt", transition.ChangedAt}}},
+		{"$push", bson.D{{"transitions", transition}}},
+		{"$inc", bson.D{{"version", 1}}},
+	}, opts).Decode(&book)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, missedState(ctx, collection, id)
 	}
 
-	_, err = collection.UpdateOne(ctx, bson.M{"_id": shoppingCart.Id}, bson.D{{"$set", shoppingCart}}, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return shoppingCart, nil
-}
\ No newline at end of file
+	return book, nil
+}
+
+// PublishBook saves the version and changes the state in one transaction.
+// Standalone servers have none, so there the version is deleted again when
+// the state change fails.
+func (mongoImpl *MongoGatewayImpl) PublishBook(id string, from models.StateBook, transition *models.BookStateTransition, version *models.BookVersion) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(books)
+	versionCollection := mongoImpl.client.Database(database).Collection(bookVersions)
+
+	version.BookId = id
+	version.Id = models.BookVersionId(id, version.Number)
+	version.PublishedAt = transition.ChangedAt
+
+	inserted := false
+	err := mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		_, err := versionCollection.InsertOne(ctx, version)
+		if mongo.IsDuplicateKeyError(err) {
+			return domain.ErrVersionExists
+		}
+		if err != nil {
+			return err
+		}
+		inserted = true
+
+		err = collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}, {"state", from}}, bson.D{
+			{"$set", bson.D{
+				{"state", transition.To},
+				{"latestVersion", version.Number},
+				{"publishedVersion", version.Number},
+				{"updatedAt", transition.ChangedAt},
+			}},
+			{"$push", bson.D{{"transitions", transition}}},
+			{"$inc", bson.D{{"version", 1}}},
+		}, opts).Decode(&book)
+		if err == mongo.ErrNoDocuments {
+			return missedState(ctx, collection, id)
+		}
+		return err
+	})
+
+	if err != nil {
+		if !mongoImpl.transactions && inserted {
+			versionCollection.DeleteOne(ctx, bson.M{"_id": version.Id})
+		}
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// missedState tells why a state change filtered by the expected state
+// matched no book: either the book is gone or it is in another state.
+func missedState(ctx context.Context, collection *mongo.Collection, id string) error {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrBookNotFound
+	}
+	return domain.ErrInvalidStateTransition
+}
+
+// DeleteBook deletes the book together with its sections and versions.
+func (mongoImpl *MongoGatewayImpl) DeleteBook(id string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
+	sectionCollection := mongoImpl.client.Database(database).Collection(bookSections)
+	versionCollection := mongoImpl.client.Database(database).Collection(bookVersions)
+	entitlementCollection := mongoImpl.client.Database(database).Collection(entitlements)
+
+	return mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		var book models.Book
+		err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&book)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := collection.DeleteOne(ctx, versionFilter(id, version))
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return missedVersion(ctx, collection, id, nil)
+		}
+
+		_, err = versionCollection.DeleteMany(ctx, bson.M{"bookId": id})
+		if err != nil {
+			return err
+		}
+
+		_, err = entitlementCollection.DeleteMany(ctx, bson.M{"bookId": id})
+		if err != nil {
+			return err
+		}
+
+		return deleteSections(ctx, sectionCollection, sectionIds(book.Content))
+	})
+}
+
+// UpdateBook writes the book if it still has the version it was read at and
+// deletes the sections its content dropped in one transaction.
+func (mongoImpl *MongoGatewayImpl) UpdateBook(book *models.Book, deletedSectionIds []string) (*models.Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
+	sectionCollection := mongoImpl.client.Database(database).Collection(bookSections)
+
+	version := book.Version
+	book.Version = version + 1
+	book.UpdatedAt = time.Now()
+
+	fields, err := bookUpdateFields(book)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		err := collection.FindOneAndUpdate(ctx, versionFilter(book.Id, version), bson.D{{"$set", fields}}, opts).Decode(book)
+		if err == mongo.ErrNoDocuments {
+			return missedVersion(ctx, collection, book.Id, domain.ErrBookNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		return deleteSections(ctx, sectionCollection, deletedSectionIds)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// bookUpdateFields holds the fields an update writes. The review count and
+// rating are left to RefreshBookRating, which does not change the version, so
+// an update read before a refresh cannot undo it.
+func bookUpdateFields(book *models.Book) (bson.M, error) {
+	data, err := bson.Marshal(book)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields bson.M
+	err = bson.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(fields, "reviews")
+	delete(fields, "rating")
+	return fields, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) SaveShoppingCart(shoppingCart *models.ShoppingCart) (*models.ShoppingCart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.Update().SetUpsert(true)
+	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+
+	id, _ := uuid.NewRandom()
+	shoppingCart.Id = id.String()
+	shoppingCart.CreatedAt = time.Now()
+	shoppingCart.Version = 1
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": shoppingCart.Id}, bson.D{{"$set", shoppingCart}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return shoppingCart, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetShoppingCarts(listOptions models.ListOptions) (*[]models.ShoppingCart, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+	filter := bson.M{}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var shoppingCart []models.ShoppingCart
+	err = cursor.All(ctx, &shoppingCart)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &shoppingCart, total, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetShoppingCartById(id string) (*models.ShoppingCart, error) {
+	var shoppingCart *models.ShoppingCart
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&shoppingCart)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrShoppingCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return shoppingCart, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) DeleteShoppingCart(id string, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+
+	result, err := collection.DeleteOne(ctx, versionFilter(id, version))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return missedVersion(ctx, collection, id, nil)
+	}
+
+	return nil
+}
+
+func (mongoImpl MongoGatewayImpl) UpdateShoppingCart(shoppingCart *models.ShoppingCart)	(*models.ShoppingCart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+
+	version := shoppingCart.Version
+	shoppingCart.Version = version + 1
+
+	result, err := collection.UpdateOne(ctx, versionFilter(shoppingCart.Id, version), bson.D{{"$set", shoppingCart}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, missedVersion(ctx, collection, shoppingCart.Id, domain.ErrShoppingCartNotFound)
+	}
+
+	return shoppingCart, nil
+}
+
+// SaveOrder creates the order and empties the cart it was checked out from in
+// one transaction. Without transactions the order is deleted again when the
+// cart cannot be emptied.
+func (mongoImpl *MongoGatewayImpl) SaveOrder(order *models.Order, cartId string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(orders)
+	cartCollection := mongoImpl.client.Database(database).Collection(shoppingCarts)
+
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+
+	inserted := false
+	err := mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		if _, err := collection.InsertOne(ctx, order); err != nil {
+			return err
+		}
+		inserted = true
+
+		result, err := cartCollection.UpdateOne(ctx, bson.M{"_id": cartId}, bson.D{
+			{"$set", bson.D{{"books", bson.A{}}}},
+			{"$inc", bson.D{{"version", 1}}},
+		})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return domain.ErrShoppingCartNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if !mongoImpl.transactions && inserted {
+			collection.DeleteOne(ctx, bson.M{"_id": order.Id})
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetOrdersByUser(userId string, listOptions models.ListOptions) (*[]models.Order, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(orders)
+	filter := bson.M{"userId": userId}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var orders []models.Order
+	err = cursor.All(ctx, &orders)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &orders, total, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetOrderById(id string) (*models.Order, error) {
+	var order *models.Order
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(orders)
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ChangeOrderStatus only applies the change while the order is still in the
+// from status, like ChangeBookState.
+func (mongoImpl *MongoGatewayImpl) ChangeOrderStatus(id string, from models.OrderStatus, change *models.OrderStatusChange) (*models.Order, error) {
+	var order *models.Order
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(orders)
+
+	set := bson.D{{"status", change.To}, {"updatedAt", change.ChangedAt}}
+	if change.PaymentId != "" {
+		set = append(set, bson.E{"paymentId", change.PaymentId})
+	}
+
+	err := collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}, {"status", from}}, bson.D{
+		{"$set", set},
+		{"$push", bson.D{{"history", change}}},
+	}, opts).Decode(&order)
+
+	if err == mongo.ErrNoDocuments {
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, domain.ErrOrderNotFound
+		}
+		return nil, domain.ErrInvalidOrderTransition
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// SaveEntitlement keeps an entitlement the user already has, so owning a book
+// again, for instance by buying it twice, changes nothing.
+func (mongoImpl *MongoGatewayImpl) SaveEntitlement(entitlement *models.Entitlement) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.Update().SetUpsert(true)
+	collection := mongoImpl.client.Database(database).Collection(entitlements)
+
+	entitlement.Id = models.EntitlementId(entitlement.UserId, entitlement.BookId)
+	entitlement.CreatedAt = time.Now()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": entitlement.Id}, bson.D{{"$setOnInsert", entitlement}}, opts)
+	return err
+}
+
+func (mongoImpl *MongoGatewayImpl) HasEntitlement(userId string, bookId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(entitlements)
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": models.EntitlementId(userId, bookId)})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetEntitlementsByUser(userId string, listOptions models.ListOptions) (*[]models.Entitlement, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(entitlements)
+	filter := bson.M{"userId": userId}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entitlements []models.Entitlement
+	err = cursor.All(ctx, &entitlements)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &entitlements, total, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) DeleteEntitlementsByOrder(orderId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(entitlements)
+
+	_, err := collection.DeleteMany(ctx, bson.M{"orderId": orderId})
+	return err
+}
+
+// GetBookBySectionId finds the book a section belongs to, either in its
+// content or in one of its versions, since readers keep reading sections the
+// authors have since dropped from the draft.
+func (mongoImpl *MongoGatewayImpl) GetBookBySectionId(sectionId string) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(books)
+	versionCollection := mongoImpl.client.Database(database).Collection(bookVersions)
+
+	err := collection.FindOne(ctx, bson.M{"content.sections.sectionId": sectionId}).Decode(&book)
+	if err == nil {
+		return book, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	var version *models.BookVersion
+	opts := options.FindOne().SetProjection(bson.D{{"bookId", 1}})
+	err = versionCollection.FindOne(ctx, bson.M{"sections._id": sectionId}, opts).Decode(&version)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = collection.FindOne(ctx, bson.M{"_id": version.BookId}).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// SaveBookVersion inserts the version and makes it both the latest and the
+// published version of its book. Versions are never replaced, so saving a
+// number twice fails with ErrVersionExists. When the server cannot run
+// transactions the version is deleted again if the book cannot be updated.
+func (mongoImpl *MongoGatewayImpl) SaveBookVersion(version *models.BookVersion) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(books)
+	versionCollection := mongoImpl.client.Database(database).Collection(bookVersions)
+
+	version.Id = models.BookVersionId(version.BookId, version.Number)
+	version.PublishedAt = time.Now()
+
+	inserted := false
+	err := mongoImpl.withTransaction(ctx, func(ctx mongo.SessionContext) error {
+		_, err := versionCollection.InsertOne(ctx, version)
+		if mongo.IsDuplicateKeyError(err) {
+			return domain.ErrVersionExists
+		}
+		if err != nil {
+			return err
+		}
+		inserted = true
+
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": version.BookId}, bson.D{
+			{"$set", bson.D{
+				{"latestVersion", version.Number},
+				{"publishedVersion", version.Number},
+				{"updatedAt", version.PublishedAt},
+			}},
+			{"$inc", bson.D{{"version", 1}}},
+		}, opts).Decode(&book)
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrBookNotFound
+		}
+		return err
+	})
+
+	if err != nil {
+		if !mongoImpl.transactions && inserted {
+			versionCollection.DeleteOne(ctx, bson.M{"_id": version.Id})
+		}
+		return nil, err
+	}
+
+	return book, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetBookVersion(bookId string, number int) (*models.BookVersion, error) {
+	var version *models.BookVersion
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(bookVersions)
+
+	err := collection.FindOne(ctx, bson.M{"_id": models.BookVersionId(bookId, number)}).Decode(&version)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// GetBookVersions lists the versions of a book without their content and
+// sections unless fields asks for them.
+func (mongoImpl *MongoGatewayImpl) GetBookVersions(bookId string, listOptions models.ListOptions) (*[]models.BookVersion, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(bookVersions)
+	filter := bson.M{"bookId": bookId}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := findOptions(listOptions)
+	if len(listOptions.Fields) == 0 {
+		opts.SetProjection(bson.D{{"content", 0}, {"sections", 0}})
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var versions []models.BookVersion
+	err = cursor.All(ctx, &versions)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &versions, total, nil
+}
+
+// SetPublishedVersion points readers of the book at one of its versions.
+func (mongoImpl *MongoGatewayImpl) SetPublishedVersion(bookId string, number int) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(books)
+	versionCollection := mongoImpl.client.Database(database).Collection(bookVersions)
+
+	count, err := versionCollection.CountDocuments(ctx, bson.M{"_id": models.BookVersionId(bookId, number)})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, domain.ErrVersionNotFound
+	}
+
+	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": bookId}, bson.D{
+		{"$set", bson.D{{"publishedVersion", number}, {"updatedAt", time.Now()}}},
+		{"$inc", bson.D{{"version", 1}}},
+	}, opts).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// GetBookOwnerIds lists the users entitled to a book.
+func (mongoImpl *MongoGatewayImpl) GetBookOwnerIds(bookId string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(entitlements)
+
+	values, err := collection.Distinct(ctx, "userId", bson.M{"bookId": bookId})
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]string, 0, len(values))
+	for _, value := range values {
+		if userId, ok := value.(string); ok {
+			userIds = append(userIds, userId)
+		}
+	}
+
+	return userIds, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) SaveNotifications(newNotifications []models.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(notifications)
+
+	if len(newNotifications) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(newNotifications))
+	for i := range newNotifications {
+		id, _ := uuid.NewRandom()
+		newNotifications[i].Id = id.String()
+		newNotifications[i].CreatedAt = time.Now()
+		documents = append(documents, newNotifications[i])
+	}
+
+	_, err := collection.InsertMany(ctx, documents)
+	return err
+}
+
+func (mongoImpl *MongoGatewayImpl) GetNotificationsByUser(userId string, listOptions models.ListOptions) (*[]models.Notification, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(notifications)
+	filter := bson.M{"userId": userId}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []models.Notification
+	err = cursor.All(ctx, &notifications)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &notifications, total, nil
+}
+
+// MarkNotificationRead only marks the notification when it belongs to the
+// user.
+func (mongoImpl *MongoGatewayImpl) MarkNotificationRead(userId string, id string) (*models.Notification, error) {
+	var notification *models.Notification
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(notifications)
+
+	err := collection.FindOneAndUpdate(ctx, bson.D{{"_id", id}, {"userId", userId}}, bson.D{
+		{"$set", bson.D{{"read", true}}},
+	}, opts).Decode(&notification)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) SaveReadingProgress(progress *models.ReadingProgress) (*models.ReadingProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.Update().SetUpsert(true)
+	collection := mongoImpl.client.Database(database).Collection(readingProgress)
+
+	progress.Id = models.ReadingProgressId(progress.UserId, progress.BookId)
+	progress.UpdatedAt = time.Now()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": progress.Id}, bson.D{{"$set", progress}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetReadingProgress(userId string, bookId string) (*models.ReadingProgress, error) {
+	var progress *models.ReadingProgress
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(readingProgress)
+
+	err := collection.FindOne(ctx, bson.M{"_id": models.ReadingProgressId(userId, bookId)}).Decode(&progress)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrReadingProgressNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) SaveBookmark(bookmark *models.Bookmark) (*models.Bookmark, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(bookmarks)
+
+	id, _ := uuid.NewRandom()
+	bookmark.Id = id.String()
+	bookmark.CreatedAt = time.Now()
+
+	_, err := collection.InsertOne(ctx, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookmark, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetBookmarks(userId string, bookId string, listOptions models.ListOptions) (*[]models.Bookmark, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(bookmarks)
+	filter := bson.D{{"userId", userId}, {"bookId", bookId}}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var bookmarks []models.Bookmark
+	err = cursor.All(ctx, &bookmarks)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &bookmarks, total, nil
+}
+
+// DeleteBookmark only deletes the bookmark when it belongs to the user.
+func (mongoImpl *MongoGatewayImpl) DeleteBookmark(userId string, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(bookmarks)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{"_id", id}, {"userId", userId}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return domain.ErrBookmarkNotFound
+	}
+
+	return nil
+}
+
+func (mongoImpl *MongoGatewayImpl) SaveHighlight(highlight *models.Highlight) (*models.Highlight, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(highlights)
+
+	id, _ := uuid.NewRandom()
+	highlight.Id = id.String()
+	highlight.CreatedAt = time.Now()
+
+	_, err := collection.InsertOne(ctx, highlight)
+	if err != nil {
+		return nil, err
+	}
+
+	return highlight, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetHighlights(userId string, bookId string, listOptions models.ListOptions) (*[]models.Highlight, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(highlights)
+	filter := bson.D{{"userId", userId}, {"bookId", bookId}}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var highlights []models.Highlight
+	err = cursor.All(ctx, &highlights)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &highlights, total, nil
+}
+
+// DeleteHighlight only deletes the highlight when it belongs to the user.
+func (mongoImpl *MongoGatewayImpl) DeleteHighlight(userId string, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(highlights)
+
+	result, err := collection.DeleteOne(ctx, bson.D{{"_id", id}, {"userId", userId}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return domain.ErrHighlightNotFound
+	}
+
+	return nil
+}
+
+// SaveReview inserts a new review. A user has one review per book, so saving
+// a second one fails with ErrReviewExists.
+func (mongoImpl *MongoGatewayImpl) SaveReview(review *models.Review) (*models.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+
+	review.Id = models.ReviewId(review.UserId, review.BookId)
+	review.CreatedAt = time.Now()
+	review.UpdatedAt = review.CreatedAt
+
+	_, err := collection.InsertOne(ctx, review)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, domain.ErrReviewExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetReviewById(id string) (*models.Review, error) {
+	var review *models.Review
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&review)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) GetReviewsByBook(bookId string, includeHidden bool, listOptions models.ListOptions) (*[]models.Review, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+	filter := bson.D{{"bookId", bookId}}
+	if !includeHidden {
+		filter = append(filter, bson.E{"status", models.ReviewVisible})
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, findOptions(listOptions))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reviews []models.Review
+	err = cursor.All(ctx, &reviews)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &reviews, total, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) UpdateReview(review *models.Review) (*models.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+
+	review.UpdatedAt = time.Now()
+
+	result, err := collection.ReplaceOne(ctx, bson.M{"_id": review.Id}, review)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, domain.ErrReviewNotFound
+	}
+
+	return review, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) DeleteReview(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return domain.ErrReviewNotFound
+	}
+
+	return nil
+}
+
+// RefreshBookRating recounts the visible reviews of a book and stores their
+// number and average rating on the book.
+func (mongoImpl *MongoGatewayImpl) RefreshBookRating(bookId string) (*models.Book, error) {
+	var book *models.Book
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	collection := mongoImpl.client.Database(database).Collection(reviews)
+	bookCollection := mongoImpl.client.Database(database).Collection(books)
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{"$match", bson.D{{"bookId", bookId}, {"status", models.ReviewVisible}}}},
+		{{"$group", bson.D{{"_id", nil}, {"count", bson.D{{"$sum", 1}}}, {"sum", bson.D{{"$sum", "$rating"}}}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []struct {
+		Count int `bson:"count"`
+		Sum   int `bson:"sum"`
+	}
+	err = cursor.All(ctx, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	count, sum := 0, 0
+	if len(stats) > 0 {
+		count, sum = stats[0].Count, stats[0].Sum
+	}
+
+	err = bookCollection.FindOneAndUpdate(ctx, bson.M{"_id": bookId}, bson.D{
+		{"$set", bson.D{{"reviews", count}, {"rating", averageRating(count, sum)}}},
+	}, opts).Decode(&book)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// RevokeToken reports whether the token was revoked by this call: the upsert
+// only inserts, so only one of several concurrent revocations of a token
+// succeeds.
+func (mongoImpl *MongoGatewayImpl) RevokeToken(token *models.RevokedToken) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	opts := options.Update().SetUpsert(true)
+	collection := mongoImpl.client.Database(database).Collection(revokedTokens)
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": token.Id}, bson.D{{"$setOnInsert", token}}, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return result.UpsertedCount == 1, nil
+}
+
+func (mongoImpl *MongoGatewayImpl) IsTokenRevoked(id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	collection := mongoImpl.client.Database(database).Collection(revokedTokens)
+
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,23 @@
+package datastore
+
+import (
+	"leanpub-app/domain"
+	"leanpub-app/infra/datastore/gatewaytest"
+	"os"
+	"testing"
+)
+
+// TestMongoGatewayImpl runs the gateway contract against the server in the
+// mongo.url environment variable and is skipped when it is not set.
+func TestMongoGatewayImpl(t *testing.T) {
+	if os.Getenv("mongo.url") == "" {
+		t.Skip("mongo.url is not set")
+	}
+
+	gateway := NewMongoGatewayImpl()
+	gateway.Setup()
+
+	gatewaytest.RunDatabaseGatewayTests(t, func() domain.DatabaseGateway {
+		return gateway
+	})
+}
@@ -0,0 +1,13 @@
+package datastore
+
+import "math"
+
+// averageRating rounds the mean of the ratings to two decimals the same way
+// on both backends. A book without reviews has a rating of 0.
+func averageRating(count int, sum int) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	return math.Round(float64(sum)/float64(count)*100) / 100
+}
@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"leanpub-app/domain/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Field weights shared by the Mongo text indexes and the in-memory scorer so
+// both backends rank matches the same way.
+var (
+	bookSearchWeights = map[string]int{
+		"title":        10,
+		"categories":   5,
+		"aboutTheBook": 3,
+		"description":  2,
+	}
+	sectionSearchWeights = map[string]int{
+		"title":   2,
+		"content": 1,
+	}
+)
+
+// rankSearchScores orders the ids of the scored books by decreasing score,
+// breaking ties by id, and returns the page listOptions selects along with
+// how many books matched.
+func rankSearchScores(scores map[string]float64, listOptions models.ListOptions) ([]string, int64) {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	total := int64(len(ids))
+	start := listOptions.Offset
+	if start > len(ids) {
+		start = len(ids)
+	}
+	end := len(ids)
+	if listOptions.Limit > 0 && start+listOptions.Limit < end {
+		end = start + listOptions.Limit
+	}
+
+	return ids[start:end], total
+}
+
+// searchResults pairs the books of a ranked page with their scores, keeping
+// the order of ids.
+func searchResults(ids []string, books []models.Book, scores map[string]float64) *[]models.BookSearchResult {
+	byId := map[string]models.Book{}
+	for _, book := range books {
+		byId[book.Id] = book
+	}
+
+	results := []models.BookSearchResult{}
+	for _, id := range ids {
+		if book, ok := byId[id]; ok {
+			results = append(results, models.BookSearchResult{Book: book, Score: scores[id]})
+		}
+	}
+
+	return &results
+}
+
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// textScore counts the occurrences of the query terms in each field, weighted
+// by the field weight.
+func textScore(terms []string, fields map[string]string, weights map[string]int) float64 {
+	score := 0.0
+	for field, text := range fields {
+		for _, word := range searchTerms(text) {
+			for _, term := range terms {
+				if word == term {
+					score += float64(weights[field])
+				}
+			}
+		}
+	}
+
+	return score
+}
+
+func matchesBookSearch(book *models.Book, search models.BookSearch) bool {
+	if search.LanguageCode != "" && book.LanguageCode != search.LanguageCode {
+		return false
+	}
+	if search.State != "" && book.State != search.State {
+		return false
+	}
+	if search.MinPrice != nil && book.MinimumPrice < *search.MinPrice {
+		return false
+	}
+	if search.MaxPrice != nil && book.MinimumPrice > *search.MaxPrice {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,168 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+// maxFileSize is the largest file downloaded, in bytes.
+const maxFileSize = 5 << 20
+
+// maxHeaderSize is the most response headers may take, in bytes.
+const maxHeaderSize = 64 << 10
+
+// errPrivateAddress is returned by the dialer for addresses files may not be
+// downloaded from.
+var errPrivateAddress = errors.New("PRIVATE_ADDRESS")
+
+// reservedNetworks are not reachable on the public internet but are not
+// covered by the net.IP checks in publicAddress.
+var reservedNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+)
+
+// HttpFileGatewayImpl downloads files from http and https URLs on the public
+// internet. Other schemes, like file, and hosts on loopback, private or
+// link-local addresses, like the cloud metadata service, are reported as not
+// found so a book cannot point the server at its own disk or network.
+type HttpFileGatewayImpl struct {
+	client *http.Client
+}
+
+// NewHttpFileGatewayImpl gives up on a download after the files.timeout
+// environment variable, or 10 seconds without it.
+func NewHttpFileGatewayImpl() domain.FileGateway {
+	timeout, err := time.ParseDuration(os.Getenv("files.timeout"))
+	if err != nil {
+		timeout = 10 * time.Second
+	}
+
+	return newHttpFileGatewayImpl(timeout, publicAddress)
+}
+
+// newHttpFileGatewayImpl only connects to addresses allowed accepts. They are
+// checked when every connection is made, redirects included, against the
+// address the host resolved to, so a host cannot be pointed at another
+// address once it passed. Proxies are not used, as the proxy would be the
+// address checked.
+func newHttpFileGatewayImpl(timeout time.Duration, allowed func(ip net.IP) bool) *HttpFileGatewayImpl {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !allowed(ip) {
+				return errPrivateAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &HttpFileGatewayImpl{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:            dialer.DialContext,
+				ForceAttemptHTTP2:      true,
+				TLSHandshakeTimeout:    timeout,
+				ResponseHeaderTimeout:  timeout,
+				MaxResponseHeaderBytes: maxHeaderSize,
+			},
+		},
+	}
+}
+
+func (httpImpl *HttpFileGatewayImpl) GetFile(location string) (*models.File, error) {
+	fileUrl, err := url.Parse(location)
+	if err != nil || (fileUrl.Scheme != "http" && fileUrl.Scheme != "https") {
+		return nil, domain.ErrFileNotFound
+	}
+
+	response, err := httpImpl.client.Get(fileUrl.String())
+	if errors.Is(err, errPrivateAddress) {
+		return nil, domain.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, domain.ErrFileNotFound
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxFileSize {
+		return nil, domain.ErrFileTooLarge
+	}
+
+	return &models.File{
+		Name:        path.Base(fileUrl.Path),
+		ContentType: contentType(response.Header.Get("Content-Type"), data),
+		Data:        data,
+	}, nil
+}
+
+// publicAddress reports whether ip may be on the public internet.
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// contentType is the declared media type without its parameters, or the one
+// sniffed from data when the server did not declare a useful one.
+func contentType(declared string, data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+
+	return mediaType
+}
@@ -0,0 +1,120 @@
+package files
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/domain"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newFileServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png; charset=binary")
+			w.Write(png)
+		case "/sniffed":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(png)
+		case "/redirect":
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", maxFileSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// newTestGateway downloads from the test servers, which listen on loopback.
+func newTestGateway() *HttpFileGatewayImpl {
+	return newHttpFileGatewayImpl(10*time.Second, func(ip net.IP) bool {
+		return ip.Equal(net.IPv4(127, 0, 0, 1))
+	})
+}
+
+func TestGetFileIsOk(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	file, err := newTestGateway().GetFile(server.URL + "/cover.png")
+	require.Nil(t, err)
+	assert.Equal(t, "cover.png", file.Name)
+	assert.Equal(t, "image/png", file.ContentType)
+	assert.Equal(t, png, file.Data)
+}
+
+func TestGetFileSniffsContentType(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	file, err := newTestGateway().GetFile(server.URL + "/sniffed")
+	require.Nil(t, err)
+	assert.Equal(t, "image/png", file.ContentType)
+}
+
+func TestGetFileIsWrongNotFound(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	_, err := newTestGateway().GetFile(server.URL + "/missing")
+	assert.Equal(t, domain.ErrFileNotFound, err)
+}
+
+func TestGetFileIsWrongTooLarge(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	_, err := newTestGateway().GetFile(server.URL + "/large")
+	assert.Equal(t, domain.ErrFileTooLarge, err)
+}
+
+func TestGetFileIsWrongScheme(t *testing.T) {
+	_, err := NewHttpFileGatewayImpl().GetFile("file:///etc/passwd")
+	assert.Equal(t, domain.ErrFileNotFound, err)
+}
+
+func TestGetFileIsWrongPrivateAddress(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	_, err := NewHttpFileGatewayImpl().GetFile(server.URL + "/cover.png")
+	assert.Equal(t, domain.ErrFileNotFound, err)
+}
+
+func TestGetFileIsWrongRedirectToPrivateAddress(t *testing.T) {
+	server := newFileServer()
+	defer server.Close()
+
+	target := strings.Replace(server.URL, "127.0.0.1", "127.0.0.2", 1) + "/cover.png"
+	_, err := newTestGateway().GetFile(server.URL + "/redirect?to=" + target)
+	assert.Equal(t, domain.ErrFileNotFound, err)
+}
+
+func TestPublicAddress(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:2800::1":    true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.0.0.1":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::ffff:10.0.0.1": false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"224.0.0.1":       false,
+	} {
+		assert.Equal(t, public, publicAddress(net.ParseIP(address)), address)
+	}
+}
@@ -0,0 +1,205 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"os"
+	"sync"
+	"time"
+)
+
+// FakeDeclinedSource is the payment source the fake processor always declines.
+// Any other source is accepted.
+const FakeDeclinedSource = "tok_declined"
+
+// FakeWebhook is a webhook delivery as the provider would post it.
+type FakeWebhook struct {
+	Payload   []byte
+	Signature string
+}
+
+// FakePaymentGatewayImpl is an in-process payment processor for development
+// and tests. Payments only live in memory and webhooks are queued until they
+// are taken with Webhooks instead of being posted.
+type FakePaymentGatewayImpl struct {
+	mutex    sync.Mutex
+	secret   []byte
+	payments map[string]*models.Payment
+	webhooks []FakeWebhook
+
+	// Delay is waited before every call answers, like a slow provider.
+	Delay time.Duration
+	// DuplicateWebhooks queues every webhook twice, like a provider retrying
+	// a delivery it thinks was lost.
+	DuplicateWebhooks bool
+}
+
+// NewFakePaymentGatewayImpl signs webhooks with the payments.secret environment
+// variable, or a random secret without it, and is only bound as is by the
+// memory app; deployments go through NewPaymentGatewayImpl. payments.delay
+// and payments.duplicateWebhooks set Delay and DuplicateWebhooks.
+func NewFakePaymentGatewayImpl() domain.PaymentGateway {
+	secret := []byte(os.Getenv("payments.secret"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+
+	delay, _ := time.ParseDuration(os.Getenv("payments.delay"))
+
+	return &FakePaymentGatewayImpl{
+		secret:            secret,
+		payments:          map[string]*models.Payment{},
+		Delay:             delay,
+		DuplicateWebhooks: os.Getenv("payments.duplicateWebhooks") == "true",
+	}
+}
+
+func (fakeImpl *FakePaymentGatewayImpl) Authorize(request *models.PaymentRequest) (*models.Payment, error) {
+	time.Sleep(fakeImpl.Delay)
+	fakeImpl.mutex.Lock()
+	defer fakeImpl.mutex.Unlock()
+
+	if request.Amount < 0 {
+		return nil, errors.New("INVALID_AMOUNT")
+	}
+
+	id, _ := uuid.NewRandom()
+	payment := &models.Payment{
+		Id:        id.String(),
+		OrderId:   request.OrderId,
+		Amount:    request.Amount,
+		Status:    models.PaymentAuthorized,
+		CreatedAt: time.Now(),
+	}
+
+	if request.Source == FakeDeclinedSource {
+		payment.Status = models.PaymentDeclined
+	}
+	fakeImpl.payments[payment.Id] = payment
+
+	if payment.Status == models.PaymentDeclined {
+		return nil, domain.ErrPaymentDeclined
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+func (fakeImpl *FakePaymentGatewayImpl) Capture(paymentId string) (*models.Payment, error) {
+	time.Sleep(fakeImpl.Delay)
+	fakeImpl.mutex.Lock()
+	defer fakeImpl.mutex.Unlock()
+
+	payment, found := fakeImpl.payments[paymentId]
+	if !found {
+		return nil, errors.New("PAYMENT_NOT_FOUND")
+	}
+
+	if payment.Status != models.PaymentAuthorized {
+		return nil, errors.New("PAYMENT_NOT_AUTHORIZED")
+	}
+
+	payment.Status = models.PaymentCaptured
+	if err := fakeImpl.queueWebhook(models.PaymentCapturedEvent, payment); err != nil {
+		return nil, err
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+// Refund returns part or all of a captured payment. The payment is REFUNDED
+// once nothing is left to return.
+func (fakeImpl *FakePaymentGatewayImpl) Refund(paymentId string, amount float64) (*models.Payment, error) {
+	time.Sleep(fakeImpl.Delay)
+	fakeImpl.mutex.Lock()
+	defer fakeImpl.mutex.Unlock()
+
+	payment, found := fakeImpl.payments[paymentId]
+	if !found {
+		return nil, errors.New("PAYMENT_NOT_FOUND")
+	}
+
+	if payment.Status != models.PaymentCaptured {
+		return nil, errors.New("PAYMENT_NOT_CAPTURED")
+	}
+
+	if amount <= 0 || amount > payment.Amount-payment.Refunded {
+		return nil, errors.New("INVALID_AMOUNT")
+	}
+
+	payment.Refunded += amount
+	if payment.Refunded >= payment.Amount {
+		payment.Status = models.PaymentRefunded
+	}
+
+	if err := fakeImpl.queueWebhook(models.PaymentRefundedEvent, payment); err != nil {
+		return nil, err
+	}
+
+	copied := *payment
+	return &copied, nil
+}
+
+func (fakeImpl *FakePaymentGatewayImpl) VerifyWebhook(payload []byte, signature string) (*models.PaymentEvent, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, fakeImpl.sign(payload)) {
+		return nil, domain.ErrInvalidWebhook
+	}
+
+	var event models.PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, domain.ErrInvalidWebhook
+	}
+
+	return &event, nil
+}
+
+// Webhooks returns the webhooks queued since the last call, in the order the
+// provider would have sent them.
+func (fakeImpl *FakePaymentGatewayImpl) Webhooks() []FakeWebhook {
+	fakeImpl.mutex.Lock()
+	defer fakeImpl.mutex.Unlock()
+
+	webhooks := fakeImpl.webhooks
+	fakeImpl.webhooks = nil
+	return webhooks
+}
+
+func (fakeImpl *FakePaymentGatewayImpl) queueWebhook(eventType models.PaymentEventType, payment *models.Payment) error {
+	id, _ := uuid.NewRandom()
+	payload, err := json.Marshal(models.PaymentEvent{
+		Id:        id.String(),
+		Type:      eventType,
+		PaymentId: payment.Id,
+		OrderId:   payment.OrderId,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	webhook := FakeWebhook{Payload: payload, Signature: hex.EncodeToString(fakeImpl.sign(payload))}
+	fakeImpl.webhooks = append(fakeImpl.webhooks, webhook)
+	if fakeImpl.DuplicateWebhooks {
+		fakeImpl.webhooks = append(fakeImpl.webhooks, webhook)
+	}
+
+	return nil
+}
+
+func (fakeImpl *FakePaymentGatewayImpl) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, fakeImpl.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
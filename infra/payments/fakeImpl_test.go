@@ -0,0 +1,87 @@
+package payments
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"leanpub-app/domain"
+	"leanpub-app/domain/models"
+	"testing"
+)
+
+func newFakePaymentGateway() *FakePaymentGatewayImpl {
+	return NewFakePaymentGatewayImpl().(*FakePaymentGatewayImpl)
+}
+
+func TestFakePaymentGatewayChargesAndRefunds(t *testing.T) {
+	payments := newFakePaymentGateway()
+
+	payment, err := payments.Authorize(&models.PaymentRequest{OrderId: "order", Amount: 20, Source: "tok_visa"})
+	require.Nil(t, err)
+	assert.Equal(t, models.PaymentAuthorized, payment.Status)
+
+	payment, err = payments.Capture(payment.Id)
+	require.Nil(t, err)
+	assert.Equal(t, models.PaymentCaptured, payment.Status)
+
+	_, err = payments.Capture(payment.Id)
+	assert.EqualError(t, err, "PAYMENT_NOT_AUTHORIZED")
+
+	payment, err = payments.Refund(payment.Id, 5)
+	require.Nil(t, err)
+	assert.Equal(t, models.PaymentCaptured, payment.Status)
+
+	_, err = payments.Refund(payment.Id, 20)
+	assert.EqualError(t, err, "INVALID_AMOUNT")
+
+	payment, err = payments.Refund(payment.Id, 15)
+	require.Nil(t, err)
+	assert.Equal(t, models.PaymentRefunded, payment.Status)
+}
+
+func TestFakePaymentGatewayDeclines(t *testing.T) {
+	payments := newFakePaymentGateway()
+
+	_, err := payments.Authorize(&models.PaymentRequest{OrderId: "order", Amount: 20, Source: FakeDeclinedSource})
+	assert.Equal(t, domain.ErrPaymentDeclined, err)
+	assert.Empty(t, payments.Webhooks())
+}
+
+func TestFakePaymentGatewaySignsWebhooks(t *testing.T) {
+	payments := newFakePaymentGateway()
+	payments.DuplicateWebhooks = true
+
+	payment, err := payments.Authorize(&models.PaymentRequest{OrderId: "order", Amount: 20, Source: "tok_visa"})
+	require.Nil(t, err)
+	_, err = payments.Capture(payment.Id)
+	require.Nil(t, err)
+
+	webhooks := payments.Webhooks()
+	require.Len(t, webhooks, 2)
+	assert.Equal(t, webhooks[0], webhooks[1])
+	assert.Empty(t, payments.Webhooks())
+
+	event, err := payments.VerifyWebhook(webhooks[0].Payload, webhooks[0].Signature)
+	require.Nil(t, err)
+	assert.Equal(t, models.PaymentCapturedEvent, event.Type)
+	assert.Equal(t, payment.Id, event.PaymentId)
+	assert.Equal(t, "order", event.OrderId)
+
+	_, err = payments.VerifyWebhook(webhooks[0].Payload, "00")
+	assert.Equal(t, domain.ErrInvalidWebhook, err)
+
+	_, err = newFakePaymentGateway().VerifyWebhook(webhooks[0].Payload, webhooks[0].Signature)
+	assert.Equal(t, domain.ErrInvalidWebhook, err, "another secret does not verify the signature")
+}
+
+func TestPaymentGatewayRequiresFakeOptInAndSecret(t *testing.T) {
+	t.Setenv("payments.fake", "")
+	t.Setenv("payments.secret", "secret")
+	assert.Panics(t, func() { NewPaymentGatewayImpl() })
+
+	t.Setenv("payments.fake", "true")
+	t.Setenv("payments.secret", "")
+	assert.Panics(t, func() { NewPaymentGatewayImpl() })
+
+	t.Setenv("payments.secret", "secret")
+	assert.IsType(t, &FakePaymentGatewayImpl{}, NewPaymentGatewayImpl())
+}
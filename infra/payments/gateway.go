@@ -0,0 +1,23 @@
+package payments
+
+import (
+	"leanpub-app/domain"
+	"os"
+)
+
+// NewPaymentGatewayImpl returns the payment processor of a deployment and
+// panics when none is configured. There is no real processor yet: only
+// setting payments.fake to "true" opts into the fake one, which approves every
+// source but FakeDeclinedSource, and it then needs payments.secret to sign
+// its webhooks with.
+func NewPaymentGatewayImpl() domain.PaymentGateway {
+	if os.Getenv("payments.fake") != "true" {
+		panic("no payment processor is configured")
+	}
+
+	if os.Getenv("payments.secret") == "" {
+		panic("payments.secret is not set")
+	}
+
+	return NewFakePaymentGatewayImpl()
+}
@@ -5,10 +5,16 @@ import (
 	"leanpub-app/app"
 	"log"
 	"net/http"
+	"os"
 )
 
 func main() {
-	application := app.CreateApp()
+	var application *app.Application
+	if os.Getenv("datastore") == "memory" {
+		application = app.CreateMemoryApp()
+	} else {
+		application = app.CreateApp()
+	}
 	application.Router = mux.NewRouter()
 	application.Setup()
 	http.Handle("/", application.Router)